@@ -0,0 +1,89 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/models"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Erasure reasons recorded in the audit log
+const (
+	ReasonSelfService  = "self_service"
+	ReasonAdminRequest = "admin_request"
+	ReasonProvisioning = "provisioning" // deprovisioned over SCIM
+)
+
+// Erase removes a user and the personal data tied to them. Access logs are
+// kept for statistics but lose their user, IP and user agent. c is the
+// request that asked for the erasure, nil for the scheduled job.
+//
+// Audit events written before the erasure are left untouched: editing them
+// would break the hash chain. Their snapshots of the user hold no name or
+// email to begin with.
+func Erase(db *gorm.DB, c *fiber.Ctx, user models.User, reason string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		steps := []*gorm.DB{
+			tx.Model(&models.AccessLog{}).Where("user_id = ?", user.ID).
+				Updates(map[string]interface{}{"user_id": 0, "ip_address": "", "user_agent": ""}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.Session{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.Invitation{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.PasswordReset{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.MFAChallenge{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.PasswordHistory{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{}),
+			tx.Where("user_id = ?", user.ID).Delete(&models.UnmappedDomainUser{}),
+			tx.Where("user_id = ? AND revoked_at <> 0", user.ID).Delete(&models.DriveGrant{}),
+			// Active grants lose the address and are revoked once this commits
+			tx.Model(&models.DriveGrant{}).Where("user_id = ?", user.ID).Update("email", ""),
+			tx.Where("email = ?", user.Email).Delete(&models.MappingOverride{}),
+			tx.Delete(&user),
+		}
+		for _, step := range steps {
+			if step.Error != nil {
+				return step.Error
+			}
+		}
+
+		// The event names the user only by ID
+		return audit.Record(tx, c, "user.erase", "user", user.ID, nil, fiber.Map{
+			"reason":                 reason,
+			"deletion_requested_at":  user.DeletionRequestedAt,
+			"deletion_scheduled_for": user.DeletionScheduledFor,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// Take back the Drive access of the erased account. Grants that could
+	// not be revoked are retried in the background.
+	drive.RevokeGrants(db, "user_id = ?", user.ID)
+	db.Where("user_id = ? AND revoked_at <> 0", user.ID).Delete(&models.DriveGrant{})
+	return nil
+}
+
+// ErasePending erases every account whose deletion grace period ended
+// before now and returns how many were erased
+func ErasePending(db *gorm.DB, now time.Time) (int, error) {
+	var users []models.User
+	err := db.Where("deletion_scheduled_for > 0 AND deletion_scheduled_for <= ?", now.Unix()).Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+
+	erased := 0
+	for _, user := range users {
+		if err := Erase(db, nil, user, ReasonSelfService); err != nil {
+			fmt.Printf("Error erasing account %d: %v\n", user.ID, err)
+			continue
+		}
+		erased++
+	}
+	return erased, nil
+}
@@ -0,0 +1,81 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/models"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestErase(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatal(err)
+	}
+
+	standIn := drive.NewStandIn()
+	standIn.AddFolder("folder-acme-1234567890", "Acme")
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	client, err := drive.NewClient("", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drive.API = client
+	t.Cleanup(func() { drive.API = nil })
+
+	user := models.User{Name: "Ada Lovelace", Email: "ada@acme.com", Password: []byte("unusable"), Department: "Analytics"}
+	db.Create(&user)
+	permission, err := client.CreatePermission(context.Background(), "folder-acme-1234567890", user.Email, "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.DriveGrant{UserID: user.ID, Email: user.Email, FolderID: "folder-acme-1234567890", PermissionID: permission, Role: "reader"})
+	if err := audit.Record(db, nil, "user.update", "user", user.ID, user, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Erase(db, nil, user, ReasonAdminRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining int64
+	db.Model(&models.User{}).Where("id = ?", user.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Error("the user is still stored")
+	}
+	db.Model(&models.DriveGrant{}).Where("user_id = ?", user.ID).Count(&remaining)
+	if remaining != 0 || len(standIn.Permissions("folder-acme-1234567890")) != 0 {
+		t.Errorf("%d grant rows and %d Drive permissions left, want none", remaining, len(standIn.Permissions("folder-acme-1234567890")))
+	}
+
+	var events []models.AuditEvent
+	db.Where("target_type = ? AND target_id = ?", "user", fmt.Sprint(user.ID)).Find(&events)
+	if len(events) != 2 {
+		t.Fatalf("%d audit events, want the update and the erasure", len(events))
+	}
+	for _, event := range events {
+		for _, personal := range []string{user.Name, user.Email, user.Department} {
+			if strings.Contains(event.Before+event.After, personal) {
+				t.Errorf("%s event keeps %q: %s %s", event.Action, personal, event.Before, event.After)
+			}
+		}
+	}
+	if result, _ := audit.Verify(db); !result.Valid {
+		t.Errorf("audit chain broken: %s", result.Reason)
+	}
+}
@@ -0,0 +1,245 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// External sign-in errors
+var (
+	ErrExternalEmailUnverified = errors.New("the identity provider has not verified this email address")
+	ErrExternalNoAccount       = errors.New("no account uses this email address, ask an admin for an invitation")
+	ErrExternalDomainBlocked   = errors.New("accounts from this email domain are blocked")
+	ErrAccountDisabled         = errors.New("account is disabled")
+	ErrExternalLinkRequired    = errors.New("an account already uses this email address, sign in to it and link this provider from your profile")
+	ErrExternalLinkedElsewhere = errors.New("this identity provider account is already linked to another user")
+)
+
+// ExternalIdentity is a user as an external identity provider describes them
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Department and Role are applied at every sign-in when the provider
+	// sends them
+	Department string
+	Role       string
+	// ClaimsAccounts lets the identity take over any existing account with
+	// its email address, for sources an admin has made the authority for
+	// their domain. Other identities only take over accounts without a
+	// usable password that are not admins.
+	ClaimsAccounts bool
+}
+
+// SignInExternal finds the user an external identity belongs to. A known
+// identity signs in its linked user. Otherwise the identity is linked to the
+// account with the same email address, which the provider must have
+// verified, or, if createUsers is set, to a new account. Accounts with a
+// password or the admin role are only linked by their signed-in owner,
+// unless the identity ClaimsAccounts.
+func SignInExternal(db *gorm.DB, c *fiber.Ctx, identity ExternalIdentity, createUsers bool) (models.User, error) {
+	var user models.User
+	now := time.Now().Unix()
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+		if err == nil {
+			err = tx.First(&user, link.UserID).Error
+		}
+
+		if err != nil {
+			if email == "" || !identity.EmailVerified {
+				return ErrExternalEmailUnverified
+			}
+
+			if tx.Where("email = ?", email).First(&user).Error == nil {
+				// Whoever controls the address at the provider must not
+				// take over an account its owner can already sign in to
+				if !identity.ClaimsAccounts && (user.Role == "admin" || passwords.Usable(user.Password)) {
+					return ErrExternalLinkRequired
+				}
+				if err := audit.Record(tx, c, "user.identity_link", "user", user.ID, nil, fiber.Map{
+					"provider": identity.Provider,
+					"subject":  identity.Subject,
+				}); err != nil {
+					return err
+				}
+			} else {
+				if !createUsers {
+					return ErrExternalNoAccount
+				}
+				created, err := createExternalUser(tx, c, identity, email, now)
+				if err != nil {
+					return err
+				}
+				user = created
+			}
+
+			// Replace a link left behind by a deleted user
+			tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).Delete(&models.UserIdentity{})
+			link = models.UserIdentity{
+				UserID:    user.ID,
+				Provider:  identity.Provider,
+				Subject:   identity.Subject,
+				CreatedAt: now,
+			}
+		}
+
+		if !user.IsActive {
+			return ErrAccountDisabled
+		}
+
+		link.Email = email
+		link.LastLoginAt = now
+		if err := tx.Save(&link).Error; err != nil {
+			return err
+		}
+
+		synced, err := SyncExternal(tx, c, user, identity)
+		user = synced
+		return err
+	})
+	return user, err
+}
+
+// LinkExternal links an external identity to a signed-in user, who has just
+// proved they control both. The identity's email address may differ from
+// the account's.
+func LinkExternal(db *gorm.DB, c *fiber.Ctx, userID uint, identity ExternalIdentity) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		if !user.IsActive {
+			return ErrAccountDisabled
+		}
+
+		var link models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&link).Error
+		if err == nil && link.UserID != user.ID && tx.First(&models.User{}, link.UserID).Error == nil {
+			return ErrExternalLinkedElsewhere
+		}
+		if err != nil || link.UserID != user.ID {
+			// Replace a link left behind by a deleted user
+			tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).Delete(&models.UserIdentity{})
+			link = models.UserIdentity{
+				UserID:    user.ID,
+				Provider:  identity.Provider,
+				Subject:   identity.Subject,
+				CreatedAt: time.Now().Unix(),
+			}
+			if err := audit.Record(tx, c, "user.identity_link", "user", user.ID, nil, fiber.Map{
+				"provider":  identity.Provider,
+				"subject":   identity.Subject,
+				"signed_in": true,
+			}); err != nil {
+				return err
+			}
+		}
+
+		link.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+		return tx.Save(&link).Error
+	})
+}
+
+// SyncExternal applies what the provider says about a user's department,
+// role and email address, since it is the source of truth for them
+func SyncExternal(db *gorm.DB, c *fiber.Ctx, user models.User, identity ExternalIdentity) (models.User, error) {
+	before := user
+	if identity.Department != "" {
+		user.Department = identity.Department
+	}
+	if identity.Role != "" {
+		user.Role = identity.Role
+	}
+	if user.EmailVerifiedAt == 0 && identity.EmailVerified && strings.EqualFold(user.Email, strings.TrimSpace(identity.Email)) {
+		user.EmailVerifiedAt = time.Now().Unix()
+	}
+	if user.Department == before.Department && user.Role == before.Role && user.EmailVerifiedAt == before.EmailVerifiedAt {
+		return user, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "user.identity_sync", "user", user.ID, before, user)
+	})
+	return user, err
+}
+
+// DeactivateExternal disables an account its identity provider no longer
+// knows and signs it out everywhere
+func DeactivateExternal(db *gorm.DB, c *fiber.Ctx, user models.User, provider string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "user.identity_deactivate", "user", user.ID, nil, fiber.Map{
+			"provider": provider,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	utils.RevokeUserSessions(user.ID)
+	return nil
+}
+
+// createExternalUser creates the account of a person who signed in through
+// an identity provider for the first time. Domain rules still apply.
+func createExternalUser(tx *gorm.DB, c *fiber.Ctx, identity ExternalIdentity, email string, now int64) (models.User, error) {
+	user := models.User{
+		Name:            strings.TrimSpace(identity.Name),
+		Email:           email,
+		Role:            "user",
+		Department:      identity.Department,
+		CreatedAt:       now,
+		EmailVerifiedAt: now,
+	}
+	if user.Name == "" {
+		user.Name = strings.SplitN(email, "@", 2)[0]
+	}
+
+	rule, err := policy.MatchDomainRule(tx, policy.EmailDomain(email))
+	if err != nil {
+		return user, err
+	}
+	if rule != nil && rule.Action == models.RegistrationBlock {
+		return user, ErrExternalDomainBlocked
+	}
+	if rule != nil {
+		if user.Department == "" {
+			user.Department = rule.Department
+		}
+		if role := policy.SignupRole(rule); role != "" {
+			user.Role = role
+		}
+	}
+
+	// The provider vouches for the user, who has no password
+	if err := tx.Create(&user).Error; err != nil {
+		return user, err
+	}
+	return user, audit.Record(tx, c, "user.create_external", "user", user.ID, nil, fiber.Map{
+		"provider":   identity.Provider,
+		"email":      user.Email,
+		"department": user.Department,
+		"role":       user.Role,
+	})
+}
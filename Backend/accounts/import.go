@@ -0,0 +1,304 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// MaxImportRows bounds a single import
+const MaxImportRows = 5000
+
+// Ways an imported user gets in for the first time
+const (
+	CredentialInvite   = "invite"   // an invitation link to set a password
+	CredentialPassword = "password" // a temporary password to change on first login
+)
+
+// Per-row import outcomes
+const (
+	StatusCreated     = "created"
+	StatusWouldCreate = "would_create" // dry run
+	StatusDuplicate   = "duplicate"
+	StatusInvalid     = "invalid"
+	StatusFailed      = "failed"
+)
+
+// ImportRow is one person to provision
+type ImportRow struct {
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Department string `json:"department"`
+	Role       string `json:"role"`
+}
+
+// ImportOptions controls an import
+type ImportOptions struct {
+	DryRun     bool
+	Credential string // invite or password
+	CreatedBy  uint
+	Request    *fiber.Ctx // for the audit log, nil from the command line
+}
+
+// ImportResult reports what happened to one row
+type ImportResult struct {
+	Row               int    `json:"row"` // 1-based, not counting a CSV header
+	Email             string `json:"email"`
+	Status            string `json:"status"`
+	Error             string `json:"error,omitempty"`
+	UserID            uint   `json:"user_id,omitempty"`
+	InviteURL         string `json:"invite_url,omitempty"`
+	InviteExpiresAt   int64  `json:"invite_expires_at,omitempty"`
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+}
+
+// ImportSummary counts the results by status
+type ImportSummary struct {
+	Total     int            `json:"total"`
+	DryRun    bool           `json:"dry_run"`
+	ByStatus  map[string]int `json:"by_status"`
+	HasErrors bool           `json:"has_errors"`
+}
+
+// ParseImport reads rows from CSV (with a header line) or a JSON array.
+// format is "csv" or "json"; when empty it is guessed from the content.
+func ParseImport(data []byte, format string) ([]ImportRow, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("the import is empty")
+	}
+	if format == "" {
+		format = "csv"
+		if trimmed[0] == '[' {
+			format = "json"
+		}
+	}
+
+	var rows []ImportRow
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rows); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case "csv":
+		parsed, err := parseImportCSV(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		rows = parsed
+	default:
+		return nil, fmt.Errorf("unsupported format %q, use csv or json", format)
+	}
+
+	if len(rows) > MaxImportRows {
+		return nil, fmt.Errorf("the import has %d rows, at most %d are allowed", len(rows), MaxImportRows)
+	}
+	return rows, nil
+}
+
+// parseImportCSV maps the header line to ImportRow fields
+func parseImportCSV(data []byte) ([]ImportRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		switch name {
+		case "name", "email", "department", "role":
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("unknown CSV column %q, expected name, email, department and role", name)
+		}
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("the CSV header must include an email column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		rows = append(rows, ImportRow{
+			Name:       field(record, "name"),
+			Email:      field(record, "email"),
+			Department: field(record, "department"),
+			Role:       field(record, "role"),
+		})
+	}
+	return rows, nil
+}
+
+// Import validates every row and, unless it is a dry run, creates an
+// account for each valid one. Rows are independent: an invalid or duplicate
+// row is reported and the others still go through.
+func Import(db *gorm.DB, rows []ImportRow, options ImportOptions) ([]ImportResult, ImportSummary) {
+	if options.Credential == "" {
+		options.Credential = CredentialInvite
+	}
+
+	// Emails already taken, and those seen earlier in this import
+	emails := make([]string, 0, len(rows))
+	for _, row := range rows {
+		emails = append(emails, strings.ToLower(strings.TrimSpace(row.Email)))
+	}
+	var existing []string
+	db.Model(&models.User{}).Where("LOWER(email) IN ?", emails).Pluck("LOWER(email)", &existing)
+	taken := map[string]string{}
+	for _, email := range existing {
+		taken[email] = "an account with this email already exists"
+	}
+
+	results := make([]ImportResult, 0, len(rows))
+	for i, row := range rows {
+		result := ImportResult{Row: i + 1, Email: strings.TrimSpace(row.Email)}
+		row, err := normalizeImportRow(row)
+
+		switch {
+		case err != nil:
+			result.Status, result.Error = StatusInvalid, err.Error()
+		case taken[row.Email] != "":
+			result.Status, result.Error = StatusDuplicate, taken[row.Email]
+		case options.DryRun:
+			result.Status = StatusWouldCreate
+		default:
+			if err := provision(db, row, options, &result); err != nil {
+				result.Status, result.Error = StatusFailed, err.Error()
+			} else {
+				result.Status = StatusCreated
+			}
+		}
+
+		if err == nil && taken[row.Email] == "" {
+			taken[row.Email] = fmt.Sprintf("duplicate of row %d", result.Row)
+		}
+		results = append(results, result)
+	}
+
+	summary := ImportSummary{Total: len(results), DryRun: options.DryRun, ByStatus: map[string]int{}}
+	for _, result := range results {
+		summary.ByStatus[result.Status]++
+		if result.Error != "" {
+			summary.HasErrors = true
+		}
+	}
+	return results, summary
+}
+
+// normalizeImportRow trims and validates a row
+func normalizeImportRow(row ImportRow) (ImportRow, error) {
+	row.Name = strings.TrimSpace(row.Name)
+	row.Department = strings.TrimSpace(row.Department)
+	row.Role = strings.ToLower(strings.TrimSpace(row.Role))
+
+	address, err := mail.ParseAddress(strings.TrimSpace(row.Email))
+	if err != nil || address.Name != "" {
+		return row, errors.New("invalid email address")
+	}
+	row.Email = strings.ToLower(address.Address)
+
+	if row.Name == "" {
+		return row, errors.New("name is required")
+	}
+
+	switch row.Role {
+	case "":
+		row.Role = "user"
+	case "user", "admin":
+	default:
+		return row, fmt.Errorf("invalid role %q, expected user or admin", row.Role)
+	}
+	return row, nil
+}
+
+// provision creates the account for a valid row together with its
+// invitation or temporary password
+func provision(db *gorm.DB, row ImportRow, options ImportOptions, result *ImportResult) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		user := models.User{
+			Name:       row.Name,
+			Email:      row.Email,
+			Role:       row.Role,
+			Department: row.Department,
+			CreatedAt:  time.Now().Unix(),
+		}
+
+		// Invited users have no password until they accept
+		password := ""
+		if options.Credential == CredentialPassword {
+			// An admin provided the address, so it needs no verification
+			user.EmailVerifiedAt = user.CreatedAt
+			generated, err := randomToken(12)
+			if err != nil {
+				return err
+			}
+			password = generated
+			if user.Password, err = passwords.Hash(password); err != nil {
+				return err
+			}
+			user.MustChangePassword = true
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		if options.Credential == CredentialPassword {
+			result.TemporaryPassword = password
+		} else {
+			// Invited accounts stay disabled until the invitation is accepted.
+			// IsActive defaults to true on insert, so switch it off after.
+			if err := tx.Model(&user).Update("is_active", false).Error; err != nil {
+				return err
+			}
+			user.IsActive = false
+
+			invitation, token, err := NewInvitation(tx, user, options.CreatedBy, time.Time{})
+			if err != nil {
+				return err
+			}
+			result.InviteURL = InviteURL(token)
+			result.InviteExpiresAt = invitation.ExpiresAt
+		}
+
+		result.UserID = user.ID
+		return audit.Record(tx, options.Request, "user.import", "user", user.ID, nil, fiber.Map{
+			"email":      user.Email,
+			"name":       user.Name,
+			"role":       user.Role,
+			"department": user.Department,
+			"credential": options.Credential,
+		})
+	})
+}
@@ -0,0 +1,159 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		format  string
+		want    []ImportRow
+		wantErr string // empty when the data must be accepted
+	}{
+		{
+			name: "csv with a byte order mark and reordered columns",
+			data: "\ufeffEmail, Name ,role\nada@acme.com, Ada Lovelace,admin\nbob@acme.com,Bob,\n",
+			want: []ImportRow{
+				{Name: "Ada Lovelace", Email: "ada@acme.com", Role: "admin"},
+				{Name: "Bob", Email: "bob@acme.com"},
+			},
+		},
+		{
+			name: "json guessed from the content",
+			data: `  [{"name": "Ada", "email": "ada@acme.com", "department": "Analytics"}]`,
+			want: []ImportRow{{Name: "Ada", Email: "ada@acme.com", Department: "Analytics"}},
+		},
+		{name: "header only", data: "name,email\n", want: nil},
+		{name: "empty", data: " \n ", wantErr: "empty"},
+		{name: "unknown csv column", data: "name,email,password\nAda,ada@acme.com,secret\n", wantErr: `unknown CSV column "password"`},
+		{name: "csv without email", data: "name,role\nAda,user\n", wantErr: "email column"},
+		{name: "unbalanced quotes", data: "name,email\n\"Ada,ada@acme.com\n", wantErr: "invalid CSV"},
+		{name: "unknown json field", data: `[{"email": "ada@acme.com", "password": "secret"}]`, wantErr: "invalid JSON"},
+		{name: "json given as csv", data: `[{"email": "ada@acme.com"}]`, format: "csv", wantErr: "invalid CSV"},
+		{name: "unsupported format", data: "name,email\n", format: "xlsx", wantErr: "unsupported format"},
+		{name: "too many rows", data: "email\n" + strings.Repeat("a@acme.com\n", MaxImportRows+1), wantErr: "at most"},
+	}
+	for _, test := range tests {
+		rows, err := ParseImport([]byte(test.data), test.format)
+		switch {
+		case test.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: err = %v, want one about %q", test.name, err, test.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case !reflect.DeepEqual(rows, test.want):
+			t.Errorf("%s: rows = %+v, want %+v", test.name, rows, test.want)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.User{Name: "Existing", Email: "Existing@Acme.com", Password: []byte("unusable")})
+
+	rows, err := ParseImport([]byte(`name,email,department,role
+Ada Lovelace,ada@acme.com,Analytics,
+Grace Hopper,grace@acme.com,,ADMIN
+No Address,not-an-email,,
+Named Address,Bob <bob@acme.com>,,
+Ada Again,ADA@acme.com,,
+Existing User,existing@acme.com,,
+,nameless@acme.com,,
+Root,root@acme.com,,superuser
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		status, errorText string
+	}{
+		{StatusCreated, ""},
+		{StatusCreated, ""},
+		{StatusInvalid, "invalid email address"},
+		{StatusInvalid, "invalid email address"},
+		{StatusDuplicate, "duplicate of row 1"},
+		{StatusDuplicate, "already exists"},
+		{StatusInvalid, "name is required"},
+		{StatusInvalid, `invalid role "superuser"`},
+	}
+
+	// A dry run reports what would happen and writes nothing
+	results, summary := Import(db, rows, ImportOptions{DryRun: true})
+	for i, result := range results {
+		status := want[i].status
+		if status == StatusCreated {
+			status = StatusWouldCreate
+		}
+		if result.Row != i+1 || result.Status != status || !strings.Contains(result.Error, want[i].errorText) {
+			t.Errorf("dry run row %d = %+v, want %s %q", i+1, result, status, want[i].errorText)
+		}
+	}
+	if !summary.DryRun || !summary.HasErrors || summary.Total != len(want) || summary.ByStatus[StatusWouldCreate] != 2 {
+		t.Errorf("dry run summary = %+v", summary)
+	}
+	for _, model := range []interface{}{&models.User{}, &models.Invitation{}, &models.AuditEvent{}} {
+		var count int64
+		db.Model(model).Count(&count)
+		if _, user := model.(*models.User); (user && count != 1) || (!user && count != 0) {
+			t.Errorf("dry run left %d rows in %T", count, model)
+		}
+	}
+
+	results, summary = Import(db, rows, ImportOptions{})
+	for i, result := range results {
+		if result.Status != want[i].status || !strings.Contains(result.Error, want[i].errorText) {
+			t.Errorf("row %d = %+v, want %s %q", i+1, result, want[i].status, want[i].errorText)
+		}
+	}
+	if summary.DryRun || summary.ByStatus[StatusCreated] != 2 || summary.ByStatus[StatusInvalid] != 4 || summary.ByStatus[StatusDuplicate] != 2 {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// Invited accounts wait for their invitation, with the role asked for
+	var grace models.User
+	db.Where("email = ?", "grace@acme.com").First(&grace)
+	if grace.ID != results[1].UserID || grace.Role != "admin" || grace.IsActive || results[1].InviteURL == "" {
+		t.Errorf("grace = %+v, result %+v; want an inactive invited admin", grace, results[1])
+	}
+	var ada models.User
+	db.Where("email = ?", "ada@acme.com").First(&ada)
+	if ada.Role != "user" || ada.Department != "Analytics" || ada.Name != "Ada Lovelace" {
+		t.Errorf("ada = %+v, want a user in Analytics", ada)
+	}
+
+	var invitations, events int64
+	db.Model(&models.Invitation{}).Count(&invitations)
+	db.Model(&models.AuditEvent{}).Where("action = ?", "user.import").Count(&events)
+	if invitations != 2 || events != 2 {
+		t.Errorf("%d invitations and %d audit events, want 2 of each", invitations, events)
+	}
+
+	// Temporary passwords are handed back and must be changed
+	results, _ = Import(db, []ImportRow{{Name: "Linus", Email: "linus@acme.com"}}, ImportOptions{Credential: CredentialPassword})
+	var linus models.User
+	db.Where("email = ?", "linus@acme.com").First(&linus)
+	if results[0].TemporaryPassword == "" || !linus.MustChangePassword || !linus.IsActive || linus.EmailVerifiedAt == 0 {
+		t.Errorf("password import = %+v, user %+v", results[0], linus)
+	}
+}
@@ -0,0 +1,252 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/policy"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Invitation errors
+var (
+	ErrInvitationInvalid = errors.New("invitation is invalid or has already been used")
+	ErrInvitationExpired = errors.New("invitation has expired")
+	ErrAlreadyActive     = errors.New("an active account with this email already exists")
+	ErrInvitationExpiry  = errors.New("give either expires_in_hours or expires_at, in the future and at most 30 days ahead")
+)
+
+// maxInvitationTTL is the longest an admin can keep an invitation open
+const maxInvitationTTL = 30 * 24 * time.Hour
+
+// Invitee describes the person an admin invites
+type Invitee struct {
+	Email      string
+	Name       string
+	Role       string
+	Department string
+	// ExpiresAt ends the invitation; zero means INVITATION_TTL_HOURS from now
+	ExpiresAt time.Time
+}
+
+// InvitationExpiry reads the expiry an admin asked for, as a number of hours
+// from now or a Unix time. Neither gives the zero time, the default.
+func InvitationExpiry(now time.Time, expiresInHours, expiresAt int64) (time.Time, error) {
+	var expiry time.Time
+	switch {
+	case expiresInHours != 0 && expiresAt != 0:
+		return expiry, ErrInvitationExpiry
+	case expiresInHours != 0:
+		if expiresInHours < 0 || expiresInHours > int64(maxInvitationTTL/time.Hour) {
+			return expiry, ErrInvitationExpiry
+		}
+		expiry = now.Add(time.Duration(expiresInHours) * time.Hour)
+	case expiresAt != 0:
+		expiry = time.Unix(expiresAt, 0)
+		if !expiry.After(now) || expiry.After(now.Add(maxInvitationTTL)) {
+			return time.Time{}, ErrInvitationExpiry
+		}
+	}
+	return expiry, nil
+}
+
+// Invite provisions a disabled account for the invitee, or reuses the one
+// left by an earlier invitation, and creates a new invitation for it.
+// Earlier pending invitations for the account are revoked.
+func Invite(db *gorm.DB, c *fiber.Ctx, invitee Invitee, createdBy uint) (models.Invitation, string, error) {
+	var invitation models.Invitation
+	var token string
+
+	// The invitee can fill in their name when accepting
+	if strings.TrimSpace(invitee.Name) == "" {
+		invitee.Name = strings.SplitN(strings.TrimSpace(invitee.Email), "@", 2)[0]
+	}
+
+	row, err := normalizeImportRow(ImportRow{
+		Name:       invitee.Name,
+		Email:      invitee.Email,
+		Role:       invitee.Role,
+		Department: invitee.Department,
+	})
+	if err != nil {
+		return invitation, "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Where("LOWER(email) = ?", row.Email).First(&user).Error; err == nil {
+			if user.IsActive {
+				return ErrAlreadyActive
+			}
+			user.Role = row.Role
+			user.Department = row.Department
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+		} else {
+			// No password until the invitation is accepted
+			user = models.User{
+				Name:       row.Name,
+				Email:      row.Email,
+				Role:       row.Role,
+				Department: row.Department,
+				CreatedAt:  time.Now().Unix(),
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			// IsActive defaults to true on insert
+			if err := tx.Model(&user).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().Unix()
+		if err := tx.Model(&models.Invitation{}).
+			Where("user_id = ? AND accepted_at = 0 AND revoked_at = 0", user.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+
+		created, plain, err := NewInvitation(tx, user, createdBy, invitee.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		invitation, token = created, plain
+
+		return audit.Record(tx, c, "invitation.create", "invitation", invitation.ID, nil, invitation)
+	})
+
+	return invitation, token, err
+}
+
+// FindInvitation returns the pending invitation for a token
+func FindInvitation(db *gorm.DB, token string) (models.Invitation, error) {
+	var invitation models.Invitation
+	if token == "" || db.Where("token_hash = ?", HashToken(token)).First(&invitation).Error != nil {
+		return invitation, ErrInvitationInvalid
+	}
+	if invitation.AcceptedAt != 0 || invitation.RevokedAt != 0 {
+		return invitation, ErrInvitationInvalid
+	}
+	if invitation.ExpiresAt <= time.Now().Unix() {
+		return invitation, ErrInvitationExpired
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation sets the invited account's password, applies the role
+// and department of the invitation and activates the account
+func AcceptInvitation(db *gorm.DB, c *fiber.Ctx, token, password, name string) (models.User, error) {
+	var user models.User
+
+	invitation, err := FindInvitation(db, token)
+	if err != nil {
+		return user, err
+	}
+	if err := policy.CheckPassword(db, models.User{Email: invitation.Email}, password); err != nil {
+		return user, err
+	}
+
+	hashed, err := passwords.Hash(password)
+	if err != nil {
+		return user, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, invitation.UserID).Error; err != nil {
+			return ErrInvitationInvalid
+		}
+
+		// Only one request may use the invitation
+		claimed := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at = 0 AND revoked_at = 0", invitation.ID).
+			Update("accepted_at", time.Now().Unix())
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			return ErrInvitationInvalid
+		}
+
+		before := user
+		if strings.TrimSpace(name) != "" {
+			user.Name = strings.TrimSpace(name)
+		}
+		user.Password = hashed
+		user.Role = invitation.Role
+		user.Department = invitation.Department
+		user.IsActive = true
+		user.MustChangePassword = false
+		// The admin who sent the invitation vouched for the address
+		if user.EmailVerifiedAt == 0 {
+			user.EmailVerifiedAt = time.Now().Unix()
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, "invitation.accept", "user", user.ID, before, user)
+	})
+
+	return user, err
+}
+
+// NewInvitation creates an invitation for a provisioned user and returns it
+// with the plain token, which is not stored and cannot be recovered later.
+// A zero expiresAt gives the configured INVITATION_TTL_HOURS.
+func NewInvitation(tx *gorm.DB, user models.User, createdBy uint, expiresAt time.Time) (models.Invitation, string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return models.Invitation{}, "", err
+	}
+
+	now := time.Now()
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(time.Duration(config.InvitationTTLHours) * time.Hour)
+	}
+	invitation := models.Invitation{
+		UserID:     user.ID,
+		Email:      user.Email,
+		Role:       user.Role,
+		Department: user.Department,
+		TokenHash:  HashToken(token),
+		ExpiresAt:  expiresAt.Unix(),
+		CreatedAt:  now.Unix(),
+		CreatedBy:  createdBy,
+	}
+	if err := tx.Create(&invitation).Error; err != nil {
+		return models.Invitation{}, "", err
+	}
+	return invitation, token, nil
+}
+
+// InviteURL is the frontend link through which an invitation is accepted
+func InviteURL(token string) string {
+	return strings.TrimSuffix(config.AppBaseURL, "/") + "/invitations/" + token
+}
+
+// HashToken returns the stored form of a token sent to a user
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns size random bytes, URL-safe encoded
+func randomToken(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
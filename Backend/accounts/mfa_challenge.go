@@ -0,0 +1,92 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/mfa"
+	"JWT-Authentication-go/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Limits of the second login step
+const (
+	MFAChallengeLifetime    = 5 * time.Minute
+	MaxMFAChallengeAttempts = 5
+)
+
+// MFA challenge errors
+var (
+	ErrChallengeInvalid = errors.New("login challenge is invalid or has already been used")
+	ErrChallengeExpired = errors.New("login challenge has expired, please log in again")
+)
+
+// NewMFAChallenge starts the second login step for a user whose password
+// was accepted. The returned token is exchanged for a session by
+// CompleteMFAChallenge.
+func NewMFAChallenge(db *gorm.DB, user models.User) (string, models.MFAChallenge, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", models.MFAChallenge{}, err
+	}
+
+	now := time.Now()
+	challenge := models.MFAChallenge{
+		UserID:    user.ID,
+		TokenHash: HashToken(token),
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(MFAChallengeLifetime).Unix(),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return "", models.MFAChallenge{}, err
+	}
+	return token, challenge, nil
+}
+
+// CompleteMFAChallenge checks the code for a challenge and returns the user
+// to sign in. A challenge allows MaxMFAChallengeAttempts tries and one success.
+func CompleteMFAChallenge(db *gorm.DB, token, code string) (models.User, string, error) {
+	var user models.User
+
+	var challenge models.MFAChallenge
+	if token == "" || db.Where("token_hash = ?", HashToken(token)).First(&challenge).Error != nil {
+		return user, "", ErrChallengeInvalid
+	}
+	if challenge.UsedAt != 0 || challenge.Attempts >= MaxMFAChallengeAttempts {
+		return user, "", ErrChallengeInvalid
+	}
+	if challenge.ExpiresAt <= time.Now().Unix() {
+		return user, "", ErrChallengeExpired
+	}
+
+	// Count the attempt before checking, so parallel guesses are limited too
+	counted := db.Model(&models.MFAChallenge{}).
+		Where("id = ? AND used_at = 0 AND attempts < ?", challenge.ID, MaxMFAChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if counted.Error != nil {
+		return user, "", counted.Error
+	}
+	if counted.RowsAffected == 0 {
+		return user, "", ErrChallengeInvalid
+	}
+
+	if err := db.First(&user, challenge.UserID).Error; err != nil || !user.IsActive {
+		return user, "", ErrChallengeInvalid
+	}
+
+	method, err := mfa.Verify(db, user, code)
+	if err != nil {
+		return user, "", err
+	}
+
+	claimed := db.Model(&models.MFAChallenge{}).
+		Where("id = ? AND used_at = 0", challenge.ID).
+		Update("used_at", time.Now().Unix())
+	if claimed.Error != nil {
+		return user, "", claimed.Error
+	}
+	if claimed.RowsAffected == 0 {
+		return user, "", ErrChallengeInvalid
+	}
+	return user, method, nil
+}
@@ -0,0 +1,159 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/mailer"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/privacy"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PasswordResetInterval is the least time between two reset emails to the
+// same account
+const PasswordResetInterval = time.Minute
+
+// Password reset errors
+var (
+	ErrResetInvalid = errors.New("reset link is invalid or has already been used")
+	ErrResetExpired = errors.New("reset link has expired")
+)
+
+// RequestPasswordReset emails a one-time reset link to the account with this
+// address. Unknown or disabled accounts get nothing, and the caller is not
+// told, so the result cannot be used to find out who has an account.
+func RequestPasswordReset(db *gorm.DB, email, ip string) error {
+	var user models.User
+	err := db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error
+	if err != nil || !user.IsActive {
+		return nil
+	}
+
+	now := time.Now()
+	var recent int64
+	db.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND created_at > ?", user.ID, now.Add(-PasswordResetInterval).Unix()).
+		Count(&recent)
+	if recent > 0 {
+		return nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Duration(config.PasswordResetTTLMinutes) * time.Minute
+	reset := models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: HashToken(token),
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		IPAddress: privacy.StoredIP(ip),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Only the newest link works
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at = 0", user.ID).
+			Update("used_at", now.Unix()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&reset).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Someone asked to reset the password of your account. To choose a new password, open this link:\n\n"+
+		"%s\n\n"+
+		"The link expires in %d minutes and works once. If you did not ask for this, you can ignore this email; your password stays the same.\n",
+		user.Name, ResetURL(token), config.PasswordResetTTLMinutes)
+
+	return mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+// ResetURL is the frontend link through which a new password is chosen
+func ResetURL(token string) string {
+	return strings.TrimSuffix(config.AppBaseURL, "/") + "/reset-password?token=" + token
+}
+
+// ResetPassword sets a new password with a reset token and signs the user
+// out everywhere. The token works once.
+func ResetPassword(db *gorm.DB, c *fiber.Ctx, token, password string) (models.User, error) {
+	var user models.User
+
+	var reset models.PasswordReset
+	if token == "" || db.Where("token_hash = ?", HashToken(token)).First(&reset).Error != nil || reset.UsedAt != 0 {
+		return user, ErrResetInvalid
+	}
+	if reset.ExpiresAt <= time.Now().Unix() {
+		return user, ErrResetExpired
+	}
+
+	if err := db.First(&user, reset.UserID).Error; err != nil || !user.IsActive {
+		return user, ErrResetInvalid
+	}
+	if err := policy.CheckPassword(db, user, password); err != nil {
+		return user, err
+	}
+
+	hashed, err := passwords.Hash(password)
+	if err != nil {
+		return user, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, reset.UserID).Error; err != nil || !user.IsActive {
+			return ErrResetInvalid
+		}
+
+		// Only one request may use the link
+		claimed := tx.Model(&models.PasswordReset{}).
+			Where("id = ? AND used_at = 0", reset.ID).
+			Update("used_at", time.Now().Unix())
+		if claimed.Error != nil {
+			return claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			return ErrResetInvalid
+		}
+
+		if err := policy.RememberPassword(tx, user.ID, user.Password); err != nil {
+			return err
+		}
+		user.Password = hashed
+		user.MustChangePassword = false
+		// Receiving the link proves the user owns the address
+		if user.EmailVerifiedAt == 0 {
+			user.EmailVerifiedAt = time.Now().Unix()
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, c, "user.password_reset", "user", user.ID, nil, fiber.Map{
+			"reset_id": reset.ID,
+		})
+	})
+	if err != nil {
+		return user, err
+	}
+
+	// Whoever knew the old password is signed out
+	utils.RevokeUserSessions(user.ID)
+	return user, nil
+}
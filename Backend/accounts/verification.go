@@ -0,0 +1,113 @@
+package accounts
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/mailer"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// VerificationResendInterval is the least time between two verification emails
+const VerificationResendInterval = time.Minute
+
+// verifyEmailPurpose keeps verification tokens from being used as anything else
+const verifyEmailPurpose = "verify_email"
+
+// Email verification errors
+var (
+	ErrVerificationInvalid = errors.New("verification link is invalid")
+	ErrVerificationExpired = errors.New("verification link has expired")
+	ErrVerificationTooSoon = errors.New("a verification email was sent recently, please wait before asking again")
+)
+
+// VerificationToken signs a token proving the holder received mail at the
+// user's current address. It stops working once the address changes.
+func VerificationToken(user models.User, now time.Time) (string, error) {
+	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":     strconv.Itoa(int(user.ID)),
+		"email":   strings.ToLower(user.Email),
+		"purpose": verifyEmailPurpose,
+		"exp":     now.Add(time.Duration(config.EmailVerificationTTLHours) * time.Hour).Unix(),
+	})
+	return claims.SignedString([]byte(utils.SecretKey))
+}
+
+// VerifyURL is the frontend link through which an address is confirmed
+func VerifyURL(token string) string {
+	return strings.TrimSuffix(config.AppBaseURL, "/") + "/verify-email?token=" + url.QueryEscape(token)
+}
+
+// SendVerification emails the user a verification link. It refuses to send
+// again within VerificationResendInterval of the previous email.
+func SendVerification(db *gorm.DB, user models.User) error {
+	now := time.Now()
+	if user.VerificationSentAt != 0 && now.Sub(time.Unix(user.VerificationSentAt, 0)) < VerificationResendInterval {
+		return ErrVerificationTooSoon
+	}
+
+	token, err := VerificationToken(user, now)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Please confirm your email address by opening this link:\n\n"+
+		"%s\n\n"+
+		"The link expires in %d hours. If you did not create an account, you can ignore this email.\n",
+		user.Name, VerifyURL(token), config.EmailVerificationTTLHours)
+
+	if err := mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body:    body,
+	}); err != nil {
+		return err
+	}
+
+	return db.Model(&models.User{}).Where("id = ?", user.ID).
+		Update("verification_sent_at", now.Unix()).Error
+}
+
+// VerifyEmail marks the address in a verification token as confirmed.
+// Verifying an address twice is not an error.
+func VerifyEmail(db *gorm.DB, token string) (models.User, error) {
+	var user models.User
+
+	parsed, err := jwt.ParseWithClaims(token, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(utils.SecretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return user, ErrVerificationExpired
+	}
+	if err != nil {
+		return user, ErrVerificationInvalid
+	}
+
+	claims := *parsed.Claims.(*jwt.MapClaims)
+	if claims["purpose"] != verifyEmailPurpose {
+		return user, ErrVerificationInvalid
+	}
+	if err := db.First(&user, utils.GetUintFromClaims(&claims, "sub")).Error; err != nil {
+		return user, ErrVerificationInvalid
+	}
+	if email, _ := claims["email"].(string); email != strings.ToLower(user.Email) {
+		return user, ErrVerificationInvalid
+	}
+
+	if user.EmailVerifiedAt == 0 {
+		user.EmailVerifiedAt = time.Now().Unix()
+		if err := db.Model(&user).Update("email_verified_at", user.EmailVerifiedAt).Error; err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
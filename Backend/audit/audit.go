@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/privacy"
+	"JWT-Authentication-go/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Record appends an audit event using tx, which should be the transaction
+// making the change so the event and the change commit together. Given a
+// plain connection it opens its own transaction, since locking the head of
+// the chain needs one. c may be nil for actions taken by the system or a
+// command-line tool. before and after are snapshotted as JSON; pass nil for
+// a missing side. Snapshots of users leave out what identifies the person,
+// so an erased account leaves nothing personal in the chain.
+func Record(tx *gorm.DB, c *fiber.Ctx, action, targetType string, targetID interface{}, before, after interface{}) error {
+	if _, inTransaction := tx.Statement.ConnPool.(gorm.TxCommitter); !inTransaction {
+		return tx.Transaction(func(tx *gorm.DB) error {
+			return Record(tx, c, action, targetType, targetID, before, after)
+		})
+	}
+
+	event := models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		Before:     snapshot(targetType, before),
+		After:      snapshot(targetType, after),
+		CreatedAt:  time.Now().Unix(),
+	}
+
+	if c != nil {
+		event.ActorID = utils.GetUserIdFromToken(c)
+		event.IPAddress = privacy.StoredIP(c.IP())
+		if requestID, ok := c.Locals("requestid").(string); ok {
+			event.RequestID = requestID
+		}
+	}
+
+	// Lock the head of the chain so concurrent writers append one at a time.
+	// SQLite has no row locks but serializes writers anyway.
+	last := tx.Order("id DESC").Limit(1)
+	if tx.Dialector.Name() != "sqlite" {
+		last = last.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var previous []models.AuditEvent
+	if err := last.Find(&previous).Error; err != nil {
+		return err
+	}
+	if len(previous) > 0 {
+		event.PrevHash = previous[0].Hash
+	}
+
+	event.Hash = Hash(event)
+	return tx.Create(&event).Error
+}
+
+// Hash computes the chain hash of an event from its content and PrevHash
+func Hash(event models.AuditEvent) string {
+	content, _ := json.Marshal([]interface{}{
+		event.PrevHash,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.Before,
+		event.After,
+		event.IPAddress,
+		event.RequestID,
+		event.CreatedAt,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// personalFields are the user attributes kept out of snapshots; the target
+// ID still says which account an event is about
+var personalFields = []string{"name", "email", "department"}
+
+// snapshot encodes a value for the Before/After columns
+func snapshot(targetType string, value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", fmt.Sprint(value))
+	}
+	if targetType != "user" {
+		return string(encoded)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return string(encoded)
+	}
+	for _, field := range personalFields {
+		delete(fields, field)
+	}
+	encoded, _ = json.Marshal(fields)
+	return string(encoded)
+}
+
+// VerifyResult reports the outcome of walking the hash chain
+type VerifyResult struct {
+	Checked   int    `json:"checked"`
+	Valid     bool   `json:"valid"`
+	BrokenAt  uint   `json:"broken_at,omitempty"` // first event that does not verify
+	Reason    string `json:"reason,omitempty"`
+	HeadID    uint   `json:"head_id"`
+	HeadHash  string `json:"head_hash"` // record this elsewhere to detect truncation
+	CheckedAt int64  `json:"checked_at"`
+}
+
+// Verify walks the whole chain in ID order. Deleting a row shows up as a
+// PrevHash mismatch on the next event; editing one as a Hash mismatch.
+func Verify(db *gorm.DB) (VerifyResult, error) {
+	result := VerifyResult{Valid: true, CheckedAt: time.Now().Unix()}
+	previousHash := ""
+
+	var batch []models.AuditEvent
+	err := db.Order("id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, event := range batch {
+			if !result.Valid {
+				return nil
+			}
+			result.Checked++
+
+			switch {
+			case event.PrevHash != previousHash:
+				result.Valid = false
+				result.BrokenAt = event.ID
+				result.Reason = "previous hash does not match, an earlier event was removed or changed"
+			case Hash(event) != event.Hash:
+				result.Valid = false
+				result.BrokenAt = event.ID
+				result.Reason = "event content does not match its hash"
+			}
+
+			previousHash = event.Hash
+			result.HeadID = event.ID
+			result.HeadHash = event.Hash
+		}
+		return nil
+	}).Error
+
+	return result, err
+}
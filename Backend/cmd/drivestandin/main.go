@@ -0,0 +1,28 @@
+package main
+
+import (
+	"JWT-Authentication-go/drive"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	// Parse command-line arguments
+	addr := flag.String("addr", ":9090", "Address to listen on")
+	folders := flag.String("folders", "", "Comma separated id=name folders to serve")
+	flag.Parse()
+
+	standIn := drive.NewStandIn()
+	for _, entry := range strings.Split(*folders, ",") {
+		id, name, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if id != "" {
+			standIn.AddFolder(id, name)
+		}
+	}
+
+	fmt.Printf("Drive API stand-in listening on %s, set DRIVE_API_BASE_URL=http://localhost%s\n", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, standIn))
+}
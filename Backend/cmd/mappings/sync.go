@@ -0,0 +1,68 @@
+package main
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/mappings"
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	// Parse command-line arguments
+	file := flag.String("file", config.MappingsFile, "Path of the declarative mappings file")
+	force := flag.Bool("force", false, "Also change or remove mappings managed in the admin panel")
+	yes := flag.Bool("yes", false, "Apply without asking for confirmation")
+	dryRun := flag.Bool("dry-run", false, "Only print the plan")
+	flag.Parse()
+
+	// Check if a file is provided
+	if *file == "" {
+		fmt.Println("Error: A mappings file is required")
+		fmt.Println("Usage: go run cmd/mappings/sync.go -file=mappings.json [-force] [-yes] [-dry-run]")
+		os.Exit(1)
+	}
+
+	desired, err := mappings.LoadFile(*file)
+	if err != nil {
+		fmt.Printf("Error reading mappings file: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize database connection
+	if _, err := database.ConnectDB(); err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+
+	plan, err := mappings.BuildPlan(database.DB, desired, *force)
+	if err != nil {
+		fmt.Printf("Error computing plan: %v\n", err)
+		os.Exit(1)
+	}
+
+	plan.Print(os.Stdout)
+	if *dryRun || plan.Pending() == 0 {
+		return
+	}
+
+	// Ask for confirmation before writing anything
+	if !*yes {
+		fmt.Print("Apply these changes? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Aborted, no changes made")
+			return
+		}
+	}
+
+	if err := mappings.Apply(database.DB, plan); err != nil {
+		fmt.Printf("Error applying plan: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Applied %d change(s)\n", plan.Pending())
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"JWT-Authentication-go/sso"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+func main() {
+	// Parse command-line arguments
+	addr := flag.String("addr", ":9091", "Address to listen on")
+	baseURL := flag.String("url", "http://localhost:9091", "Address the browser reaches the stand-in at")
+	flag.Parse()
+
+	standIn, err := sso.NewSAMLStandIn(*baseURL)
+	if err != nil {
+		log.Fatalf("Failed to set up SAML stand-in: %v", err)
+	}
+
+	fmt.Printf("SAML stand-in listening on %s, upload the metadata from %s/metadata to a SAML connection\n", *addr, *baseURL)
+	log.Fatal(http.ListenAndServe(*addr, standIn))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/passwords"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+	// Parse command-line arguments
+	file := flag.String("file", "", "CSV or JSON file with name, email, department and role")
+	format := flag.String("format", "", "csv or json (default: from the file extension)")
+	credential := flag.String("credential", accounts.CredentialInvite, "invite (invitation links) or password (temporary passwords)")
+	dryRun := flag.Bool("dry-run", false, "Only validate the file")
+	asJSON := flag.Bool("json", false, "Print the report as JSON")
+	flag.Parse()
+
+	// Check if a file is provided
+	if *file == "" {
+		fmt.Println("Error: An import file is required")
+		fmt.Println("Usage: go run cmd/users/import.go -file=users.csv [-credential=invite|password] [-dry-run] [-json]")
+		os.Exit(1)
+	}
+	if *credential != accounts.CredentialInvite && *credential != accounts.CredentialPassword {
+		fmt.Println("Error: -credential must be invite or password")
+		os.Exit(1)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		fmt.Printf("Error reading import file: %v\n", err)
+		os.Exit(1)
+	}
+
+	rows, err := accounts.ParseImport(data, *format)
+	if err != nil {
+		fmt.Printf("Error parsing import file: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize database connection
+	if _, err := database.ConnectDB(); err != nil {
+		fmt.Printf("Error connecting to database: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Temporary passwords are hashed like any other
+	hasher, err := passwords.FromConfig()
+	if err != nil {
+		fmt.Printf("Error setting up password hashing: %v\n", err)
+		os.Exit(1)
+	}
+	passwords.Default = hasher
+
+	results, summary := accounts.Import(database.DB, rows, accounts.ImportOptions{
+		DryRun:     *dryRun,
+		Credential: *credential,
+	})
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(map[string]interface{}{"summary": summary, "results": results})
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "ROW\tEMAIL\tSTATUS\tDETAIL")
+		for _, result := range results {
+			detail := result.Error
+			switch {
+			case result.InviteURL != "":
+				detail = result.InviteURL
+			case result.TemporaryPassword != "":
+				detail = "temporary password: " + result.TemporaryPassword
+			}
+			fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", result.Row, result.Email, result.Status, detail)
+		}
+		table.Flush()
+		fmt.Printf("\n%d row(s): %v\n", summary.Total, summary.ByStatus)
+	}
+
+	if summary.HasErrors {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Settings read from the environment. Every value has a default so the
+// server still starts with no configuration at all.
+var (
+	// MappingsFile is the path of the declarative domain mapping file
+	MappingsFile = getEnv("MAPPINGS_FILE", "")
+	// MappingsSyncOnStart applies MappingsFile when the server starts
+	MappingsSyncOnStart = getEnvBool("MAPPINGS_SYNC_ON_START", false)
+	// DefaultDriveURL seeds the default mapping on first start
+	DefaultDriveURL = getEnv("DEFAULT_DRIVE_URL", "")
+
+	// DriveCredentialsFile is a service account key enabling the Drive API integration
+	DriveCredentialsFile = getEnv("DRIVE_CREDENTIALS_FILE", "")
+	// DriveImpersonate is the Workspace user the service account acts as
+	DriveImpersonate = getEnv("DRIVE_IMPERSONATE", "")
+	// DriveAPIBaseURL overrides the API host, e.g. to use the local stand-in
+	DriveAPIBaseURL = getEnv("DRIVE_API_BASE_URL", "")
+	// DriveGrantRole is the permission granted on mapped folders: reader, commenter or writer
+	DriveGrantRole = getEnv("DRIVE_GRANT_ROLE", "reader")
+	// DriveRevokeRetryIntervalMinutes is how often failed grant revocations are retried
+	DriveRevokeRetryIntervalMinutes = getEnvInt("DRIVE_REVOKE_RETRY_INTERVAL_MINUTES", 15)
+
+	// HealthCheckIntervalMinutes is how often mapped folders are probed; 0 disables it
+	HealthCheckIntervalMinutes = getEnvInt("HEALTH_CHECK_INTERVAL_MINUTES", 60)
+	// HealthCheckFailureThreshold is the number of consecutive failures that flags a mapping
+	HealthCheckFailureThreshold = getEnvInt("HEALTH_CHECK_FAILURE_THRESHOLD", 3)
+	// HealthCheckLocalRoots lists, comma separated, the folders under which
+	// local mappings are checked; local mappings elsewhere are not probed
+	HealthCheckLocalRoots = getEnv("HEALTH_CHECK_LOCAL_ROOTS", "")
+	// HealthCheckSMBHosts lists, comma separated, the file servers SMB
+	// mappings are checked on; shares on other servers are not probed
+	HealthCheckSMBHosts = getEnv("HEALTH_CHECK_SMB_HOSTS", "")
+
+	// NotifyWebhookURL receives admin notifications as JSON POSTs
+	NotifyWebhookURL = getEnv("NOTIFY_WEBHOOK_URL", "")
+	// UnmappedNotifyThreshold is the number of affected users after which a new
+	// unmapped domain triggers a notification; 0 disables it
+	UnmappedNotifyThreshold = getEnvInt("UNMAPPED_NOTIFY_THRESHOLD", 0)
+
+	// AccessLogRetentionDays is how long raw access logs are kept; 0 keeps them forever
+	AccessLogRetentionDays = getEnvInt("ACCESS_LOG_RETENTION_DAYS", 0)
+	// AccessLogRetentionMode is what happens to expired logs: delete or rollup
+	// (fold them into daily aggregates first)
+	AccessLogRetentionMode = getEnv("ACCESS_LOG_RETENTION_MODE", "rollup")
+	// AccessLogPurgeIntervalMinutes is how often the retention job runs
+	AccessLogPurgeIntervalMinutes = getEnvInt("ACCESS_LOG_PURGE_INTERVAL_MINUTES", 1440)
+	// AccessLogIPMode controls how client IPs are stored: full, truncate or hash
+	AccessLogIPMode = getEnv("ACCESS_LOG_IP_MODE", "full")
+	// AccessLogIPSalt keys the IP hash so stored values cannot be reversed by
+	// hashing the whole address space
+	AccessLogIPSalt = getEnv("ACCESS_LOG_IP_SALT", "")
+	// AccessLogUserAgent stores the client user agent with each lookup
+	AccessLogUserAgent = getEnvBool("ACCESS_LOG_USER_AGENT", true)
+
+	// AccountDeletionGraceDays is how long a self-service deletion can be
+	// cancelled before the account is erased; 0 erases it immediately
+	AccountDeletionGraceDays = getEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 14)
+	// AccountErasureIntervalMinutes is how often due deletions are carried out
+	AccountErasureIntervalMinutes = getEnvInt("ACCOUNT_ERASURE_INTERVAL_MINUTES", 60)
+
+	// AppBaseURL is the frontend address used in links sent to users
+	AppBaseURL = getEnv("APP_BASE_URL", "http://localhost:3000")
+	// InvitationTTLHours is how long an invitation link stays valid
+	InvitationTTLHours = getEnvInt("INVITATION_TTL_HOURS", 168)
+	// RegistrationMode decides who may self-register: open, invite_only or
+	// mapped_domains (emails on a domain with an active mapping)
+	RegistrationMode = getEnv("REGISTRATION_MODE", "open")
+	// BlockDisposableEmails rejects signups from throwaway email providers
+	BlockDisposableEmails = getEnvBool("BLOCK_DISPOSABLE_EMAILS", true)
+	// DisposableDomainsFile lists extra disposable domains, one per line
+	DisposableDomainsFile = getEnv("DISPOSABLE_DOMAINS_FILE", "")
+
+	// MailDriver picks how email is sent: smtp, file or memory. When unset,
+	// smtp is used if SMTPHost is set and memory otherwise.
+	MailDriver = getEnv("MAIL_DRIVER", "")
+	// MailFrom is the sender of every email
+	MailFrom = getEnv("MAIL_FROM", "Drive Mapper <no-reply@localhost>")
+	// MailFileDir is where the file driver writes messages
+	MailFileDir = getEnv("MAIL_FILE_DIR", "mail")
+	// SMTP server settings for the smtp driver
+	SMTPHost     = getEnv("SMTP_HOST", "")
+	SMTPPort     = getEnvInt("SMTP_PORT", 587)
+	SMTPUsername = getEnv("SMTP_USERNAME", "")
+	SMTPPassword = getEnv("SMTP_PASSWORD", "")
+
+	// EmailVerificationRequired keeps domain-mapped folders from users who
+	// have not confirmed their email address
+	EmailVerificationRequired = getEnvBool("EMAIL_VERIFICATION_REQUIRED", true)
+	// EmailVerificationTTLHours is how long a verification link stays valid
+	EmailVerificationTTLHours = getEnvInt("EMAIL_VERIFICATION_TTL_HOURS", 48)
+	// PasswordResetTTLMinutes is how long a password reset link stays valid
+	PasswordResetTTLMinutes = getEnvInt("PASSWORD_RESET_TTL_MINUTES", 60)
+
+	// PasswordHashAlgorithm hashes new passwords: bcrypt or argon2id. Stored
+	// hashes made differently are replaced at the next login.
+	PasswordHashAlgorithm = getEnv("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	// BcryptCost is the bcrypt work factor
+	BcryptCost = getEnvInt("BCRYPT_COST", 10)
+	// Argon2 settings for the argon2id algorithm
+	Argon2MemoryKB    = getEnvInt("ARGON2_MEMORY_KB", 19456)
+	Argon2Iterations  = getEnvInt("ARGON2_ITERATIONS", 2)
+	Argon2Parallelism = getEnvInt("ARGON2_PARALLELISM", 1)
+	// PasswordMinLength is the shortest password accepted
+	PasswordMinLength = getEnvInt("PASSWORD_MIN_LENGTH", 8)
+	// PasswordMinClasses is how many of lowercase, uppercase, digits and
+	// symbols a password must mix; 0 turns the check off
+	PasswordMinClasses = getEnvInt("PASSWORD_MIN_CLASSES", 2)
+	// PasswordHistory is how many of a user's latest passwords, the current
+	// one included, cannot be chosen again; 0 turns the check off
+	PasswordHistory = getEnvInt("PASSWORD_HISTORY", 5)
+	// BlockBreachedPasswords rejects passwords found in known data breaches
+	BlockBreachedPasswords = getEnvBool("BLOCK_BREACHED_PASSWORDS", true)
+	// BreachedPasswordsDir holds a breached password hash list split by
+	// SHA-1 prefix, as written by the Have I Been Pwned downloader
+	BreachedPasswordsDir = getEnv("BREACHED_PASSWORDS_DIR", "")
+	// BreachedPasswordsAPI is the base address of a k-anonymity range API,
+	// such as https://api.pwnedpasswords.com/range; empty keeps the check offline
+	BreachedPasswordsAPI = getEnv("BREACHED_PASSWORDS_API", "")
+
+	// APIBaseURL is the public address of this server, where identity
+	// providers send users back after signing in
+	APIBaseURL = getEnv("API_BASE_URL", "http://localhost:8000")
+	// OIDCProvidersFile lists OpenID Connect providers as a JSON array
+	OIDCProvidersFile = getEnv("OIDC_PROVIDERS_FILE", "")
+	// Google sign-in, a shortcut for the most common OpenID Connect provider
+	GoogleClientID     = getEnv("GOOGLE_CLIENT_ID", "")
+	GoogleClientSecret = getEnv("GOOGLE_CLIENT_SECRET", "")
+	// GoogleHostedDomain limits Google sign-in to one Workspace domain
+	GoogleHostedDomain = getEnv("GOOGLE_HOSTED_DOMAIN", "")
+	// GoogleDomains lists, comma separated, the email domains Google sign-in
+	// serves; required without GOOGLE_HOSTED_DOMAIN
+	GoogleDomains = getEnv("GOOGLE_DOMAINS", "")
+	// GoogleCreateUsers creates accounts for new people signing in with Google
+	GoogleCreateUsers = getEnvBool("GOOGLE_CREATE_USERS", false)
+
+	// LDAPDirectoriesFile lists LDAP or Active Directory servers, each
+	// serving the email domains it names, as a JSON array
+	LDAPDirectoriesFile = getEnv("LDAP_DIRECTORIES_FILE", "")
+	// LDAPSyncIntervalMinutes is how often directory users are synced; 0 disables it
+	LDAPSyncIntervalMinutes = getEnvInt("LDAP_SYNC_INTERVAL_MINUTES", 60)
+	// LDAPSyncMaxDeactivations stops a sync that would disable more users
+	// than this, which usually means the directory settings are wrong
+	LDAPSyncMaxDeactivations = getEnvInt("LDAP_SYNC_MAX_DEACTIVATIONS", 25)
+
+	// SAMLCertFile and SAMLKeyFile are the PEM certificate and RSA key this
+	// server signs and decrypts SAML messages with. Without them a temporary
+	// pair is made at every start.
+	SAMLCertFile = getEnv("SAML_SP_CERT_FILE", "")
+	SAMLKeyFile  = getEnv("SAML_SP_KEY_FILE", "")
+
+	// SCIMAdminGroup is the SCIM group whose members are admins; every other
+	// group pushed over SCIM is a department
+	SCIMAdminGroup = getEnv("SCIM_ADMIN_GROUP", "Admins")
+
+	// MFAIssuer names the service in authenticator apps
+	MFAIssuer = getEnv("MFA_ISSUER", "Drive Mapper")
+	// MFARequiredRoles lists the roles that must enable two-factor
+	// authentication before using admin features, comma separated
+	MFARequiredRoles = getEnv("MFA_REQUIRED_ROLES", "admin")
+	// MFAEncryptionKey encrypts TOTP secrets at rest. The server refuses to
+	// start without it while two-factor authentication is required or in use.
+	MFAEncryptionKey = getEnv("MFA_ENCRYPTION_KEY", "")
+
+	// ThrottleStore keeps rate limits and failed logins: memory (per
+	// instance) or database (shared by every instance)
+	ThrottleStore = getEnv("THROTTLE_STORE", "memory")
+	// LoginBackoffAfter is the number of failed logins allowed before each
+	// further one doubles the wait, starting at one second
+	LoginBackoffAfter = getEnvInt("LOGIN_BACKOFF_AFTER", 3)
+	// LoginLockoutThreshold is the number of failed logins that locks an
+	// address out; 0 disables lockouts
+	LoginLockoutThreshold = getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10)
+	// LoginLockoutMinutes is how long a lockout lasts
+	LoginLockoutMinutes = getEnvInt("LOGIN_LOCKOUT_MINUTES", 15)
+	// LoginFailureWindowMinutes is how long failures are remembered without
+	// a new one
+	LoginFailureWindowMinutes = getEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 60)
+	// Requests allowed per client IP; 0 disables a limit
+	LoginRateLimitPerMinute       = getEnvInt("LOGIN_RATE_LIMIT_PER_MINUTE", 20)
+	RegisterRateLimitPerHour      = getEnvInt("REGISTER_RATE_LIMIT_PER_HOUR", 10)
+	PasswordResetRateLimitPerHour = getEnvInt("PASSWORD_RESET_RATE_LIMIT_PER_HOUR", 10)
+)
+
+// getEnv returns the environment variable or the fallback when it is unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return strings.TrimSpace(value)
+	}
+	return fallback
+}
+
+// getEnvBool parses a boolean environment variable
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvInt parses an integer environment variable
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/privacy"
+	"JWT-Authentication-go/utils"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// accessLogSorts are the columns access logs can be ordered by
+var accessLogSorts = map[string]utils.SortField{
+	"timestamp": {Column: "timestamp", Numeric: true},
+	"id":        {Column: "id", Numeric: true},
+	"user_id":   {Column: "user_id", Numeric: true},
+	"domain":    {Column: "domain"},
+}
+
+// GetAccessLogs returns a filtered, cursor paginated page of access logs (admin only)
+func GetAccessLogs(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetAccessLogs")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query, err := filterAccessLogs(c, database.DB.Model(&models.AccessLog{}))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := utils.ParsePage(c, accessLogSorts, "timestamp", true, 50, 500)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var logs []models.AccessLog
+	if err := page.Apply(query).Find(&logs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch access logs",
+		})
+	}
+
+	// The extra row only tells us there is another page
+	nextCursor := ""
+	if len(logs) > page.Limit {
+		logs = logs[:page.Limit]
+		last := logs[len(logs)-1]
+		nextCursor = utils.EncodeCursor(accessLogSortValue(last, page.Field.Column), last.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        logs,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// ExportAccessLogs streams every matching access log as CSV or NDJSON so
+// large ranges are never held in memory (admin only)
+func ExportAccessLogs(c *fiber.Ctx) error {
+	fmt.Println("Admin request - ExportAccessLogs")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	format := strings.ToLower(c.Query("format", "csv"))
+	if format != "csv" && format != "ndjson" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be csv or ndjson",
+		})
+	}
+
+	query, err := filterAccessLogs(c, database.DB.Model(&models.AccessLog{}))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	order := "ASC"
+	if strings.ToLower(c.Query("order")) == "desc" {
+		order = "DESC"
+	}
+
+	rows, err := query.Order("timestamp " + order + ", id " + order).Rows()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch access logs",
+		})
+	}
+
+	// Nothing from the fiber context may be used inside the stream writer,
+	// it is recycled once the handler returns
+	asCSV := format == "csv"
+	if asCSV {
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="access-logs.csv"`)
+	} else {
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="access-logs.ndjson"`)
+	}
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer rows.Close()
+
+		csvWriter := csv.NewWriter(w)
+		encoder := json.NewEncoder(w)
+		if asCSV {
+			csvWriter.Write([]string{"id", "user_id", "domain", "drive_url", "is_default", "mapping_type", "mapping_id", "timestamp", "ip_address", "user_agent"})
+		}
+
+		count := 0
+		for rows.Next() {
+			var log models.AccessLog
+			if err := query.ScanRows(rows, &log); err != nil {
+				fmt.Println("Error scanning access log during export:", err)
+				return
+			}
+
+			if asCSV {
+				csvWriter.Write([]string{
+					strconv.FormatUint(uint64(log.ID), 10),
+					strconv.FormatUint(uint64(log.UserID), 10),
+					log.Domain,
+					log.DriveURL,
+					strconv.FormatBool(log.IsDefault),
+					log.MappingType,
+					strconv.FormatUint(uint64(log.MappingID), 10),
+					strconv.FormatInt(log.Timestamp, 10),
+					log.IPAddress,
+					log.UserAgent,
+				})
+			} else {
+				encoder.Encode(log)
+			}
+
+			// Push rows to the client regularly instead of buffering the export
+			if count++; count%500 == 0 {
+				csvWriter.Flush()
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+
+		csvWriter.Flush()
+		w.Flush()
+	})
+
+	return nil
+}
+
+// filterAccessLogs applies the user_id, domain, from, to, is_default and ip filters
+func filterAccessLogs(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user_id %q", raw)
+		}
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if domain := c.Query("domain"); domain != "" {
+		query = query.Where("domain = ?", strings.ToLower(domain))
+	}
+
+	if raw := c.Query("from"); raw != "" {
+		from, err := utils.ParseTimeParam(raw)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("timestamp >= ?", from)
+	}
+
+	if raw := c.Query("to"); raw != "" {
+		to, err := utils.ParseTimeParam(raw)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("timestamp < ?", to)
+	}
+
+	if raw := c.Query("is_default"); raw != "" {
+		isDefault, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid is_default %q", raw)
+		}
+		query = query.Where("is_default = ?", isDefault)
+	}
+
+	// Match the stored form when IPs are truncated or hashed at write time
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip_address = ?", privacy.StoredIP(ip))
+	}
+
+	return query, nil
+}
+
+// accessLogSortValue returns the value of the sort column for a cursor
+func accessLogSortValue(log models.AccessLog, column string) interface{} {
+	switch column {
+	case "user_id":
+		return log.UserID
+	case "domain":
+		return log.Domain
+	case "id":
+		return log.ID
+	default:
+		return log.Timestamp
+	}
+}
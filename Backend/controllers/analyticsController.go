@@ -0,0 +1,374 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Time buckets are computed with integer arithmetic on the unix timestamp so
+// the same SQL works on MySQL, PostgreSQL and SQLite. Buckets are in UTC;
+// weeks start on Monday (the epoch was a Thursday, four days later).
+var bucketExpressions = map[string]string{
+	"day":  "timestamp - (timestamp % 86400)",
+	"week": "timestamp - ((timestamp - 345600) % 604800)",
+}
+
+// defaultAnalyticsRange is used when a request gives no from parameter
+const defaultAnalyticsRange = 30 * 24 * time.Hour
+
+// GetActiveUsers returns distinct users and lookups per day or week (admin only)
+func GetActiveUsers(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetActiveUsers")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	interval := c.Query("interval", "day")
+	bucket, ok := bucketExpressions[interval]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "interval must be day or week",
+		})
+	}
+
+	query, from, to, err := analyticsRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	rows := []struct {
+		Bucket      int64 `json:"bucket"`
+		ActiveUsers int64 `json:"active_users"`
+		Lookups     int64 `json:"lookups"`
+	}{}
+	err = query.
+		Select(bucket + " AS bucket, COUNT(DISTINCT user_id) AS active_users, COUNT(*) AS lookups").
+		Group("bucket").
+		Order("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute active users",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"interval": interval,
+		"from":     from,
+		"to":       to,
+		"data":     rows,
+	})
+}
+
+// GetLookupsByDomain returns lookup and user counts per email domain (admin only)
+func GetLookupsByDomain(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetLookupsByDomain")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query, from, to, err := analyticsRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	rows := []struct {
+		Domain   string `json:"domain"`
+		Lookups  int64  `json:"lookups"`
+		Users    int64  `json:"users"`
+		Defaults int64  `json:"default_lookups"`
+	}{}
+	err = query.
+		Select("domain, COUNT(*) AS lookups, COUNT(DISTINCT user_id) AS users, SUM(CASE WHEN is_default THEN 1 ELSE 0 END) AS defaults").
+		Group("domain").
+		Order("lookups DESC").
+		Limit(analyticsLimit(c)).
+		Scan(&rows).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute lookups per domain",
+		})
+	}
+
+	return c.JSON(fiber.Map{"from": from, "to": to, "data": rows})
+}
+
+// GetLookupsByMapping returns lookup and user counts per mapping (admin only)
+func GetLookupsByMapping(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetLookupsByMapping")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query, from, to, err := analyticsRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	rows := []struct {
+		MappingType string `json:"mapping_type"`
+		MappingID   uint   `json:"mapping_id"`
+		Lookups     int64  `json:"lookups"`
+		Users       int64  `json:"users"`
+		LastUsed    int64  `json:"last_used"`
+	}{}
+	err = query.
+		Select("mapping_type, mapping_id, COUNT(*) AS lookups, COUNT(DISTINCT user_id) AS users, MAX(timestamp) AS last_used").
+		Where("mapping_type <> ?", "").
+		Group("mapping_type, mapping_id").
+		Order("lookups DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute lookups per mapping",
+		})
+	}
+
+	// Name each mapping; active domain mappings that were never used are
+	// listed too since they are the candidates for clean-up
+	var mappings []models.DomainMapping
+	database.DB.Find(&mappings)
+	byID := map[uint]models.DomainMapping{}
+	for _, mapping := range mappings {
+		byID[mapping.ID] = mapping
+	}
+
+	used := map[uint]bool{}
+	data := make([]fiber.Map, 0, len(rows))
+	for _, row := range rows {
+		entry := fiber.Map{
+			"mapping_type": row.MappingType,
+			"mapping_id":   row.MappingID,
+			"lookups":      row.Lookups,
+			"users":        row.Users,
+			"last_used":    row.LastUsed,
+		}
+		if row.MappingType == "domain" {
+			used[row.MappingID] = true
+			if mapping, ok := byID[row.MappingID]; ok {
+				entry["domain"] = mapping.Domain
+				entry["drive_url"] = mapping.DriveURL
+			} else {
+				entry["deleted"] = true
+			}
+		}
+		data = append(data, entry)
+	}
+
+	unused := []fiber.Map{}
+	for _, mapping := range mappings {
+		if mapping.IsActive && !used[mapping.ID] {
+			unused = append(unused, fiber.Map{
+				"mapping_id": mapping.ID,
+				"domain":     mapping.Domain,
+				"drive_url":  mapping.DriveURL,
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{"from": from, "to": to, "data": data, "unused": unused})
+}
+
+// GetDefaultShare returns how many lookups fell through to the default mapping (admin only)
+func GetDefaultShare(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetDefaultShare")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query, from, to, err := analyticsRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var totals struct {
+		Total        int64
+		Defaults     int64
+		Users        int64
+		DefaultUsers int64
+	}
+	err = query.
+		Select("COUNT(*) AS total, " +
+			"COALESCE(SUM(CASE WHEN is_default THEN 1 ELSE 0 END), 0) AS defaults, " +
+			"COUNT(DISTINCT user_id) AS users, " +
+			"COUNT(DISTINCT CASE WHEN is_default THEN user_id END) AS default_users").
+		Scan(&totals).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute default share",
+		})
+	}
+
+	share := 0.0
+	if totals.Total > 0 {
+		share = float64(totals.Defaults) / float64(totals.Total)
+	}
+
+	return c.JSON(fiber.Map{
+		"from":            from,
+		"to":              to,
+		"lookups":         totals.Total,
+		"default_lookups": totals.Defaults,
+		"default_share":   share,
+		"users":           totals.Users,
+		"default_users":   totals.DefaultUsers,
+	})
+}
+
+// GetTopUnmappedDomains lists domains whose lookups fell to the default
+// mapping and that still have no active mapping (admin only)
+func GetTopUnmappedDomains(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetTopUnmappedDomains")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query, from, to, err := analyticsRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	mapped := database.DB.Model(&models.DomainMapping{}).Select("domain").Where("is_active = ?", true)
+
+	rows := []struct {
+		Domain   string `json:"domain"`
+		Lookups  int64  `json:"lookups"`
+		Users    int64  `json:"users"`
+		LastSeen int64  `json:"last_seen"`
+	}{}
+	err = query.
+		Select("domain, COUNT(*) AS lookups, COUNT(DISTINCT user_id) AS users, MAX(timestamp) AS last_seen").
+		Where("is_default = ?", true).
+		Where("domain NOT IN (?)", mapped).
+		Group("domain").
+		Order("users DESC, lookups DESC").
+		Limit(analyticsLimit(c)).
+		Scan(&rows).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute unmapped domains",
+		})
+	}
+
+	return c.JSON(fiber.Map{"from": from, "to": to, "data": rows})
+}
+
+// GetUserAccessSummary returns the first and last lookup of every user (admin only)
+func GetUserAccessSummary(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetUserAccessSummary")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	// First access is all-time, so this endpoint ignores the date range
+	// unless one is given explicitly
+	query := database.DB.Model(&models.AccessLog{})
+	if c.Query("from") != "" || c.Query("to") != "" {
+		var err error
+		if query, _, _, err = analyticsRange(c); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	rows := []struct {
+		UserID      uint   `json:"user_id"`
+		Name        string `json:"name"`
+		Email       string `json:"email"`
+		FirstAccess int64  `json:"first_access"`
+		LastAccess  int64  `json:"last_access"`
+		Lookups     int64  `json:"lookups"`
+	}{}
+	err := query.
+		Select("access_logs.user_id, users.name, users.email, MIN(access_logs.timestamp) AS first_access, MAX(access_logs.timestamp) AS last_access, COUNT(*) AS lookups").
+		Joins("LEFT JOIN users ON users.id = access_logs.user_id").
+		Group("access_logs.user_id, users.name, users.email").
+		Order("last_access DESC").
+		Limit(analyticsLimit(c)).
+		Scan(&rows).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to compute user access summary",
+		})
+	}
+
+	return c.JSON(fiber.Map{"data": rows})
+}
+
+// analyticsRange starts an access log query limited to the from/to range,
+// defaulting to the last 30 days
+func analyticsRange(c *fiber.Ctx) (*gorm.DB, int64, int64, error) {
+	// to is exclusive, so include lookups made in the current second
+	to := time.Now().Unix() + 1
+	from := to - int64(defaultAnalyticsRange.Seconds())
+
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := utils.ParseTimeParam(raw)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		from = parsed
+	}
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := utils.ParseTimeParam(raw)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		to = parsed
+	}
+
+	query := database.DB.Model(&models.AccessLog{}).
+		Where("access_logs.timestamp >= ? AND access_logs.timestamp < ?", from, to)
+	return query, from, to, nil
+}
+
+// analyticsLimit reads the limit parameter, defaulting to 100 rows
+func analyticsLimit(c *fiber.Ctx) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit < 1 || limit > 1000 {
+		return 100
+	}
+	return limit
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// auditEventSorts are the columns audit events can be ordered by
+var auditEventSorts = map[string]utils.SortField{
+	"id":         {Column: "id", Numeric: true},
+	"created_at": {Column: "created_at", Numeric: true},
+}
+
+// auditEntry is an audit event with its snapshots decoded for the response
+type auditEntry struct {
+	models.AuditEvent
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// GetAuditEvents returns a filtered, cursor paginated page of audit events (admin only)
+func GetAuditEvents(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetAuditEvents")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query := database.DB.Model(&models.AuditEvent{})
+
+	if raw := c.Query("actor_id"); raw != "" {
+		actorID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("invalid actor_id %q", raw),
+			})
+		}
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if requestID := c.Query("request_id"); requestID != "" {
+		query = query.Where("request_id = ?", requestID)
+	}
+	for param, condition := range map[string]string{"from": "created_at >= ?", "to": "created_at < ?"} {
+		if raw := c.Query(param); raw != "" {
+			value, err := utils.ParseTimeParam(raw)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			query = query.Where(condition, value)
+		}
+	}
+
+	page, err := utils.ParsePage(c, auditEventSorts, "id", true, 50, 500)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var events []models.AuditEvent
+	if err := page.Apply(query).Find(&events).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch audit events",
+		})
+	}
+
+	// The extra row only tells us there is another page
+	nextCursor := ""
+	if len(events) > page.Limit {
+		events = events[:page.Limit]
+		last := events[len(events)-1]
+		value := interface{}(last.ID)
+		if page.Field.Column == "created_at" {
+			value = last.CreatedAt
+		}
+		nextCursor = utils.EncodeCursor(value, last.ID)
+	}
+
+	entries := make([]auditEntry, 0, len(events))
+	for _, event := range events {
+		entries = append(entries, auditEntry{
+			AuditEvent: event,
+			Before:     rawSnapshot(event.Before),
+			After:      rawSnapshot(event.After),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        entries,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// VerifyAuditChain walks the audit hash chain and reports the first broken
+// link, if any (admin only)
+func VerifyAuditChain(c *fiber.Ctx) error {
+	fmt.Println("Admin request - VerifyAuditChain")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	result, err := audit.Verify(database.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify audit log",
+		})
+	}
+
+	if !result.Valid {
+		return c.Status(fiber.StatusConflict).JSON(result)
+	}
+	return c.JSON(result)
+}
+
+// rawSnapshot turns a stored snapshot into JSON, null when it is empty
+func rawSnapshot(snapshot string) json.RawMessage {
+	if snapshot == "" || !json.Valid([]byte(snapshot)) {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(snapshot)
+}
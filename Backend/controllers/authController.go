@@ -1,16 +1,26 @@
 package controllers
 
 import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/audit"
 	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/directory"
+	"JWT-Authentication-go/mfa"
 	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/sso"
+	"JWT-Authentication-go/throttle"
 	"JWT-Authentication-go/utils"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // No need for local secretKey, using utils.SecretKey instead
@@ -32,6 +42,19 @@ func Register(c *fiber.Ctx) error {
 
 	fmt.Println("User name: ", data["name"], "email", data["email"])
 
+	// Self-service signup may be closed or limited to some email domains
+	signup, err := policy.CheckRegistration(database.DB, data["email"])
+	if errors.Is(err, policy.ErrInvalidEmail) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Check if the email already exists
 	var existingUser models.User
 	if err := database.DB.Where("email = ?", data["email"]).First(&existingUser).Error; err == nil {
@@ -40,7 +63,13 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(data["password"]), bcrypt.DefaultCost)
+	if err := policy.CheckPassword(database.DB, models.User{Email: data["email"]}, data["password"]); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	hashedPassword, err := passwords.Hash(data["password"])
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to hash password",
@@ -57,15 +86,31 @@ func Register(c *fiber.Ctx) error {
 		CreatedAt:  time.Now().Unix(),
 		LastLogin:  time.Now().Unix(),
 	}
+
+	// The domain's registration rule may place the user
+	if signup.Department != "" {
+		user.Department = signup.Department
+	}
+	if signup.Role != "" {
+		user.Role = signup.Role
+	}
 	if err := database.DB.Create(&user).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
 	}
 
+	// The address has to be confirmed before it unlocks a domain folder
+	verificationSent := true
+	if err := accounts.SendVerification(database.DB, *user); err != nil {
+		fmt.Println("Error sending verification email:", err)
+		verificationSent = false
+	}
+
 	fmt.Println("User registered successfully")
 	return c.JSON(fiber.Map{
-		"message": "User registered successfully",
+		"message":           "User registered successfully",
+		"verification_sent": verificationSent,
 	})
 }
 
@@ -80,57 +125,136 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	fmt.Println("User email", data)
+	// Addresses with repeated failures wait, or are locked out
+	state, err := throttle.LoginStatus(data["email"])
+	if err != nil {
+		return loginUnavailable(c, err)
+	}
+	if state.Wait(time.Now()) > 0 {
+		return tooManyLoginAttempts(c, state)
+	}
+
+	// Domains with a SAML connection sign in at their identity provider
+	if connection, _ := sso.MatchSAMLConnection(database.DB, data["email"]); connection != nil {
+		return samlRequired(c, data["email"])
+	}
+
+	// Some domains sign in against their LDAP directory instead
+	if source := directory.ForEmail(data["email"]); source != nil {
+		return directoryLogin(c, source, data["email"], data["password"])
+	}
 
 	// Check if user exists
 	var user models.User
 	database.DB.Where("email = ?", data["email"]).First(&user)
 	if user.ID == 0 {
 		fmt.Println("User not found")
+		if err := recordLoginFailure(c, data["email"], user); err != nil {
+			return loginUnavailable(c, err)
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Invalid credentials",
 		})
 	}
 
 	// Compare passwords
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data["password"]))
-	if err != nil {
-		fmt.Println("Invalid Password:", err)
+	if !passwords.Verify(user.Password, data["password"]) {
+		fmt.Println("Invalid Password")
+		if err := recordLoginFailure(c, data["email"], user); err != nil {
+			return loginUnavailable(c, err)
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Invalid credentials",
 		})
 	}
 
-	// Update last login time
-	user.LastLogin = time.Now().Unix()
-	database.DB.Save(&user)
+	// Disabled accounts keep their data but cannot sign in
+	if !user.IsActive {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Account is disabled",
+		})
+	}
 
-	fmt.Println("Generating JWT token")
-	// Generate JWT token
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": strconv.Itoa(int(user.ID)),
-		"exp": time.Now().Add(time.Hour * 24).Unix(), // Expires in 24 hours
-	})
-	token, err := claims.SignedString([]byte(utils.SecretKey))
+	// Hashes made with an outdated algorithm or cost are upgraded
+	rehashPassword(&user, data["password"])
+
+	return passwordVerified(c, user)
+}
+
+// passwordVerified continues a login once the password is known to be
+// right: accounts with two-factor authentication finish with a code
+func passwordVerified(c *fiber.Ctx, user models.User) error {
+	if user.MFAEnabled {
+		token, challenge, err := accounts.NewMFAChallenge(database.DB, user)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to start two-factor authentication",
+			})
+		}
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":      "Two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    token,
+			"expires_at":   challenge.ExpiresAt,
+		})
+	}
+
+	return completeLogin(c, user)
+}
+
+// LoginMFA is the second login step: it exchanges the token from Login and
+// a code from the authenticator app, or a recovery code, for a session
+func LoginMFA(c *fiber.Ctx) error {
+	fmt.Println("Received a two-factor login")
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	user, method, err := accounts.CompleteMFAChallenge(database.DB, data["mfa_token"], data["code"])
+	if errors.Is(err, mfa.ErrInvalidCode) {
+		// Wrong codes count against the address like wrong passwords
+		if err := recordLoginFailure(c, user.Email, user); err != nil {
+			return loginUnavailable(c, err)
+		}
+	}
+	if errors.Is(err, accounts.ErrChallengeExpired) || errors.Is(err, accounts.ErrChallengeInvalid) || errors.Is(err, mfa.ErrInvalidCode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
-		fmt.Println("Error generating token:", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate token",
+			"error": "Failed to verify authentication code",
 		})
 	}
 
-	fmt.Println("Setting cookie")
+	// A lockout that began since the password step still applies
+	state, err := throttle.LoginStatus(user.Email)
+	if err != nil {
+		return loginUnavailable(c, err)
+	}
+	if state.Locked(time.Now()) {
+		return tooManyLoginAttempts(c, state)
+	}
 
-	// Set JWT token in cookie
-	cookie := fiber.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Expires:  time.Now().Add(time.Hour * 24), // Expires in 24 hours
-		HTTPOnly: true,
-		SameSite: "Lax",
-		Path:     "/",
+	if method == mfa.MethodRecovery {
+		fmt.Println("User signed in with a recovery code:", user.ID)
+	}
+	return completeLogin(c, user)
+}
+
+// completeLogin starts a session for a user who passed every login check
+func completeLogin(c *fiber.Ctx, user models.User) error {
+	if err := startSession(c, &user); err != nil {
+		fmt.Println("Error generating token:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
 	}
-	c.Cookie(&cookie)
 
 	fmt.Println("Authentication successful, returning")
 	// Authentication successful, return success response with user info
@@ -142,6 +266,119 @@ func Login(c *fiber.Ctx) error {
 			"email": user.Email,
 			"role":  user.Role,
 		},
+		"must_change_password": user.MustChangePassword,
+		"email_verified":       user.EmailVerifiedAt != 0,
+		"mfa_setup_required":   mfa.Required(user.Role) && !user.MFAEnabled,
+	})
+}
+
+// startSession records the login of an authenticated user and sets the
+// session cookie
+func startSession(c *fiber.Ctx, user *models.User) error {
+	throttle.ResetLogin(user.Email)
+
+	// Update last login time
+	user.LastLogin = time.Now().Unix()
+	database.DB.Save(user)
+
+	fmt.Println("Generating JWT token")
+	// Generate JWT token for a new session
+	token, session, err := utils.NewSession(c, *user)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Setting cookie")
+
+	// Set JWT token in cookie
+	setSessionCookie(c, token, session)
+	return nil
+}
+
+// recordLoginFailure counts a failed login for the address and audits the
+// lockout it may start. user is empty when no account has the address. An
+// error means the failure was not counted.
+func recordLoginFailure(c *fiber.Ctx, email string, user models.User) error {
+	state, locked, err := throttle.RecordLoginFailure(email)
+	if err != nil || !locked {
+		return err
+	}
+
+	fmt.Println("Login locked out after repeated failures:", email)
+	if user.ID != 0 {
+		err := audit.Record(database.DB, c, "user.lockout", "user", user.ID, nil, fiber.Map{
+			"locked_until": state.LockedUntil,
+		})
+		if err != nil {
+			fmt.Println("Error recording lockout in audit log:", err)
+		}
+	}
+	return nil
+}
+
+// loginUnavailable refuses a login when failed logins cannot be read or
+// counted, rather than letting attempts through unthrottled
+func loginUnavailable(c *fiber.Ctx, err error) error {
+	fmt.Println("Error tracking failed logins:", err)
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"error": "Sign-in is temporarily unavailable, please try again later",
+	})
+}
+
+// tooManyLoginAttempts refuses a login while the address has to wait
+func tooManyLoginAttempts(c *fiber.Ctx, state throttle.LoginState) error {
+	wait := state.Wait(time.Now())
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())))
+
+	message := "Too many failed login attempts, please try again later"
+	if state.Locked(time.Now()) {
+		message = "Account temporarily locked after too many failed login attempts"
+	}
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       message,
+		"retry_after": int(wait.Seconds()),
+	})
+}
+
+// passwordChangeRoutes stay open to a user who must replace a temporary
+// password: seeing who they are, signing out and changing it
+var passwordChangeRoutes = map[string]bool{
+	fiber.MethodGet + " /api/user":         true,
+	fiber.MethodPost + " /api/logout":      true,
+	fiber.MethodPut + " /api/user/profile": true,
+}
+
+// RequirePasswordChange refuses everything else to a signed-in user who was
+// given a temporary password until they have replaced it
+func RequirePasswordChange(c *fiber.Ctx) error {
+	userID := utils.GetUserIdFromToken(c)
+	if userID == 0 || passwordChangeRoutes[c.Method()+" "+c.Path()] {
+		return c.Next()
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "must_change_password").First(&user, userID).Error; err != nil {
+		return c.Next()
+	}
+
+	if user.MustChangePassword {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":                "You must change your temporary password first",
+			"must_change_password": true,
+		})
+	}
+	return c.Next()
+}
+
+// setSessionCookie hands the session token to the browser
+func setSessionCookie(c *fiber.Ctx, token string, session models.Session) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    token,
+		Expires:  time.Unix(session.ExpiresAt, 0), // Expires in 24 hours
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Path:     "/",
 	})
 }
 
@@ -151,9 +388,7 @@ func UpdateProfile(c *fiber.Ctx) error {
 
 	// Get current user from JWT
 	cookie := c.Cookies("jwt")
-	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(utils.SecretKey), nil
-	})
+	claims, err := utils.ParseToken(cookie)
 
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -161,7 +396,6 @@ func UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	claims := token.Claims.(*jwt.MapClaims)
 	id, _ := strconv.Atoi((*claims)["sub"].(string))
 
 	// Parse request body
@@ -201,24 +435,57 @@ func UpdateProfile(c *fiber.Ctx) error {
 	}
 
 	// Update password if provided
+	var previousPassword []byte
 	if data["password"] != "" && data["password_confirm"] != "" {
 		if data["password"] != data["password_confirm"] {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Passwords do not match",
 			})
 		}
+		if directory.ForEmail(user.Email) != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Your password is managed by your organization's directory",
+			})
+		}
+		// A session left open is not enough to take over the account
+		if data["current_password"] == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Current password is required",
+			})
+		}
+		if !passwords.Verify(user.Password, data["current_password"]) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Current password is incorrect",
+			})
+		}
+		if err := policy.CheckPassword(database.DB, user, data["password"]); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(data["password"]), bcrypt.DefaultCost)
+		hashedPassword, err := passwords.Hash(data["password"])
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to hash password",
 			})
 		}
+		previousPassword = user.Password
 		user.Password = hashedPassword
+		user.MustChangePassword = false
 	}
 
-	// Save updated user
-	if err := database.DB.Save(&user).Error; err != nil {
+	// Save updated user, remembering the password it replaces
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if previousPassword == nil {
+			return nil
+		}
+		return policy.RememberPassword(tx, user.ID, previousPassword)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update user",
 		})
@@ -240,12 +507,76 @@ func GetAllUsers(c *fiber.Ctx) error {
 		})
 	}
 
-	var users []models.User
-	database.DB.Find(&users)
+	query := filterSearch(c, database.DB.Model(&models.User{}), "name", "email")
+	query = filterEqual(c, query, map[string]string{"role": "role", "department": "department"})
+	query, err := filterBool(c, query, "active", "is_active")
+	if err == nil {
+		query, err = filterTimeRange(c, query, "created", "created_at")
+	}
+	if err == nil {
+		query, err = filterTimeRange(c, query, "last_login", "last_login")
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := utils.ParsePage(c, userSorts, "id", false, 100, 500)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Count and fetch from the same filters without one affecting the other
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count users",
+		})
+	}
+
+	users := []models.User{}
+	if err := page.Apply(query).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch users",
+		})
+	}
+
+	// The extra row only tells us there is another page
+	nextCursor := ""
+	if len(users) > page.Limit {
+		users = users[:page.Limit]
+		last := users[len(users)-1]
+		nextCursor = utils.EncodeCursor(userSortValue(last, page.Field.Column), last.ID)
+	}
+	utils.SetListHeaders(c, total, nextCursor)
 
 	return c.JSON(users)
 }
 
+// userSortValue returns the value of the sort column for a cursor
+func userSortValue(user models.User, column string) interface{} {
+	switch column {
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	case "role":
+		return user.Role
+	case "department":
+		return user.Department
+	case "created_at":
+		return user.CreatedAt
+	case "last_login":
+		return user.LastLogin
+	default:
+		return user.ID
+	}
+}
+
 func User(c *fiber.Ctx) error {
 	fmt.Println("Request to get user...")
 
@@ -253,9 +584,7 @@ func User(c *fiber.Ctx) error {
 	cookie := c.Cookies("jwt")
 
 	// Parse JWT token with claims
-	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(utils.SecretKey), nil
-	})
+	claims, err := utils.ParseToken(cookie)
 
 	// Handle token parsing errors
 	if err != nil {
@@ -264,14 +593,6 @@ func User(c *fiber.Ctx) error {
 		})
 	}
 
-	// Extract claims from token
-	claims, ok := token.Claims.(*jwt.MapClaims)
-	if !ok {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to parse claims",
-		})
-	}
-
 	// Extract user ID from claims
 	userID := utils.GetUintFromClaims(claims, "sub")
 	var user models.User
@@ -292,6 +613,9 @@ func User(c *fiber.Ctx) error {
 func Logout(c *fiber.Ctx) error {
 	fmt.Println("Received a logout request")
 
+	// End the session so the token cannot be reused
+	utils.RevokeSession(c.Cookies("jwt"))
+
 	// Clear JWT token by setting an empty value and expired time in the cookie
 	cookie := fiber.Cookie{
 		Name:     "jwt",
@@ -333,9 +657,17 @@ func UpdateUserRole(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update the user role
+	// Update the user role and record the change
+	previousRole := user.Role
 	user.Role = data["role"]
-	if err := database.DB.Save(&user).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "user.role_update", "user", user.ID,
+			fiber.Map{"role": previousRole}, fiber.Map{"role": user.Role})
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update user role",
 		})
@@ -366,9 +698,7 @@ func DebugAuth(c *fiber.Ctx) error {
 	}
 
 	// Try to parse the token
-	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(utils.SecretKey), nil
-	})
+	claims, err := utils.ParseToken(cookie)
 
 	if err != nil {
 		return c.JSON(fiber.Map{
@@ -377,15 +707,6 @@ func DebugAuth(c *fiber.Ctx) error {
 		})
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(*jwt.MapClaims)
-	if !ok {
-		return c.JSON(fiber.Map{
-			"status":  "invalid_claims",
-			"message": "Failed to parse claims",
-		})
-	}
-
 	// Get user ID
 	userID := utils.GetUintFromClaims(claims, "sub")
 
@@ -410,8 +731,50 @@ func DebugAuth(c *fiber.Ctx) error {
 	})
 }
 
-// CreateAdmin creates a new admin user (for testing purposes)
+// rehashPassword replaces the stored hash of a user who just proved their
+// password when it was made with an outdated algorithm or cost
+func rehashPassword(user *models.User, password string) {
+	if !passwords.NeedsRehash(user.Password) {
+		return
+	}
+	hashed, err := passwords.Hash(password)
+	if err != nil {
+		fmt.Println("Error rehashing password:", err)
+		return
+	}
+	// Leave it alone if the password changed in the meantime
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashed)
+	if result.Error == nil && result.RowsAffected == 1 {
+		user.Password = hashed
+	}
+}
+
+// createAdminMu keeps concurrent first-admin requests on this instance from
+// both finding no admin
+var createAdminMu sync.Mutex
+
+// errAdminExists stops a transaction that found an admin it did not expect
+var errAdminExists = errors.New("an admin already exists")
+
+// CreateAdmin creates a new admin user. Anyone may create the first admin
+// of a fresh install; after that it takes an admin.
 func CreateAdmin(c *fiber.Ctx) error {
+	fmt.Println("Received a CreateAdmin request")
+
+	var admins int64
+	if err := database.DB.Model(&models.User{}).Where("role = ?", "admin").Count(&admins).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check for admins",
+		})
+	}
+	if admins > 0 && !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
 	// Parse request
 	var data map[string]string
 	if err := c.BodyParser(&data); err != nil {
@@ -427,17 +790,14 @@ func CreateAdmin(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user already exists
-	var user models.User
-	database.DB.Where("email = ?", data["email"]).First(&user)
-	if user.ID != 0 {
+	if err := policy.CheckPassword(database.DB, models.User{Email: data["email"]}, data["password"]); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Email already exists",
+			"error": err.Error(),
 		})
 	}
 
 	// Hash password
-	password, err := bcrypt.GenerateFromPassword([]byte(data["password"]), 14)
+	password, err := passwords.Hash(data["password"])
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to hash password",
@@ -445,12 +805,13 @@ func CreateAdmin(c *fiber.Ctx) error {
 	}
 
 	// Create new admin user
-	user = models.User{
-		Name:      data["name"],
-		Email:     data["email"],
-		Password:  password,
-		Role:      "admin",
-		CreatedAt: time.Now().Unix(),
+	user := models.User{
+		Name:            data["name"],
+		Email:           data["email"],
+		Password:        password,
+		Role:            "admin",
+		CreatedAt:       time.Now().Unix(),
+		EmailVerifiedAt: time.Now().Unix(),
 	}
 
 	// Add department if provided
@@ -458,7 +819,52 @@ func CreateAdmin(c *fiber.Ctx) error {
 		user.Department = data["department"]
 	}
 
-	database.DB.Create(&user)
+	// Count the admins again and create the user in one transaction. The
+	// locking read makes a concurrent request on another instance wait for
+	// this one to commit, so two callers cannot both create the first admin.
+	createAdminMu.Lock()
+	defer createAdminMu.Unlock()
+
+	emailTaken := false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Model(&models.User{}).Where("role = ?", "admin").Count(&admins).Error
+		if err != nil {
+			return err
+		}
+		if admins > 0 && !utils.IsAdmin(c) {
+			return errAdminExists
+		}
+
+		var existing int64
+		if err := tx.Model(&models.User{}).Where("email = ?", user.Email).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			emailTaken = true
+			return nil
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "user.create_admin", "user", user.ID, nil, user)
+	})
+	switch {
+	case errors.Is(err, errAdminExists):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create admin user",
+		})
+	case emailTaken:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email already exists",
+		})
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Admin user created successfully",
@@ -477,9 +883,7 @@ func DebugAdmin(c *fiber.Ctx) error {
 		})
 	}
 
-	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(utils.SecretKey), nil
-	})
+	claims, err := utils.ParseToken(cookie)
 
 	if err != nil {
 		return c.JSON(fiber.Map{
@@ -490,7 +894,6 @@ func DebugAdmin(c *fiber.Ctx) error {
 		})
 	}
 
-	claims := token.Claims.(*jwt.MapClaims)
 	userID := utils.GetUintFromClaims(claims, "sub")
 
 	var user models.User
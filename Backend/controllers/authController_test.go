@@ -0,0 +1,201 @@
+package controllers_test
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/throttle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendJSON sends a JSON body with cookies to the app
+func sendJSON(t *testing.T, app *fiber.App, method, path string, body interface{}, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(method, path, strings.NewReader(string(encoded)))
+	request.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	response, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// signIn gives user a password and logs in with it
+func signIn(t *testing.T, app *fiber.App, user models.User, password string) *http.Cookie {
+	t.Helper()
+
+	hash, err := passwords.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&user).Update("password", hash)
+
+	login := sendJSON(t, app, http.MethodPost, "/api/login",
+		map[string]string{"email": user.Email, "password": password})
+	session := responseCookie(login, "jwt")
+	if login.StatusCode != http.StatusAccepted || session == nil {
+		t.Fatalf("login status = %d, want a session", login.StatusCode)
+	}
+	return session
+}
+
+// signInAdmin creates an admin and logs in. Two-factor authentication is
+// not required of admins for the rest of the test.
+func signInAdmin(t *testing.T, app *fiber.App) *http.Cookie {
+	t.Helper()
+
+	required := config.MFARequiredRoles
+	config.MFARequiredRoles = ""
+	t.Cleanup(func() { config.MFARequiredRoles = required })
+
+	admin := createUser(t, "admin@example.com")
+	database.DB.Model(&admin).Update("role", "admin")
+	return signIn(t, app, admin, "Admin-Passphrase-5183")
+}
+
+func TestTemporaryPasswordMustBeChanged(t *testing.T) {
+	app := newTestApp(t)
+	user := createUser(t, "ada@example.com")
+	database.DB.Model(&user).Update("must_change_password", true)
+	session := signIn(t, app, user, "Temporary-Pass-4821")
+
+	if status := get(t, app, "/api/user/drive", session).StatusCode; status != http.StatusForbidden {
+		t.Errorf("drive lookup status = %d, want 403 before the change", status)
+	}
+	if status := get(t, app, "/api/user", session).StatusCode; status != http.StatusOK {
+		t.Errorf("user status = %d, want 200", status)
+	}
+
+	change := sendJSON(t, app, http.MethodPut, "/api/user/profile", map[string]string{
+		"current_password": "Temporary-Pass-4821",
+		"password":         "Chosen-Passphrase-7390",
+		"password_confirm": "Chosen-Passphrase-7390",
+	}, session)
+	if change.StatusCode != http.StatusOK {
+		t.Fatalf("password change status = %d, want 200", change.StatusCode)
+	}
+
+	if status := get(t, app, "/api/user/mfa", session).StatusCode; status == http.StatusForbidden {
+		t.Error("still refused after changing the password")
+	}
+}
+
+func TestCreateAdmin(t *testing.T) {
+	app := newTestApp(t)
+	body := func(email string) map[string]string {
+		return map[string]string{"name": "Admin", "email": email, "password": "Admin-Passphrase-5183"}
+	}
+
+	// Concurrent requests on a fresh install create a single first admin
+	statuses := make(chan int, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			request := httptest.NewRequest(http.MethodPost, "/api/create-admin",
+				strings.NewReader(fmt.Sprintf(`{"name":"Admin","email":"admin%d@example.com","password":"Admin-Passphrase-5183"}`, i)))
+			request.Header.Set("Content-Type", "application/json")
+			response, err := app.Test(request, -1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses <- response.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		if status == http.StatusCreated {
+			created++
+		} else if status != http.StatusForbidden {
+			t.Errorf("concurrent create status = %d, want 201 or 403", status)
+		}
+	}
+	var admins int64
+	database.DB.Model(&models.User{}).Where("role = ?", "admin").Count(&admins)
+	if created != 1 || admins != 1 {
+		t.Fatalf("%d requests succeeded and %d admins exist, want 1", created, admins)
+	}
+
+	if status := sendJSON(t, app, http.MethodPost, "/api/create-admin", body("late@example.com")).StatusCode; status != http.StatusForbidden {
+		t.Errorf("anonymous create status = %d, want 403 once an admin exists", status)
+	}
+
+	// An admin still needs two-factor authentication to add another
+	var first models.User
+	database.DB.Where("role = ?", "admin").First(&first)
+	session := signIn(t, app, first, "Admin-Passphrase-5183")
+	response := sendJSON(t, app, http.MethodPost, "/api/create-admin", body("second@example.com"), session)
+	var refused struct {
+		MFASetupRequired bool `json:"mfa_setup_required"`
+	}
+	json.NewDecoder(response.Body).Decode(&refused)
+	if response.StatusCode != http.StatusForbidden || !refused.MFASetupRequired {
+		t.Errorf("admin without 2FA status = %d %+v, want 403 asking for 2FA", response.StatusCode, refused)
+	}
+
+	required := config.MFARequiredRoles
+	config.MFARequiredRoles = ""
+	t.Cleanup(func() { config.MFARequiredRoles = required })
+	if status := sendJSON(t, app, http.MethodPost, "/api/create-admin", body("second@example.com"), session).StatusCode; status != http.StatusCreated {
+		t.Errorf("admin create status = %d, want 201", status)
+	}
+	if status := sendJSON(t, app, http.MethodPost, "/api/create-admin", body("second@example.com"), session).StatusCode; status != http.StatusBadRequest {
+		t.Errorf("duplicate email status = %d, want 400", status)
+	}
+}
+
+// brokenLoginStore keeps rate limit counters but cannot hold failed logins
+type brokenLoginStore struct{ *throttle.Memory }
+
+func (s brokenLoginStore) Get(key string) ([]byte, error) {
+	if strings.HasPrefix(key, "login:") {
+		return nil, errors.New("store unavailable")
+	}
+	return s.Memory.Get(key)
+}
+
+func (s brokenLoginStore) Update(key string, fn func(value []byte) ([]byte, time.Duration)) error {
+	if strings.HasPrefix(key, "login:") {
+		return errors.New("store unavailable")
+	}
+	return s.Memory.Update(key, fn)
+}
+
+func TestLoginFailsClosedWithoutFailureTracking(t *testing.T) {
+	app := newTestApp(t)
+	user := createUser(t, "ada@example.com")
+	signIn(t, app, user, "Chosen-Passphrase-7390")
+
+	throttle.Store = brokenLoginStore{throttle.NewMemory()}
+	for _, password := range []string{"Chosen-Passphrase-7390", "wrong"} {
+		response := sendJSON(t, app, http.MethodPost, "/api/login",
+			map[string]string{"email": user.Email, "password": password})
+		if response.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("login with %q status = %d, want 503", password, response.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/directory"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// directoryLogin checks a login against the LDAP directory that serves the
+// email address. The directory decides the password, role and department.
+func directoryLogin(c *fiber.Ctx, source *directory.Directory, email, password string) error {
+	identity, err := source.Authenticate(email, password)
+	if errors.Is(err, directory.ErrInvalidCredentials) {
+		var user models.User
+		database.DB.Where("email = ?", email).First(&user)
+		if err := recordLoginFailure(c, email, user); err != nil {
+			return loginUnavailable(c, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Invalid credentials",
+		})
+	}
+	if err != nil {
+		fmt.Println("Directory login failed:", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "The directory is not reachable, please try again later",
+		})
+	}
+
+	user, err := accounts.SignInExternal(database.DB, c, identity, source.CreateUsers)
+	if errors.Is(err, accounts.ErrAccountDisabled) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Account is disabled",
+		})
+	}
+	if errors.Is(err, accounts.ErrExternalNoAccount) || errors.Is(err, accounts.ErrExternalDomainBlocked) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		fmt.Println("Error signing in directory user:", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sign in",
+		})
+	}
+
+	return passwordVerified(c, user)
+}
+
+// GetDirectories lists the LDAP directories, without their credentials, and
+// recent sync runs (admin only)
+func GetDirectories(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetDirectories")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	directories := []fiber.Map{}
+	for _, source := range directory.All() {
+		directories = append(directories, fiber.Map{
+			"name":           source.Name,
+			"url":            source.URL,
+			"base_dn":        source.BaseDN,
+			"domains":        source.Domains,
+			"group_mappings": source.GroupMappings,
+			"default_role":   source.DefaultRole,
+			"create_users":   source.CreateUsers,
+		})
+	}
+
+	runs := []models.DirectorySyncRun{}
+	if err := database.DB.Order("id DESC").Limit(20).Find(&runs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch directory sync runs",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"directories":           directories,
+		"sync_interval_minutes": config.LDAPSyncIntervalMinutes,
+		"max_deactivations":     config.LDAPSyncMaxDeactivations,
+		"runs":                  runs,
+	})
+}
+
+// SyncDirectory syncs the users of a directory now instead of waiting for
+// the scheduled job (admin only)
+func SyncDirectory(c *fiber.Ctx) error {
+	fmt.Println("Admin request - SyncDirectory")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	source := directory.Find(c.Params("name"))
+	if source == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Directory not found",
+		})
+	}
+
+	run := source.Sync(database.DB)
+	if err := audit.Record(database.DB, c, "directory.sync", "directory_sync_run", run.ID, nil, run); err != nil {
+		fmt.Println("Error recording directory sync in audit log:", err)
+	}
+
+	if run.Error != "" {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Directory sync failed: " + run.Error,
+			"run":   run,
+		})
+	}
+	return c.JSON(run)
+}
+
+// verifyPassword confirms a signed-in user's password. Users of a directory
+// have no local password, so the directory checks theirs.
+func verifyPassword(user models.User, password string) bool {
+	if source := directory.ForEmail(user.Email); source != nil {
+		_, err := source.Authenticate(user.Email, password)
+		if err != nil && !errors.Is(err, directory.ErrInvalidCredentials) {
+			fmt.Println("Directory password check failed:", err)
+		}
+		return err == nil
+	}
+	return passwords.Verify(user.Password, password)
+}
@@ -1,15 +1,21 @@
 package controllers
 
 import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
 	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/mappings"
 	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/privacy"
+	"JWT-Authentication-go/providers"
 	"JWT-Authentication-go/utils"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // GetDomainMappings returns all domain mappings (admin only)
@@ -21,16 +27,93 @@ func GetDomainMappings(c *fiber.Ctx) error {
 		})
 	}
 
-	var mappings []models.DomainMapping
-	if err := database.DB.Find(&mappings).Error; err != nil {
+	query := filterSearch(c, database.DB.Model(&models.DomainMapping{}), "domain", "description")
+	query = filterEqual(c, query, map[string]string{
+		"provider":      "provider",
+		"managed_by":    "managed_by",
+		"health_status": "health_status",
+	})
+	query, err := filterBool(c, query, "active", "is_active")
+	if err == nil {
+		query, err = filterTimeRange(c, query, "created", "created_at")
+	}
+	if err == nil {
+		query, err = filterTimeRange(c, query, "updated", "updated_at")
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := utils.ParsePage(c, domainMappingSorts, "id", false, 100, 500)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Count and fetch from the same filters without one affecting the other
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count domain mappings",
+		})
+	}
+
+	mappings := []models.DomainMapping{}
+	if err := page.Apply(query).Find(&mappings).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch domain mappings",
 		})
 	}
 
+	// The extra row only tells us there is another page
+	nextCursor := ""
+	if len(mappings) > page.Limit {
+		mappings = mappings[:page.Limit]
+		last := mappings[len(mappings)-1]
+		nextCursor = utils.EncodeCursor(domainMappingSortValue(last, page.Field.Column), last.ID)
+	}
+	utils.SetListHeaders(c, total, nextCursor)
+
 	return c.JSON(mappings)
 }
 
+// domainMappingSortValue returns the value of the sort column for a cursor
+func domainMappingSortValue(mapping models.DomainMapping, column string) interface{} {
+	switch column {
+	case "domain":
+		return mapping.Domain
+	case "provider":
+		return mapping.Provider
+	case "health_status":
+		return mapping.HealthStatus
+	case "created_at":
+		return mapping.CreatedAt
+	case "updated_at":
+		return mapping.UpdatedAt
+	default:
+		return mapping.ID
+	}
+}
+
+// GetProviders lists the storage providers a mapping can point at (admin only)
+func GetProviders(c *fiber.Ctx) error {
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized access",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"providers": providers.Names(),
+		"default":   providers.Default,
+	})
+}
+
 // GetDefaultMapping returns the default folder mapping
 func GetDefaultMapping(c *fiber.Ctx) error {
 	// Check if user is admin
@@ -73,34 +156,66 @@ func CreateDomainMapping(c *fiber.Ctx) error {
 	// Log the parsed data
 	fmt.Printf("Parsed data: %+v\n", data)
 
-	// Validate required fields
-	if data["domain"] == nil || data["drive_url"] == nil {
+	// Validate required fields. The domain is stored the way user lookups
+	// compare it.
+	domain, _ := data["domain"].(string)
+	domain = mappings.NormalizeDomain(domain)
+	driveURL, _ := data["drive_url"].(string)
+	if domain == "" || driveURL == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Domain and Drive URL are required",
 		})
 	}
 
+	// Validate the link with its storage provider and keep the folder ID
+	provider, _ := data["provider"].(string)
+	resource, err := providers.Parse(provider, driveURL)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := drive.VerifyFolder(resource.Provider, resource.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Get current user ID
 	userId := utils.GetUserIdFromToken(c)
 	currentTime := time.Now().Unix()
+	description, _ := data["description"].(string)
 
 	// Create the domain mapping
 	mapping := models.DomainMapping{
-		Domain:      data["domain"].(string),
-		DriveURL:    data["drive_url"].(string),
-		Description: data["description"].(string),
+		Domain:      domain,
+		Provider:    resource.Provider,
+		DriveURL:    strings.TrimSpace(driveURL),
+		FolderID:    resource.ID,
+		Description: description,
 		IsActive:    true,
 		CreatedAt:   currentTime,
 		UpdatedAt:   currentTime,
 		CreatedBy:   userId,
+		ManagedBy:   models.ManagedByUI,
 	}
 
-	if err := database.DB.Create(&mapping).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&mapping).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "domain_mapping.create", "domain_mapping", mapping.ID, nil, mapping)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create domain mapping",
 		})
 	}
 
+	// Close the matching entry in the unmapped domain inbox
+	mappings.MarkDomainMapped(database.DB, mapping, userId)
+
 	return c.JSON(mapping)
 }
 
@@ -147,23 +262,61 @@ func UpdateDomainMapping(c *fiber.Ctx) error {
 	}
 
 	// Update fields
-	if data["domain"] != nil && data["domain"] != "" {
-		mapping.Domain = normalizeDomain(data["domain"].(string))
-	}
-	if data["drive_url"] != nil && data["drive_url"] != "" {
-		mapping.DriveURL = data["drive_url"].(string)
+	before := mapping
+	previousFolder := mapping.FolderID
+	rawDomain, _ := data["domain"].(string)
+	if domain := mappings.NormalizeDomain(rawDomain); domain != "" {
+		mapping.Domain = domain
+	}
+	newProvider, _ := data["provider"].(string)
+	newURL, _ := data["drive_url"].(string)
+	if newProvider != "" || newURL != "" {
+		// Either the link or the provider changed, so validate the pair again
+		if newProvider != "" {
+			mapping.Provider = newProvider
+		}
+		if newURL != "" {
+			mapping.DriveURL = strings.TrimSpace(newURL)
+		}
+
+		resource, err := providers.Parse(mapping.Provider, mapping.DriveURL)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err := drive.VerifyFolder(resource.Provider, resource.ID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if resource.ID != mapping.FolderID {
+			// A new folder has not been checked yet
+			mapping.LinkHealth = models.LinkHealth{HealthStatus: models.HealthUnknown}
+		}
+		mapping.Provider = resource.Provider
+		mapping.FolderID = resource.ID
 	}
-	if data["description"] != nil {
-		mapping.Description = data["description"].(string)
+	if description, ok := data["description"].(string); ok {
+		mapping.Description = description
 	}
 
-	// Update timestamp and save
+	// Update timestamp and save. Editing in the panel takes the mapping
+	// away from the mappings file.
 	mapping.UpdatedAt = time.Now().Unix()
+	mapping.ManagedBy = models.ManagedByUI
 
-	result := database.DB.Save(&mapping)
-	if result.Error != nil {
+	var result *gorm.DB
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result = tx.Save(&mapping)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return audit.Record(tx, c, "domain_mapping.update", "domain_mapping", mapping.ID, before, mapping)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update domain mapping: " + result.Error.Error(),
+			"error": "Failed to update domain mapping: " + err.Error(),
 		})
 	}
 
@@ -174,6 +327,11 @@ func UpdateDomainMapping(c *fiber.Ctx) error {
 		})
 	}
 
+	// Users of the old folder lose the access granted through this mapping
+	if mapping.FolderID != previousFolder {
+		revokeMappingDriveGrants("domain", mapping.ID)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(mapping)
 }
 
@@ -205,10 +363,17 @@ func DeleteDomainMapping(c *fiber.Ctx) error {
 	}
 
 	// Delete the mapping
-	result := database.DB.Delete(&mapping)
-	if result.Error != nil {
+	var result *gorm.DB
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result = tx.Delete(&mapping)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return audit.Record(tx, c, "domain_mapping.delete", "domain_mapping", mapping.ID, mapping, nil)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete domain mapping: " + result.Error.Error(),
+			"error": "Failed to delete domain mapping: " + err.Error(),
 		})
 	}
 
@@ -219,6 +384,8 @@ func DeleteDomainMapping(c *fiber.Ctx) error {
 		})
 	}
 
+	revokeMappingDriveGrants("domain", mapping.ID)
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "Domain mapping deleted successfully",
 	})
@@ -247,6 +414,20 @@ func UpdateDefaultMapping(c *fiber.Ctx) error {
 		})
 	}
 
+	// Validate the link with its storage provider and keep the folder ID
+	resource, err := providers.Parse(data["provider"], data["drive_url"])
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := drive.VerifyFolder(resource.Provider, resource.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	driveURL := strings.TrimSpace(data["drive_url"])
+
 	// Get current user ID
 	userId := utils.GetUserIdFromToken(c)
 
@@ -254,25 +435,53 @@ func UpdateDefaultMapping(c *fiber.Ctx) error {
 	if err := database.DB.First(&defaultMapping).Error; err != nil {
 		// Create if doesn't exist
 		defaultMapping = models.DefaultMapping{
-			DriveURL:  data["drive_url"],
+			Provider:  resource.Provider,
+			DriveURL:  driveURL,
+			FolderID:  resource.ID,
 			UpdatedAt: time.Now().Unix(),
 			UpdatedBy: userId,
+			ManagedBy: models.ManagedByUI,
 		}
-		if err := database.DB.Create(&defaultMapping).Error; err != nil {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&defaultMapping).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "default_mapping.update", "default_mapping", defaultMapping.ID, nil, defaultMapping)
+		})
+		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to create default mapping",
 			})
 		}
 	} else {
 		// Update existing
-		defaultMapping.DriveURL = data["drive_url"]
+		before := defaultMapping
+		folderChanged := defaultMapping.FolderID != resource.ID
+		if folderChanged {
+			defaultMapping.LinkHealth = models.LinkHealth{HealthStatus: models.HealthUnknown}
+		}
+		defaultMapping.Provider = resource.Provider
+		defaultMapping.DriveURL = driveURL
+		defaultMapping.FolderID = resource.ID
 		defaultMapping.UpdatedAt = time.Now().Unix()
 		defaultMapping.UpdatedBy = userId
-		if err := database.DB.Save(&defaultMapping).Error; err != nil {
+		defaultMapping.ManagedBy = models.ManagedByUI
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&defaultMapping).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "default_mapping.update", "default_mapping", defaultMapping.ID, before, defaultMapping)
+		})
+		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to update default mapping",
 			})
 		}
+
+		// Users of the old folder lose the access granted through it
+		if folderChanged {
+			revokeMappingDriveGrants("default", defaultMapping.ID)
+		}
 	}
 
 	return c.JSON(defaultMapping)
@@ -282,9 +491,7 @@ func UpdateDefaultMapping(c *fiber.Ctx) error {
 func FindDriveUrlForUser(c *fiber.Ctx) error {
 	// Get current user from JWT
 	cookie := c.Cookies("jwt")
-	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(utils.SecretKey), nil
-	})
+	claims, err := utils.ParseToken(cookie)
 
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -292,7 +499,6 @@ func FindDriveUrlForUser(c *fiber.Ctx) error {
 		})
 	}
 
-	claims := token.Claims.(*jwt.MapClaims)
 	userId := utils.GetUintFromClaims(claims, "sub")
 
 	// Get user email
@@ -311,33 +517,72 @@ func FindDriveUrlForUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// Folders picked by the address itself are only for its verified owner
+	unverified := config.EmailVerificationRequired && user.EmailVerifiedAt == 0
+
+	// A per-user override wins over the domain mapping
+	var override models.MappingOverride
+	if err := database.DB.Where("email = ?", strings.ToLower(user.Email)).First(&override).Error; err == nil {
+		if unverified {
+			return emailNotVerified(c, emailDomain)
+		}
+		logAccess(user.ID, emailDomain, override.DriveURL, "override", override.ID, c)
+		ensureDriveGrant(user, override.Provider, override.FolderID, "override", override.ID)
+
+		return c.JSON(fiber.Map{
+			"drive_url":   override.DriveURL,
+			"folder_id":   override.FolderID,
+			"provider":    providerName(override.Provider),
+			"open_url":    providers.OpenURL(override.Provider, override.FolderID, override.DriveURL),
+			"domain":      emailDomain,
+			"is_default":  false,
+			"is_override": true,
+			"description": override.Description,
+		})
+	}
+
 	// Find domain mapping
 	var mapping models.DomainMapping
 	if err := database.DB.Where("domain = ? AND is_active = ?", emailDomain, true).First(&mapping).Error; err != nil {
 		// If no domain mapping found, use default mapping
 		var defaultMapping models.DefaultMapping
-		if err := database.DB.First(&defaultMapping).Error; err != nil {
+		if err := database.DB.First(&defaultMapping).Error; err != nil || defaultMapping.DriveURL == "" {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "No drive mapping found for your domain",
 			})
 		}
 
 		// Log access using default mapping
-		logAccess(user.ID, emailDomain, defaultMapping.DriveURL, c)
+		logAccess(user.ID, emailDomain, defaultMapping.DriveURL, "default", defaultMapping.ID, c)
+		ensureDriveGrant(user, defaultMapping.Provider, defaultMapping.FolderID, "default", defaultMapping.ID)
+
+		// Record that the domain needs a mapping of its own
+		trackUnmappedDomain(emailDomain, user)
 
 		return c.JSON(fiber.Map{
 			"drive_url":  defaultMapping.DriveURL,
+			"folder_id":  defaultMapping.FolderID,
+			"provider":   providerName(defaultMapping.Provider),
+			"open_url":   providers.OpenURL(defaultMapping.Provider, defaultMapping.FolderID, defaultMapping.DriveURL),
 			"is_default": true,
 			"domain":     emailDomain,
 		})
 	}
 
-	// Log access
-	logAccess(user.ID, emailDomain, mapping.DriveURL, c)
+	if unverified {
+		return emailNotVerified(c, emailDomain)
+	}
+
+	// Log access and make sure the user can open the folder
+	logAccess(user.ID, emailDomain, mapping.DriveURL, "domain", mapping.ID, c)
+	ensureDriveGrant(user, mapping.Provider, mapping.FolderID, "domain", mapping.ID)
 
 	// Return drive URL for the domain
 	return c.JSON(fiber.Map{
 		"drive_url":   mapping.DriveURL,
+		"folder_id":   mapping.FolderID,
+		"provider":    providerName(mapping.Provider),
+		"open_url":    providers.OpenURL(mapping.Provider, mapping.FolderID, mapping.DriveURL),
 		"domain":      emailDomain,
 		"is_default":  false,
 		"description": mapping.Description,
@@ -346,23 +591,26 @@ func FindDriveUrlForUser(c *fiber.Ctx) error {
 
 // Helper functions
 
-// normalizeDomain normalizes a domain by removing common prefixes
-func normalizeDomain(domain string) string {
-	// Remove http://, https://, www.
-	domain = strings.ToLower(domain)
-	domain = strings.TrimPrefix(domain, "http://")
-	domain = strings.TrimPrefix(domain, "https://")
-	domain = strings.TrimPrefix(domain, "www.")
+// emailNotVerified refuses a domain-mapped folder to a user who has not
+// confirmed their email address yet
+func emailNotVerified(c *fiber.Ctx, domain string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":          "Verify your email address to open your domain's folder",
+		"email_verified": false,
+		"domain":         domain,
+	})
+}
 
-	// Remove anything after a slash if present
-	if idx := strings.Index(domain, "/"); idx != -1 {
-		domain = domain[:idx]
+// providerName returns the provider of a mapping, treating rows saved before
+// providers existed as Google Drive
+func providerName(provider string) string {
+	if provider == "" {
+		return providers.Default
 	}
-
-	return domain
+	return provider
 }
 
-// extractDomainFromEmail extracts the domain portion from an email address
+// extractDomainFromEmail extracts the lowercased domain of an email address
 func extractDomainFromEmail(email string) string {
 	if email == "" {
 		return ""
@@ -383,18 +631,24 @@ func extractDomainFromEmail(email string) string {
 		return ""
 	}
 
-	return domain
+	// Mappings and access logs store domains in lowercase
+	return strings.ToLower(domain)
 }
 
 // logAccess logs user access to drive folders
-func logAccess(userID uint, domain string, driveURL string, c *fiber.Ctx) {
+func logAccess(userID uint, domain string, driveURL string, mappingType string, mappingID uint, c *fiber.Ctx) {
 	accessLog := models.AccessLog{
-		UserID:    userID,
-		Domain:    domain,
-		DriveURL:  driveURL,
-		Timestamp: time.Now().Unix(),
-		IPAddress: c.IP(),
-		UserAgent: c.Get("User-Agent"),
+		UserID:      userID,
+		Domain:      domain,
+		DriveURL:    driveURL,
+		IsDefault:   mappingType == "default",
+		MappingType: mappingType,
+		MappingID:   mappingID,
+		Timestamp:   time.Now().Unix(),
+		IPAddress:   privacy.StoredIP(c.IP()),
+	}
+	if config.AccessLogUserAgent {
+		accessLog.UserAgent = c.Get("User-Agent")
 	}
 
 	database.DB.Create(&accessLog)
@@ -0,0 +1,108 @@
+package controllers_test
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestDriveLookupIgnoresEmailCase(t *testing.T) {
+	app := newTestApp(t)
+	mapping := models.DomainMapping{Domain: "acme.com", DriveURL: "https://drive.google.com/drive/folders/acme", IsActive: true}
+	database.DB.Create(&mapping)
+	user := createUser(t, "Ada@Acme.COM")
+	session := signIn(t, app, user, "Chosen-Passphrase-7390")
+
+	response := get(t, app, "/api/user/drive", session)
+	var body struct {
+		DriveURL  string `json:"drive_url"`
+		Domain    string `json:"domain"`
+		IsDefault bool   `json:"is_default"`
+	}
+	json.NewDecoder(response.Body).Decode(&body)
+	if response.StatusCode != http.StatusOK || body.DriveURL != mapping.DriveURL || body.Domain != "acme.com" {
+		t.Fatalf("lookup = %d %+v, want the acme.com mapping", response.StatusCode, body)
+	}
+
+	// The access log stores the domain in lowercase, as the filter expects
+	var logged models.AccessLog
+	if err := database.DB.Where("domain = ?", "acme.com").First(&logged).Error; err != nil || logged.MappingType != "domain" {
+		t.Errorf("access log = %+v, %v; want a lowercase domain entry", logged, err)
+	}
+}
+
+func TestCreateDomainMappingNormalizesDomain(t *testing.T) {
+	app := newTestApp(t)
+	session := signInAdmin(t, app)
+
+	// No description given
+	response := sendJSON(t, app, http.MethodPost, "/api/admin/domains", map[string]string{
+		"domain":    " HTTPS://www.Acme.COM/ ",
+		"drive_url": "https://drive.google.com/drive/folders/1AbCdEfGhIjKlMnOpQrStUvWxYz012345",
+	}, session)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("create status = %d, want 200", response.StatusCode)
+	}
+
+	var mapping models.DomainMapping
+	if err := database.DB.First(&mapping).Error; err != nil || mapping.Domain != "acme.com" {
+		t.Errorf("stored mapping = %+v, %v; want domain acme.com", mapping, err)
+	}
+
+	response = sendJSON(t, app, http.MethodPost, "/api/admin/domains", map[string]interface{}{
+		"domain":    "https://",
+		"drive_url": "https://drive.google.com/drive/folders/1AbCdEfGhIjKlMnOpQrStUvWxYz012345",
+	}, session)
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty domain status = %d, want 400", response.StatusCode)
+	}
+}
+
+func TestDomainMappingSearch(t *testing.T) {
+	app := newTestApp(t)
+	session := signInAdmin(t, app)
+	for _, mapping := range []models.DomainMapping{
+		{Domain: "acme.com", Description: "Sales 50% team"},
+		{Domain: "acme-labs.com", Description: "Acme_Labs research"},
+		{Domain: "globex.com", Description: "Acme partner!"},
+		{Domain: "initech.com", Description: "Sales 500 team"},
+	} {
+		database.DB.Create(&mapping)
+	}
+
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"", []string{"acme.com", "acme-labs.com", "globex.com", "initech.com"}},
+		{"   ", []string{"acme.com", "acme-labs.com", "globex.com", "initech.com"}},
+		// Case does not matter, and both columns are searched
+		{"ACME", []string{"acme.com", "acme-labs.com", "globex.com"}},
+		// Wildcards and the escape character are matched literally
+		{"50%", []string{"acme.com"}},
+		{"_", []string{"acme-labs.com"}},
+		{"!", []string{"globex.com"}},
+		{"nothing", nil},
+	}
+	for _, test := range tests {
+		response := get(t, app, "/api/admin/domains?sort=id&q="+url.QueryEscape(test.q), session)
+		var mappings []models.DomainMapping
+		json.NewDecoder(response.Body).Decode(&mappings)
+
+		var domains []string
+		for _, mapping := range mappings {
+			domains = append(domains, mapping.Domain)
+		}
+		if response.StatusCode != http.StatusOK || !reflect.DeepEqual(domains, test.want) {
+			t.Errorf("search %q = %d %v, want %v", test.q, response.StatusCode, domains, test.want)
+		}
+		if total := response.Header.Get("X-Total-Count"); total != fmt.Sprint(len(test.want)) {
+			t.Errorf("search %q total = %s, want %d", test.q, total, len(test.want))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/jobs"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetDomainHealth returns the last link check result of every mapping (admin only)
+func GetDomainHealth(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetDomainHealth")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var mappings []models.DomainMapping
+	if err := database.DB.Where("is_active = ?", true).Order("domain").Find(&mappings).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch domain mappings",
+		})
+	}
+
+	flagged := 0
+	domains := make([]fiber.Map, 0, len(mappings))
+	for _, mapping := range mappings {
+		entry := healthEntry(mapping.LinkHealth)
+		entry["id"] = mapping.ID
+		entry["domain"] = mapping.Domain
+		entry["provider"] = providerName(mapping.Provider)
+		entry["drive_url"] = mapping.DriveURL
+		if entry["flagged"] == true {
+			flagged++
+		}
+		domains = append(domains, entry)
+	}
+
+	response := fiber.Map{
+		"threshold":     config.HealthCheckFailureThreshold,
+		"domains":       domains,
+		"default":       nil,
+		"flagged_count": flagged,
+	}
+
+	var defaultMapping models.DefaultMapping
+	if err := database.DB.First(&defaultMapping).Error; err == nil && defaultMapping.DriveURL != "" {
+		entry := healthEntry(defaultMapping.LinkHealth)
+		entry["id"] = defaultMapping.ID
+		entry["provider"] = providerName(defaultMapping.Provider)
+		entry["drive_url"] = defaultMapping.DriveURL
+		if entry["flagged"] == true {
+			response["flagged_count"] = flagged + 1
+		}
+		response["default"] = entry
+	}
+
+	return c.JSON(response)
+}
+
+// RunDomainHealthCheck starts a probe of every mapping now instead of
+// waiting for the next scheduled run. The probes run in the background;
+// GetDomainHealth shows the results as they come in (admin only)
+func RunDomainHealthCheck(c *fiber.Ctx) error {
+	fmt.Println("Admin request - RunDomainHealthCheck")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	if !jobs.QueueHealthChecks(database.DB) {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "A health check is already running",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Health check started",
+	})
+}
+
+// healthEntry renders a link check result, flagging repeated failures
+func healthEntry(health models.LinkHealth) fiber.Map {
+	return fiber.Map{
+		"status":               health.HealthStatus,
+		"last_checked_at":      health.LastCheckedAt,
+		"last_error":           health.LastError,
+		"consecutive_failures": health.ConsecutiveFailures,
+		"flagged":              health.ConsecutiveFailures >= config.HealthCheckFailureThreshold,
+	}
+}
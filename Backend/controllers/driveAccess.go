@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// driveTimeout bounds every Drive API call made while serving a request
+const driveTimeout = 20 * time.Second
+
+// driveGrantRequest is a grant waiting for the background worker
+type driveGrantRequest struct {
+	user        models.User
+	folderID    string
+	mappingType string
+	mappingID   uint
+}
+
+// Grants are reconciled one at a time in the background. A user is queued at
+// most once; when the queue is full the request is dropped and the user's
+// next lookup tries again.
+var (
+	driveGrantQueue   = make(chan driveGrantRequest, 256)
+	driveGrantPending sync.Map // user ID -> queued
+	driveGrantWorker  sync.Once
+)
+
+// ensureDriveGrant gives the user access to the folder they were resolved to
+// and revokes grants on folders they no longer map to. A user who already
+// has just that grant costs one query; anything else is left to a background
+// worker so Drive API calls never hold up the lookup.
+func ensureDriveGrant(user models.User, provider, folderID, mappingType string, mappingID uint) {
+	if drive.API == nil || providerName(provider) != "gdrive" || folderID == "" {
+		return
+	}
+
+	var folders []string
+	database.DB.Model(&models.DriveGrant{}).Where("user_id = ? AND revoked_at = 0 AND revoke_requested_at = 0", user.ID).Pluck("folder_id", &folders)
+	current := len(folders) > 0
+	for _, granted := range folders {
+		if granted != folderID {
+			current = false
+		}
+	}
+	if current {
+		return
+	}
+
+	if _, queued := driveGrantPending.LoadOrStore(user.ID, true); queued {
+		return
+	}
+	driveGrantWorker.Do(func() {
+		go func() {
+			for request := range driveGrantQueue {
+				reconcileDriveGrant(request)
+				driveGrantPending.Delete(request.user.ID)
+			}
+		}()
+	})
+
+	select {
+	case driveGrantQueue <- driveGrantRequest{user: user, folderID: folderID, mappingType: mappingType, mappingID: mappingID}:
+	default:
+		driveGrantPending.Delete(user.ID)
+		fmt.Printf("Drive grant queue is full, %s will be granted on a later lookup\n", user.Email)
+	}
+}
+
+// reconcileDriveGrant revokes a user's grants on other folders and grants
+// the folder they map to now
+func reconcileDriveGrant(request driveGrantRequest) {
+	user, folderID := request.user, request.folderID
+
+	// Grants on other folders are left over from an earlier mapping
+	revokeDriveGrants("user_id = ? AND folder_id <> ?", user.ID, folderID)
+
+	var existing models.DriveGrant
+	if err := database.DB.Where("user_id = ? AND folder_id = ? AND revoked_at = 0 AND revoke_requested_at = 0", user.ID, folderID).First(&existing).Error; err == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), driveTimeout)
+	defer cancel()
+
+	permissionID, err := drive.API.CreatePermission(ctx, folderID, user.Email, config.DriveGrantRole)
+	if err != nil {
+		fmt.Printf("Error granting %s access to folder %s: %v\n", user.Email, folderID, err)
+		return
+	}
+
+	database.DB.Create(&models.DriveGrant{
+		UserID:       user.ID,
+		Email:        user.Email,
+		FolderID:     folderID,
+		PermissionID: permissionID,
+		Role:         config.DriveGrantRole,
+		MappingType:  request.mappingType,
+		MappingID:    request.mappingID,
+		CreatedAt:    time.Now().Unix(),
+	})
+}
+
+// revokeUserDriveGrants removes every grant made for a user
+func revokeUserDriveGrants(userID uint) {
+	revokeDriveGrants("user_id = ?", userID)
+}
+
+// revokeMappingDriveGrants removes the grants made through a mapping whose
+// folder changed or which was deleted
+func revokeMappingDriveGrants(mappingType string, mappingID uint) {
+	revokeDriveGrants("mapping_type = ? AND mapping_id = ?", mappingType, mappingID)
+}
+
+// revokeDriveGrants deletes the Drive permissions of the active grants
+// matching the condition and marks them revoked
+func revokeDriveGrants(condition string, args ...interface{}) {
+	drive.RevokeGrants(database.DB, condition, args...)
+}
+
+// GetPendingDriveRevocations lists the grants whose Drive permission could
+// not be deleted yet and are being retried (admin only)
+func GetPendingDriveRevocations(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetPendingDriveRevocations")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	grants := []models.DriveGrant{}
+	if err := database.DB.Where("revoke_requested_at > 0 AND revoked_at = 0").Order("revoke_requested_at").Find(&grants).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch pending revocations",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"grants":         grants,
+		"retry_interval": config.DriveRevokeRetryIntervalMinutes,
+	})
+}
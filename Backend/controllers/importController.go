@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImportUsers provisions accounts from a CSV or JSON list of name, email,
+// department and role (admin only). The list is the request body or a
+// multipart "file" field. dry_run=true only validates.
+func ImportUsers(c *fiber.Ctx) error {
+	fmt.Println("Admin request - ImportUsers")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	dryRun := false
+	if raw := c.Query("dry_run"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "dry_run must be true or false",
+			})
+		}
+		dryRun = value
+	}
+
+	credential := c.Query("credential", accounts.CredentialInvite)
+	if credential != accounts.CredentialInvite && credential != accounts.CredentialPassword {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "credential must be invite or password",
+		})
+	}
+
+	data, format, err := readImportBody(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	rows, err := accounts.ParseImport(data, format)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	results, summary := accounts.Import(database.DB, rows, accounts.ImportOptions{
+		DryRun:     dryRun,
+		Credential: credential,
+		CreatedBy:  utils.GetUserIdFromToken(c),
+		Request:    c,
+	})
+
+	return c.JSON(fiber.Map{
+		"summary": summary,
+		"results": results,
+	})
+}
+
+// readImportBody returns the uploaded list and its format, taken from the
+// format parameter, the file extension or the content type
+func readImportBody(c *fiber.Ctx) ([]byte, string, error) {
+	format := strings.ToLower(c.Query("format"))
+
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", fmt.Errorf("a file field is required")
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, "", err
+		}
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+		return data, format, nil
+	}
+
+	if format == "" {
+		switch {
+		case strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON):
+			format = "json"
+		case strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv"):
+			format = "csv"
+		}
+	}
+	return c.Body(), format, nil
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// invitationSorts are the columns invitations can be ordered by
+var invitationSorts = map[string]utils.SortField{
+	"id":         {Column: "id", Numeric: true},
+	"created_at": {Column: "created_at", Numeric: true},
+	"expires_at": {Column: "expires_at", Numeric: true},
+}
+
+// invitationInput is an invitation as admins send it
+type invitationInput struct {
+	Email      string `json:"email"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	Department string `json:"department"`
+	// Optional expiry, in hours from now or as a Unix time
+	ExpiresInHours int64 `json:"expires_in_hours"`
+	ExpiresAt      int64 `json:"expires_at"`
+}
+
+// CreateInvitation invites a person by email with a role and department (admin only)
+func CreateInvitation(c *fiber.Ctx) error {
+	fmt.Println("Admin request - CreateInvitation")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var data invitationInput
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	expiresAt, err := accounts.InvitationExpiry(time.Now(), data.ExpiresInHours, data.ExpiresAt)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	invitation, token, err := accounts.Invite(database.DB, c, accounts.Invitee{
+		Email:      data.Email,
+		Name:       data.Name,
+		Role:       data.Role,
+		Department: data.Department,
+		ExpiresAt:  expiresAt,
+	}, utils.GetUserIdFromToken(c))
+	if errors.Is(err, accounts.ErrAlreadyActive) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"invitation": invitation,
+		"invite_url": accounts.InviteURL(token),
+	})
+}
+
+// GetInvitations lists invitations, by default the pending ones (admin only)
+func GetInvitations(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetInvitations")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	now := time.Now().Unix()
+	query := filterSearch(c, database.DB.Model(&models.Invitation{}), "email")
+	switch c.Query("status", "pending") {
+	case "all":
+	case "pending":
+		query = query.Where("accepted_at = 0 AND revoked_at = 0 AND expires_at > ?", now)
+	case "accepted":
+		query = query.Where("accepted_at <> 0")
+	case "revoked":
+		query = query.Where("revoked_at <> 0")
+	case "expired":
+		query = query.Where("accepted_at = 0 AND revoked_at = 0 AND expires_at <= ?", now)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "status must be pending, accepted, revoked, expired or all",
+		})
+	}
+
+	page, err := utils.ParsePage(c, invitationSorts, "id", true, 100, 500)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Count and fetch from the same filters without one affecting the other
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count invitations",
+		})
+	}
+
+	invitations := []models.Invitation{}
+	if err := page.Apply(query).Find(&invitations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch invitations",
+		})
+	}
+
+	// The extra row only tells us there is another page
+	nextCursor := ""
+	if len(invitations) > page.Limit {
+		invitations = invitations[:page.Limit]
+		last := invitations[len(invitations)-1]
+		value := interface{}(last.ID)
+		switch page.Field.Column {
+		case "created_at":
+			value = last.CreatedAt
+		case "expires_at":
+			value = last.ExpiresAt
+		}
+		nextCursor = utils.EncodeCursor(value, last.ID)
+	}
+	utils.SetListHeaders(c, total, nextCursor)
+
+	return c.JSON(invitations)
+}
+
+// RevokeInvitation cancels a pending invitation (admin only). The disabled
+// account it created stays until an admin deletes it or invites again.
+func RevokeInvitation(c *fiber.Ctx) error {
+	fmt.Println("Admin request - RevokeInvitation")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var invitation models.Invitation
+	if err := database.DB.First(&invitation, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invitation not found",
+		})
+	}
+
+	if invitation.AcceptedAt != 0 || invitation.RevokedAt != 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Invitation is no longer pending",
+		})
+	}
+
+	before := invitation
+	invitation.RevokedAt = time.Now().Unix()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&invitation).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "invitation.revoke", "invitation", invitation.ID, before, invitation)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke invitation",
+		})
+	}
+
+	return c.JSON(invitation)
+}
+
+// GetInvitation shows who an invitation is for so the accept page can
+// greet them
+func GetInvitation(c *fiber.Ctx) error {
+	invitation, err := accounts.FindInvitation(database.DB, c.Params("token"))
+	if err != nil {
+		return c.Status(invitationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var user models.User
+	database.DB.First(&user, invitation.UserID)
+
+	return c.JSON(fiber.Map{
+		"email":      invitation.Email,
+		"name":       user.Name,
+		"role":       invitation.Role,
+		"department": invitation.Department,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// AcceptInvitation sets the password of an invited account, activates it
+// and signs the user in
+func AcceptInvitation(c *fiber.Ctx) error {
+	fmt.Println("Received an invitation acceptance")
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if data["password"] == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Password is required",
+		})
+	}
+	if data["password"] != data["password_confirm"] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Passwords do not match",
+		})
+	}
+
+	user, err := accounts.AcceptInvitation(database.DB, c, c.Params("token"), data["password"], data["name"])
+	if err != nil {
+		return c.Status(invitationErrorStatus(err)).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	token, session, err := utils.NewSession(c, user)
+	if err != nil {
+		// The account is ready; the user can still sign in normally
+		return c.JSON(fiber.Map{
+			"message": "Invitation accepted, please log in",
+		})
+	}
+	setSessionCookie(c, token, session)
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation accepted",
+		"user": fiber.Map{
+			"id":    user.ID,
+			"name":  user.Name,
+			"email": user.Email,
+			"role":  user.Role,
+		},
+	})
+}
+
+// invitationErrorStatus maps invitation errors to HTTP statuses
+func invitationErrorStatus(err error) int {
+	var weak *policy.PasswordError
+	switch {
+	case errors.As(err, &weak):
+		return fiber.StatusBadRequest
+	case errors.Is(err, accounts.ErrInvitationInvalid):
+		return fiber.StatusNotFound
+	case errors.Is(err, accounts.ErrInvitationExpired):
+		return fiber.StatusGone
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
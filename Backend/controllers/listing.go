@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// userSorts are the columns the user list can be ordered by
+var userSorts = map[string]utils.SortField{
+	"id":         {Column: "id", Numeric: true},
+	"name":       {Column: "name"},
+	"email":      {Column: "email"},
+	"role":       {Column: "role"},
+	"department": {Column: "department"},
+	"created_at": {Column: "created_at", Numeric: true},
+	"last_login": {Column: "last_login", Numeric: true},
+}
+
+// domainMappingSorts are the columns the domain mapping list can be ordered by
+var domainMappingSorts = map[string]utils.SortField{
+	"id":            {Column: "id", Numeric: true},
+	"domain":        {Column: "domain"},
+	"provider":      {Column: "provider"},
+	"health_status": {Column: "health_status"},
+	"created_at":    {Column: "created_at", Numeric: true},
+	"updated_at":    {Column: "updated_at", Numeric: true},
+}
+
+// filterSearch matches free text from the q parameter against the columns
+func filterSearch(c *fiber.Ctx, query *gorm.DB, columns ...string) *gorm.DB {
+	text := c.Query("q")
+	if strings.TrimSpace(text) == "" {
+		return query
+	}
+
+	pattern := utils.LikePattern(text)
+	conditions := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("LOWER(%s) LIKE ? ESCAPE '!'", column)
+		args[i] = pattern
+	}
+	return query.Where(strings.Join(conditions, " OR "), args...)
+}
+
+// filterEqual adds an exact match on column for each query parameter given.
+// A comma separated value matches any of its entries.
+func filterEqual(c *fiber.Ctx, query *gorm.DB, params map[string]string) *gorm.DB {
+	for param, column := range params {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		values := strings.Split(raw, ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		query = query.Where(column+" IN ?", values)
+	}
+	return query
+}
+
+// filterBool adds a match on a boolean column from a query parameter
+func filterBool(c *fiber.Ctx, query *gorm.DB, param, column string) (*gorm.DB, error) {
+	raw := c.Query(param)
+	if raw == "" {
+		return query, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", param, raw)
+	}
+	return query.Where(column+" = ?", value), nil
+}
+
+// filterTimeRange adds <param>_from (inclusive) and <param>_to (exclusive)
+// bounds on a unix time column
+func filterTimeRange(c *fiber.Ctx, query *gorm.DB, param, column string) (*gorm.DB, error) {
+	if raw := c.Query(param + "_from"); raw != "" {
+		from, err := utils.ParseTimeParam(raw)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(column+" >= ?", from)
+	}
+	if raw := c.Query(param + "_to"); raw != "" {
+		to, err := utils.ParseTimeParam(raw)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(column+" < ?", to)
+	}
+	return query, nil
+}
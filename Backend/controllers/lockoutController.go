@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/throttle"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetUserLockout shows the failed login record of a user (admin only)
+func GetUserLockout(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetUserLockout")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	state, err := throttle.LoginStatus(user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read failed logins",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"locked":       state.Locked(time.Now()),
+		"failures":     state.Failures,
+		"last_failure": state.LastFailure,
+		"retry_at":     state.RetryAt,
+		"locked_until": state.LockedUntil,
+	})
+}
+
+// UnlockUser clears the failed logins and any lockout of a user (admin only)
+func UnlockUser(c *fiber.Ctx) error {
+	fmt.Println("Admin request - UnlockUser")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	before, err := throttle.LoginStatus(user.Email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read failed logins",
+		})
+	}
+	if err := throttle.ResetLogin(user.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlock user",
+		})
+	}
+
+	if err := audit.Record(database.DB, c, "user.unlock", "user", user.ID, before, nil); err != nil {
+		fmt.Println("Error recording unlock in audit log:", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User unlocked",
+	})
+}
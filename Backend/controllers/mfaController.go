@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/mfa"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetMFAStatus tells the current user whether two-factor authentication is
+// on and how many recovery codes are left
+func GetMFAStatus(c *fiber.Ctx) error {
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":                  user.MFAEnabled,
+		"enabled_at":               user.MFAEnabledAt,
+		"required":                 mfa.Required(user.Role),
+		"recovery_codes_remaining": mfa.RemainingRecoveryCodes(database.DB, user.ID),
+	})
+}
+
+// SetupMFA starts enrollment and returns the secret and QR code to add to
+// an authenticator app
+func SetupMFA(c *fiber.Ctx) error {
+	fmt.Println("Received a two-factor setup request")
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	enrollment, err := mfa.Setup(database.DB, user)
+	if errors.Is(err, mfa.ErrAlreadyEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start two-factor setup",
+		})
+	}
+
+	return c.JSON(enrollment)
+}
+
+// EnableMFA finishes enrollment with a code from the app and returns the
+// recovery codes, which are shown only this once
+func EnableMFA(c *fiber.Ctx) error {
+	fmt.Println("Received a two-factor enable request")
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	codes, err := mfa.Enable(database.DB, c, user, data["code"])
+	switch {
+	case errors.Is(err, mfa.ErrAlreadyEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, mfa.ErrNoPendingSetup), errors.Is(err, mfa.ErrInvalidCode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to enable two-factor authentication",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns two-factor authentication off. It takes the password and
+// a current code, so a stolen session alone cannot remove it.
+func DisableMFA(c *fiber.Ctx) error {
+	fmt.Println("Received a two-factor disable request")
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if !verifyPassword(user, data["password"]) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Incorrect password",
+		})
+	}
+	if !user.MFAEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": mfa.ErrNotEnabled.Error(),
+		})
+	}
+	if _, err := mfa.Verify(database.DB, user, data["code"]); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": mfa.ErrInvalidCode.Error(),
+		})
+	}
+
+	if err := mfa.Disable(database.DB, c, user, "user.mfa_disable"); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to disable two-factor authentication",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateMFARecoveryCodes replaces the recovery codes after checking a
+// current code, and returns the new ones
+func RegenerateMFARecoveryCodes(c *fiber.Ctx) error {
+	fmt.Println("Received a recovery code regeneration request")
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if !user.MFAEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": mfa.ErrNotEnabled.Error(),
+		})
+	}
+	if _, err := mfa.Verify(database.DB, user, data["code"]); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": mfa.ErrInvalidCode.Error(),
+		})
+	}
+
+	codes, err := mfa.RegenerateRecoveryCodes(database.DB, c, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to regenerate recovery codes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// ResetUserMFA turns off two-factor authentication for a user who lost
+// their device and recovery codes (admin only)
+func ResetUserMFA(c *fiber.Ctx) error {
+	fmt.Println("Admin request - ResetUserMFA")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	err := mfa.Disable(database.DB, c, user, "user.mfa_reset")
+	if errors.Is(err, mfa.ErrNotEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset two-factor authentication",
+		})
+	}
+
+	// Sessions opened with the old factor end with it
+	utils.RevokeUserSessions(user.ID)
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication reset",
+	})
+}
+
+// RequireAdminMFA keeps admin features from users whose role must use
+// two-factor authentication until they have turned it on. Requests without
+// a valid session pass through to the handlers' own checks.
+func RequireAdminMFA(c *fiber.Ctx) error {
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Next()
+	}
+
+	if mfa.Required(user.Role) && !user.MFAEnabled {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":              "Two-factor authentication must be enabled to use admin features",
+			"mfa_setup_required": true,
+		})
+	}
+	return c.Next()
+}
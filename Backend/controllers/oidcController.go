@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/sso"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ssoStateCookie carries the sign-in state while the user is at the provider
+const ssoStateCookie = "sso_login"
+
+// GetOIDCProviders lists the identity providers users can sign in with
+func GetOIDCProviders(c *fiber.Ctx) error {
+	providers := []fiber.Map{}
+	for _, provider := range sso.OIDCProviders() {
+		providers = append(providers, fiber.Map{
+			"name":         provider.Name,
+			"display_name": provider.DisplayName,
+			"login_url":    "/api/auth/oidc/" + provider.Name,
+		})
+	}
+	return c.JSON(providers)
+}
+
+// OIDCLogin sends the browser to the identity provider's login page. The
+// optional redirect query is the frontend path to return to.
+func OIDCLogin(c *fiber.Ctx) error {
+	fmt.Println("Received an OIDC login request")
+	return startOIDC(c, 0)
+}
+
+// LinkOIDC sends a signed-in user to the identity provider to link the
+// account they have there to theirs. The optional redirect query is the
+// frontend path to return to.
+func LinkOIDC(c *fiber.Ctx) error {
+	fmt.Println("Received an OIDC link request")
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+	return startOIDC(c, user.ID)
+}
+
+// startOIDC redirects to the provider's login page, for a sign-in or, with
+// linkUserID, to link the provider to that user
+func startOIDC(c *fiber.Ctx, linkUserID uint) error {
+	provider, err := sso.FindOIDC(c.Params("provider"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	state, signed, err := sso.NewLoginState(provider.Name, c.Query("redirect"))
+	if err == nil && linkUserID != 0 {
+		state.LinkUserID = linkUserID
+		signed, err = state.Sign()
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start sign-in",
+		})
+	}
+	authURL, err := provider.AuthCodeURL(c.UserContext(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		fmt.Println("Error starting OIDC sign-in:", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "The identity provider is not reachable",
+		})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     ssoStateCookie,
+		Value:    signed,
+		Expires:  time.Now().Add(sso.LoginStateTTL),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Path:     "/api/auth",
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallback finishes a sign-in when the provider sends the browser back,
+// then returns it to the frontend
+func OIDCCallback(c *fiber.Ctx) error {
+	fmt.Println("Received an OIDC callback")
+
+	signed := c.Cookies(ssoStateCookie)
+	clearSSOStateCookie(c)
+
+	provider, err := sso.FindOIDC(c.Params("provider"))
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+	state, err := sso.ParseLoginState(signed, provider.Name, c.Query("state"))
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+	if c.Query("error") != "" {
+		return ssoFailed(c, fmt.Errorf("the identity provider refused the sign-in: %s", c.Query("error")))
+	}
+
+	identity, err := provider.Exchange(c.UserContext(), c.Query("code"), state.Nonce, state.Verifier)
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+
+	if state.LinkUserID != 0 {
+		// The browser must still be signed in to the account being linked
+		if utils.GetUserIdFromToken(c) != state.LinkUserID {
+			return ssoFailed(c, sso.ErrLoginState)
+		}
+		if err := accounts.LinkExternal(database.DB, c, state.LinkUserID, identity); err != nil {
+			return ssoFailed(c, err)
+		}
+		return c.Redirect(frontendURL(state.Redirect), fiber.StatusFound)
+	}
+
+	user, err := accounts.SignInExternal(database.DB, c, identity, provider.CreateUsers)
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+	return ssoSignedIn(c, user, state.Redirect)
+}
+
+// ssoSignedIn finishes a single sign-on and returns the browser to the
+// frontend path it started from
+func ssoSignedIn(c *fiber.Ctx, user models.User, redirect string) error {
+	// Two-factor authentication still applies
+	if user.MFAEnabled {
+		token, _, err := accounts.NewMFAChallenge(database.DB, user)
+		if err != nil {
+			return ssoFailed(c, err)
+		}
+		return c.Redirect(frontendURL("/login?mfa_token="+url.QueryEscape(token)), fiber.StatusFound)
+	}
+
+	if err := startSession(c, &user); err != nil {
+		return ssoFailed(c, err)
+	}
+	return c.Redirect(frontendURL(redirect), fiber.StatusFound)
+}
+
+// ssoFailed returns the browser to the login page with a reason the user can
+// act on; other errors are only logged
+func ssoFailed(c *fiber.Ctx, err error) error {
+	fmt.Println("SSO sign-in failed:", err)
+
+	message := "Sign-in failed, please try again"
+	for _, known := range []error{
+		sso.ErrUnknownProvider, sso.ErrDomainNotServed, sso.ErrLoginState,
+		sso.ErrSAMLNoConnection, sso.ErrSAMLResponse,
+		accounts.ErrExternalEmailUnverified, accounts.ErrExternalNoAccount,
+		accounts.ErrExternalDomainBlocked, accounts.ErrAccountDisabled,
+		accounts.ErrExternalLinkRequired, accounts.ErrExternalLinkedElsewhere,
+	} {
+		if errors.Is(err, known) {
+			message = known.Error()
+		}
+	}
+	return c.Redirect(frontendURL("/login?sso_error="+url.QueryEscape(message)), fiber.StatusFound)
+}
+
+// clearSSOStateCookie expires the sign-in state cookie
+func clearSSOStateCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     ssoStateCookie,
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+		Path:     "/api/auth",
+	})
+}
+
+// frontendURL is a page of the frontend
+func frontendURL(path string) string {
+	return strings.TrimSuffix(config.AppBaseURL, "/") + path
+}
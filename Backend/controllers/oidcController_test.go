@@ -0,0 +1,469 @@
+package controllers_test
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/sso"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// testIssuer is an OpenID Connect provider that signs in whoever Claims
+// describes. It checks the client credentials and the PKCE verifier.
+type testIssuer struct {
+	*httptest.Server
+	Claims map[string]interface{}
+	// Nonce replaces the nonce of the sign-in in the ID token when set
+	Nonce string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/token", issuer.token)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (i *testIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+// authorize signs the user in at once and sends them back with a code
+func (i *testIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE is required", http.StatusBadRequest)
+		return
+	}
+
+	i.mu.Lock()
+	code := fmt.Sprintf("code-%d", len(i.codes))
+	i.codes[code] = query
+	i.mu.Unlock()
+
+	back := query.Get("redirect_uri") + "?code=" + code + "&state=" + url.QueryEscape(query.Get("state"))
+	http.Redirect(w, r, back, http.StatusFound)
+}
+
+// token trades a code for an ID token when the client proves the verifier
+func (i *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	i.mu.Lock()
+	request, ok := i.codes[r.Form.Get("code")]
+	delete(i.codes, r.Form.Get("code"))
+	i.mu.Unlock()
+
+	clientID, secret, _ := r.BasicAuth()
+	verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || clientID != "test-client" || secret != "test-secret" ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != request.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   i.URL,
+		"aud":   "test-client",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": request.Get("nonce"),
+	}
+	if i.Nonce != "" {
+		claims["nonce"] = i.Nonce
+	}
+	for name, value := range i.Claims {
+		claims[name] = value
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(i.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "test-access-token",
+		"token_type":   "Bearer",
+		"id_token":     signed,
+	})
+}
+
+func (i *testIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}},
+	})
+}
+
+// useOIDCProvider configures the issuer as the only provider, named "test".
+// It serves example.com unless the provider sets its domains.
+func useOIDCProvider(t *testing.T, issuer *testIssuer, provider map[string]interface{}) {
+	t.Helper()
+
+	if _, ok := provider["domains"]; !ok {
+		provider["domains"] = []string{"example.com"}
+	}
+	provider["name"] = "test"
+	provider["issuer"] = issuer.URL
+	provider["client_id"] = "test-client"
+	provider["client_secret"] = "test-secret"
+	data, _ := json.Marshal([]interface{}{provider})
+
+	file := filepath.Join(t.TempDir(), "oidc.json")
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	previousFile, previousGoogle := config.OIDCProvidersFile, config.GoogleClientID
+	config.OIDCProvidersFile, config.GoogleClientID = file, ""
+	t.Cleanup(func() { config.OIDCProvidersFile, config.GoogleClientID = previousFile, previousGoogle })
+
+	if err := sso.LoadOIDC(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// oidcSignIn goes through the provider's login and back to the callback.
+// tamper may change the callback query and state cookie first.
+func oidcSignIn(t *testing.T, app *fiber.App, tamper func(query url.Values, state *http.Cookie)) *http.Response {
+	t.Helper()
+	return oidcFlow(t, app, "/api/auth/oidc/test?redirect=/profile", nil, tamper)
+}
+
+// oidcFlow starts at path, goes through the provider's login and back to the
+// callback, with the browser's session if it has one
+func oidcFlow(t *testing.T, app *fiber.App, path string, session *http.Cookie, tamper func(query url.Values, state *http.Cookie)) *http.Response {
+	t.Helper()
+
+	cookies := []*http.Cookie{}
+	if session != nil {
+		cookies = append(cookies, session)
+	}
+	start := get(t, app, path, cookies...)
+	if start.StatusCode != http.StatusFound {
+		t.Fatalf("login status = %d, want 302", start.StatusCode)
+	}
+	state := responseCookie(start, "sso_login")
+	if state == nil {
+		t.Fatal("login set no state cookie")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	authorized, err := client.Get(start.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized.Body.Close()
+	if authorized.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want 302", authorized.StatusCode)
+	}
+	callback, err := url.Parse(authorized.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := callback.Query()
+	if tamper != nil {
+		tamper(query, state)
+	}
+	return get(t, app, callback.Path+"?"+query.Encode(), append(cookies, state)...)
+}
+
+func TestOIDCSignInLinksExistingAccount(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	useOIDCProvider(t, issuer, map[string]interface{}{})
+	user := createUser(t, "ada@example.com")
+
+	issuer.Claims = map[string]interface{}{"sub": "ada-1", "email": "Ada@example.com", "email_verified": true}
+	response := oidcSignIn(t, app, nil)
+	ssoOutcome(t, response, "")
+	if location := response.Header.Get("Location"); location != config.AppBaseURL+"/profile" {
+		t.Errorf("redirect = %q, want the frontend /profile", location)
+	}
+
+	var link models.UserIdentity
+	if err := database.DB.Where("provider = ? AND subject = ?", "oidc:test", "ada-1").First(&link).Error; err != nil {
+		t.Fatal("identity not linked:", err)
+	}
+	if link.UserID != user.ID {
+		t.Errorf("identity linked to user %d, want %d", link.UserID, user.ID)
+	}
+
+	// The link holds even when the provider changes the address
+	issuer.Claims = map[string]interface{}{"sub": "ada-1", "email": "ada.lovelace@example.com", "email_verified": false}
+	ssoOutcome(t, oidcSignIn(t, app, nil), "")
+}
+
+func TestOIDCSignInRequiresPKCEVerifier(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	useOIDCProvider(t, issuer, map[string]interface{}{})
+	createUser(t, "ada@example.com")
+	issuer.Claims = map[string]interface{}{"sub": "ada-1", "email": "ada@example.com", "email_verified": true}
+
+	// Same state and nonce, but a verifier the issuer never saw
+	response := oidcSignIn(t, app, func(query url.Values, state *http.Cookie) {
+		login, err := sso.ParseLoginState(state.Value, "test", query.Get("state"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		login.Verifier = oauth2.GenerateVerifier()
+		state.Value, _ = login.Sign()
+	})
+	ssoOutcome(t, response, "Sign-in failed, please try again")
+}
+
+func TestOIDCSignInRejectsStateMismatch(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	useOIDCProvider(t, issuer, map[string]interface{}{})
+	createUser(t, "ada@example.com")
+	issuer.Claims = map[string]interface{}{"sub": "ada-1", "email": "ada@example.com", "email_verified": true}
+
+	response := oidcSignIn(t, app, func(query url.Values, state *http.Cookie) {
+		query.Set("state", "forged")
+	})
+	ssoOutcome(t, response, sso.ErrLoginState.Error())
+
+	response = oidcSignIn(t, app, func(query url.Values, state *http.Cookie) {
+		state.Value = ""
+	})
+	ssoOutcome(t, response, sso.ErrLoginState.Error())
+}
+
+func TestOIDCSignInRejectsNonceMismatch(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	useOIDCProvider(t, issuer, map[string]interface{}{})
+	createUser(t, "ada@example.com")
+
+	issuer.Claims = map[string]interface{}{"sub": "ada-1", "email": "ada@example.com", "email_verified": true}
+	issuer.Nonce = "replayed"
+	ssoOutcome(t, oidcSignIn(t, app, nil), "Sign-in failed, please try again")
+}
+
+func TestOIDCSignInRefusesUnverifiedEmail(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	useOIDCProvider(t, issuer, map[string]interface{}{"create_users": true})
+	createUser(t, "ada@example.com")
+
+	for _, verified := range []interface{}{false, "false", nil} {
+		issuer.Claims = map[string]interface{}{"sub": "mallory", "email": "ada@example.com", "email_verified": verified}
+		ssoOutcome(t, oidcSignIn(t, app, nil), accounts.ErrExternalEmailUnverified.Error())
+	}
+
+	var links int64
+	database.DB.Model(&models.UserIdentity{}).Count(&links)
+	if links != 0 {
+		t.Errorf("%d identities linked, want none", links)
+	}
+}
+
+func TestOIDCSignInCreatesUsers(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	issuer.Claims = map[string]interface{}{
+		"sub": "grace-1", "email": "grace@example.com", "email_verified": true,
+		"name": "Grace Hopper", "dept": "Navy",
+	}
+
+	useOIDCProvider(t, issuer, map[string]interface{}{"department_claim": "dept"})
+	ssoOutcome(t, oidcSignIn(t, app, nil), accounts.ErrExternalNoAccount.Error())
+
+	useOIDCProvider(t, issuer, map[string]interface{}{"department_claim": "dept", "create_users": true})
+	ssoOutcome(t, oidcSignIn(t, app, nil), "")
+
+	var user models.User
+	if err := database.DB.Where("email = ?", "grace@example.com").First(&user).Error; err != nil {
+		t.Fatal("user not created:", err)
+	}
+	if user.Name != "Grace Hopper" || user.Department != "Navy" || user.Role != "user" || user.EmailVerifiedAt == 0 {
+		t.Errorf("created %+v", user)
+	}
+}
+
+func TestOIDCSignInEnforcesDomains(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	createUser(t, "ada@example.com")
+	createUser(t, "ada@sub.example.com")
+	createUser(t, "eve@example.org")
+
+	useOIDCProvider(t, issuer, map[string]interface{}{"domains": []string{"example.com"}})
+	for email, wantError := range map[string]string{
+		"ada@example.com":     "",
+		"ada@sub.example.com": "",
+		"eve@example.org":     sso.ErrDomainNotServed.Error(),
+	} {
+		issuer.Claims = map[string]interface{}{"sub": email, "email": email, "email_verified": true}
+		ssoOutcome(t, oidcSignIn(t, app, nil), wantError)
+	}
+
+	useOIDCProvider(t, issuer, map[string]interface{}{"domains": []string{"example.com"}, "hosted_domain": "example.com"})
+	start := get(t, app, "/api/auth/oidc/test")
+	authURL, _ := url.Parse(start.Header.Get("Location"))
+	if authURL.Query().Get("hd") != "example.com" {
+		t.Errorf("login URL %s does not ask for the hosted domain", authURL)
+	}
+	for hd, wantError := range map[string]string{
+		"example.com": "",
+		"example.org": sso.ErrDomainNotServed.Error(),
+		"":            sso.ErrDomainNotServed.Error(),
+	} {
+		issuer.Claims = map[string]interface{}{"sub": "ada-hd", "email": "ada@example.com", "email_verified": true, "hd": hd}
+		ssoOutcome(t, oidcSignIn(t, app, nil), wantError)
+	}
+}
+
+func TestLoadOIDCRequiresDomains(t *testing.T) {
+	issuer := newTestIssuer(t)
+	previousFile, previousGoogle := config.OIDCProvidersFile, config.GoogleClientID
+	previousHosted, previousDomains := config.GoogleHostedDomain, config.GoogleDomains
+	t.Cleanup(func() {
+		config.OIDCProvidersFile, config.GoogleClientID = previousFile, previousGoogle
+		config.GoogleHostedDomain, config.GoogleDomains = previousHosted, previousDomains
+	})
+
+	tests := []struct {
+		provider map[string]interface{}
+		ok       bool
+	}{
+		{map[string]interface{}{"issuer": issuer.URL}, false},
+		{map[string]interface{}{"issuer": issuer.URL, "domains": []string{" ", ""}}, false},
+		{map[string]interface{}{"issuer": issuer.URL, "hosted_domain": "example.com"}, false},
+		{map[string]interface{}{"issuer": "https://accounts.google.com"}, false},
+		{map[string]interface{}{"issuer": "https://accounts.google.com", "hosted_domain": "example.com"}, true},
+		{map[string]interface{}{"issuer": issuer.URL, "domains": []string{" Example.COM "}}, true},
+	}
+	for _, test := range tests {
+		test.provider["name"], test.provider["client_id"] = "test", "test-client"
+		data, _ := json.Marshal([]interface{}{test.provider})
+		file := filepath.Join(t.TempDir(), "oidc.json")
+		os.WriteFile(file, data, 0o600)
+		config.OIDCProvidersFile, config.GoogleClientID = file, ""
+
+		if err := sso.LoadOIDC(); (err == nil) != test.ok {
+			t.Errorf("%v: err = %v, want ok %v", test.provider, err, test.ok)
+		}
+	}
+	if provider, _ := sso.FindOIDC("test"); provider == nil || len(provider.Domains) != 1 || provider.Domains[0] != "example.com" {
+		t.Errorf("domains not normalized: %+v", provider)
+	}
+
+	// The built-in Google provider
+	config.OIDCProvidersFile, config.GoogleClientID = "", "google-client"
+	config.GoogleHostedDomain, config.GoogleDomains = "", ""
+	if err := sso.LoadOIDC(); err == nil {
+		t.Error("Google loaded without GOOGLE_HOSTED_DOMAIN or GOOGLE_DOMAINS")
+	}
+	config.GoogleDomains = "example.com, example.org"
+	if err := sso.LoadOIDC(); err != nil {
+		t.Errorf("Google with GOOGLE_DOMAINS: %v", err)
+	}
+	config.GoogleHostedDomain, config.GoogleDomains = "example.com", ""
+	if err := sso.LoadOIDC(); err != nil {
+		t.Errorf("Google with GOOGLE_HOSTED_DOMAIN: %v", err)
+	}
+}
+
+func TestOIDCSignInDoesNotTakeOverAccounts(t *testing.T) {
+	app := newTestApp(t)
+	issuer := newTestIssuer(t)
+	useOIDCProvider(t, issuer, map[string]interface{}{"create_users": true})
+
+	ada := createUser(t, "ada@example.com")
+	session := signIn(t, app, ada, "Chosen-Passphrase-7390")
+	admin := createUser(t, "root@example.com")
+	database.DB.Model(&admin).Update("role", "admin")
+
+	// Whoever has the address at the provider cannot claim either account
+	for _, email := range []string{"ada@example.com", "root@example.com"} {
+		issuer.Claims = map[string]interface{}{"sub": "mallory-" + email, "email": email, "email_verified": true}
+		ssoOutcome(t, oidcSignIn(t, app, nil), accounts.ErrExternalLinkRequired.Error())
+	}
+	var links int64
+	database.DB.Model(&models.UserIdentity{}).Count(&links)
+	if links != 0 {
+		t.Fatalf("%d identities linked, want none", links)
+	}
+
+	// Linking needs a session, and the same one when the browser comes back
+	if response := get(t, app, "/api/user/identities/oidc/test"); response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("link without a session status = %d, want 401", response.StatusCode)
+	}
+	grace := createUser(t, "grace@example.com")
+	graceSession := signIn(t, app, grace, "Chosen-Passphrase-7390")
+	issuer.Claims = map[string]interface{}{"sub": "ada-1", "email": "ada.lovelace@example.com", "email_verified": false}
+	adaSession := *session
+	response := oidcFlow(t, app, "/api/user/identities/oidc/test?redirect=/profile", session,
+		func(query url.Values, state *http.Cookie) { session.Value = graceSession.Value })
+	ssoOutcome(t, response, sso.ErrLoginState.Error())
+	*session = adaSession
+
+	// Ada links the provider while signed in, even with another address
+	response = oidcFlow(t, app, "/api/user/identities/oidc/test?redirect=/profile", session, nil)
+	if location := response.Header.Get("Location"); response.StatusCode != http.StatusFound || location != config.AppBaseURL+"/profile" {
+		t.Fatalf("link = %d to %q, want the frontend /profile", response.StatusCode, location)
+	}
+	var link models.UserIdentity
+	if err := database.DB.Where("provider = ? AND subject = ?", "oidc:test", "ada-1").First(&link).Error; err != nil || link.UserID != ada.ID {
+		t.Fatalf("link = %+v, %v; want one to ada", link, err)
+	}
+	ssoOutcome(t, oidcSignIn(t, app, nil), "")
+
+	// Nobody else can link the same provider account
+	ssoOutcome(t, oidcFlow(t, app, "/api/user/identities/oidc/test", graceSession, nil), accounts.ErrExternalLinkedElsewhere.Error())
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/directory"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/throttle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ForgotPassword emails a reset link if the address belongs to an account.
+// The response is the same either way and is sent before any lookup, so
+// neither its content nor its timing tells whether the account exists.
+func ForgotPassword(c *fiber.Ctx) error {
+	fmt.Println("Received a password reset request")
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if strings.TrimSpace(data["email"]) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email is required",
+		})
+	}
+
+	// The request context is recycled once the handler returns
+	email, ip := strings.Clone(data["email"]), strings.Clone(c.IP())
+	go func() {
+		// Directory passwords are reset in the directory
+		if directory.ForEmail(email) != nil {
+			return
+		}
+		if err := accounts.RequestPasswordReset(database.DB, email, ip); err != nil {
+			fmt.Println("Error sending password reset:", err)
+		}
+	}()
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If an account exists for this address, a reset link has been sent to it",
+	})
+}
+
+// ResetPassword sets a new password using the token from a reset link
+func ResetPassword(c *fiber.Ctx) error {
+	fmt.Println("Received a password reset")
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if data["password"] == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Password is required",
+		})
+	}
+	if data["password"] != data["password_confirm"] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Passwords do not match",
+		})
+	}
+
+	user, err := accounts.ResetPassword(database.DB, c, data["token"], data["password"])
+	if errors.Is(err, accounts.ErrResetExpired) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	var weak *policy.PasswordError
+	if errors.Is(err, accounts.ErrResetInvalid) || errors.As(err, &weak) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset password",
+		})
+	}
+
+	// The owner proved themselves, so earlier failed logins no longer count
+	throttle.ResetLogin(user.Email)
+
+	// Signed out everywhere, including any session this browser had
+	clearAuthCookie(c)
+
+	return c.JSON(fiber.Map{
+		"message": "Password has been reset, please log in",
+	})
+}
+
+// GetPasswordPolicy describes the rules new passwords must follow so forms
+// can show them up front
+func GetPasswordPolicy(c *fiber.Ctx) error {
+	return c.JSON(policy.Requirements())
+}
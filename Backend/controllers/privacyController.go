@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ExportUserData returns everything stored about the current user as a
+// downloadable JSON bundle
+func ExportUserData(c *fiber.Ctx) error {
+	fmt.Println("Received a personal data export request")
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	return sendUserExport(c, user)
+}
+
+// ExportUserDataByID returns the personal data bundle of any user, for
+// subject access requests (admin only)
+func ExportUserDataByID(c *fiber.Ctx) error {
+	fmt.Println("Admin request - ExportUserDataByID")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := audit.Record(database.DB, c, "user.export", "user", user.ID, nil, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record export in audit log",
+		})
+	}
+
+	return sendUserExport(c, user)
+}
+
+// RequestAccountDeletion schedules the current user's account for erasure
+// after the grace period. The password must be confirmed.
+func RequestAccountDeletion(c *fiber.Ctx) error {
+	fmt.Println("Received an account deletion request")
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	if !verifyPassword(user, data["password"]) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Password is incorrect",
+		})
+	}
+
+	// The last admin cannot leave the app without one
+	if user.Role == "admin" {
+		var admins int64
+		database.DB.Model(&models.User{}).Where("role = ?", "admin").Count(&admins)
+		if admins <= 1 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The last admin account cannot be deleted",
+			})
+		}
+	}
+
+	if config.AccountDeletionGraceDays <= 0 {
+		if err := accounts.Erase(database.DB, c, user, accounts.ReasonSelfService); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to delete account",
+			})
+		}
+		clearAuthCookie(c)
+		return c.JSON(fiber.Map{
+			"message": "Account deleted",
+		})
+	}
+
+	if user.DeletionScheduledFor == 0 {
+		now := time.Now()
+		user.DeletionRequestedAt = now.Unix()
+		user.DeletionScheduledFor = now.AddDate(0, 0, config.AccountDeletionGraceDays).Unix()
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "user.deletion_request", "user", user.ID, nil, fiber.Map{
+				"deletion_scheduled_for": user.DeletionScheduledFor,
+			})
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to schedule account deletion",
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":                "Account scheduled for deletion",
+		"deletion_scheduled_for": user.DeletionScheduledFor,
+	})
+}
+
+// CancelAccountDeletion keeps the current user's account during the grace period
+func CancelAccountDeletion(c *fiber.Ctx) error {
+	fmt.Println("Received an account deletion cancellation")
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUserIdFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	if user.DeletionScheduledFor == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No account deletion is pending",
+		})
+	}
+
+	before := fiber.Map{"deletion_scheduled_for": user.DeletionScheduledFor}
+	user.DeletionRequestedAt = 0
+	user.DeletionScheduledFor = 0
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "user.deletion_cancel", "user", user.ID, before, nil)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to cancel account deletion",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Account deletion cancelled",
+	})
+}
+
+// EraseUser erases a user and their personal data right away, for erasure
+// requests received outside the app (admin only)
+func EraseUser(c *fiber.Ctx) error {
+	fmt.Println("Admin request - EraseUser")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	id := c.Params("id")
+	if strconv.Itoa(int(utils.GetUserIdFromToken(c))) == id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot erase your own account",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := accounts.Erase(database.DB, c, user, accounts.ReasonAdminRequest); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to erase user: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User erased successfully",
+	})
+}
+
+// sendUserExport writes the personal data bundle of a user
+func sendUserExport(c *fiber.Ctx, user models.User) error {
+	sessions := []models.Session{}
+	accessLogs := []models.AccessLog{}
+	grants := []models.DriveGrant{}
+	events := []models.AuditEvent{}
+	identities := []models.UserIdentity{}
+	var override *models.MappingOverride
+
+	database.DB.Where("user_id = ?", user.ID).Order("id").Find(&sessions)
+	database.DB.Where("user_id = ?", user.ID).Order("id").Find(&accessLogs)
+	database.DB.Where("user_id = ?", user.ID).Order("id").Find(&grants)
+	database.DB.Where("user_id = ?", user.ID).Order("id").Find(&identities)
+	database.DB.Where("(target_type = ? AND target_id = ?) OR actor_id = ?", "user", strconv.Itoa(int(user.ID)), user.ID).
+		Order("id").Find(&events)
+
+	var found models.MappingOverride
+	if err := database.DB.Where("email = ?", user.Email).First(&found).Error; err == nil {
+		override = &found
+	}
+
+	entries := make([]auditEntry, 0, len(events))
+	for _, event := range events {
+		entries = append(entries, auditEntry{
+			AuditEvent: event,
+			Before:     rawSnapshot(event.Before),
+			After:      rawSnapshot(event.After),
+		})
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="user-%d-export.json"`, user.ID))
+	return c.JSON(fiber.Map{
+		"exported_at":      time.Now().Unix(),
+		"user":             user,
+		"sessions":         sessions,
+		"access_logs":      accessLogs,
+		"drive_grants":     grants,
+		"identities":       identities,
+		"mapping_override": override,
+		"audit_events":     entries,
+	})
+}
+
+// clearAuthCookie expires the JWT cookie
+func clearAuthCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+	})
+}
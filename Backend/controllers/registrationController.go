@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetRegistrationPolicy summarises who may currently self-register (admin only)
+func GetRegistrationPolicy(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetRegistrationPolicy")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var allowRules, blockRules int64
+	database.DB.Model(&models.RegistrationDomainRule{}).Where("action = ?", models.RegistrationAllow).Count(&allowRules)
+	database.DB.Model(&models.RegistrationDomainRule{}).Where("action = ?", models.RegistrationBlock).Count(&blockRules)
+
+	mode := policy.RegistrationMode()
+	return c.JSON(fiber.Map{
+		"mode":                    mode,
+		"allow_rules":             allowRules,
+		"block_rules":             blockRules,
+		"allowlist_active":        mode == policy.RegistrationMappedDomains || allowRules > 0,
+		"mapped_domains_allowed":  mode == policy.RegistrationMappedDomains,
+		"block_disposable_emails": config.BlockDisposableEmails,
+		"disposable_domains":      len(policy.DisposableDomains()),
+	})
+}
+
+// GetRegistrationRules lists the registration domain rules (admin only)
+func GetRegistrationRules(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetRegistrationRules")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query := filterEqual(c, database.DB.Model(&models.RegistrationDomainRule{}), map[string]string{
+		"action": "action",
+	})
+	query = filterSearch(c, query, "domain", "description")
+
+	rules := []models.RegistrationDomainRule{}
+	if err := query.Order("domain").Find(&rules).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch registration rules",
+		})
+	}
+	return c.JSON(rules)
+}
+
+// CreateRegistrationRule allows or blocks signup for a domain (admin only)
+func CreateRegistrationRule(c *fiber.Ctx) error {
+	fmt.Println("Admin request - CreateRegistrationRule")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var input models.RegistrationDomainRule
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	rule, err := policy.NormalizeDomainRule(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var existing models.RegistrationDomainRule
+	if database.DB.Where("domain = ?", rule.Domain).First(&existing).Error == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A rule for this domain already exists",
+		})
+	}
+
+	now := time.Now().Unix()
+	rule.ID = 0
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	rule.CreatedBy = utils.GetUserIdFromToken(c)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "registration_rule.create", "registration_rule", rule.ID, nil, rule)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create registration rule",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// UpdateRegistrationRule changes a registration domain rule (admin only)
+func UpdateRegistrationRule(c *fiber.Ctx) error {
+	fmt.Println("Admin request - UpdateRegistrationRule")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var rule models.RegistrationDomainRule
+	if err := database.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Registration rule not found",
+		})
+	}
+	before := rule
+
+	// Fields left out of the body keep their values
+	input := rule
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	updated, err := policy.NormalizeDomainRule(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var existing models.RegistrationDomainRule
+	if database.DB.Where("domain = ? AND id <> ?", updated.Domain, rule.ID).First(&existing).Error == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A rule for this domain already exists",
+		})
+	}
+
+	rule.Domain = updated.Domain
+	rule.Action = updated.Action
+	rule.Department = updated.Department
+	rule.Role = updated.Role
+	rule.Description = updated.Description
+	rule.UpdatedAt = time.Now().Unix()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&rule).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "registration_rule.update", "registration_rule", rule.ID, before, rule)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update registration rule",
+		})
+	}
+
+	return c.JSON(rule)
+}
+
+// DeleteRegistrationRule removes a registration domain rule (admin only)
+func DeleteRegistrationRule(c *fiber.Ctx) error {
+	fmt.Println("Admin request - DeleteRegistrationRule")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var rule models.RegistrationDomainRule
+	if err := database.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Registration rule not found",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&rule).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "registration_rule.delete", "registration_rule", rule.ID, rule, nil)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete registration rule",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Registration rule deleted",
+	})
+}
+
+// CheckRegistrationEmail shows what the policy would decide for an email
+// address without registering anyone (admin only)
+func CheckRegistrationEmail(c *fiber.Ctx) error {
+	fmt.Println("Admin request - CheckRegistrationEmail")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	signup, err := policy.CheckRegistration(database.DB, data["email"])
+	result := fiber.Map{
+		"allowed": err == nil,
+		"signup":  signup,
+	}
+	if err != nil {
+		result["reason"] = err.Error()
+	}
+	return c.JSON(result)
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/jobs"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAccessLogRetention returns the retention settings, the next cutoff and
+// recent purge runs with their totals (admin only)
+func GetAccessLogRetention(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetAccessLogRetention")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	runs := []models.RetentionRun{}
+	if err := database.DB.Order("id DESC").Limit(20).Find(&runs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch retention runs",
+		})
+	}
+
+	var totals struct {
+		Runs     int64 `json:"runs"`
+		Failed   int64 `json:"failed"`
+		Deleted  int64 `json:"deleted"`
+		RolledUp int64 `json:"rolled_up"`
+	}
+	database.DB.Model(&models.RetentionRun{}).
+		Select("COUNT(*) AS runs, SUM(CASE WHEN error <> '' THEN 1 ELSE 0 END) AS failed, COALESCE(SUM(deleted), 0) AS deleted, COALESCE(SUM(rolled_up), 0) AS rolled_up").
+		Scan(&totals)
+
+	var oldest int64
+	database.DB.Model(&models.AccessLog{}).Select("COALESCE(MIN(timestamp), 0)").Scan(&oldest)
+
+	settings := fiber.Map{
+		"retention_days":   config.AccessLogRetentionDays,
+		"mode":             strings.ToLower(config.AccessLogRetentionMode),
+		"interval_minutes": config.AccessLogPurgeIntervalMinutes,
+		"ip_mode":          strings.ToLower(config.AccessLogIPMode),
+		"store_user_agent": config.AccessLogUserAgent,
+	}
+	if config.AccessLogRetentionDays > 0 {
+		settings["cutoff"] = jobs.RetentionCutoff(time.Now(), config.AccessLogRetentionDays)
+	}
+
+	return c.JSON(fiber.Map{
+		"settings":   settings,
+		"oldest_log": oldest,
+		"totals":     totals,
+		"runs":       runs,
+	})
+}
+
+// RunAccessLogRetention expires old access logs now instead of waiting for
+// the scheduled job (admin only)
+func RunAccessLogRetention(c *fiber.Ctx) error {
+	fmt.Println("Admin request - RunAccessLogRetention")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	if config.AccessLogRetentionDays <= 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Access log retention is disabled, set ACCESS_LOG_RETENTION_DAYS",
+		})
+	}
+
+	run, err := jobs.RunRetention(database.DB, time.Now())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Retention run failed: " + err.Error(),
+			"run":   run,
+		})
+	}
+
+	if err := audit.Record(database.DB, c, "access_logs.purge", "retention_run", run.ID, nil, run); err != nil {
+		fmt.Println("Error recording retention run in audit log:", err)
+	}
+
+	return c.JSON(run)
+}
+
+// GetAccessLogRollups returns the daily aggregates kept for expired access
+// logs, optionally filtered by domain and date range (admin only)
+func GetAccessLogRollups(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetAccessLogRollups")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query := database.DB.Model(&models.AccessLogRollup{})
+	if domain := c.Query("domain"); domain != "" {
+		query = query.Where("domain = ?", strings.ToLower(domain))
+	}
+	for param, condition := range map[string]string{"from": "day >= ?", "to": "day < ?"} {
+		if raw := c.Query(param); raw != "" {
+			value, err := utils.ParseTimeParam(raw)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			query = query.Where(condition, value)
+		}
+	}
+
+	rollups := []models.AccessLogRollup{}
+	if err := query.Order("day DESC, lookups DESC").Limit(analyticsLimit(c)).Find(&rollups).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch access log rollups",
+		})
+	}
+
+	return c.JSON(rollups)
+}
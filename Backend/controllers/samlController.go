@@ -0,0 +1,362 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/sso"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// samlConnectionInput is a connection as admins send it, metadata included
+type samlConnectionInput struct {
+	models.SAMLConnection
+	MetadataXML *string `json:"metadata_xml"`
+}
+
+// SAMLMetadata serves the service provider metadata partner identity
+// providers are set up with
+func SAMLMetadata(c *fiber.Ctx) error {
+	metadata, err := sso.SAMLMetadata()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build SAML metadata",
+		})
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+	return c.Send(metadata)
+}
+
+// SAMLLogin sends the browser to the identity provider of the email's domain.
+// The optional redirect query is the frontend path to return to.
+func SAMLLogin(c *fiber.Ctx) error {
+	fmt.Println("Received a SAML login request")
+
+	connection, err := sso.MatchSAMLConnection(database.DB, c.Query("email"))
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+	if connection == nil {
+		return ssoFailed(c, sso.ErrSAMLNoConnection)
+	}
+
+	state, _, err := sso.NewLoginState(sso.SAMLProvider(*connection), c.Query("redirect"))
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+	authURL, requestID, err := sso.SAMLAuthURL(*connection, state.State)
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+	state.RequestID = requestID
+	signed, err := state.Sign()
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+
+	// The identity provider posts back from its own site, so over HTTPS the
+	// cookie has to be allowed on cross-site requests
+	secure := strings.HasPrefix(config.APIBaseURL, "https://")
+	sameSite := "Lax"
+	if secure {
+		sameSite = "None"
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     ssoStateCookie,
+		Value:    signed,
+		Expires:  time.Now().Add(sso.LoginStateTTL),
+		HTTPOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+		Path:     "/api/auth",
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// SAMLACS receives the identity provider's signed response, signs the user
+// in and returns the browser to the frontend
+func SAMLACS(c *fiber.Ctx) error {
+	fmt.Println("Received a SAML response")
+
+	signed := c.Cookies(ssoStateCookie)
+	clearSSOStateCookie(c)
+
+	// Sign-ins the identity provider starts on its own are not accepted
+	connection, err := sso.FindSAMLConnection(database.DB, sso.LoginStateProvider(signed))
+	if err != nil {
+		return ssoFailed(c, sso.ErrLoginState)
+	}
+	state, err := sso.ParseLoginState(signed, sso.SAMLProvider(*connection), c.FormValue("RelayState"))
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+
+	identity, err := sso.SAMLIdentity(*connection, c.FormValue("SAMLResponse"), state.RequestID)
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+
+	user, err := accounts.SignInExternal(database.DB, c, identity, connection.CreateUsers)
+	if err != nil {
+		return ssoFailed(c, err)
+	}
+	return ssoSignedIn(c, user, state.Redirect)
+}
+
+// samlLoginURL is where a user of a SAML domain starts signing in
+func samlLoginURL(email string) string {
+	return strings.TrimSuffix(config.APIBaseURL, "/") + "/api/auth/saml/login?email=" + url.QueryEscape(email)
+}
+
+// GetSAMLConnections lists the SAML connections (admin only)
+func GetSAMLConnections(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetSAMLConnections")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	connections := []models.SAMLConnection{}
+	if err := database.DB.Order("domain").Find(&connections).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch SAML connections",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"metadata_url": strings.TrimSuffix(config.APIBaseURL, "/") + "/api/auth/saml/metadata",
+		"connections":  connections,
+	})
+}
+
+// CreateSAMLConnection sets up single sign-on for a domain from its identity
+// provider's metadata (admin only)
+func CreateSAMLConnection(c *fiber.Ctx) error {
+	fmt.Println("Admin request - CreateSAMLConnection")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	input := samlConnectionInput{SAMLConnection: models.SAMLConnection{IsActive: true}}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+	if input.MetadataXML != nil {
+		input.SAMLConnection.MetadataXML = *input.MetadataXML
+	}
+
+	connection, err := sso.NormalizeSAMLConnection(input.SAMLConnection)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var existing models.SAMLConnection
+	if database.DB.Where("domain = ?", connection.Domain).First(&existing).Error == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A SAML connection for this domain already exists",
+		})
+	}
+
+	now := time.Now().Unix()
+	connection.ID = 0
+	connection.CreatedAt = now
+	connection.UpdatedAt = now
+	connection.CreatedBy = utils.GetUserIdFromToken(c)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&connection).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "saml_connection.create", "saml_connection", connection.ID, nil, connection)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create SAML connection",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(connection)
+}
+
+// UpdateSAMLConnection changes a SAML connection (admin only)
+func UpdateSAMLConnection(c *fiber.Ctx) error {
+	fmt.Println("Admin request - UpdateSAMLConnection")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var connection models.SAMLConnection
+	if err := database.DB.First(&connection, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SAML connection not found",
+		})
+	}
+
+	// Fields left out of the body keep their values
+	input := samlConnectionInput{SAMLConnection: connection}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+	if input.MetadataXML != nil {
+		input.SAMLConnection.MetadataXML = *input.MetadataXML
+	}
+
+	return saveSAMLConnection(c, connection, input.SAMLConnection)
+}
+
+// UploadSAMLMetadata replaces a connection's identity provider metadata,
+// such as when the provider rotates its certificate. The XML is the request
+// body or a multipart "file" field (admin only).
+func UploadSAMLMetadata(c *fiber.Ctx) error {
+	fmt.Println("Admin request - UploadSAMLMetadata")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var connection models.SAMLConnection
+	if err := database.DB.First(&connection, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SAML connection not found",
+		})
+	}
+
+	metadata := c.Body()
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "a file field is required",
+			})
+		}
+		file, err := header.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		defer file.Close()
+		if metadata, err = io.ReadAll(file); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	updated := connection
+	updated.MetadataXML = string(metadata)
+	return saveSAMLConnection(c, connection, updated)
+}
+
+// saveSAMLConnection validates and stores changes to a connection
+func saveSAMLConnection(c *fiber.Ctx, connection, input models.SAMLConnection) error {
+	before := connection
+
+	updated, err := sso.NormalizeSAMLConnection(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var existing models.SAMLConnection
+	if database.DB.Where("domain = ? AND id <> ?", updated.Domain, connection.ID).First(&existing).Error == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "A SAML connection for this domain already exists",
+		})
+	}
+
+	updated.ID = connection.ID
+	updated.CreatedAt = connection.CreatedAt
+	updated.CreatedBy = connection.CreatedBy
+	updated.UpdatedAt = time.Now().Unix()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&updated).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "saml_connection.update", "saml_connection", updated.ID, before, updated)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update SAML connection",
+		})
+	}
+
+	return c.JSON(updated)
+}
+
+// DeleteSAMLConnection removes a SAML connection; its users sign in with a
+// password again (admin only)
+func DeleteSAMLConnection(c *fiber.Ctx) error {
+	fmt.Println("Admin request - DeleteSAMLConnection")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var connection models.SAMLConnection
+	if err := database.DB.First(&connection, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SAML connection not found",
+		})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&connection).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "saml_connection.delete", "saml_connection", connection.ID, connection, nil)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete SAML connection",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "SAML connection deleted",
+	})
+}
+
+// samlRequired answers a password login for a domain that signs in with SAML
+func samlRequired(c *fiber.Ctx, email string) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error":        "Your organization signs in with single sign-on",
+		"sso_required": true,
+		"sso_url":      samlLoginURL(email),
+	})
+}
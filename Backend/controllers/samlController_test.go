@@ -0,0 +1,246 @@
+package controllers_test
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/sso"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// samlTest signs in through a SAML stand-in serving acme.com
+type samlTest struct {
+	app     *fiber.App
+	standIn *sso.SAMLStandIn
+	server  *httptest.Server
+}
+
+func newSAMLTest(t *testing.T) *samlTest {
+	t.Helper()
+
+	test := &samlTest{app: newTestApp(t)}
+	if err := sso.LoadSAML(); err != nil {
+		t.Fatal(err)
+	}
+
+	test.server = httptest.NewUnstartedServer(nil)
+	var err error
+	test.standIn, err = sso.NewSAMLStandIn("http://" + test.server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.server.Config.Handler = test.standIn
+	test.server.Start()
+	t.Cleanup(test.server.Close)
+	test.trustServiceProvider(t)
+
+	metadata, err := test.standIn.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection, err := sso.NormalizeSAMLConnection(models.SAMLConnection{
+		Domain:        "acme.com",
+		MetadataXML:   string(metadata),
+		NameAttribute: "cn",
+		IsActive:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&connection).Error; err != nil {
+		t.Fatal(err)
+	}
+	return test
+}
+
+// trustServiceProvider gives the stand-in this server's metadata as it is
+// configured now
+func (s *samlTest) trustServiceProvider(t *testing.T) {
+	t.Helper()
+
+	metadata, err := sso.SAMLMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.standIn.AddServiceProvider(metadata); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// samlLogin is a sign-in started at this server and answered by the stand-in
+type samlLogin struct {
+	State      *http.Cookie
+	Response   string
+	RelayState string
+}
+
+var hiddenField = regexp.MustCompile(`name="(SAMLRequest|SAMLResponse|RelayState)" value="([^"]*)"`)
+
+// hiddenFields reads the hidden inputs of a SAML form
+func hiddenFields(t *testing.T, body io.Reader) map[string]string {
+	t.Helper()
+
+	page, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]string{}
+	for _, match := range hiddenField.FindAllStringSubmatch(string(page), -1) {
+		fields[match[1]] = html.UnescapeString(match[2])
+	}
+	return fields
+}
+
+// login starts a sign-in for email and has identityProvider answer it as
+// signInAs
+func (s *samlTest) login(t *testing.T, email, signInAs string, identityProvider http.Handler) samlLogin {
+	t.Helper()
+
+	start := get(t, s.app, "/api/auth/saml/login?redirect=/profile&email="+url.QueryEscape(email))
+	location, _ := url.Parse(start.Header.Get("Location"))
+	if start.StatusCode != http.StatusFound || !strings.HasSuffix(location.Path, "/sso") {
+		t.Fatalf("login went to %s with status %d, want the stand-in", location, start.StatusCode)
+	}
+	login := samlLogin{State: responseCookie(start, "sso_login")}
+
+	page, err := http.Get(location.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer page.Body.Close()
+	request := hiddenFields(t, page.Body)
+
+	form := url.Values{
+		"SAMLRequest": {request["SAMLRequest"]},
+		"RelayState":  {request["RelayState"]},
+		"email":       {signInAs},
+		"name":        {"Ada Lovelace"},
+	}
+	answer := httptest.NewRecorder()
+	post := httptest.NewRequest(http.MethodPost, "/sso", strings.NewReader(form.Encode()))
+	post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	identityProvider.ServeHTTP(answer, post)
+
+	response := hiddenFields(t, answer.Body)
+	if response["SAMLResponse"] == "" {
+		t.Fatal("the identity provider sent no response")
+	}
+	login.Response, login.RelayState = response["SAMLResponse"], response["RelayState"]
+	return login
+}
+
+// post sends a response to the assertion consumer service
+func (s *samlTest) post(t *testing.T, response, relayState string, state *http.Cookie) *http.Response {
+	t.Helper()
+
+	form := url.Values{"SAMLResponse": {response}, "RelayState": {relayState}}
+	if state == nil {
+		return postForm(t, s.app, "/api/auth/saml/acs", form)
+	}
+	return postForm(t, s.app, "/api/auth/saml/acs", form, state)
+}
+
+func TestSAMLACSAcceptsSignedResponse(t *testing.T) {
+	test := newSAMLTest(t)
+	user := createUser(t, "ada@acme.com")
+
+	login := test.login(t, "ada@acme.com", "ada@acme.com", test.standIn)
+	response := test.post(t, login.Response, login.RelayState, login.State)
+	ssoOutcome(t, response, "")
+	if location := response.Header.Get("Location"); location != config.AppBaseURL+"/profile" {
+		t.Errorf("redirect = %q, want the frontend /profile", location)
+	}
+
+	var link models.UserIdentity
+	if err := database.DB.Where("user_id = ?", user.ID).First(&link).Error; err != nil || !strings.HasPrefix(link.Provider, "saml:") {
+		t.Errorf("identity = %+v, %v; want a SAML link", link, err)
+	}
+}
+
+func TestSAMLACSRejectsBadSignature(t *testing.T) {
+	test := newSAMLTest(t)
+	createUser(t, "ada@acme.com")
+
+	// Another identity provider at the same address signs with its own key
+	forger, err := sso.NewSAMLStandIn(test.standIn.IDP.MetadataURL.Scheme + "://" + test.standIn.IDP.MetadataURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, _ := sso.SAMLMetadata()
+	forger.AddServiceProvider(metadata)
+
+	login := test.login(t, "ada@acme.com", "ada@acme.com", forger)
+	ssoOutcome(t, test.post(t, login.Response, login.RelayState, login.State), sso.ErrSAMLResponse.Error())
+}
+
+func TestSAMLACSRejectsWrongAudience(t *testing.T) {
+	test := newSAMLTest(t)
+	createUser(t, "ada@acme.com")
+
+	// A response meant for another service provider, with its audience and
+	// recipient, is replayed here
+	previous := config.APIBaseURL
+	t.Cleanup(func() { config.APIBaseURL = previous })
+	config.APIBaseURL = "https://other.example.org"
+	test.trustServiceProvider(t)
+	login := test.login(t, "ada@acme.com", "ada@acme.com", test.standIn)
+	config.APIBaseURL = previous
+
+	ssoOutcome(t, test.post(t, login.Response, login.RelayState, login.State), sso.ErrSAMLResponse.Error())
+}
+
+func TestSAMLACSRejectsWrongInResponseTo(t *testing.T) {
+	test := newSAMLTest(t)
+	createUser(t, "ada@acme.com")
+
+	first := test.login(t, "ada@acme.com", "ada@acme.com", test.standIn)
+	second := test.login(t, "ada@acme.com", "ada@acme.com", test.standIn)
+
+	// The first response, posted in the second sign-in
+	ssoOutcome(t, test.post(t, first.Response, second.RelayState, second.State), sso.ErrSAMLResponse.Error())
+}
+
+func TestSAMLACSRejectsUnsolicitedResponse(t *testing.T) {
+	test := newSAMLTest(t)
+	createUser(t, "ada@acme.com")
+
+	// Without the state of a sign-in started here
+	login := test.login(t, "ada@acme.com", "ada@acme.com", test.standIn)
+	ssoOutcome(t, test.post(t, login.Response, login.RelayState, nil), sso.ErrLoginState.Error())
+
+	// A response the identity provider started on its own answers no request
+	pending := test.login(t, "ada@acme.com", "ada@acme.com", test.standIn)
+	answer := httptest.NewRecorder()
+	form := url.Values{"email": {"ada@acme.com"}}
+	request := httptest.NewRequest(http.MethodPost, "/idp-initiated", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	entityID := strings.TrimSuffix(config.APIBaseURL, "/") + "/api/auth/saml/metadata"
+	test.standIn.IDP.ServeIDPInitiated(answer, request, entityID, pending.RelayState)
+
+	unsolicited := hiddenFields(t, answer.Body)
+	if unsolicited["SAMLResponse"] == "" {
+		t.Fatal("the identity provider sent no response")
+	}
+	ssoOutcome(t, test.post(t, unsolicited["SAMLResponse"], pending.RelayState, pending.State), sso.ErrSAMLResponse.Error())
+}
+
+func TestSAMLACSRejectsEmailOutsideDomain(t *testing.T) {
+	test := newSAMLTest(t)
+	createUser(t, "ada@acme.com")
+	createUser(t, "eve@example.org")
+
+	login := test.login(t, "ada@acme.com", "eve@example.org", test.standIn)
+	ssoOutcome(t, test.post(t, login.Response, login.RelayState, login.State), sso.ErrDomainNotServed.Error())
+
+	login = test.login(t, "ada@acme.com", "eve@notacme.com", test.standIn)
+	ssoOutcome(t, test.post(t, login.Response, login.RelayState, login.State), sso.ErrDomainNotServed.Error())
+}
@@ -0,0 +1,511 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/scim"
+	"JWT-Authentication-go/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// scimContentType is the media type of SCIM requests and responses
+const scimContentType = "application/scim+json"
+
+// RequireSCIMToken admits requests carrying an active SCIM token
+func RequireSCIMToken(c *fiber.Ctx) error {
+	token, err := scim.FindToken(database.DB, c.Get(fiber.HeaderAuthorization))
+	if err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="scim"`)
+		return scimError(c, fiber.StatusUnauthorized, "", err.Error())
+	}
+	fmt.Printf("SCIM request - %s %s (token %d)\n", c.Method(), c.Path(), token.ID)
+	return c.Next()
+}
+
+// scimJSON sends a SCIM response, with the resource's version as its ETag
+func scimJSON(c *fiber.Ctx, status int, body map[string]interface{}) error {
+	if version := scim.Version(body); version != "" {
+		c.Set(fiber.HeaderETag, version)
+	}
+	return c.Status(status).JSON(body, scimContentType)
+}
+
+// scimError sends a SCIM error message
+func scimError(c *fiber.Ctx, status int, scimType, detail string) error {
+	body := fiber.Map{
+		"schemas": []string{scim.ErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	return c.Status(status).JSON(body, scimContentType)
+}
+
+// scimFailed reports a provisioning error
+func scimFailed(c *fiber.Ctx, err error) error {
+	var passwordErr *policy.PasswordError
+	switch {
+	case errors.Is(err, scim.ErrNotFound):
+		return scimError(c, fiber.StatusNotFound, "", "Resource not found")
+	case errors.Is(err, scim.ErrUniqueness):
+		return scimError(c, fiber.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, scim.ErrLastAdmin):
+		return scimError(c, fiber.StatusConflict, "mutability", err.Error())
+	case errors.Is(err, scim.ErrInvalidFilter):
+		return scimError(c, fiber.StatusBadRequest, "invalidFilter", err.Error())
+	case errors.Is(err, scim.ErrInvalidPath):
+		return scimError(c, fiber.StatusBadRequest, "invalidPath", err.Error())
+	case errors.Is(err, scim.ErrNoTarget):
+		return scimError(c, fiber.StatusBadRequest, "noTarget", err.Error())
+	case errors.Is(err, scim.ErrInvalidValue):
+		return scimError(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	case errors.As(err, &passwordErr):
+		return scimError(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	}
+	fmt.Println("SCIM request failed:", err)
+	return scimError(c, fiber.StatusInternalServerError, "", "The request could not be completed")
+}
+
+// scimBody reads a SCIM request body into v
+func scimBody(c *fiber.Ctx, v interface{}) error {
+	if err := json.Unmarshal(c.Body(), v); err != nil {
+		return scimError(c, fiber.StatusBadRequest, "invalidSyntax", "The request body is not valid JSON")
+	}
+	return nil
+}
+
+// scimPreconditionFailed reports whether an If-Match header names an older
+// version of the resource
+func scimPreconditionFailed(c *fiber.Ctx, resource map[string]interface{}) bool {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	return ifMatch != "" && !scim.ETagMatches(ifMatch, resource)
+}
+
+// scimListQuery reads the filter, which is nil without one, and the paging
+// of a list request
+func scimListQuery(c *fiber.Ctx) (scim.Filter, int, int, error) {
+	var filter scim.Filter
+	if raw := c.Query("filter"); raw != "" {
+		parsed, err := scim.ParseFilter(raw)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		filter = parsed
+	}
+
+	startIndex := c.QueryInt("startIndex", 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := c.QueryInt("count", scim.MaxResults)
+	if count < 0 {
+		count = 0
+	}
+	if count > scim.MaxResults {
+		count = scim.MaxResults
+	}
+	return filter, startIndex, count, nil
+}
+
+// scimList answers a list request from all the resources, applying its
+// filter and paging
+func scimList(c *fiber.Ctx, resources []map[string]interface{}) error {
+	filter, startIndex, count, err := scimListQuery(c)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	page, total := scim.Page(scim.Select(resources, filter), startIndex, count)
+	return scimPage(c, page, total, startIndex)
+}
+
+// scimPage sends one page of a list with the requested attributes
+func scimPage(c *fiber.Ctx, resources []map[string]interface{}, total, startIndex int) error {
+	page := make([]map[string]interface{}, 0, len(resources))
+	for _, resource := range resources {
+		page = append(page, scim.Project(resource, c.Query("attributes"), c.Query("excludedAttributes")))
+	}
+	return c.JSON(scim.ListResponse(page, total, startIndex), scimContentType)
+}
+
+// scimGet answers a request for one resource, honoring If-None-Match
+func scimGet(c *fiber.Ctx, resource map[string]interface{}) error {
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" && scim.ETagMatches(ifNoneMatch, resource) {
+		c.Set(fiber.HeaderETag, scim.Version(resource))
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	projected := scim.Project(resource, c.Query("attributes"), c.Query("excludedAttributes"))
+	return scimJSON(c, fiber.StatusOK, projected)
+}
+
+// SCIMServiceProviderConfig describes the SCIM features this server supports
+func SCIMServiceProviderConfig(c *fiber.Ctx) error {
+	return c.JSON(scim.ServiceProviderConfig(), scimContentType)
+}
+
+// SCIMResourceTypes lists the SCIM resource types
+func SCIMResourceTypes(c *fiber.Ctx) error {
+	types := scim.ResourceTypes()
+	return c.JSON(scim.ListResponse(types, len(types), 1), scimContentType)
+}
+
+// SCIMSchemas lists the SCIM schemas and the attributes this server reads
+func SCIMSchemas(c *fiber.Ctx) error {
+	schemas := scim.Schemas()
+	return c.JSON(scim.ListResponse(schemas, len(schemas), 1), scimContentType)
+}
+
+// GetSCIMUsers lists users, optionally filtered, e.g. by userName
+func GetSCIMUsers(c *fiber.Ctx) error {
+	filter, startIndex, count, err := scimListQuery(c)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	page, total, err := scim.Users(database.DB, filter, startIndex, count)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return scimPage(c, page, total, startIndex)
+}
+
+// GetSCIMUser returns one user
+func GetSCIMUser(c *fiber.Ctx) error {
+	_, resource, err := scim.User(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return scimGet(c, resource)
+}
+
+// CreateSCIMUser provisions a user
+func CreateSCIMUser(c *fiber.Ctx) error {
+	resource := map[string]interface{}{}
+	if err := scimBody(c, &resource); err != nil {
+		return err
+	}
+	input, err := scim.ParseUser(resource)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+
+	user, err := scim.CreateUser(database.DB, c, input)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+
+	_, created, err := scim.User(database.DB, strconv.FormatUint(uint64(user.ID), 10))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	c.Location(scim.BaseURL() + "/Users/" + strconv.FormatUint(uint64(user.ID), 10))
+	return scimJSON(c, fiber.StatusCreated, created)
+}
+
+// ReplaceSCIMUser replaces a user's attributes
+func ReplaceSCIMUser(c *fiber.Ctx) error {
+	user, current, err := scim.User(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	if scimPreconditionFailed(c, current) {
+		return scimError(c, fiber.StatusPreconditionFailed, "", "The user has changed since it was read")
+	}
+
+	resource := map[string]interface{}{}
+	if err := scimBody(c, &resource); err != nil {
+		return err
+	}
+	input, err := scim.ParseUser(resource)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return saveSCIMUser(c, user, input)
+}
+
+// PatchSCIMUser changes some attributes of a user, e.g. deactivates them
+func PatchSCIMUser(c *fiber.Ctx) error {
+	user, resource, err := scim.User(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	if scimPreconditionFailed(c, resource) {
+		return scimError(c, fiber.StatusPreconditionFailed, "", "The user has changed since it was read")
+	}
+
+	var patch scim.PatchRequest
+	if err := scimBody(c, &patch); err != nil {
+		return err
+	}
+	if err := scim.Patch(resource, patch.Operations); err != nil {
+		return scimFailed(c, err)
+	}
+	input, err := scim.ParseUser(resource)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return saveSCIMUser(c, user, input)
+}
+
+// saveSCIMUser stores a user's new attributes and returns the resource
+func saveSCIMUser(c *fiber.Ctx, user models.User, input scim.UserInput) error {
+	user, err := scim.UpdateUser(database.DB, c, user, input)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	_, updated, err := scim.User(database.DB, strconv.FormatUint(uint64(user.ID), 10))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return scimJSON(c, fiber.StatusOK, updated)
+}
+
+// DeleteSCIMUser deprovisions a user, erasing the account
+func DeleteSCIMUser(c *fiber.Ctx) error {
+	user, resource, err := scim.User(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	if scimPreconditionFailed(c, resource) {
+		return scimError(c, fiber.StatusPreconditionFailed, "", "The user has changed since it was read")
+	}
+
+	if err := scim.DeleteUser(database.DB, c, user); err != nil {
+		return scimFailed(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetSCIMGroups lists groups, optionally filtered, e.g. by displayName
+func GetSCIMGroups(c *fiber.Ctx) error {
+	resources, err := scim.Groups(database.DB)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return scimList(c, resources)
+}
+
+// GetSCIMGroup returns one group with its members
+func GetSCIMGroup(c *fiber.Ctx) error {
+	_, resource, err := scim.Group(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return scimGet(c, resource)
+}
+
+// CreateSCIMGroup provisions the admin group or a department
+func CreateSCIMGroup(c *fiber.Ctx) error {
+	resource := map[string]interface{}{}
+	if err := scimBody(c, &resource); err != nil {
+		return err
+	}
+	input, err := scim.ParseGroup(resource)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+
+	group, err := scim.CreateGroup(database.DB, c, input)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+
+	_, created, err := scim.Group(database.DB, strconv.FormatUint(uint64(group.ID), 10))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	c.Location(scim.BaseURL() + "/Groups/" + strconv.FormatUint(uint64(group.ID), 10))
+	return scimJSON(c, fiber.StatusCreated, created)
+}
+
+// ReplaceSCIMGroup replaces a group's name and members
+func ReplaceSCIMGroup(c *fiber.Ctx) error {
+	group, current, err := scim.Group(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	if scimPreconditionFailed(c, current) {
+		return scimError(c, fiber.StatusPreconditionFailed, "", "The group has changed since it was read")
+	}
+
+	resource := map[string]interface{}{}
+	if err := scimBody(c, &resource); err != nil {
+		return err
+	}
+	input, err := scim.ParseGroup(resource)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return saveSCIMGroup(c, group, input)
+}
+
+// PatchSCIMGroup changes a group, usually adding or removing members
+func PatchSCIMGroup(c *fiber.Ctx) error {
+	group, resource, err := scim.Group(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	if scimPreconditionFailed(c, resource) {
+		return scimError(c, fiber.StatusPreconditionFailed, "", "The group has changed since it was read")
+	}
+
+	var patch scim.PatchRequest
+	if err := scimBody(c, &patch); err != nil {
+		return err
+	}
+	if err := scim.Patch(resource, patch.Operations); err != nil {
+		return scimFailed(c, err)
+	}
+	input, err := scim.ParseGroup(resource)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return saveSCIMGroup(c, group, input)
+}
+
+// saveSCIMGroup stores a group's new name and members and returns the
+// resource
+func saveSCIMGroup(c *fiber.Ctx, group models.SCIMGroup, input scim.GroupInput) error {
+	group, err := scim.UpdateGroup(database.DB, c, group, input)
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	_, updated, err := scim.Group(database.DB, strconv.FormatUint(uint64(group.ID), 10))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	return scimJSON(c, fiber.StatusOK, updated)
+}
+
+// DeleteSCIMGroup removes a group; its members lose its role or department
+func DeleteSCIMGroup(c *fiber.Ctx) error {
+	group, resource, err := scim.Group(database.DB, c.Params("id"))
+	if err != nil {
+		return scimFailed(c, err)
+	}
+	if scimPreconditionFailed(c, resource) {
+		return scimError(c, fiber.StatusPreconditionFailed, "", "The group has changed since it was read")
+	}
+
+	if err := scim.DeleteGroup(database.DB, c, group); err != nil {
+		return scimFailed(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetSCIMTokens lists the SCIM tokens (admin only)
+func GetSCIMTokens(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetSCIMTokens")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	tokens := []models.SCIMToken{}
+	if err := database.DB.Order("id DESC").Find(&tokens).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch SCIM tokens",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"base_url": scim.BaseURL(),
+		"tokens":   tokens,
+	})
+}
+
+// CreateSCIMToken creates a token for an identity provider to provision
+// users with. The token is only shown in this response (admin only).
+func CreateSCIMToken(c *fiber.Ctx) error {
+	fmt.Println("Admin request - CreateSCIMToken")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+	if data["name"] == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name is required",
+		})
+	}
+
+	var token models.SCIMToken
+	var raw string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if token, raw, err = scim.NewToken(tx, data["name"], utils.GetUserIdFromToken(c)); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "scim_token.create", "scim_token", token.ID, nil, token)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create SCIM token",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token":    raw,
+		"base_url": scim.BaseURL(),
+		"scim":     token,
+	})
+}
+
+// RevokeSCIMToken stops a SCIM token from working (admin only)
+func RevokeSCIMToken(c *fiber.Ctx) error {
+	fmt.Println("Admin request - RevokeSCIMToken")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var token models.SCIMToken
+	if err := database.DB.First(&token, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "SCIM token not found",
+		})
+	}
+	if token.RevokedAt != 0 {
+		return c.JSON(token)
+	}
+
+	before := token
+	token.RevokedAt = time.Now().Unix()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&token).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "scim_token.revoke", "scim_token", token.ID, before, token)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke SCIM token",
+		})
+	}
+
+	return c.JSON(token)
+}
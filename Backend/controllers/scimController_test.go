@@ -0,0 +1,151 @@
+package controllers_test
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/scim"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scimRequest sends a SCIM request with a bearer token and optional headers,
+// given as name and value pairs
+func scimRequest(t *testing.T, app *fiber.App, token, method, path string, body interface{}, headers ...string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+
+	var encoded string
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded = string(data)
+	}
+	request := httptest.NewRequest(method, path, strings.NewReader(encoded))
+	request.Header.Set("Content-Type", "application/scim+json")
+	request.Header.Set("Authorization", "Bearer "+token)
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	response, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := map[string]interface{}{}
+	json.NewDecoder(response.Body).Decode(&result)
+	return response, result
+}
+
+// scimToken issues a SCIM token for a test
+func scimToken(t *testing.T) string {
+	t.Helper()
+
+	_, token, err := scim.NewToken(database.DB, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSCIMUserRejectsStaleIfMatch(t *testing.T) {
+	app := newTestApp(t)
+	token := scimToken(t)
+	admin := createUser(t, "admin@example.com")
+	database.DB.Model(&admin).Update("role", "admin")
+	user := createUser(t, "ada@example.com")
+	path := fmt.Sprintf("/scim/v2/Users/%d", user.ID)
+
+	response, _ := scimRequest(t, app, token, http.MethodGet, path, nil)
+	read := response.Header.Get("ETag")
+	if response.StatusCode != fiber.StatusOK || read == "" {
+		t.Fatalf("GET answered %d with ETag %q", response.StatusCode, read)
+	}
+
+	// Someone else changes the user after it was read
+	move := scim.PatchRequest{Operations: []scim.Operation{{Op: "replace", Path: scim.EnterpriseUserSchema + ":department", Value: "Analytics"}}}
+	response, _ = scimRequest(t, app, token, http.MethodPatch, path, move, "If-Match", read)
+	current := response.Header.Get("ETag")
+	if response.StatusCode != fiber.StatusOK || current == read {
+		t.Fatalf("PATCH with the current ETag answered %d with ETag %q", response.StatusCode, current)
+	}
+
+	deactivate := scim.PatchRequest{Operations: []scim.Operation{{Op: "replace", Path: "active", Value: false}}}
+	replace := map[string]interface{}{
+		"schemas":  []string{scim.UserSchema},
+		"userName": "ada@example.com",
+		"active":   false,
+	}
+	for _, request := range []struct {
+		method string
+		body   interface{}
+	}{
+		{http.MethodPatch, deactivate},
+		{http.MethodPut, replace},
+		{http.MethodDelete, nil},
+	} {
+		response, body := scimRequest(t, app, token, request.method, path, request.body, "If-Match", read)
+		if response.StatusCode != fiber.StatusPreconditionFailed {
+			t.Errorf("%s with a stale ETag answered %d: %v", request.method, response.StatusCode, body)
+		}
+	}
+
+	// Nothing changed, so the current ETag still applies
+	response, body := scimRequest(t, app, token, http.MethodGet, path, nil, "If-None-Match", current)
+	if response.StatusCode != fiber.StatusNotModified {
+		t.Errorf("the stale requests changed the user: %d %v", response.StatusCode, body)
+	}
+	response, body = scimRequest(t, app, token, http.MethodPatch, path, deactivate, "If-Match", read+", "+current)
+	if response.StatusCode != fiber.StatusOK || body["active"] != false {
+		t.Errorf("PATCH listing the current ETag answered %d: %v", response.StatusCode, body)
+	}
+	response, _ = scimRequest(t, app, token, http.MethodDelete, path, nil, "If-Match", response.Header.Get("ETag"))
+	if response.StatusCode != fiber.StatusNoContent {
+		t.Errorf("DELETE with the current ETag answered %d", response.StatusCode)
+	}
+}
+
+func TestSCIMUsersFilterAndPage(t *testing.T) {
+	app := newTestApp(t)
+	token := scimToken(t)
+	for _, email := range []string{"ada@example.com", "bob@example.com", "cy@example.com"} {
+		createUser(t, email)
+	}
+
+	list := func(query url.Values) (int, []string) {
+		t.Helper()
+		response, body := scimRequest(t, app, token, http.MethodGet, "/scim/v2/Users?"+query.Encode(), nil)
+		if response.StatusCode != fiber.StatusOK {
+			t.Fatalf("%s answered %d: %v", query.Encode(), response.StatusCode, body)
+		}
+		userNames := []string{}
+		resources, _ := body["Resources"].([]interface{})
+		for _, resource := range resources {
+			userNames = append(userNames, resource.(map[string]interface{})["userName"].(string))
+		}
+		return int(body["totalResults"].(float64)), userNames
+	}
+
+	total, userNames := list(url.Values{"filter": {`userName eq "BOB@example.com"`}})
+	if total != 1 || len(userNames) != 1 || userNames[0] != "bob@example.com" {
+		t.Errorf("userName filter found %d: %v", total, userNames)
+	}
+	total, userNames = list(url.Values{"startIndex": {"2"}, "count": {"1"}})
+	if total != 3 || len(userNames) != 1 || userNames[0] != "bob@example.com" {
+		t.Errorf("second page found %d: %v", total, userNames)
+	}
+	total, userNames = list(url.Values{"filter": {`userName ne "ada@example.com"`}, "startIndex": {"2"}})
+	if total != 2 || len(userNames) != 1 || userNames[0] != "cy@example.com" {
+		t.Errorf("ne filter found %d: %v", total, userNames)
+	}
+
+	response, body := scimRequest(t, app, token, http.MethodGet, "/scim/v2/Users?filter="+url.QueryEscape(`userName eq`), nil)
+	if response.StatusCode != fiber.StatusBadRequest || body["scimType"] != "invalidFilter" {
+		t.Errorf("a bad filter answered %d: %v", response.StatusCode, body)
+	}
+}
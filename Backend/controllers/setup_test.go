@@ -0,0 +1,128 @@
+package controllers_test
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/routes"
+	"JWT-Authentication-go/throttle"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestApp serves the routes against an empty in-memory database
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	database.DB = db
+	throttle.Store = throttle.NewMemory()
+
+	app := fiber.New()
+	app.Use(requestid.New())
+	routes.SetupRoutes(app)
+	return app
+}
+
+// createUser stores a verified, active user
+func createUser(t *testing.T, email string) models.User {
+	t.Helper()
+
+	user := models.User{
+		Name:            "Test User",
+		Email:           email,
+		Password:        []byte("unusable"),
+		Role:            "user",
+		EmailVerifiedAt: 1,
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// get sends a GET request with cookies to the app
+func get(t *testing.T, app *fiber.App, path string, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	response, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// postForm posts a form with cookies to the app
+func postForm(t *testing.T, app *fiber.App, path string, form url.Values, cookies ...*http.Cookie) *http.Response {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	response, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// responseCookie returns the cookie a response sets, or nil
+func responseCookie(response *http.Response, name string) *http.Cookie {
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == name && cookie.Value != "" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// ssoOutcome checks where a single sign-on sent the browser. An empty
+// wantError expects a session; otherwise the login page must show it.
+func ssoOutcome(t *testing.T, response *http.Response, wantError string) {
+	t.Helper()
+
+	if response.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(response.Body)
+		t.Fatalf("status = %d, want 302: %s", response.StatusCode, body)
+	}
+	location, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotError := location.Query().Get("sso_error")
+	session := responseCookie(response, "jwt")
+
+	switch {
+	case wantError == "" && (gotError != "" || session == nil):
+		t.Fatalf("sign-in failed: %q", gotError)
+	case wantError != "" && session != nil:
+		t.Fatalf("signed in, want error %q", wantError)
+	case wantError != "" && gotError != wantError:
+		t.Fatalf("sso_error = %q, want %q", gotError, wantError)
+	}
+}
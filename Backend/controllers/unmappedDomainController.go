@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/mappings"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/notify"
+	"JWT-Authentication-go/providers"
+	"JWT-Authentication-go/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetUnmappedDomains lists domains that fell back to the default mapping (admin only)
+func GetUnmappedDomains(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetUnmappedDomains")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	query := database.DB.Model(&models.UnmappedDomain{})
+	switch status := c.Query("status", models.UnmappedOpen); status {
+	case "all":
+	case models.UnmappedOpen, models.UnmappedDismissed, models.UnmappedMapped:
+		query = query.Where("status = ?", status)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "status must be open, dismissed, mapped or all",
+		})
+	}
+
+	domains := []models.UnmappedDomain{}
+	if err := query.Order("user_count DESC, lookups DESC").Find(&domains).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch unmapped domains",
+		})
+	}
+
+	return c.JSON(domains)
+}
+
+// GetUnmappedDomain returns one inbox entry with its affected users (admin only)
+func GetUnmappedDomain(c *fiber.Ctx) error {
+	fmt.Println("Admin request - GetUnmappedDomain")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var entry models.UnmappedDomain
+	if err := database.DB.First(&entry, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unmapped domain not found",
+		})
+	}
+
+	users := []fiber.Map{}
+	rows, err := database.DB.Table("unmapped_domain_users").
+		Select("unmapped_domain_users.user_id, users.name, users.email, unmapped_domain_users.first_seen_at, unmapped_domain_users.last_seen_at").
+		Joins("LEFT JOIN users ON users.id = unmapped_domain_users.user_id").
+		Where("unmapped_domain_users.unmapped_domain_id = ?", entry.ID).
+		Order("unmapped_domain_users.last_seen_at DESC").
+		Rows()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch affected users",
+		})
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uint
+		var name, email *string
+		var firstSeen, lastSeen int64
+		if err := rows.Scan(&userID, &name, &email, &firstSeen, &lastSeen); err != nil {
+			continue
+		}
+
+		user := fiber.Map{"user_id": userID, "first_seen_at": firstSeen, "last_seen_at": lastSeen}
+		if name != nil {
+			user["name"] = *name
+		}
+		if email != nil {
+			user["email"] = *email
+		}
+		users = append(users, user)
+	}
+
+	return c.JSON(fiber.Map{
+		"domain": entry,
+		"users":  users,
+	})
+}
+
+// MapUnmappedDomain turns an inbox entry into a domain mapping in one call (admin only)
+func MapUnmappedDomain(c *fiber.Ctx) error {
+	fmt.Println("Admin request - MapUnmappedDomain")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if data["drive_url"] == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Drive URL is required",
+		})
+	}
+
+	var entry models.UnmappedDomain
+	if err := database.DB.First(&entry, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unmapped domain not found",
+		})
+	}
+
+	// A mapping may have been created by hand in the meantime
+	var existing models.DomainMapping
+	if err := database.DB.Where("domain = ?", entry.Domain).First(&existing).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":      "A mapping for this domain already exists",
+			"mapping_id": existing.ID,
+		})
+	}
+
+	// Validate the link with its storage provider and keep the folder ID
+	resource, err := providers.Parse(data["provider"], data["drive_url"])
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := drive.VerifyFolder(resource.Provider, resource.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userId := utils.GetUserIdFromToken(c)
+	currentTime := time.Now().Unix()
+
+	mapping := models.DomainMapping{
+		Domain:      entry.Domain,
+		Provider:    resource.Provider,
+		DriveURL:    strings.TrimSpace(data["drive_url"]),
+		FolderID:    resource.ID,
+		Description: data["description"],
+		IsActive:    true,
+		CreatedAt:   currentTime,
+		UpdatedAt:   currentTime,
+		CreatedBy:   userId,
+		ManagedBy:   models.ManagedByUI,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&mapping).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "domain_mapping.create", "domain_mapping", mapping.ID, nil, mapping)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create domain mapping",
+		})
+	}
+
+	mappings.MarkDomainMapped(database.DB, mapping, userId)
+
+	return c.Status(fiber.StatusCreated).JSON(mapping)
+}
+
+// DismissUnmappedDomain removes an entry from the inbox (admin only). New
+// lookups keep being counted but do not reopen it.
+func DismissUnmappedDomain(c *fiber.Ctx) error {
+	fmt.Println("Admin request - DismissUnmappedDomain")
+
+	// Check if user is admin
+	if !utils.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+
+	var entry models.UnmappedDomain
+	if err := database.DB.First(&entry, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Unmapped domain not found",
+		})
+	}
+
+	before := entry
+	entry.Status = models.UnmappedDismissed
+	entry.ResolvedBy = utils.GetUserIdFromToken(c)
+	entry.ResolvedAt = time.Now().Unix()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&entry).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "unmapped_domain.dismiss", "unmapped_domain", entry.ID, before, entry)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to dismiss unmapped domain",
+		})
+	}
+
+	return c.JSON(entry)
+}
+
+// trackUnmappedDomain counts a lookup that fell back to the default mapping
+// and notifies admins once a new domain affects enough users. Only users who
+// confirmed their address count as affected, so self-signups cannot push an
+// arbitrary domain up the inbox.
+func trackUnmappedDomain(domain string, user models.User) {
+	domain = strings.ToLower(domain)
+	now := time.Now().Unix()
+
+	var entry models.UnmappedDomain
+	if err := database.DB.Where("domain = ?", domain).First(&entry).Error; err != nil {
+		entry = models.UnmappedDomain{
+			Domain:      domain,
+			FirstSeenAt: now,
+			LastSeenAt:  now,
+			Status:      models.UnmappedOpen,
+		}
+		// Another request may have created it first; the unique index decides
+		if err := database.DB.Create(&entry).Error; err != nil {
+			if err := database.DB.Where("domain = ?", domain).First(&entry).Error; err != nil {
+				fmt.Println("Error tracking unmapped domain:", err)
+				return
+			}
+		}
+	}
+
+	// A domain marked mapped falls back again once its mapping is deleted or
+	// deactivated, so it goes back to the inbox
+	if entry.Status == models.UnmappedMapped {
+		reopened := database.DB.Model(&models.UnmappedDomain{}).
+			Where("id = ? AND status = ?", entry.ID, models.UnmappedMapped).
+			Updates(map[string]interface{}{
+				"status":      models.UnmappedOpen,
+				"mapping_id":  0,
+				"resolved_by": 0,
+				"resolved_at": 0,
+				"notified_at": 0,
+			})
+		if reopened.Error == nil {
+			entry.Status = models.UnmappedOpen
+			entry.NotifiedAt = 0
+		}
+	}
+
+	updates := map[string]interface{}{
+		"lookups":      gorm.Expr("lookups + 1"),
+		"last_seen_at": now,
+	}
+
+	// Count each affected user once
+	if user.EmailVerifiedAt != 0 {
+		result := database.DB.Model(&models.UnmappedDomainUser{}).
+			Where("unmapped_domain_id = ? AND user_id = ?", entry.ID, user.ID).
+			Update("last_seen_at", now)
+		if result.Error == nil && result.RowsAffected == 0 {
+			created := database.DB.Create(&models.UnmappedDomainUser{
+				UnmappedDomainID: entry.ID,
+				UserID:           user.ID,
+				FirstSeenAt:      now,
+				LastSeenAt:       now,
+			})
+			if created.Error == nil {
+				updates["user_count"] = gorm.Expr("user_count + 1")
+				entry.UserCount++
+			}
+		}
+	}
+
+	database.DB.Model(&entry).Updates(updates)
+
+	threshold := int64(config.UnmappedNotifyThreshold)
+	if threshold > 0 && entry.Status == models.UnmappedOpen && entry.NotifiedAt == 0 && entry.UserCount >= threshold {
+		// Only the request that flips notified_at sends the notification
+		claimed := database.DB.Model(&models.UnmappedDomain{}).
+			Where("id = ? AND notified_at = 0", entry.ID).
+			Update("notified_at", now)
+		if claimed.RowsAffected == 1 {
+			notify.Send("unmapped_domain", map[string]interface{}{
+				"domain":     entry.Domain,
+				"user_count": entry.UserCount,
+				"id":         entry.ID,
+			})
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package controllers_test
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"net/http"
+	"testing"
+)
+
+func TestUnmappedDomainTracking(t *testing.T) {
+	app := newTestApp(t)
+	database.DB.Create(&models.DefaultMapping{DriveURL: "https://drive.google.com/drive/folders/default-1234567890"})
+
+	verified := createUser(t, "ada@acme.com")
+	unverified := createUser(t, "eve@acme.com")
+	database.DB.Model(&unverified).Update("email_verified_at", 0)
+
+	lookup := func(user models.User, password string) {
+		t.Helper()
+		session := signIn(t, app, user, password)
+		if status := get(t, app, "/api/user/drive", session).StatusCode; status != http.StatusOK {
+			t.Fatalf("lookup status = %d, want the default mapping", status)
+		}
+	}
+	entry := func() models.UnmappedDomain {
+		var entry models.UnmappedDomain
+		database.DB.Where("domain = ?", "acme.com").First(&entry)
+		return entry
+	}
+
+	lookup(verified, "Chosen-Passphrase-7390")
+	lookup(unverified, "Another-Passphrase-2841")
+	if got := entry(); got.Lookups != 2 || got.UserCount != 1 {
+		t.Errorf("entry counts %d lookups and %d users, want 2 and only the verified one", got.Lookups, got.UserCount)
+	}
+
+	// The mapping made from the entry is deactivated again
+	mapping := models.DomainMapping{Domain: "acme.com", DriveURL: "https://drive.google.com/drive/folders/acme-1234567890", IsActive: true}
+	database.DB.Create(&mapping)
+	database.DB.Model(&models.UnmappedDomain{}).Where("domain = ?", "acme.com").
+		Updates(map[string]interface{}{"status": models.UnmappedMapped, "mapping_id": mapping.ID})
+	database.DB.Model(&mapping).Update("is_active", false)
+
+	lookup(verified, "Chosen-Passphrase-7390")
+	if got := entry(); got.Status != models.UnmappedOpen || got.MappingID != 0 {
+		t.Errorf("entry is %s with mapping %d, want it reopened", got.Status, got.MappingID)
+	}
+}
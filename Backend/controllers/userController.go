@@ -1,14 +1,18 @@
 package controllers
 
 import (
+	"JWT-Authentication-go/audit"
 	"JWT-Authentication-go/database"
 	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/policy"
 	"JWT-Authentication-go/utils"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // UpdateUser updates a user by ID (admin only)
@@ -47,6 +51,8 @@ func UpdateUser(c *fiber.Ctx) error {
 	}
 
 	// Update user fields if provided
+	before := user
+	previousEmail := user.Email
 	if data["name"] != "" {
 		user.Name = data["name"]
 	}
@@ -59,6 +65,10 @@ func UpdateUser(c *fiber.Ctx) error {
 			})
 		}
 		user.Email = data["email"]
+		// An address set by an admin needs no verification
+		if user.Email != previousEmail {
+			user.EmailVerifiedAt = time.Now().Unix()
+		}
 	}
 	if data["department"] != "" {
 		user.Department = data["department"]
@@ -66,10 +76,24 @@ func UpdateUser(c *fiber.Ctx) error {
 	if data["role"] != "" {
 		user.Role = data["role"]
 	}
+	if data["is_active"] != "" {
+		isActive, err := strconv.ParseBool(data["is_active"])
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "is_active must be true or false",
+			})
+		}
+		user.IsActive = isActive
+	}
 
 	// Update password if provided
 	if data["password"] != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(data["password"]), bcrypt.DefaultCost)
+		if err := policy.CheckPassword(database.DB, user, data["password"]); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		hashedPassword, err := passwords.Hash(data["password"])
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to hash password",
@@ -78,11 +102,23 @@ func UpdateUser(c *fiber.Ctx) error {
 		user.Password = hashedPassword
 	}
 
-	// Save updated user
-	result := database.DB.Save(&user)
-	if result.Error != nil {
+	// Save updated user together with its audit event
+	var result *gorm.DB
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result = tx.Save(&user)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if data["password"] != "" {
+			if err := policy.RememberPassword(tx, user.ID, before.Password); err != nil {
+				return err
+			}
+		}
+		return audit.Record(tx, c, "user.update", "user", user.ID, before, user)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update user: " + result.Error.Error(),
+			"error": "Failed to update user: " + err.Error(),
 		})
 	}
 
@@ -93,6 +129,16 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// Grants were made to the old address; the next lookup grants the new one
+	if user.Email != previousEmail {
+		revokeUserDriveGrants(user.ID)
+	}
+
+	// A disabled account is signed out everywhere
+	if before.IsActive && !user.IsActive {
+		utils.RevokeUserSessions(user.ID)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User updated successfully",
 		"user": fiber.Map{
@@ -101,6 +147,7 @@ func UpdateUser(c *fiber.Ctx) error {
 			"email":      user.Email,
 			"role":       user.Role,
 			"department": user.Department,
+			"is_active":  user.IsActive,
 		},
 	})
 }
@@ -140,11 +187,21 @@ func DeleteUser(c *fiber.Ctx) error {
 		})
 	}
 
-	// Delete the user
-	result := database.DB.Delete(&user)
-	if result.Error != nil {
+	// Take back the Drive access granted to the user
+	revokeUserDriveGrants(user.ID)
+
+	// Delete the user and record who did it
+	var result *gorm.DB
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result = tx.Delete(&user)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return audit.Record(tx, c, "user.delete", "user", user.ID, user, nil)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete user: " + result.Error.Error(),
+			"error": "Failed to delete user: " + err.Error(),
 		})
 	}
 
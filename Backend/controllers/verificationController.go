@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// VerifyEmail confirms the address a verification link was sent to
+func VerifyEmail(c *fiber.Ctx) error {
+	fmt.Println("Received an email verification")
+
+	var data map[string]string
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	user, err := accounts.VerifyEmail(database.DB, data["token"])
+	if errors.Is(err, accounts.ErrVerificationExpired) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, accounts.ErrVerificationInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify email address",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":           "Email address verified",
+		"email":             user.Email,
+		"email_verified_at": user.EmailVerifiedAt,
+	})
+}
+
+// ResendVerification emails the current user a new verification link
+func ResendVerification(c *fiber.Ctx) error {
+	claims, err := utils.ParseToken(c.Cookies("jwt"))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, utils.GetUintFromClaims(claims, "sub")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.EmailVerifiedAt != 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Email address is already verified",
+		})
+	}
+
+	err = accounts.SendVerification(database.DB, user)
+	if errors.Is(err, accounts.ErrVerificationTooSoon) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		fmt.Println("Error sending verification email:", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Verification email sent",
+	})
+}
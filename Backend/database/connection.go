@@ -1,7 +1,10 @@
 package database
 
 import (
+	"JWT-Authentication-go/config"
 	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/providers"
+	"fmt"
 	"time"
 
 	"gorm.io/driver/mysql"
@@ -12,6 +15,36 @@ import (
 // database operations like querying, inserting, updating, and deleting data from the database.
 var DB *gorm.DB
 
+// Models lists every table the application stores
+func Models() []interface{} {
+	return []interface{}{
+		&models.User{},
+		&models.DomainMapping{},
+		&models.DefaultMapping{},
+		&models.AccessLog{},
+		&models.MappingOverride{},
+		&models.DriveGrant{},
+		&models.UnmappedDomain{},
+		&models.UnmappedDomainUser{},
+		&models.AuditEvent{},
+		&models.AccessLogRollup{},
+		&models.RetentionRun{},
+		&models.Session{},
+		&models.Invitation{},
+		&models.RegistrationDomainRule{},
+		&models.PasswordReset{},
+		&models.MFARecoveryCode{},
+		&models.MFAChallenge{},
+		&models.ThrottleEntry{},
+		&models.PasswordHistory{},
+		&models.UserIdentity{},
+		&models.DirectorySyncRun{},
+		&models.SAMLConnection{},
+		&models.SCIMToken{},
+		&models.SCIMGroup{},
+	}
+}
+
 // Connect to MySQL database
 func ConnectDB() (*gorm.DB, error) {
 	// Database configuration
@@ -26,23 +59,112 @@ func ConnectDB() (*gorm.DB, error) {
 
 	DB = db
 
+	// Accounts created before email verification existed count as verified
+	backfillVerified := !db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+
+	// Access logs written before the mapping type was recorded get one
+	backfillLogTypes := !db.Migrator().HasColumn(&models.AccessLog{}, "mapping_type")
+
 	// Auto migrate all models
-	db.AutoMigrate(
-		&models.User{},
-		&models.DomainMapping{},
-		&models.DefaultMapping{},
-		&models.AccessLog{},
-	)
+	db.AutoMigrate(Models()...)
 
-	// Create default mapping if it doesn't exist
+	// Create default mapping if it doesn't exist. It stays empty until an
+	// admin sets it unless DEFAULT_DRIVE_URL provides a real folder.
+	seedURL := defaultDriveURL()
 	var defaultMapping models.DefaultMapping
 	if db.First(&defaultMapping).RowsAffected == 0 {
+		// Seeded from the environment, so a mappings file may take it over
 		db.Create(&models.DefaultMapping{
-			DriveURL:  "https://drive.google.com/drive/folders/default",
+			DriveURL:  seedURL,
 			UpdatedAt: time.Now().Unix(),
 			UpdatedBy: 1, // System ID
+			ManagedBy: models.ManagedByConfig,
 		})
+	} else if defaultMapping.DriveURL == legacyDefaultDriveURL {
+		// Replace the placeholder older versions seeded
+		defaultMapping.DriveURL = seedURL
+		defaultMapping.FolderID = ""
+		db.Save(&defaultMapping)
+	}
+
+	backfillFolderIDs(db)
+
+	if backfillLogTypes {
+		backfillAccessLogTypes(db)
+	}
+
+	if backfillVerified {
+		db.Model(&models.User{}).Where("created_at > 0").Update("email_verified_at", gorm.Expr("created_at"))
+		db.Model(&models.User{}).Where("email_verified_at = 0").Update("email_verified_at", time.Now().Unix())
 	}
 
 	return db, nil
 }
+
+// defaultDriveURL returns DEFAULT_DRIVE_URL when it is a folder link the
+// default provider accepts. Anything else is left out with a warning, so the
+// default mapping stays empty rather than pointing nowhere.
+func defaultDriveURL() string {
+	if config.DefaultDriveURL == "" {
+		return ""
+	}
+	if _, err := providers.Parse(providers.Default, config.DefaultDriveURL); err != nil {
+		fmt.Println("Warning: ignoring DEFAULT_DRIVE_URL:", err)
+		return ""
+	}
+	return config.DefaultDriveURL
+}
+
+// legacyDefaultDriveURL is the fake folder older versions seeded as default
+const legacyDefaultDriveURL = "https://drive.google.com/drive/folders/default"
+
+// backfillFolderIDs fills in folder IDs for mappings saved before links were parsed
+func backfillFolderIDs(db *gorm.DB) {
+	var domains []models.DomainMapping
+	db.Where("folder_id = ? OR folder_id IS NULL", "").Find(&domains)
+	for _, mapping := range domains {
+		if resource, err := providers.Parse(mapping.Provider, mapping.DriveURL); err == nil {
+			db.Model(&mapping).Update("folder_id", resource.ID)
+		}
+	}
+
+	var defaults []models.DefaultMapping
+	db.Where("folder_id = ? OR folder_id IS NULL", "").Find(&defaults)
+	for _, mapping := range defaults {
+		if resource, err := providers.Parse(mapping.Provider, mapping.DriveURL); err == nil {
+			db.Model(&mapping).Update("folder_id", resource.ID)
+		}
+	}
+}
+
+// backfillAccessLogTypes lowercases the domains of older access logs and
+// classifies them by matching their folder link against the current
+// mappings. Rows that no mapping matches any more keep an empty type.
+func backfillAccessLogTypes(db *gorm.DB) {
+	db.Model(&models.AccessLog{}).Where("1 = 1").Update("domain", gorm.Expr("LOWER(domain)"))
+
+	untyped := func() *gorm.DB {
+		return db.Model(&models.AccessLog{}).Where("mapping_type = ? OR mapping_type IS NULL", "")
+	}
+
+	domainMatch := "FROM domain_mappings WHERE domain_mappings.domain = access_logs.domain AND domain_mappings.drive_url = access_logs.drive_url"
+	untyped().Where("EXISTS (SELECT 1 " + domainMatch + ")").Updates(map[string]interface{}{
+		"mapping_type": "domain",
+		"mapping_id":   gorm.Expr("(SELECT MIN(domain_mappings.id) " + domainMatch + ")"),
+		"is_default":   false,
+	})
+
+	overrideMatch := "FROM mapping_overrides JOIN users ON users.email = mapping_overrides.email WHERE users.id = access_logs.user_id AND mapping_overrides.drive_url = access_logs.drive_url"
+	untyped().Where("EXISTS (SELECT 1 " + overrideMatch + ")").Updates(map[string]interface{}{
+		"mapping_type": "override",
+		"mapping_id":   gorm.Expr("(SELECT MIN(mapping_overrides.id) " + overrideMatch + ")"),
+		"is_default":   false,
+	})
+
+	defaultMatch := "FROM default_mappings WHERE default_mappings.drive_url = access_logs.drive_url"
+	untyped().Where("EXISTS (SELECT 1 " + defaultMatch + ")").Updates(map[string]interface{}{
+		"mapping_type": "default",
+		"mapping_id":   gorm.Expr("(SELECT MIN(default_mappings.id) " + defaultMatch + ")"),
+		"is_default":   true,
+	})
+}
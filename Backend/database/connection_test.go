@@ -0,0 +1,61 @@
+package database
+
+import (
+	"JWT-Authentication-go/models"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestBackfillAccessLogTypes(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(Models()...); err != nil {
+		t.Fatal(err)
+	}
+
+	ada := models.User{Name: "Ada", Email: "ada@acme.com", Password: []byte("unusable")}
+	db.Create(&ada)
+	mapping := models.DomainMapping{Domain: "acme.com", DriveURL: "https://drive.example/acme"}
+	db.Create(&mapping)
+	override := models.MappingOverride{Email: "ada@acme.com", DriveURL: "https://drive.example/ada"}
+	db.Create(&override)
+	fallback := models.DefaultMapping{DriveURL: "https://drive.example/default"}
+	db.Create(&fallback)
+
+	logs := []models.AccessLog{
+		{UserID: ada.ID, Domain: "Acme.COM", DriveURL: mapping.DriveURL},
+		{UserID: ada.ID, Domain: "acme.com", DriveURL: override.DriveURL},
+		{UserID: 99, Domain: "other.org", DriveURL: fallback.DriveURL},
+		{UserID: 99, Domain: "gone.org", DriveURL: "https://drive.example/removed"},
+	}
+	db.Create(&logs)
+
+	backfillAccessLogTypes(db)
+
+	want := []struct {
+		domain, mappingType string
+		mappingID           uint
+		isDefault           bool
+	}{
+		{"acme.com", "domain", mapping.ID, false},
+		{"acme.com", "override", override.ID, false},
+		{"other.org", "default", fallback.ID, true},
+		{"gone.org", "", 0, false},
+	}
+	for i, log := range logs {
+		var got models.AccessLog
+		db.First(&got, log.ID)
+		if got.Domain != want[i].domain || got.MappingType != want[i].mappingType ||
+			got.MappingID != want[i].mappingID || got.IsDefault != want[i].isDefault {
+			t.Errorf("log %d = %s %q #%d default %v, want %+v", i, got.Domain, got.MappingType, got.MappingID, got.IsDefault, want[i])
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package directory
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/policy"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// GroupMapping gives the members of a directory group a role, a department
+// or both
+type GroupMapping struct {
+	Group      string `json:"group"` // DN of the group
+	Role       string `json:"role"`
+	Department string `json:"department"`
+}
+
+// Directory is an LDAP or Active Directory server that authenticates the
+// users of some email domains
+type Directory struct {
+	Name string `json:"name"`
+	// URL is ldap://host:389 or ldaps://host:636
+	URL                string `json:"url"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// BindDN and BindPassword are the service account used to search; empty
+	// searches anonymously
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	// UserFilter finds a user by email address, given as %s
+	UserFilter string `json:"user_filter"`
+
+	IDAttribute         string `json:"id_attribute"`
+	EmailAttribute      string `json:"email_attribute"`
+	NameAttribute       string `json:"name_attribute"`
+	DepartmentAttribute string `json:"department_attribute"`
+	// GroupAttribute lists the groups on the user entry, such as memberOf
+	GroupAttribute string `json:"group_attribute"`
+	// GroupFilter searches GroupBaseDN for groups whose members include the
+	// user DN, given as %s, for servers without memberOf
+	GroupBaseDN string `json:"group_base_dn"`
+	GroupFilter string `json:"group_filter"`
+
+	// GroupMappings are checked in order; the first with a role, and the
+	// first with a department, apply. DefaultRole is given when no group
+	// grants a role.
+	GroupMappings []GroupMapping `json:"group_mappings"`
+	DefaultRole   string         `json:"default_role"`
+
+	// Domains are the email domains, with their subdomains, that sign in here
+	Domains []string `json:"domains"`
+	// CreateUsers creates an account for a new person on their first sign-in
+	CreateUsers bool `json:"create_users"`
+}
+
+var directories = map[string]*Directory{}
+
+// Load reads the directories from LDAP_DIRECTORIES_FILE. Values in the file
+// may refer to environment variables as ${NAME}, to keep secrets out of it.
+func Load() error {
+	loaded := map[string]*Directory{}
+	if config.LDAPDirectoriesFile == "" {
+		directories = loaded
+		return nil
+	}
+
+	data, err := os.ReadFile(config.LDAPDirectoriesFile)
+	if err != nil {
+		return err
+	}
+	list := []*Directory{}
+	if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &list); err != nil {
+		return fmt.Errorf("%s: %w", config.LDAPDirectoriesFile, err)
+	}
+
+	served := map[string]string{}
+	for _, directory := range list {
+		directory.Name = strings.ToLower(strings.TrimSpace(directory.Name))
+		if directory.Name == "" || directory.URL == "" || directory.BaseDN == "" || len(directory.Domains) == 0 {
+			return errors.New("every LDAP directory needs a name, url, base_dn and domains")
+		}
+		if loaded[directory.Name] != nil {
+			return fmt.Errorf("LDAP directory %q is configured twice", directory.Name)
+		}
+		for i, domain := range directory.Domains {
+			domain = strings.ToLower(strings.TrimSpace(domain))
+			if other, taken := served[domain]; taken {
+				return fmt.Errorf("domain %s is served by both %s and %s", domain, other, directory.Name)
+			}
+			served[domain] = directory.Name
+			directory.Domains[i] = domain
+		}
+		directory.applyDefaults()
+		loaded[directory.Name] = directory
+	}
+	directories = loaded
+	return nil
+}
+
+// applyDefaults fills in the attributes most servers use
+func (d *Directory) applyDefaults() {
+	if d.UserFilter == "" {
+		d.UserFilter = "(mail=%s)"
+	}
+	if d.IDAttribute == "" {
+		d.IDAttribute = "entryUUID"
+	}
+	if d.EmailAttribute == "" {
+		d.EmailAttribute = "mail"
+	}
+	if d.NameAttribute == "" {
+		d.NameAttribute = "cn"
+	}
+	if d.GroupAttribute == "" && d.GroupFilter == "" {
+		d.GroupAttribute = "memberOf"
+	}
+	if d.GroupBaseDN == "" {
+		d.GroupBaseDN = d.BaseDN
+	}
+	if d.DefaultRole == "" {
+		d.DefaultRole = "user"
+	}
+}
+
+// All returns the configured directories ordered by name
+func All() []*Directory {
+	list := make([]*Directory, 0, len(directories))
+	for _, directory := range directories {
+		list = append(list, directory)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Find returns the directory with the given name, or nil
+func Find(name string) *Directory {
+	return directories[strings.ToLower(name)]
+}
+
+// ForEmail returns the directory that serves an email address, or nil. The
+// most specific domain wins.
+func ForEmail(email string) *Directory {
+	var match *Directory
+	matched := ""
+	domain := policy.EmailDomain(email)
+	for _, directory := range directories {
+		for _, served := range directory.Domains {
+			if (domain == served || strings.HasSuffix(domain, "."+served)) && len(served) > len(matched) {
+				match, matched = directory, served
+			}
+		}
+	}
+	return match
+}
+
+// Serves reports whether the directory authenticates an email address
+func (d *Directory) Serves(email string) bool {
+	return ForEmail(email) == d
+}
+
+// Provider names the directory in linked identities and audit events
+func (d *Directory) Provider() string {
+	return "ldap:" + d.Name
+}
+
+// mapGroups returns the role and department the user's groups give
+func (d *Directory) mapGroups(groups []string) (role, department string) {
+	member := map[string]bool{}
+	for _, group := range groups {
+		member[normalizeDN(group)] = true
+	}
+
+	grantsRoles := false
+	for _, mapping := range d.GroupMappings {
+		if mapping.Role != "" {
+			grantsRoles = true
+		}
+		if !member[normalizeDN(mapping.Group)] {
+			continue
+		}
+		if role == "" {
+			role = mapping.Role
+		}
+		if department == "" {
+			department = mapping.Department
+		}
+	}
+
+	// Leaving every mapped group takes the role away again
+	if role == "" && grantsRoles {
+		role = d.DefaultRole
+	}
+	return role, department
+}
+
+// normalizeDN makes DNs that differ only in case and spacing compare equal
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
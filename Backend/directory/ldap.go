@@ -0,0 +1,190 @@
+package directory
+
+import (
+	"JWT-Authentication-go/accounts"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapTimeout bounds every directory request
+const ldapTimeout = 10 * time.Second
+
+// Directory errors
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUserNotFound       = errors.New("user not found in the directory")
+)
+
+// Authenticate checks an email address and password against the directory
+// and returns who the user is there
+func (d *Directory) Authenticate(email, password string) (accounts.ExternalIdentity, error) {
+	var identity accounts.ExternalIdentity
+
+	// An empty password would be an anonymous bind, which always succeeds
+	if password == "" {
+		return identity, ErrInvalidCredentials
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return identity, err
+	}
+	defer conn.Close()
+
+	entry, err := d.findUser(conn, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return identity, ErrInvalidCredentials
+	}
+	if err != nil {
+		return identity, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return identity, ErrInvalidCredentials
+		}
+		return identity, err
+	}
+
+	// Groups are read with the service account, which may see more
+	if err := d.bindService(conn); err != nil {
+		return identity, err
+	}
+	return d.identity(conn, entry, email)
+}
+
+// connect dials the server and binds as the service account
+func (d *Directory) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.InsecureSkipVerify}
+	if parsed, err := url.Parse(d.URL); err == nil {
+		tlsConfig.ServerName = parsed.Hostname()
+	}
+
+	conn, err := ldap.DialURL(d.URL,
+		ldap.DialWithTLSConfig(tlsConfig),
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", d.Name, err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if d.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("starting TLS with %s: %w", d.Name, err)
+		}
+	}
+	if err := d.bindService(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// bindService authenticates as the service account, if there is one
+func (d *Directory) bindService(conn *ldap.Conn) error {
+	if d.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(d.BindDN, d.BindPassword); err != nil {
+		return fmt.Errorf("binding to %s as the service account: %w", d.Name, err)
+	}
+	return nil
+}
+
+// findUser searches for the single entry with an email address
+func (d *Directory) findUser(conn *ldap.Conn, email string) (*ldap.Entry, error) {
+	attributes := []string{d.IDAttribute, d.EmailAttribute, d.NameAttribute}
+	if d.DepartmentAttribute != "" {
+		attributes = append(attributes, d.DepartmentAttribute)
+	}
+	if d.GroupAttribute != "" {
+		attributes = append(attributes, d.GroupAttribute)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(d.UserFilter, ldap.EscapeFilter(strings.TrimSpace(email))),
+		attributes, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("more than one entry in %s uses %s", d.Name, email)
+	}
+}
+
+// identity describes a directory entry as an external identity, with the
+// role and department its groups give
+func (d *Directory) identity(conn *ldap.Conn, entry *ldap.Entry, email string) (accounts.ExternalIdentity, error) {
+	identity := accounts.ExternalIdentity{
+		Provider: d.Provider(),
+		Subject:  attributeID(entry.GetRawAttributeValue(d.IDAttribute)),
+		Email:    entry.GetAttributeValue(d.EmailAttribute),
+		Name:     entry.GetAttributeValue(d.NameAttribute),
+		// The directory is the authority for its own addresses
+		EmailVerified:  true,
+		ClaimsAccounts: true,
+	}
+	if identity.Subject == "" {
+		identity.Subject = normalizeDN(entry.DN)
+	}
+	if identity.Email == "" {
+		identity.Email = email
+	}
+
+	groups := []string{}
+	if d.GroupAttribute != "" {
+		groups = append(groups, entry.GetAttributeValues(d.GroupAttribute)...)
+	}
+	if d.GroupFilter != "" {
+		result, err := conn.Search(ldap.NewSearchRequest(
+			d.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()), false,
+			fmt.Sprintf(d.GroupFilter, ldap.EscapeFilter(entry.DN)),
+			[]string{"dn"}, nil,
+		))
+		if err != nil {
+			return identity, fmt.Errorf("searching groups in %s: %w", d.Name, err)
+		}
+		for _, group := range result.Entries {
+			groups = append(groups, group.DN)
+		}
+	}
+
+	identity.Role, identity.Department = d.mapGroups(groups)
+	if identity.Department == "" && d.DepartmentAttribute != "" {
+		identity.Department = entry.GetAttributeValue(d.DepartmentAttribute)
+	}
+	return identity, nil
+}
+
+// attributeID turns an identifier attribute into text. Binary ones, such as
+// Active Directory's objectGUID, are hex encoded.
+func attributeID(raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	if utf8.Valid(raw) && !strings.ContainsFunc(string(raw), func(r rune) bool { return r < ' ' }) {
+		return string(raw)
+	}
+	return hex.EncodeToString(raw)
+}
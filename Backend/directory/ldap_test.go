@@ -0,0 +1,340 @@
+package directory
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// testServer is a small LDAP server holding a few entries. It answers binds
+// against userPassword and searches with one equality filter, and records
+// what it was asked.
+type testServer struct {
+	URL string
+
+	mu       sync.Mutex
+	entries  map[string]map[string][]string // by DN
+	binds    []string
+	filters  []string
+	failNext bool
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testServer{URL: "ldap://" + listener.Addr().String(), entries: map[string]map[string][]string{}}
+	server.add("cn=service,dc=acme,dc=com", map[string][]string{"userPassword": {"service-secret"}})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// add stores an entry
+func (s *testServer) add(dn string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[dn] = attributes
+}
+
+// addPerson stores a person under ou=people with the groups in memberOf
+func (s *testServer) addPerson(uid, email, password string, groups ...string) string {
+	dn := "uid=" + uid + ",ou=people,dc=acme,dc=com"
+	s.add(dn, map[string][]string{
+		"entryUUID":    {"uuid-" + uid},
+		"mail":         {email},
+		"cn":           {strings.ToUpper(uid[:1]) + uid[1:]},
+		"userPassword": {password},
+		"memberOf":     groups,
+	})
+	return dn
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			conn.Write(s.bind(id, request).Bytes())
+		case ldap.ApplicationSearchRequest:
+			for _, response := range s.search(id, request) {
+				conn.Write(response.Bytes())
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *testServer) bind(id int64, request *ber.Packet) *ber.Packet {
+	dn, _ := request.Children[1].Value.(string)
+	password := request.Children[2].Data.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.binds = append(s.binds, dn)
+
+	code := ldap.LDAPResultInvalidCredentials
+	switch entry, ok := s.entries[dn]; {
+	case dn == "" && password == "":
+		code = ldap.LDAPResultSuccess // anonymous
+	case ok && password != "" && len(entry["userPassword"]) > 0 && entry["userPassword"][0] == password:
+		code = ldap.LDAPResultSuccess
+	}
+	return result(id, ldap.ApplicationBindResponse, code)
+}
+
+func (s *testServer) search(id int64, request *ber.Packet) []*ber.Packet {
+	baseDN, _ := request.Children[0].Value.(string)
+	filter := request.Children[6]
+	decompiled, _ := ldap.DecompileFilter(filter)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters = append(s.filters, decompiled)
+	if s.failNext {
+		s.failNext = false
+		return []*ber.Packet{result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultUnavailable)}
+	}
+
+	// Only equality filters are understood; anything else matches nothing
+	responses := []*ber.Packet{}
+	if filter.Tag == ldap.FilterEqualityMatch {
+		attribute := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+		for dn, entry := range s.entries {
+			if !strings.HasSuffix(strings.ToLower(dn), strings.ToLower(baseDN)) || !hasValue(entry, attribute, value) {
+				continue
+			}
+			responses = append(responses, searchEntry(id, dn, entry))
+		}
+	}
+	return append(responses, result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+// filtersSeen returns the search filters received so far
+func (s *testServer) filtersSeen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.filters...)
+}
+
+// bindsSeen returns the DNs bound as so far
+func (s *testServer) bindsSeen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func hasValue(entry map[string][]string, attribute, value string) bool {
+	for name, values := range entry {
+		if !strings.EqualFold(name, attribute) {
+			continue
+		}
+		for _, candidate := range values {
+			if strings.EqualFold(candidate, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func message(id int64, operation *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "id"))
+	packet.AppendChild(operation)
+	return packet
+}
+
+func result(id int64, tag ber.Tag, code int) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "message"))
+	return message(id, response)
+}
+
+func searchEntry(id int64, dn string, entry map[string][]string) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "entry")
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "dn"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry {
+		if name == "userPassword" {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	response.AppendChild(attributes)
+	return message(id, response)
+}
+
+// testDirectory serves acme.com from the server through the service account
+func testDirectory(server *testServer) *Directory {
+	directory := &Directory{
+		Name:         "acme",
+		URL:          server.URL,
+		BindDN:       "cn=service,dc=acme,dc=com",
+		BindPassword: "service-secret",
+		BaseDN:       "dc=acme,dc=com",
+		Domains:      []string{"acme.com"},
+		GroupMappings: []GroupMapping{
+			{Group: "cn=admins,ou=groups,dc=acme,dc=com", Role: "admin"},
+			{Group: "cn=sales,ou=groups,dc=acme,dc=com", Department: "Sales"},
+			{Group: "cn=engineering,ou=groups,dc=acme,dc=com", Role: "user", Department: "Engineering"},
+		},
+	}
+	directory.applyDefaults()
+	directories = map[string]*Directory{directory.Name: directory}
+	return directory
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := newTestServer(t)
+	directory := testDirectory(server)
+	server.addPerson("ada", "ada@acme.com", "right-password", "CN=Sales, OU=Groups, DC=acme, DC=com")
+
+	identity, err := directory.Authenticate("ada@acme.com", "right-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ldap:acme uuid-ada ada@acme.com Ada Sales true"
+	got := strings.Join([]string{identity.Provider, identity.Subject, identity.Email, identity.Name, identity.Department}, " ")
+	if identity.EmailVerified {
+		got += " true"
+	}
+	if got != want {
+		t.Errorf("identity = %q, want %q", got, want)
+	}
+
+	for name, attempt := range map[string][2]string{
+		"wrong password": {"ada@acme.com", "wrong-password"},
+		"unknown user":   {"bob@acme.com", "right-password"},
+	} {
+		if _, err := directory.Authenticate(attempt[0], attempt[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s: err = %v, want ErrInvalidCredentials", name, err)
+		}
+	}
+}
+
+func TestAuthenticateRefusesEmptyPassword(t *testing.T) {
+	server := newTestServer(t)
+	directory := testDirectory(server)
+	dn := server.addPerson("ada", "ada@acme.com", "right-password")
+
+	if _, err := directory.Authenticate("ada@acme.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	for _, bound := range server.bindsSeen() {
+		if bound == dn {
+			t.Fatal("bound as the user with an empty password")
+		}
+	}
+}
+
+func TestFindUserEscapesFilter(t *testing.T) {
+	server := newTestServer(t)
+	directory := testDirectory(server)
+	server.addPerson("ada", "ada@acme.com", "right-password")
+
+	conn, err := directory.connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for email, filter := range map[string]string{
+		"*":                       `(mail=\2a)`,
+		"x)(mail=*":               `(mail=x\29\28mail=\2a)`,
+		"*)(|(objectClass=*)":     `(mail=\2a\29\28|\28objectClass=\2a\29)`,
+		"ada@acme.com)(uid=ada\\": `(mail=ada@acme.com\29\28uid=ada\5c)`,
+	} {
+		if _, err := directory.findUser(conn, email); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("findUser(%q) err = %v, want ErrUserNotFound", email, err)
+		}
+		filters := server.filtersSeen()
+		if last := filters[len(filters)-1]; last != filter {
+			t.Errorf("findUser(%q) searched %s, want %s", email, last, filter)
+		}
+	}
+
+	entry, err := directory.findUser(conn, " ada@acme.com ")
+	if err != nil || entry.DN != "uid=ada,ou=people,dc=acme,dc=com" {
+		t.Errorf("findUser(ada) = %v, %v", entry, err)
+	}
+}
+
+func TestGroupMappings(t *testing.T) {
+	directory := testDirectory(newTestServer(t))
+
+	for name, test := range map[string]struct {
+		groups           []string
+		role, department string
+	}{
+		"no groups":            {nil, "user", ""},
+		"admin":                {[]string{"cn=admins,ou=groups,dc=acme,dc=com"}, "admin", ""},
+		"first role wins":      {[]string{"cn=engineering,ou=groups,dc=acme,dc=com", "cn=admins,ou=groups,dc=acme,dc=com"}, "admin", "Engineering"},
+		"first department":     {[]string{"cn=engineering,ou=groups,dc=acme,dc=com", "cn=sales,ou=groups,dc=acme,dc=com"}, "user", "Sales"},
+		"case and spacing":     {[]string{"CN=Admins, OU=Groups, DC=Acme, DC=Com"}, "admin", ""},
+		"unmapped groups only": {[]string{"cn=everyone,ou=groups,dc=acme,dc=com"}, "user", ""},
+	} {
+		role, department := directory.mapGroups(test.groups)
+		if role != test.role || department != test.department {
+			t.Errorf("%s: got %q %q, want %q %q", name, role, department, test.role, test.department)
+		}
+	}
+
+	// Without role mappings the role is left alone
+	directory.GroupMappings = []GroupMapping{{Group: "cn=sales,ou=groups,dc=acme,dc=com", Department: "Sales"}}
+	if role, _ := directory.mapGroups(nil); role != "" {
+		t.Errorf("role = %q without role mappings, want none", role)
+	}
+}
+
+func TestGroupFilter(t *testing.T) {
+	server := newTestServer(t)
+	directory := testDirectory(server)
+	directory.GroupAttribute = ""
+	directory.GroupFilter = "(member=%s)"
+	dn := server.addPerson("ada", "ada@acme.com", "right-password")
+	server.add("cn=admins,ou=groups,dc=acme,dc=com", map[string][]string{"member": {dn}})
+
+	identity, err := directory.Authenticate("ada@acme.com", "right-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "admin" {
+		t.Errorf("role = %q, want admin from the group search", identity.Role)
+	}
+}
@@ -0,0 +1,134 @@
+package directory
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/notify"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sync looks up every active user who signs in with the directory. Users it
+// no longer has are deactivated; the others get the role and department
+// their groups give now. The run is recorded.
+func (d *Directory) Sync(db *gorm.DB) models.DirectorySyncRun {
+	run := models.DirectorySyncRun{
+		Directory: d.Name,
+		StartedAt: time.Now().Unix(),
+	}
+	if err := d.sync(db, &run); err != nil {
+		run.Error = err.Error()
+		fmt.Printf("Directory sync of %s failed: %v\n", d.Name, err)
+	}
+	run.FinishedAt = time.Now().Unix()
+
+	if err := db.Create(&run).Error; err != nil {
+		fmt.Println("Error recording directory sync:", err)
+	}
+	return run
+}
+
+func (d *Directory) sync(db *gorm.DB, run *models.DirectorySyncRun) error {
+	users, err := d.activeUsers(db)
+	if err != nil {
+		return err
+	}
+
+	conn, err := d.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Look everyone up before changing anything, so a directory that cannot
+	// answer does not disable anyone
+	gone := []models.User{}
+	found := map[uint]accounts.ExternalIdentity{}
+	for _, user := range users {
+		run.Checked++
+		entry, err := d.findUser(conn, user.Email)
+		if errors.Is(err, ErrUserNotFound) {
+			gone = append(gone, user)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		identity, err := d.identity(conn, entry, user.Email)
+		if err != nil {
+			return err
+		}
+		found[user.ID] = identity
+	}
+
+	if len(gone) > config.LDAPSyncMaxDeactivations {
+		notify.Send("directory_sync_stopped", map[string]interface{}{
+			"directory": d.Name,
+			"missing":   len(gone),
+			"limit":     config.LDAPSyncMaxDeactivations,
+		})
+		return fmt.Errorf("%d users are missing from the directory, more than LDAP_SYNC_MAX_DEACTIVATIONS (%d); nobody was deactivated",
+			len(gone), config.LDAPSyncMaxDeactivations)
+	}
+
+	for _, user := range users {
+		identity, ok := found[user.ID]
+		if !ok {
+			continue
+		}
+		synced, err := accounts.SyncExternal(db, nil, user, identity)
+		if err != nil {
+			return err
+		}
+		if synced.Role != user.Role || synced.Department != user.Department {
+			run.Updated++
+		}
+	}
+
+	for _, user := range gone {
+		if err := accounts.DeactivateExternal(db, nil, user, d.Provider()); err != nil {
+			return err
+		}
+		run.Deactivated++
+	}
+	return nil
+}
+
+// activeUsers returns the active users who sign in with the directory.
+// Local accounts on its domains that never did are left alone.
+func (d *Directory) activeUsers(db *gorm.DB) ([]models.User, error) {
+	linked := db.Model(&models.UserIdentity{}).Select("user_id").Where("provider = ?", d.Provider())
+	query := db.Where("is_active = ? AND id IN (?)", true, linked)
+	conditions := db
+	for _, domain := range d.Domains {
+		conditions = conditions.Or("email LIKE ?", "%@"+domain).Or("email LIKE ?", "%."+domain)
+	}
+
+	candidates := []models.User{}
+	if err := query.Where(conditions).Order("id").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	// LIKE also matches look-alike domains such as notexample.com
+	users := []models.User{}
+	for _, user := range candidates {
+		if d.Serves(strings.ToLower(user.Email)) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// SyncAll syncs every configured directory
+func SyncAll(db *gorm.DB) []models.DirectorySyncRun {
+	runs := []models.DirectorySyncRun{}
+	for _, directory := range All() {
+		runs = append(runs, directory.Sync(db))
+	}
+	return runs
+}
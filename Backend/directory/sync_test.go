@@ -0,0 +1,152 @@
+package directory
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an empty in-memory database with the tables sync uses
+// and makes it the shared one
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.UserIdentity{}, &models.AuditEvent{},
+		&models.Session{}, &models.DirectorySyncRun{}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// Sessions are revoked through the shared handle
+	database.DB = db
+	return db
+}
+
+// addUser stores an active user, linked to the directory when linked is set
+func addUser(t *testing.T, db *gorm.DB, directory *Directory, email string, linked bool) models.User {
+	t.Helper()
+
+	user := models.User{Name: email, Email: email, Password: []byte("unusable"), Role: "user"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if linked {
+		link := models.UserIdentity{UserID: user.ID, Provider: directory.Provider(), Subject: "uuid-" + strings.Split(email, "@")[0]}
+		if err := db.Create(&link).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return user
+}
+
+func isActive(t *testing.T, db *gorm.DB, user models.User) bool {
+	t.Helper()
+
+	var stored models.User
+	if err := db.First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return stored.IsActive
+}
+
+func withMaxDeactivations(t *testing.T, max int) {
+	previous := config.LDAPSyncMaxDeactivations
+	config.LDAPSyncMaxDeactivations = max
+	t.Cleanup(func() { config.LDAPSyncMaxDeactivations = previous })
+}
+
+func TestSyncDeactivatesOnlyLinkedUsers(t *testing.T) {
+	server := newTestServer(t)
+	directory := testDirectory(server)
+	db := newTestDB(t)
+	withMaxDeactivations(t, 25)
+
+	server.addPerson("ada", "ada@acme.com", "secret", "cn=admins,ou=groups,dc=acme,dc=com")
+	ada := addUser(t, db, directory, "ada@acme.com", true)
+	bob := addUser(t, db, directory, "bob@acme.com", true)
+	local := addUser(t, db, directory, "carol@acme.com", false)
+	other := addUser(t, db, directory, "dave@notacme.com", true)
+
+	run := directory.Sync(db)
+	if run.Error != "" {
+		t.Fatal(run.Error)
+	}
+	if run.Checked != 2 || run.Updated != 1 || run.Deactivated != 1 {
+		t.Errorf("run checked %d, updated %d, deactivated %d; want 2, 1, 1", run.Checked, run.Updated, run.Deactivated)
+	}
+
+	var synced models.User
+	db.First(&synced, ada.ID)
+	if !synced.IsActive || synced.Role != "admin" {
+		t.Errorf("ada is active %v with role %q, want active admin", synced.IsActive, synced.Role)
+	}
+	if isActive(t, db, bob) {
+		t.Error("bob left the directory but is still active")
+	}
+	if !isActive(t, db, local) {
+		t.Error("a local account that never used the directory was deactivated")
+	}
+	if !isActive(t, db, other) {
+		t.Error("a user of another domain was deactivated")
+	}
+}
+
+func TestSyncStopsAboveMaxDeactivations(t *testing.T) {
+	server := newTestServer(t)
+	directory := testDirectory(server)
+	db := newTestDB(t)
+	withMaxDeactivations(t, 1)
+
+	server.addPerson("ada", "ada@acme.com", "secret")
+	users := []models.User{
+		addUser(t, db, directory, "ada@acme.com", true),
+		addUser(t, db, directory, "bob@acme.com", true),
+		addUser(t, db, directory, "carol@acme.com", true),
+	}
+
+	run := directory.Sync(db)
+	if !strings.Contains(run.Error, "LDAP_SYNC_MAX_DEACTIVATIONS") || run.Deactivated != 0 {
+		t.Fatalf("run deactivated %d with error %q, want it stopped", run.Deactivated, run.Error)
+	}
+	for _, user := range users {
+		if !isActive(t, db, user) {
+			t.Errorf("%s was deactivated by a stopped sync", user.Email)
+		}
+	}
+
+	// Once few enough are missing, they are
+	server.addPerson("carol", "carol@acme.com", "secret")
+	run = directory.Sync(db)
+	if run.Error != "" || run.Deactivated != 1 || isActive(t, db, users[1]) {
+		t.Errorf("run deactivated %d with error %q, want bob deactivated", run.Deactivated, run.Error)
+	}
+}
+
+func TestSyncKeepsUsersWhenDirectoryFails(t *testing.T) {
+	server := newTestServer(t)
+	directory := testDirectory(server)
+	db := newTestDB(t)
+	withMaxDeactivations(t, 25)
+
+	bob := addUser(t, db, directory, "bob@acme.com", true)
+	server.failNext = true
+
+	run := directory.Sync(db)
+	if run.Error == "" || run.Deactivated != 0 || !isActive(t, db, bob) {
+		t.Errorf("run deactivated %d with error %q, want nobody deactivated", run.Deactivated, run.Error)
+	}
+}
@@ -0,0 +1,279 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// FolderMimeType is the MIME type Drive reports for folders
+const FolderMimeType = "application/vnd.google-apps.folder"
+
+const (
+	defaultBaseURL  = "https://www.googleapis.com"
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+	driveScope      = "https://www.googleapis.com/auth/drive"
+)
+
+// ErrNotFound is returned when a file or permission does not exist or the
+// service account cannot see it
+var ErrNotFound = errors.New("not found on Google Drive")
+
+// API is the client used by the controllers. It stays nil unless the
+// Drive integration is configured.
+var API *Client
+
+// File is the subset of Drive file metadata the app needs
+type File struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+	Trashed  bool   `json:"trashed"`
+}
+
+// IsFolder reports whether the file is a folder (shared drive roots included)
+func (f *File) IsFolder() bool {
+	return f.MimeType == FolderMimeType
+}
+
+// Client talks to the Drive v3 REST API with a service account
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	email    string
+	subject  string
+	tokenURL string
+	key      *rsa.PrivateKey
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// serviceAccountFile is the JSON key downloaded from the Cloud console
+type serviceAccountFile struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// NewClient builds a client from a service account key file. subject, when
+// set, is the Workspace user to impersonate through domain-wide delegation.
+// An empty credentialsFile builds an unauthenticated client, which is only
+// useful against a stand-in server at baseURL.
+func NewClient(credentialsFile, subject, baseURL string) (*Client, error) {
+	client := &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 20 * time.Second},
+		subject:    subject,
+	}
+	if client.BaseURL == "" {
+		client.BaseURL = defaultBaseURL
+	}
+
+	if credentialsFile == "" {
+		return client, nil
+	}
+
+	raw, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var account serviceAccountFile
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("parse service account key: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("service account key is missing client_email or private_key")
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse service account private key: %w", err)
+	}
+
+	client.email = account.ClientEmail
+	client.key = key
+	client.tokenURL = account.TokenURI
+	if client.tokenURL == "" {
+		client.tokenURL = defaultTokenURL
+	}
+
+	return client, nil
+}
+
+// GetFolder fetches a file's metadata and checks that it is a usable folder
+func (c *Client) GetFolder(ctx context.Context, id string) (*File, error) {
+	query := url.Values{
+		"fields":            {"id,name,mimeType,trashed"},
+		"supportsAllDrives": {"true"},
+	}
+
+	var file File
+	if err := c.do(ctx, http.MethodGet, "/drive/v3/files/"+url.PathEscape(id)+"?"+query.Encode(), nil, &file); err != nil {
+		return nil, err
+	}
+
+	if !file.IsFolder() {
+		return &file, fmt.Errorf("%q is not a folder (%s)", file.Name, file.MimeType)
+	}
+	if file.Trashed {
+		return &file, fmt.Errorf("folder %q is in the trash", file.Name)
+	}
+	return &file, nil
+}
+
+// CreatePermission shares a file with a user and returns the permission ID
+func (c *Client) CreatePermission(ctx context.Context, fileID, email, role string) (string, error) {
+	query := url.Values{
+		"supportsAllDrives":     {"true"},
+		"sendNotificationEmail": {"false"},
+	}
+	body := map[string]string{
+		"type":         "user",
+		"role":         role,
+		"emailAddress": email,
+	}
+
+	var permission struct {
+		ID string `json:"id"`
+	}
+	path := "/drive/v3/files/" + url.PathEscape(fileID) + "/permissions?" + query.Encode()
+	if err := c.do(ctx, http.MethodPost, path, body, &permission); err != nil {
+		return "", err
+	}
+	return permission.ID, nil
+}
+
+// DeletePermission removes a permission. A permission that is already gone
+// is not an error.
+func (c *Client) DeletePermission(ctx context.Context, fileID, permissionID string) error {
+	path := "/drive/v3/files/" + url.PathEscape(fileID) + "/permissions/" + url.PathEscape(permissionID) + "?supportsAllDrives=true"
+	err := c.do(ctx, http.MethodDelete, path, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// do sends an authenticated JSON request and decodes the response into out
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.key != nil {
+		token, err := c.token(ctx)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if response.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 2048))
+		return fmt.Errorf("drive API %s %s: %s: %s", method, path, response.Status, strings.TrimSpace(string(detail)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// token returns a cached access token, exchanging a signed assertion for a
+// new one when it is about to expire
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken != "" && time.Until(c.expiresAt) > time.Minute {
+		return c.accessToken, nil
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   c.email,
+		"scope": driveScope,
+		"aud":   c.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	if c.subject != "" {
+		claims["sub"] = c.subject
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(c.key)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(response.Body, 2048))
+		return "", fmt.Errorf("drive token exchange: %s: %s", response.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	c.accessToken = result.AccessToken
+	c.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return c.accessToken, nil
+}
@@ -0,0 +1,60 @@
+package drive
+
+import (
+	"JWT-Authentication-go/models"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// grantTimeout bounds the Drive call made to revoke a single grant
+const grantTimeout = 20 * time.Second
+
+// RevokeGrants deletes the Drive permissions of the active grants matching
+// the condition and marks them revoked. Grants whose permission could not be
+// deleted are marked as pending with the error; RetryRevocations tries them
+// again. It does nothing while the integration is off.
+func RevokeGrants(db *gorm.DB, condition string, args ...interface{}) {
+	if API == nil {
+		return
+	}
+
+	var grants []models.DriveGrant
+	db.Where(condition, args...).Where("revoked_at = 0").Find(&grants)
+
+	now := time.Now().Unix()
+	for _, grant := range grants {
+		if grant.RevokeRequestedAt == 0 {
+			db.Model(&grant).Update("revoke_requested_at", now)
+		}
+
+		// Drive hands out one permission per user and folder, so a newer
+		// grant on the same folder may share it; deleting it would take the
+		// access that grant gave
+		var shared int64
+		db.Model(&models.DriveGrant{}).
+			Where("id <> ? AND folder_id = ? AND permission_id = ? AND revoked_at = 0 AND revoke_requested_at = 0",
+				grant.ID, grant.FolderID, grant.PermissionID).
+			Count(&shared)
+
+		if shared == 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), grantTimeout)
+			err := API.DeletePermission(ctx, grant.FolderID, grant.PermissionID)
+			cancel()
+
+			if err != nil {
+				fmt.Printf("Error revoking grant %d on folder %s: %v\n", grant.ID, grant.FolderID, err)
+				db.Model(&grant).Update("revoke_error", err.Error())
+				continue
+			}
+		}
+		db.Model(&grant).Updates(map[string]interface{}{"revoked_at": time.Now().Unix(), "revoke_error": ""})
+	}
+}
+
+// RetryRevocations tries again to revoke the grants whose revocation failed
+func RetryRevocations(db *gorm.DB) {
+	RevokeGrants(db, "revoke_requested_at > 0")
+}
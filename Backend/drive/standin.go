@@ -0,0 +1,117 @@
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// StandIn is an in-memory imitation of the few Drive API endpoints the
+// client uses. Point a Client at it (or DRIVE_API_BASE_URL at a served
+// instance) to exercise folder checks and grants without Google.
+type StandIn struct {
+	mu          sync.Mutex
+	files       map[string]File
+	permissions map[string]map[string]Permission // file ID -> permission ID -> permission
+	nextID      int
+}
+
+// Permission is a grant recorded by the stand-in
+type Permission struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Role         string `json:"role"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// NewStandIn returns an empty stand-in
+func NewStandIn() *StandIn {
+	return &StandIn{
+		files:       map[string]File{},
+		permissions: map[string]map[string]Permission{},
+	}
+}
+
+// AddFolder makes a folder visible to the stand-in
+func (s *StandIn) AddFolder(id, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[id] = File{ID: id, Name: name, MimeType: FolderMimeType}
+}
+
+// AddFile makes a non-folder file visible to the stand-in
+func (s *StandIn) AddFile(id, name, mimeType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[id] = File{ID: id, Name: name, MimeType: mimeType}
+}
+
+// Permissions returns the grants currently on a file
+func (s *StandIn) Permissions(fileID string) []Permission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Permission
+	for _, permission := range s.permissions[fileID] {
+		list = append(list, permission)
+	}
+	return list
+}
+
+// ServeHTTP implements files.get, permissions.create and permissions.delete
+func (s *StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// /drive/v3/files/<id>[/permissions[/<permissionId>]]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/drive/v3/files/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/drive/v3/files/") || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[parts[0]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, file)
+
+	case len(parts) == 2 && parts[1] == "permissions" && r.Method == http.MethodPost:
+		var permission Permission
+		if err := json.NewDecoder(r.Body).Decode(&permission); err != nil || permission.EmailAddress == "" {
+			http.Error(w, `{"error":"invalid permission"}`, http.StatusBadRequest)
+			return
+		}
+
+		s.nextID++
+		permission.ID = fmt.Sprintf("perm-%d", s.nextID)
+		if s.permissions[file.ID] == nil {
+			s.permissions[file.ID] = map[string]Permission{}
+		}
+		s.permissions[file.ID][permission.ID] = permission
+		writeJSON(w, permission)
+
+	case len(parts) == 3 && parts[1] == "permissions" && r.Method == http.MethodDelete:
+		if _, ok := s.permissions[file.ID][parts[2]]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.permissions[file.ID], parts[2])
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"error":"unsupported"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// writeJSON encodes a response body
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
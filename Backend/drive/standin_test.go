@@ -0,0 +1,173 @@
+package drive
+
+import (
+	"JWT-Authentication-go/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newStandInClient serves a stand-in and returns a client pointed at it.
+// While failing is set every request gets a server error.
+func newStandInClient(t *testing.T) (*StandIn, *Client, *atomic.Bool) {
+	t.Helper()
+
+	standIn := NewStandIn()
+	failing := &atomic.Bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, `{"error":"backend error"}`, http.StatusInternalServerError)
+			return
+		}
+		standIn.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient("", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return standIn, client, failing
+}
+
+func TestStandInGetFolder(t *testing.T) {
+	standIn, client, _ := newStandInClient(t)
+	standIn.AddFolder("folder-1234567890", "Team folder")
+	standIn.AddFile("file-1234567890", "Notes", "application/vnd.google-apps.document")
+	ctx := context.Background()
+
+	folder, err := client.GetFolder(ctx, "folder-1234567890")
+	if err != nil || folder.Name != "Team folder" || !folder.IsFolder() {
+		t.Errorf("GetFolder(folder) = %+v, %v", folder, err)
+	}
+	if _, err := client.GetFolder(ctx, "file-1234567890"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFolder(file) err = %v, want not a folder", err)
+	}
+	if _, err := client.GetFolder(ctx, "missing-1234567890"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetFolder(missing) err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStandInPermissions(t *testing.T) {
+	standIn, client, _ := newStandInClient(t)
+	standIn.AddFolder("folder-1234567890", "Team folder")
+	ctx := context.Background()
+
+	id, err := client.CreatePermission(ctx, "folder-1234567890", "ada@example.com", "reader")
+	if err != nil || id == "" {
+		t.Fatalf("CreatePermission = %q, %v", id, err)
+	}
+	permissions := standIn.Permissions("folder-1234567890")
+	want := Permission{ID: id, Type: "user", Role: "reader", EmailAddress: "ada@example.com"}
+	if len(permissions) != 1 || permissions[0] != want {
+		t.Fatalf("permissions = %+v, want [%+v]", permissions, want)
+	}
+
+	if _, err := client.CreatePermission(ctx, "missing-1234567890", "ada@example.com", "reader"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CreatePermission(missing) err = %v, want ErrNotFound", err)
+	}
+
+	if err := client.DeletePermission(ctx, "folder-1234567890", id); err != nil {
+		t.Fatal(err)
+	}
+	if permissions := standIn.Permissions("folder-1234567890"); len(permissions) != 0 {
+		t.Errorf("permissions after delete = %+v", permissions)
+	}
+	// A permission that is already gone is not an error
+	if err := client.DeletePermission(ctx, "folder-1234567890", id); err != nil {
+		t.Errorf("deleting again err = %v", err)
+	}
+}
+
+func TestRevokeGrants(t *testing.T) {
+	standIn, client, failing := newStandInClient(t)
+	standIn.AddFolder("folder-a-1234567890", "A")
+	standIn.AddFolder("folder-b-1234567890", "B")
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.DriveGrant{}); err != nil {
+		t.Fatal(err)
+	}
+
+	grant := func(userID uint, folderID string) models.DriveGrant {
+		id, err := client.CreatePermission(context.Background(), folderID, fmt.Sprintf("user%d@example.com", userID), "reader")
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := models.DriveGrant{UserID: userID, FolderID: folderID, PermissionID: id, Role: "reader"}
+		db.Create(&record)
+		return record
+	}
+	revoked := func(record models.DriveGrant) bool {
+		db.First(&record, record.ID)
+		return record.RevokedAt != 0
+	}
+
+	mine := grant(1, "folder-a-1234567890")
+	mineElsewhere := grant(1, "folder-b-1234567890")
+	theirs := grant(2, "folder-a-1234567890")
+
+	// Nothing happens while the integration is off
+	API = nil
+	RevokeGrants(db, "user_id = ?", 1)
+	if revoked(mine) {
+		t.Fatal("revoked without a Drive client")
+	}
+
+	API = client
+	t.Cleanup(func() { API = nil })
+
+	// Failed deletions stay active, marked pending with the error
+	failing.Store(true)
+	RevokeGrants(db, "user_id = ? AND folder_id <> ?", 1, "folder-a-1234567890")
+	if revoked(mineElsewhere) {
+		t.Error("marked revoked although Drive failed")
+	}
+	var pending models.DriveGrant
+	db.First(&pending, mineElsewhere.ID)
+	if pending.RevokeRequestedAt == 0 || pending.RevokeError == "" {
+		t.Errorf("failed revocation = %+v, want it pending with the error", pending)
+	}
+	failing.Store(false)
+
+	// The retry picks up only the pending grant
+	RetryRevocations(db)
+	if !revoked(mineElsewhere) || revoked(mine) || revoked(theirs) {
+		t.Errorf("revoked: other folder %v, mine %v, theirs %v; want only the other folder",
+			revoked(mineElsewhere), revoked(mine), revoked(theirs))
+	}
+	if permissions := standIn.Permissions("folder-b-1234567890"); len(permissions) != 0 {
+		t.Errorf("folder B still shared: %+v", permissions)
+	}
+	if permissions := standIn.Permissions("folder-a-1234567890"); len(permissions) != 2 {
+		t.Errorf("folder A has %d permissions, want 2", len(permissions))
+	}
+	db.First(&pending, mineElsewhere.ID)
+	if pending.RevokeError != "" {
+		t.Errorf("revoke error = %q after success, want it cleared", pending.RevokeError)
+	}
+
+	// A permission also held by a newer grant is left in place
+	again := models.DriveGrant{UserID: 1, FolderID: mine.FolderID, PermissionID: mine.PermissionID, Role: "reader"}
+	db.Create(&again)
+	RevokeGrants(db, "id = ?", mine.ID)
+	if !revoked(mine) || revoked(again) {
+		t.Errorf("revoked: old grant %v, newer grant %v; want only the old one", revoked(mine), revoked(again))
+	}
+	if permissions := standIn.Permissions("folder-a-1234567890"); len(permissions) != 2 {
+		t.Errorf("folder A has %d permissions, want the shared one kept", len(permissions))
+	}
+}
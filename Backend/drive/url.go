@@ -0,0 +1,139 @@
+package drive
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// FolderURLPrefix is the canonical form of a Drive folder link
+const FolderURLPrefix = "https://drive.google.com/drive/folders/"
+
+// idPattern matches Drive file, folder and shared drive IDs
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{10,}$`)
+
+// bareIDPattern matches an ID given without a link: folder IDs of 25 or
+// more characters or a 19-character shared drive ID, so that a pasted word
+// or name is not taken for one
+var bareIDPattern = regexp.MustCompile(`^([A-Za-z0-9_-]{25,}|0A[A-Za-z0-9_-]{17})$`)
+
+// Folder is a parsed Google Drive folder or shared drive link
+type Folder struct {
+	ID          string
+	SharedDrive bool
+}
+
+// URL returns the canonical link for the folder
+func (f Folder) URL() string {
+	return FolderURLPrefix + f.ID
+}
+
+// URLError explains why a link is not a usable folder link
+type URLError struct {
+	Input  string
+	Reason string
+}
+
+func (e *URLError) Error() string {
+	return fmt.Sprintf("invalid Google Drive folder link %q: %s", e.Input, e.Reason)
+}
+
+// docsKinds names the Google editors so file links get a specific message
+var docsKinds = map[string]string{
+	"document":     "a Google Docs document",
+	"spreadsheets": "a Google Sheets spreadsheet",
+	"presentation": "a Google Slides presentation",
+	"forms":        "a Google Form",
+	"drawings":     "a Google Drawing",
+}
+
+// ParseURL validates a Google Drive folder link and extracts its ID.
+// It understands the common shapes:
+//
+//	https://drive.google.com/drive/folders/<id>
+//	https://drive.google.com/drive/u/0/folders/<id>?usp=sharing
+//	https://drive.google.com/drive/mobile/folders/<id>
+//	https://drive.google.com/open?id=<id>
+//	https://drive.google.com/folderview?id=<id>
+//	https://drive.google.com/embeddedfolderview?id=<id>#grid
+//
+// A bare folder or shared drive ID is accepted as well.
+func ParseURL(raw string) (Folder, error) {
+	input := strings.TrimSpace(raw)
+	if input == "" {
+		return Folder{}, &URLError{Input: raw, Reason: "the link is empty"}
+	}
+
+	// Bare IDs are pasted from the Drive API or the address bar
+	if bareIDPattern.MatchString(input) {
+		return newFolder(input), nil
+	}
+
+	link := input
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" {
+		return Folder{}, &URLError{Input: raw, Reason: "it is not a valid URL"}
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+	segments := strings.FieldsFunc(parsed.Path, func(r rune) bool { return r == '/' })
+
+	switch host {
+	case "docs.google.com":
+		if len(segments) > 0 {
+			if kind, ok := docsKinds[segments[0]]; ok {
+				return Folder{}, &URLError{Input: raw, Reason: "it points to " + kind + ", not a folder; share the folder that contains it instead"}
+			}
+		}
+		return Folder{}, &URLError{Input: raw, Reason: "it points to a Google Docs file, not a folder"}
+	case "drive.google.com":
+	default:
+		return Folder{}, &URLError{Input: raw, Reason: "it is not a drive.google.com link"}
+	}
+
+	if len(segments) > 0 && segments[0] == "file" {
+		return Folder{}, &URLError{Input: raw, Reason: "it points to a single file, not a folder"}
+	}
+
+	// open?id=, folderview?id= and embeddedfolderview?id= carry the ID in the query
+	if id := parsed.Query().Get("id"); id != "" {
+		return checkID(raw, id)
+	}
+
+	// /drive/[u/<n>/][mobile/]folders/<id>
+	for i, segment := range segments {
+		if segment == "folders" {
+			if i+1 >= len(segments) {
+				break
+			}
+			return checkID(raw, segments[i+1])
+		}
+	}
+
+	if len(segments) > 1 && segments[0] == "drive" {
+		return Folder{}, &URLError{Input: raw, Reason: "it points to a Drive view such as My Drive or Recent, not a specific folder"}
+	}
+
+	return Folder{}, &URLError{Input: raw, Reason: "no folder ID found; copy the link from the folder's Share dialog"}
+}
+
+// checkID validates an extracted ID
+func checkID(raw, id string) (Folder, error) {
+	if !idPattern.MatchString(id) {
+		return Folder{}, &URLError{Input: raw, Reason: fmt.Sprintf("the folder ID %q is malformed", id)}
+	}
+	return newFolder(id), nil
+}
+
+// newFolder builds a Folder, recognising shared drive root IDs
+func newFolder(id string) Folder {
+	return Folder{
+		ID:          id,
+		SharedDrive: len(id) == 19 && strings.HasPrefix(id, "0A"),
+	}
+}
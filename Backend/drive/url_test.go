@@ -0,0 +1,43 @@
+package drive
+
+import "testing"
+
+func TestParseURL(t *testing.T) {
+	const id = "1AbCdEfGhIjKlMnOpQrStUvWxYz012345"
+
+	tests := []struct {
+		input  string
+		wantID string // empty when the input must be rejected
+	}{
+		{"https://drive.google.com/drive/folders/" + id, id},
+		{"https://drive.google.com/drive/u/0/folders/" + id + "?usp=sharing", id},
+		{"drive.google.com/open?id=" + id, id},
+		{"https://drive.google.com/embeddedfolderview?id=" + id + "#grid", id},
+		{"  " + id + "  ", id},
+		{"0AAbCdEfGhIjKlMnOpQ", "0AAbCdEfGhIjKlMnOpQ"},
+
+		// Words and names that happen to be ID characters are not IDs
+		{"marketing", ""},
+		{"engineering-team", ""},
+		{"shared_folder_2024", ""},
+		{"https://drive.google.com/drive/folders/default", ""},
+		{"https://drive.google.com/file/d/" + id + "/view", ""},
+		{"https://docs.google.com/document/d/" + id + "/edit", ""},
+		{"https://drive.google.com/drive/my-drive", ""},
+		{"https://example.com/folders/" + id, ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		folder, err := ParseURL(test.input)
+		switch {
+		case test.wantID == "" && err == nil:
+			t.Errorf("ParseURL(%q) = %q, want an error", test.input, folder.ID)
+		case test.wantID != "" && (err != nil || folder.ID != test.wantID):
+			t.Errorf("ParseURL(%q) = %q, %v; want %q", test.input, folder.ID, err, test.wantID)
+		}
+	}
+
+	if folder, _ := ParseURL("0AAbCdEfGhIjKlMnOpQ"); !folder.SharedDrive {
+		t.Error("a shared drive ID is not recognised")
+	}
+}
@@ -0,0 +1,23 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+)
+
+// VerifyFolder checks with the Drive API that a mapped folder exists. It is
+// a no-op when the integration is off or the mapping is not on Drive; an
+// empty provider is Drive, as for rows saved before providers existed.
+func VerifyFolder(provider, folderID string) error {
+	if API == nil || (provider != "" && provider != "gdrive") || folderID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), grantTimeout)
+	defer cancel()
+
+	if _, err := API.GetFolder(ctx, folderID); err != nil {
+		return fmt.Errorf("Drive folder could not be verified: %w", err)
+	}
+	return nil
+}
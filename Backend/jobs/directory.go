@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"JWT-Authentication-go/directory"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StartDirectorySync syncs users with their LDAP directories on an interval
+// until ctx is cancelled. It does nothing when the interval is not positive
+// or no directory is configured.
+func StartDirectorySync(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	if interval <= 0 || len(directory.All()) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			for _, run := range directory.SyncAll(db) {
+				if run.Error == "" && (run.Updated > 0 || run.Deactivated > 0) {
+					fmt.Printf("Directory %s: updated %d and deactivated %d of %d user(s)\n",
+						run.Directory, run.Updated, run.Deactivated, run.Checked)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"JWT-Authentication-go/accounts"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StartAccountErasure erases accounts whose deletion grace period has ended,
+// checking on an interval until ctx is cancelled
+func StartAccountErasure(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			erased, err := accounts.ErasePending(db, time.Now())
+			if err != nil {
+				fmt.Println("Account erasure failed:", err)
+			} else if erased > 0 {
+				fmt.Printf("Erased %d account(s) after their deletion grace period\n", erased)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"JWT-Authentication-go/drive"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StartRevocationRetry retries failed Drive grant revocations on an interval
+// until ctx is cancelled
+func StartRevocationRetry(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				drive.RetryRevocations(db)
+			}
+		}
+	}()
+}
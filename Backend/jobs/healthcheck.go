@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/providers"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// healthWorkers is the number of links probed in parallel
+const healthWorkers = 4
+
+// healthTimeout bounds a single probe
+const healthTimeout = 20 * time.Second
+
+// healthMu keeps the scheduled job and manual runs from overlapping
+var healthMu sync.Mutex
+
+// StartHealthChecker probes every mapped folder on an interval until ctx is
+// cancelled. It does nothing when the interval is not positive.
+func StartHealthChecker(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			RunHealthChecks(ctx, db)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// healthTarget is one mapping row to probe
+type healthTarget struct {
+	model    interface{}
+	label    string
+	provider string
+	folderID string
+	link     string
+	health   models.LinkHealth
+}
+
+// RunHealthChecks probes every active domain mapping and the default mapping
+// once and records the outcome on each row
+func RunHealthChecks(ctx context.Context, db *gorm.DB) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	runHealthChecks(ctx, db)
+}
+
+// QueueHealthChecks starts a run in the background and returns at once. It
+// reports false, starting nothing, while another run is in progress.
+func QueueHealthChecks(db *gorm.DB) bool {
+	if !healthMu.TryLock() {
+		return false
+	}
+
+	go func() {
+		defer healthMu.Unlock()
+		runHealthChecks(context.Background(), db)
+	}()
+	return true
+}
+
+// runHealthChecks does the work of a run; the caller holds healthMu
+func runHealthChecks(ctx context.Context, db *gorm.DB) {
+	var targets []healthTarget
+
+	var domains []models.DomainMapping
+	db.Where("is_active = ?", true).Find(&domains)
+	for i := range domains {
+		targets = append(targets, healthTarget{
+			model:    &domains[i],
+			label:    "domain " + domains[i].Domain,
+			provider: domains[i].Provider,
+			folderID: domains[i].FolderID,
+			link:     domains[i].DriveURL,
+			health:   domains[i].LinkHealth,
+		})
+	}
+
+	var defaults []models.DefaultMapping
+	db.Where("drive_url <> ?", "").Find(&defaults)
+	for i := range defaults {
+		targets = append(targets, healthTarget{
+			model:    &defaults[i],
+			label:    "default mapping",
+			provider: defaults[i].Provider,
+			folderID: defaults[i].FolderID,
+			link:     defaults[i].DriveURL,
+			health:   defaults[i].LinkHealth,
+		})
+	}
+
+	queue := make(chan healthTarget)
+	var wg sync.WaitGroup
+	for i := 0; i < healthWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range queue {
+				checkTarget(ctx, db, target)
+			}
+		}()
+	}
+
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- target
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// checkTarget probes one link and stores the result
+func checkTarget(ctx context.Context, db *gorm.DB, target healthTarget) {
+	probeCtx, cancel := context.WithTimeout(ctx, healthTimeout)
+	err := probe(probeCtx, target.provider, target.folderID, target.link)
+	cancel()
+
+	update := map[string]interface{}{
+		"last_checked_at":      time.Now().Unix(),
+		"last_error":           "",
+		"consecutive_failures": 0,
+	}
+	if errors.Is(err, providers.ErrNoHealthCheck) {
+		update["health_status"] = models.HealthUnknown
+	} else if err == nil {
+		update["health_status"] = models.HealthOK
+	} else {
+		update["health_status"] = models.HealthFailing
+		update["last_error"] = err.Error()
+		// Counted in the database so runs on other instances cannot lose a failure
+		update["consecutive_failures"] = gorm.Expr("consecutive_failures + 1")
+
+		if failures := target.health.ConsecutiveFailures + 1; failures == config.HealthCheckFailureThreshold {
+			fmt.Printf("Link health: %s has failed %d checks in a row: %v\n", target.label, failures, err)
+		}
+	}
+
+	// The row is found by its ID, so legacy rows without a folder ID are
+	// updated too; a link replaced while it was probed keeps its own, fresh
+	// health
+	db.Model(target.model).Where("COALESCE(drive_url, '') = ?", target.link).Updates(update)
+}
+
+// probe checks a single mapping. Drive folders go through the Drive API when
+// it is configured, other providers use their own check, and anything else
+// with a web link falls back to an HTTP HEAD request.
+func probe(ctx context.Context, provider, folderID, link string) error {
+	if provider == "" {
+		provider = providers.Default
+	}
+
+	if provider == "gdrive" && drive.API != nil && folderID != "" {
+		_, err := drive.API.GetFolder(ctx, folderID)
+		return err
+	}
+
+	p, err := providers.Get(provider)
+	if err != nil {
+		return err
+	}
+
+	resource, err := p.Parse(link)
+	if err != nil {
+		return err
+	}
+
+	if checker, ok := p.(providers.HealthChecker); ok {
+		return checker.HealthCheck(ctx, resource)
+	}
+
+	openURL := p.OpenURL(resource)
+	if strings.HasPrefix(openURL, "http://") || strings.HasPrefix(openURL, "https://") {
+		return providers.CheckHTTP(ctx, openURL)
+	}
+
+	return providers.ErrNoHealthCheck
+}
@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/models"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.DomainMapping{}, &models.DefaultMapping{}); err != nil {
+		t.Fatal(err)
+	}
+
+	mapping := func(domain, folderID string) models.DomainMapping {
+		row := models.DomainMapping{Domain: domain, Provider: "gdrive", FolderID: folderID, IsActive: true,
+			DriveURL: "https://drive.google.com/drive/folders/" + folderID}
+		db.Create(&row)
+		return row
+	}
+	present := mapping("acme.com", "folder-present-1234567890")
+
+	// A row from before folder IDs were stored has none
+	root := t.TempDir()
+	config.HealthCheckLocalRoots = root
+	t.Cleanup(func() { config.HealthCheckLocalRoots = "" })
+	legacy := models.DomainMapping{Domain: "legacy.com", Provider: "local", DriveURL: root, IsActive: true}
+	db.Create(&legacy)
+	db.Exec("UPDATE domain_mappings SET folder_id = NULL WHERE id = ?", legacy.ID)
+
+	missing := mapping("gone.com", "folder-missing-1234567890")
+	replaced := mapping("moved.com", "folder-replaced-1234567890")
+
+	// The moved.com mapping gets a new folder while its old one is probed
+	standIn := drive.NewStandIn()
+	standIn.AddFolder(present.FolderID, "Acme")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, replaced.FolderID) {
+			db.Model(&models.DomainMapping{}).Where("id = ?", replaced.ID).Updates(map[string]interface{}{
+				"folder_id": "folder-new-1234567890",
+				"drive_url": "https://drive.google.com/drive/folders/folder-new-1234567890",
+			})
+		}
+		standIn.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	client, err := drive.NewClient("", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drive.API = client
+	t.Cleanup(func() { drive.API = nil })
+
+	RunHealthChecks(context.Background(), db)
+	RunHealthChecks(context.Background(), db)
+
+	health := func(row models.DomainMapping) models.LinkHealth {
+		db.First(&row, row.ID)
+		return row.LinkHealth
+	}
+	if got := health(present); got.HealthStatus != models.HealthOK || got.ConsecutiveFailures != 0 {
+		t.Errorf("present folder health = %+v, want ok", got)
+	}
+	if got := health(missing); got.HealthStatus != models.HealthFailing || got.ConsecutiveFailures != 2 || got.LastError == "" {
+		t.Errorf("missing folder health = %+v, want failing twice", got)
+	}
+	if got := health(legacy); got.HealthStatus != models.HealthOK || got.LastCheckedAt == 0 {
+		t.Errorf("legacy row health = %+v, want ok", got)
+	}
+	// Only the second run probed the new folder; the first result was dropped
+	if got := health(replaced); got.ConsecutiveFailures != 1 {
+		t.Errorf("replaced folder failures = %d, want 1 from the new folder alone", got.ConsecutiveFailures)
+	}
+}
+
+func TestQueueHealthChecks(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.DomainMapping{}, &models.DefaultMapping{}); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	config.HealthCheckLocalRoots = root
+	t.Cleanup(func() { config.HealthCheckLocalRoots = "" })
+	row := models.DomainMapping{Domain: "acme.com", Provider: "local", FolderID: root, DriveURL: root, IsActive: true}
+	db.Create(&row)
+
+	// Nothing starts while a run holds the lock
+	healthMu.Lock()
+	if QueueHealthChecks(db) {
+		t.Error("a run was queued while another was in progress")
+	}
+	healthMu.Unlock()
+
+	if !QueueHealthChecks(db) {
+		t.Fatal("no run was queued")
+	}
+	// Taking the lock waits for the queued run to finish
+	healthMu.Lock()
+	healthMu.Unlock()
+
+	db.First(&row, row.ID)
+	if row.HealthStatus != models.HealthOK {
+		t.Errorf("health after the queued run = %+v, want ok", row.LinkHealth)
+	}
+}
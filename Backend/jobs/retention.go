@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Retention modes accepted by ACCESS_LOG_RETENTION_MODE
+const (
+	RetentionDelete = "delete"
+	RetentionRollup = "rollup"
+)
+
+// retentionMu keeps the scheduled job and manual runs from overlapping
+var retentionMu sync.Mutex
+
+// StartRetentionPurge expires old access logs on an interval until ctx is
+// cancelled. It does nothing when retention or the interval is disabled.
+func StartRetentionPurge(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	if interval <= 0 || config.AccessLogRetentionDays <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := RunRetention(db, time.Now()); err != nil {
+				fmt.Println("Access log retention failed:", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RetentionCutoff returns the unix time before which access logs expire. It
+// is aligned to 00:00 UTC so a day is always rolled up in one piece.
+func RetentionCutoff(now time.Time, days int) int64 {
+	cutoff := now.Unix() - int64(days)*86400
+	return cutoff - cutoff%86400
+}
+
+// RunRetention expires access logs older than the configured number of
+// days, rolling them up first when the mode asks for it. Each run is
+// recorded as a RetentionRun, failed ones included.
+func RunRetention(db *gorm.DB, now time.Time) (models.RetentionRun, error) {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+
+	run := models.RetentionRun{
+		StartedAt: time.Now().Unix(),
+		Mode:      strings.ToLower(config.AccessLogRetentionMode),
+	}
+	if run.Mode != RetentionDelete {
+		run.Mode = RetentionRollup
+	}
+
+	if config.AccessLogRetentionDays <= 0 {
+		return run, fmt.Errorf("access log retention is disabled, set ACCESS_LOG_RETENTION_DAYS")
+	}
+	run.Cutoff = RetentionCutoff(now, config.AccessLogRetentionDays)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if run.Mode == RetentionRollup {
+			rolledUp, err := rollupAccessLogs(tx, run.Cutoff)
+			if err != nil {
+				return err
+			}
+			run.RolledUp = rolledUp
+		}
+
+		result := tx.Where("timestamp < ?", run.Cutoff).Delete(&models.AccessLog{})
+		run.Deleted = result.RowsAffected
+		return result.Error
+	})
+
+	run.FinishedAt = time.Now().Unix()
+	if err != nil {
+		run.Deleted, run.RolledUp = 0, 0
+		run.Error = err.Error()
+	}
+	db.Create(&run)
+
+	fmt.Printf("Access log retention (%s, before %d): %d deleted, %d rollup rows\n", run.Mode, run.Cutoff, run.Deleted, run.RolledUp)
+	return run, err
+}
+
+// rollupAccessLogs adds daily counts for logs older than cutoff to the
+// rollup table and returns the number of rollup rows written
+func rollupAccessLogs(tx *gorm.DB, cutoff int64) (int64, error) {
+	var rows []struct {
+		Day         int64
+		Domain      string
+		MappingType string
+		MappingID   uint
+		IsDefault   bool
+		Lookups     int64
+		Users       int64
+	}
+
+	err := tx.Model(&models.AccessLog{}).
+		Select("timestamp - (timestamp % 86400) AS day, domain, mapping_type, mapping_id, is_default, COUNT(*) AS lookups, COUNT(DISTINCT user_id) AS users").
+		Where("timestamp < ?", cutoff).
+		Group("day, domain, mapping_type, mapping_id, is_default").
+		Scan(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		rollup := models.AccessLogRollup{
+			Day:         row.Day,
+			Domain:      row.Domain,
+			MappingType: row.MappingType,
+			MappingID:   row.MappingID,
+		}
+
+		// Add to an existing row for the day rather than tripping the unique
+		// index, e.g. when older logs were imported after a rollup
+		result := tx.Model(&models.AccessLogRollup{}).
+			Where("day = ? AND domain = ? AND mapping_type = ? AND mapping_id = ?", rollup.Day, rollup.Domain, rollup.MappingType, rollup.MappingID).
+			Updates(map[string]interface{}{
+				"lookups": gorm.Expr("lookups + ?", row.Lookups),
+				"users":   gorm.Expr("users + ?", row.Users),
+			})
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			continue
+		}
+
+		rollup.IsDefault = row.IsDefault
+		rollup.Lookups = row.Lookups
+		rollup.Users = row.Users
+		if err := tx.Create(&rollup).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(rows)), nil
+}
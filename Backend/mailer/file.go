@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes each message to a .eml file in Dir instead of sending it,
+// for development machines without a mail server
+type File struct {
+	Dir  string
+	From string
+}
+
+// Send saves the message as a new file
+func (f *File) Send(message Message) error {
+	data, err := format(f.From, message)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(f.Dir, 0o700); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+	path := filepath.Join(f.Dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Mail to %s saved to %s\n", message.To, path)
+	return nil
+}
@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"JWT-Authentication-go/config"
+	"bytes"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email
+type Mailer interface {
+	Send(message Message) error
+}
+
+// Default is the mailer the server sends through. It keeps messages in
+// memory until main replaces it with the configured one.
+var Default Mailer = NewMemory()
+
+// FromConfig builds the mailer selected by MAIL_DRIVER: smtp, file or
+// memory. When the driver is not set, SMTP is used if SMTP_HOST is.
+func FromConfig() (Mailer, error) {
+	driver := strings.ToLower(config.MailDriver)
+	if driver == "" {
+		driver = "memory"
+		if config.SMTPHost != "" {
+			driver = "smtp"
+		}
+	}
+
+	switch driver {
+	case "smtp":
+		if config.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail driver")
+		}
+		return &SMTP{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.MailFrom,
+		}, nil
+	case "file":
+		return &File{Dir: config.MailFileDir, From: config.MailFrom}, nil
+	case "memory":
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q, use smtp, file or memory", driver)
+	}
+}
+
+// Send delivers a message through the default mailer
+func Send(message Message) error {
+	return Default.Send(message)
+}
+
+// format renders a message as an RFC 5322 email
+func format(from string, message Message) ([]byte, error) {
+	if _, err := mail.ParseAddress(message.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient %q", message.To)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
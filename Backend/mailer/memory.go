@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Memory keeps sent messages in memory, for development and tests
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemory returns an empty in-memory mailer
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send records the message
+func (m *Memory) Send(message Message) error {
+	if _, err := format("", message); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+
+	fmt.Printf("Mail to %s: %s\n", message.To, message.Subject)
+	return nil
+}
+
+// Messages returns every message sent so far
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the most recent message to an address
+func (m *Memory) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == to {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
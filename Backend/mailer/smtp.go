@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTP sends email through a mail server. STARTTLS is used when the server
+// offers it, and authentication when a username is set.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message to the SMTP server
+func (s *SMTP) Send(message Message) error {
+	data, err := format(s.From, message)
+	if err != nil {
+		return err
+	}
+
+	sender, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q", s.From)
+	}
+	recipient, _ := mail.ParseAddress(message.To)
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	address := s.Host + ":" + strconv.Itoa(s.Port)
+	if err := smtp.SendMail(address, auth, sender.Address, []string{recipient.Address}, data); err != nil {
+		return fmt.Errorf("sending mail to %s: %w", recipient.Address, err)
+	}
+	return nil
+}
@@ -1,16 +1,36 @@
 package main
 
 import (
+	"JWT-Authentication-go/config"
 	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/directory"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/jobs"
+	"JWT-Authentication-go/mailer"
+	"JWT-Authentication-go/mappings"
+	"JWT-Authentication-go/mfa"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/privacy"
 	"JWT-Authentication-go/routes"
+	"JWT-Authentication-go/sso"
+	"JWT-Authentication-go/throttle"
+	"context"
 	"log"
+	"os"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 func main() {
+	// Refuse to store client IPs other than as configured
+	if err := privacy.CheckConfig(); err != nil {
+		log.Fatalf("Invalid access log settings: %v", err)
+	}
+
 	db, err := database.ConnectDB()
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
@@ -19,6 +39,83 @@ func main() {
 	// Ensure database handle is set
 	database.DB = db
 
+	// Older mappings may hold domains as typed, which lookups never match
+	if err := mappings.NormalizeStoredDomains(db); err != nil {
+		log.Fatalf("Failed to normalize mapping domains: %v", err)
+	}
+
+	// Enable the Drive API integration when credentials or a stand-in are configured
+	if config.DriveCredentialsFile != "" || config.DriveAPIBaseURL != "" {
+		client, err := drive.NewClient(config.DriveCredentialsFile, config.DriveImpersonate, config.DriveAPIBaseURL)
+		if err != nil {
+			log.Fatalf("Failed to set up Drive API client: %v", err)
+		}
+		drive.API = client
+	}
+
+	// Send email through the configured driver
+	sender, err := mailer.FromConfig()
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+	mailer.Default = sender
+
+	// Hash new passwords with the configured algorithm and cost
+	hasher, err := passwords.FromConfig()
+	if err != nil {
+		log.Fatalf("Failed to set up password hashing: %v", err)
+	}
+	passwords.Default = hasher
+
+	// Encrypt TOTP secrets with a key of the deployment's own
+	if err := mfa.Load(db); err != nil {
+		log.Fatalf("Failed to set up two-factor authentication: %v", err)
+	}
+
+	// Offer sign-in through the configured identity providers
+	if err := sso.LoadOIDC(); err != nil {
+		log.Fatalf("Failed to load OIDC providers: %v", err)
+	}
+
+	// Act as a SAML service provider for the domains that have a connection
+	if err := sso.LoadSAML(); err != nil {
+		log.Fatalf("Failed to load SAML key pair: %v", err)
+	}
+
+	// Authenticate the users of some domains against their LDAP directory
+	if err := directory.Load(); err != nil {
+		log.Fatalf("Failed to load LDAP directories: %v", err)
+	}
+
+	// Keep rate limits and failed logins where every instance can see them
+	store, err := throttle.FromConfig(db)
+	if err != nil {
+		log.Fatalf("Failed to set up throttle store: %v", err)
+	}
+	throttle.Store = store
+
+	// Optionally bring mappings in line with the declarative file
+	if config.MappingsSyncOnStart && config.MappingsFile != "" {
+		if err := mappings.SyncFile(db, config.MappingsFile, os.Stdout); err != nil {
+			log.Fatalf("Failed to sync mappings file: %v", err)
+		}
+	}
+
+	// Probe mapped folders in the background
+	jobs.StartHealthChecker(context.Background(), db, time.Duration(config.HealthCheckIntervalMinutes)*time.Minute)
+
+	// Expire access logs past their retention period
+	jobs.StartRetentionPurge(context.Background(), db, time.Duration(config.AccessLogPurgeIntervalMinutes)*time.Minute)
+
+	// Erase accounts whose deletion grace period is over
+	jobs.StartAccountErasure(context.Background(), db, time.Duration(config.AccountErasureIntervalMinutes)*time.Minute)
+
+	// Retry Drive grant revocations that failed
+	jobs.StartRevocationRetry(context.Background(), db, time.Duration(config.DriveRevokeRetryIntervalMinutes)*time.Minute)
+
+	// Deactivate users removed from their directory
+	jobs.StartDirectorySync(context.Background(), db, time.Duration(config.LDAPSyncIntervalMinutes)*time.Minute)
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			// Default error handling
@@ -43,6 +140,9 @@ func main() {
 		},
 	})
 
+	// Tag every request with an ID so audit events can be correlated
+	app.Use(requestid.New())
+
 	// Add logger middleware
 	app.Use(logger.New(logger.Config{
 		Format:     "[${time}] ${status} - ${method} ${path} ${latency}\n",
@@ -57,7 +157,7 @@ func main() {
 		AllowHeaders:     "Origin,Content-Type,Accept,Content-Length,Accept-Language,Accept-Encoding,Connection,Access-Control-Allow-Origin",
 		AllowCredentials: true,
 		MaxAge:           300,
-		ExposeHeaders:    "Set-Cookie",
+		ExposeHeaders:    "Set-Cookie,X-Request-ID,X-Total-Count,X-Next-Cursor",
 	}))
 
 	// Setup routes
@@ -0,0 +1,45 @@
+package mappings
+
+import (
+	"JWT-Authentication-go/models"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// NormalizeDomain reduces a domain typed by an admin to the form user
+// lookups compare against: lowercase, without scheme, www. or path
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "http://")
+	domain = strings.TrimPrefix(domain, "https://")
+	domain = strings.TrimPrefix(domain, "www.")
+
+	// Remove anything after a slash if present
+	if idx := strings.Index(domain, "/"); idx != -1 {
+		domain = domain[:idx]
+	}
+
+	return domain
+}
+
+// NormalizeStoredDomains rewrites the domains of mappings saved before they
+// were normalized, which user lookups could never match
+func NormalizeStoredDomains(db *gorm.DB) error {
+	var rows []models.DomainMapping
+	if err := db.Select("id", "domain").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		normalized := NormalizeDomain(row.Domain)
+		if normalized == row.Domain {
+			continue
+		}
+		if err := db.Model(&models.DomainMapping{}).Where("id = ?", row.ID).Update("domain", normalized).Error; err != nil {
+			return fmt.Errorf("mapping %d: %w", row.ID, err)
+		}
+	}
+	return nil
+}
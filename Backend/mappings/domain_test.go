@@ -0,0 +1,43 @@
+package mappings
+
+import (
+	"JWT-Authentication-go/models"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := map[string]string{
+		"acme.com":                   "acme.com",
+		"  Acme.COM ":                "acme.com",
+		"https://www.acme.com/about": "acme.com",
+		"http://Acme.com/":           "acme.com",
+		"www.sub.acme.com":           "sub.acme.com",
+		"":                           "",
+	}
+	for input, want := range tests {
+		if got := NormalizeDomain(input); got != want {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestNormalizeStoredDomains(t *testing.T) {
+	db := newTestDB(t)
+	rows := []models.DomainMapping{
+		{Domain: "acme.com", DriveURL: folderURL + "acme"},
+		{Domain: " HTTPS://www.Globex.com/ ", DriveURL: folderURL + "globex"},
+	}
+	db.Create(&rows)
+
+	if err := NormalizeStoredDomains(db); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"acme.com", "globex.com"}
+	for i, row := range rows {
+		db.First(&row, row.ID)
+		if row.Domain != want[i] {
+			t.Errorf("mapping %d domain = %q, want %q", row.ID, row.Domain, want[i])
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package mappings
+
+import (
+	"JWT-Authentication-go/providers"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// File is the declarative description of every mapping the sync owns
+type File struct {
+	DefaultMapping *DefaultEntry   `json:"default_mapping,omitempty"`
+	Domains        []DomainEntry   `json:"domains"`
+	Overrides      []OverrideEntry `json:"overrides"`
+}
+
+// DefaultEntry describes the fallback folder
+type DefaultEntry struct {
+	Provider string `json:"provider,omitempty"` // defaults to gdrive
+	DriveURL string `json:"drive_url"`
+
+	folderID string
+}
+
+// DomainEntry describes the folder for one email domain
+type DomainEntry struct {
+	Domain      string `json:"domain"`
+	Provider    string `json:"provider,omitempty"`
+	DriveURL    string `json:"drive_url"`
+	Description string `json:"description"`
+	IsActive    *bool  `json:"is_active,omitempty"` // defaults to true
+
+	folderID string
+}
+
+// OverrideEntry sends one email address to its own folder
+type OverrideEntry struct {
+	Email       string `json:"email"`
+	Provider    string `json:"provider,omitempty"`
+	DriveURL    string `json:"drive_url"`
+	Description string `json:"description"`
+
+	folderID string
+}
+
+// active reports whether the domain entry should be active
+func (e DomainEntry) active() bool {
+	return e.IsActive == nil || *e.IsActive
+}
+
+// LoadFile reads and validates a mappings file
+func LoadFile(path string) (*File, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	var file File
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if err := file.normalize(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &file, nil
+}
+
+// normalize lower-cases keys and rejects incomplete or duplicate entries
+func (f *File) normalize() error {
+	if f.DefaultMapping != nil {
+		f.DefaultMapping.DriveURL = strings.TrimSpace(f.DefaultMapping.DriveURL)
+		if f.DefaultMapping.DriveURL == "" {
+			return fmt.Errorf("default_mapping: drive_url is required")
+		}
+		resource, err := providers.Parse(f.DefaultMapping.Provider, f.DefaultMapping.DriveURL)
+		if err != nil {
+			return fmt.Errorf("default_mapping: %w", err)
+		}
+		f.DefaultMapping.Provider = resource.Provider
+		f.DefaultMapping.folderID = resource.ID
+	}
+
+	seen := map[string]bool{}
+	for i := range f.Domains {
+		entry := &f.Domains[i]
+		entry.Domain = NormalizeDomain(entry.Domain)
+		entry.DriveURL = strings.TrimSpace(entry.DriveURL)
+
+		if entry.Domain == "" || entry.DriveURL == "" {
+			return fmt.Errorf("domains[%d]: domain and drive_url are required", i)
+		}
+		if seen[entry.Domain] {
+			return fmt.Errorf("domains[%d]: duplicate domain %q", i, entry.Domain)
+		}
+		resource, err := providers.Parse(entry.Provider, entry.DriveURL)
+		if err != nil {
+			return fmt.Errorf("domains[%d]: %w", i, err)
+		}
+		entry.Provider = resource.Provider
+		entry.folderID = resource.ID
+		seen[entry.Domain] = true
+	}
+
+	seen = map[string]bool{}
+	for i := range f.Overrides {
+		entry := &f.Overrides[i]
+		entry.Email = strings.ToLower(strings.TrimSpace(entry.Email))
+		entry.DriveURL = strings.TrimSpace(entry.DriveURL)
+
+		if !strings.Contains(entry.Email, "@") || entry.DriveURL == "" {
+			return fmt.Errorf("overrides[%d]: email and drive_url are required", i)
+		}
+		if seen[entry.Email] {
+			return fmt.Errorf("overrides[%d]: duplicate email %q", i, entry.Email)
+		}
+		resource, err := providers.Parse(entry.Provider, entry.DriveURL)
+		if err != nil {
+			return fmt.Errorf("overrides[%d]: %w", i, err)
+		}
+		entry.Provider = resource.Provider
+		entry.folderID = resource.ID
+		seen[entry.Email] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package mappings
+
+import (
+	"JWT-Authentication-go/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MarkDomainMapped closes the unmapped domain inbox entry for a domain that
+// just got a mapping. adminID is 0 when the mappings file created it.
+func MarkDomainMapped(db *gorm.DB, mapping models.DomainMapping, adminID uint) {
+	db.Model(&models.UnmappedDomain{}).
+		Where("domain = ? AND status <> ?", strings.ToLower(mapping.Domain), models.UnmappedMapped).
+		Updates(map[string]interface{}{
+			"status":      models.UnmappedMapped,
+			"mapping_id":  mapping.ID,
+			"resolved_by": adminID,
+			"resolved_at": time.Now().Unix(),
+		})
+}
@@ -0,0 +1,492 @@
+package mappings
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/models"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Plan actions
+const (
+	ActionAdd    = "add"
+	ActionChange = "change"
+	ActionRemove = "remove"
+)
+
+// Change is a single difference between the file and the database
+type Change struct {
+	Action  string   // add, change or remove
+	Kind    string   // domain, override or default
+	Key     string   // domain, email or "default"
+	Diff    []string // human readable field differences
+	Blocked bool     // touches a UI-managed mapping without --force
+
+	domain   *models.DomainMapping
+	override *models.MappingOverride
+	fallback *models.DefaultMapping
+
+	before    interface{} // the row as it was, for the audit log
+	newFolder bool        // the folder is new to this mapping and is verified first
+}
+
+// Plan is the ordered list of changes needed to make the database match a file
+type Plan struct {
+	Changes []Change
+}
+
+// Pending returns the number of changes that will be applied
+func (p *Plan) Pending() int {
+	count := 0
+	for _, change := range p.Changes {
+		if !change.Blocked {
+			count++
+		}
+	}
+	return count
+}
+
+// Print writes the plan in a diff-like format
+func (p *Plan) Print(w io.Writer) {
+	if len(p.Changes) == 0 {
+		fmt.Fprintln(w, "Mappings are up to date, nothing to do.")
+		return
+	}
+
+	symbols := map[string]string{ActionAdd: "+", ActionChange: "~", ActionRemove: "-"}
+	for _, change := range p.Changes {
+		line := fmt.Sprintf("%s %s %s", symbols[change.Action], change.Kind, change.Key)
+		if change.Blocked {
+			line += "  (skipped: managed in the admin panel, use --force)"
+		}
+		fmt.Fprintln(w, line)
+
+		for _, diff := range change.Diff {
+			fmt.Fprintf(w, "    %s\n", diff)
+		}
+	}
+
+	blocked := len(p.Changes) - p.Pending()
+	fmt.Fprintf(w, "\n%d to apply, %d skipped.\n", p.Pending(), blocked)
+}
+
+// BuildPlan compares the file with the database. Mappings created in the
+// admin panel are only touched when force is set.
+func BuildPlan(db *gorm.DB, file *File, force bool) (*Plan, error) {
+	plan := &Plan{}
+
+	if err := planDefault(db, file, force, plan); err != nil {
+		return nil, err
+	}
+	if err := planDomains(db, file, force, plan); err != nil {
+		return nil, err
+	}
+	if err := planOverrides(db, file, force, plan); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// planDefault compares the default mapping. Omitting it from the file leaves it alone.
+func planDefault(db *gorm.DB, file *File, force bool, plan *Plan) error {
+	if file.DefaultMapping == nil {
+		return nil
+	}
+
+	var existing []models.DefaultMapping
+	if err := db.Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	if len(existing) == 0 {
+		plan.Changes = append(plan.Changes, Change{
+			Action: ActionAdd,
+			Kind:   "default",
+			Key:    "default",
+			Diff:   []string{"drive_url: " + file.DefaultMapping.DriveURL},
+			fallback: &models.DefaultMapping{
+				Provider: file.DefaultMapping.Provider,
+				DriveURL: file.DefaultMapping.DriveURL,
+				FolderID: file.DefaultMapping.folderID,
+			},
+			newFolder: true,
+		})
+		return nil
+	}
+
+	desired := existing[0]
+	if desired.FolderID != file.DefaultMapping.folderID {
+		desired.LinkHealth = models.LinkHealth{HealthStatus: models.HealthUnknown}
+	}
+	desired.Provider = file.DefaultMapping.Provider
+	desired.DriveURL = file.DefaultMapping.DriveURL
+	desired.FolderID = file.DefaultMapping.folderID
+	desired.ManagedBy = models.ManagedByConfig
+
+	diff := diffFields(existing[0].Provider, desired.Provider, "provider", nil)
+	diff = diffFields(existing[0].DriveURL, desired.DriveURL, "drive_url", diff)
+	diff = diffFields(existing[0].FolderID, desired.FolderID, "folder_id", diff)
+	diff = diffFields(existing[0].ManagedBy, desired.ManagedBy, "managed_by", diff)
+	if len(diff) > 0 {
+		// A default that was never set belongs to nobody yet
+		unset := existing[0].DriveURL == ""
+		plan.Changes = append(plan.Changes, Change{
+			Action:    ActionChange,
+			Kind:      "default",
+			Key:       "default",
+			Diff:      diff,
+			Blocked:   existing[0].ManagedBy != models.ManagedByConfig && !unset && !force,
+			fallback:  &desired,
+			before:    existing[0],
+			newFolder: existing[0].FolderID != desired.FolderID,
+		})
+	}
+	return nil
+}
+
+// planDomains compares domain mappings
+func planDomains(db *gorm.DB, file *File, force bool, plan *Plan) error {
+	var rows []models.DomainMapping
+	if err := db.Order("domain").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	existing := map[string]models.DomainMapping{}
+	for _, row := range rows {
+		existing[strings.ToLower(row.Domain)] = row
+	}
+
+	for _, entry := range file.Domains {
+		row, found := existing[entry.Domain]
+		if !found {
+			plan.Changes = append(plan.Changes, Change{
+				Action: ActionAdd,
+				Kind:   "domain",
+				Key:    entry.Domain,
+				Diff:   []string{"drive_url: " + entry.DriveURL},
+				domain: &models.DomainMapping{
+					Domain:      entry.Domain,
+					Provider:    entry.Provider,
+					DriveURL:    entry.DriveURL,
+					FolderID:    entry.folderID,
+					Description: entry.Description,
+					IsActive:    entry.active(),
+				},
+				newFolder: true,
+			})
+			continue
+		}
+		delete(existing, entry.Domain)
+
+		desired := row
+		if desired.FolderID != entry.folderID {
+			desired.LinkHealth = models.LinkHealth{HealthStatus: models.HealthUnknown}
+		}
+		desired.Provider = entry.Provider
+		desired.DriveURL = entry.DriveURL
+		desired.FolderID = entry.folderID
+		desired.Description = entry.Description
+		desired.IsActive = entry.active()
+		desired.ManagedBy = models.ManagedByConfig
+
+		diff := diffFields(row.Provider, desired.Provider, "provider", nil)
+		diff = diffFields(row.DriveURL, desired.DriveURL, "drive_url", diff)
+		diff = diffFields(row.FolderID, desired.FolderID, "folder_id", diff)
+		diff = diffFields(row.Description, desired.Description, "description", diff)
+		diff = diffFields(fmt.Sprint(row.IsActive), fmt.Sprint(desired.IsActive), "is_active", diff)
+		diff = diffFields(row.ManagedBy, desired.ManagedBy, "managed_by", diff)
+		if len(diff) > 0 {
+			plan.Changes = append(plan.Changes, Change{
+				Action:    ActionChange,
+				Kind:      "domain",
+				Key:       entry.Domain,
+				Diff:      diff,
+				Blocked:   row.ManagedBy != models.ManagedByConfig && !force,
+				domain:    &desired,
+				before:    row,
+				newFolder: row.FolderID != desired.FolderID,
+			})
+		}
+	}
+
+	// Mappings the file does not list are removed when the file owns them.
+	// Those made in the admin panel are not the file's business unless forced.
+	for _, row := range rows {
+		if _, stale := existing[strings.ToLower(row.Domain)]; !stale {
+			continue
+		}
+		if row.ManagedBy != models.ManagedByConfig && !force {
+			continue
+		}
+		row := row
+		plan.Changes = append(plan.Changes, Change{
+			Action: ActionRemove,
+			Kind:   "domain",
+			Key:    row.Domain,
+			domain: &row,
+			before: row,
+		})
+	}
+
+	return nil
+}
+
+// planOverrides compares per-email overrides
+func planOverrides(db *gorm.DB, file *File, force bool, plan *Plan) error {
+	var rows []models.MappingOverride
+	if err := db.Order("email").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	existing := map[string]models.MappingOverride{}
+	for _, row := range rows {
+		existing[strings.ToLower(row.Email)] = row
+	}
+
+	for _, entry := range file.Overrides {
+		row, found := existing[entry.Email]
+		if !found {
+			plan.Changes = append(plan.Changes, Change{
+				Action: ActionAdd,
+				Kind:   "override",
+				Key:    entry.Email,
+				Diff:   []string{"drive_url: " + entry.DriveURL},
+				override: &models.MappingOverride{
+					Email:       entry.Email,
+					Provider:    entry.Provider,
+					DriveURL:    entry.DriveURL,
+					FolderID:    entry.folderID,
+					Description: entry.Description,
+				},
+				newFolder: true,
+			})
+			continue
+		}
+		delete(existing, entry.Email)
+
+		desired := row
+		desired.Provider = entry.Provider
+		desired.DriveURL = entry.DriveURL
+		desired.FolderID = entry.folderID
+		desired.Description = entry.Description
+		desired.ManagedBy = models.ManagedByConfig
+
+		diff := diffFields(row.Provider, desired.Provider, "provider", nil)
+		diff = diffFields(row.DriveURL, desired.DriveURL, "drive_url", diff)
+		diff = diffFields(row.FolderID, desired.FolderID, "folder_id", diff)
+		diff = diffFields(row.Description, desired.Description, "description", diff)
+		diff = diffFields(row.ManagedBy, desired.ManagedBy, "managed_by", diff)
+		if len(diff) > 0 {
+			plan.Changes = append(plan.Changes, Change{
+				Action:    ActionChange,
+				Kind:      "override",
+				Key:       entry.Email,
+				Diff:      diff,
+				Blocked:   row.ManagedBy != models.ManagedByConfig && !force,
+				override:  &desired,
+				before:    row,
+				newFolder: row.FolderID != desired.FolderID,
+			})
+		}
+	}
+
+	for _, row := range rows {
+		if _, stale := existing[strings.ToLower(row.Email)]; !stale {
+			continue
+		}
+		if row.ManagedBy != models.ManagedByConfig && !force {
+			continue
+		}
+		row := row
+		plan.Changes = append(plan.Changes, Change{
+			Action:   ActionRemove,
+			Kind:     "override",
+			Key:      row.Email,
+			override: &row,
+			before:   row,
+		})
+	}
+
+	return nil
+}
+
+// diffFields appends "field: old -> new" when the values differ
+func diffFields(before, after, field string, diff []string) []string {
+	if before == after {
+		return diff
+	}
+	return append(diff, fmt.Sprintf("%s: %q -> %q", field, before, after))
+}
+
+// Apply writes every unblocked change in a single transaction the way the
+// admin panel does: new Drive folders are verified first and every write is
+// audited. Once committed, grants made through a mapping whose folder changed
+// or which was removed are revoked, and new domains leave the unmapped inbox.
+func Apply(db *gorm.DB, plan *Plan) error {
+	for _, change := range plan.Changes {
+		if change.Blocked || !change.newFolder {
+			continue
+		}
+		provider, folderID := change.folder()
+		if err := drive.VerifyFolder(provider, folderID); err != nil {
+			return fmt.Errorf("%s %s %s: %w", change.Action, change.Kind, change.Key, err)
+		}
+	}
+
+	now := time.Now().Unix()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, change := range plan.Changes {
+			if change.Blocked {
+				continue
+			}
+
+			var err error
+			switch {
+			case change.domain != nil:
+				err = applyDomain(tx, change, now)
+			case change.override != nil:
+				err = applyOverride(tx, change, now)
+			case change.fallback != nil:
+				err = applyDefault(tx, change, now)
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s %s: %w", change.Action, change.Kind, change.Key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range plan.Changes {
+		if change.Blocked {
+			continue
+		}
+		if change.Action == ActionRemove || (change.Action == ActionChange && change.newFolder) {
+			drive.RevokeGrants(db, "mapping_type = ? AND mapping_id = ?", change.Kind, change.id())
+		}
+		if change.domain != nil && change.Action != ActionRemove && change.domain.IsActive {
+			MarkDomainMapped(db, *change.domain, 0)
+		}
+	}
+	return nil
+}
+
+// folder returns the provider and folder ID a change points to
+func (c Change) folder() (string, string) {
+	switch {
+	case c.domain != nil:
+		return c.domain.Provider, c.domain.FolderID
+	case c.override != nil:
+		return c.override.Provider, c.override.FolderID
+	case c.fallback != nil:
+		return c.fallback.Provider, c.fallback.FolderID
+	}
+	return "", ""
+}
+
+// id returns the ID of the row a change writes
+func (c Change) id() uint {
+	switch {
+	case c.domain != nil:
+		return c.domain.ID
+	case c.override != nil:
+		return c.override.ID
+	case c.fallback != nil:
+		return c.fallback.ID
+	}
+	return 0
+}
+
+// auditAction names a change in the audit log
+func auditAction(targetType, action string) string {
+	switch action {
+	case ActionAdd:
+		return targetType + ".create"
+	case ActionRemove:
+		return targetType + ".delete"
+	default:
+		return targetType + ".update"
+	}
+}
+
+// applyDomain writes one domain mapping change
+func applyDomain(tx *gorm.DB, change Change, now int64) error {
+	mapping := change.domain
+	if change.Action == ActionRemove {
+		if err := tx.Delete(mapping).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, nil, "domain_mapping.delete", "domain_mapping", mapping.ID, change.before, nil)
+	}
+
+	mapping.ManagedBy = models.ManagedByConfig
+	mapping.UpdatedAt = now
+	if mapping.ID == 0 {
+		mapping.CreatedAt = now
+		if err := tx.Create(mapping).Error; err != nil {
+			return err
+		}
+	}
+	// Save again so an explicit is_active=false is not replaced by the column default
+	if err := tx.Save(mapping).Error; err != nil {
+		return err
+	}
+	return audit.Record(tx, nil, auditAction("domain_mapping", change.Action), "domain_mapping", mapping.ID, change.before, mapping)
+}
+
+// applyOverride writes one override change
+func applyOverride(tx *gorm.DB, change Change, now int64) error {
+	override := change.override
+	if change.Action == ActionRemove {
+		if err := tx.Delete(override).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, nil, "mapping_override.delete", "mapping_override", override.ID, change.before, nil)
+	}
+
+	override.ManagedBy = models.ManagedByConfig
+	override.UpdatedAt = now
+	if override.ID == 0 {
+		override.CreatedAt = now
+	}
+	if err := tx.Save(override).Error; err != nil {
+		return err
+	}
+	return audit.Record(tx, nil, auditAction("mapping_override", change.Action), "mapping_override", override.ID, change.before, override)
+}
+
+// applyDefault writes the default mapping
+func applyDefault(tx *gorm.DB, change Change, now int64) error {
+	fallback := change.fallback
+	fallback.ManagedBy = models.ManagedByConfig
+	fallback.UpdatedAt = now
+	if err := tx.Save(fallback).Error; err != nil {
+		return err
+	}
+	return audit.Record(tx, nil, "default_mapping.update", "default_mapping", fallback.ID, change.before, fallback)
+}
+
+// SyncFile loads a mappings file and applies it without prompting.
+// Used by the optional startup hook.
+func SyncFile(db *gorm.DB, path string, w io.Writer) error {
+	file, err := LoadFile(path)
+	if err != nil {
+		return err
+	}
+
+	plan, err := BuildPlan(db, file, false)
+	if err != nil {
+		return err
+	}
+
+	plan.Print(w)
+	return Apply(db, plan)
+}
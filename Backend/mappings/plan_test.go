@@ -0,0 +1,202 @@
+package mappings
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/drive"
+	"JWT-Authentication-go/models"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const folderURL = "https://drive.google.com/drive/folders/"
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// withStandIn turns the Drive integration on with the given folders
+func withStandIn(t *testing.T, folders ...string) *drive.StandIn {
+	t.Helper()
+
+	standIn := drive.NewStandIn()
+	for _, folder := range folders {
+		standIn.AddFolder(folder, folder)
+	}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+	client, err := drive.NewClient("", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drive.API = client
+	t.Cleanup(func() { drive.API = nil })
+	return standIn
+}
+
+func loadFile(t *testing.T, content string) *File {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "mappings.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// summary lists the changes of a plan as "action kind key", with "!" for
+// blocked ones
+func summary(plan *Plan) string {
+	lines := []string{}
+	for _, change := range plan.Changes {
+		line := change.Action + " " + change.Kind + " " + change.Key
+		if change.Blocked {
+			line += " !"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestBuildPlan(t *testing.T) {
+	db := newTestDB(t)
+
+	// An empty default as older versions seeded it, managed by nobody yet
+	db.Create(&models.DefaultMapping{ManagedBy: models.ManagedByUI})
+	db.Create(&models.DomainMapping{Domain: "panel.com", DriveURL: folderURL + "panel-1234567890", FolderID: "panel-1234567890", IsActive: true, ManagedBy: models.ManagedByUI})
+	db.Create(&models.DomainMapping{Domain: "edited.com", DriveURL: folderURL + "edited-1234567890", FolderID: "edited-1234567890", IsActive: true, ManagedBy: models.ManagedByUI})
+	db.Create(&models.DomainMapping{Domain: "stale.com", DriveURL: folderURL + "stale-1234567890", FolderID: "stale-1234567890", IsActive: true, ManagedBy: models.ManagedByConfig})
+	db.Create(&models.DomainMapping{Domain: "same.com", DriveURL: folderURL + "same-1234567890", FolderID: "same-1234567890", IsActive: true, ManagedBy: models.ManagedByConfig})
+
+	file := loadFile(t, `{
+		"default_mapping": {"drive_url": "`+folderURL+`default-1234567890"},
+		"domains": [
+			{"domain": "Edited.com", "drive_url": "`+folderURL+`file-1234567890"},
+			{"domain": "same.com", "drive_url": "`+folderURL+`same-1234567890"},
+			{"domain": "new.com", "drive_url": "`+folderURL+`new-1234567890", "is_active": false}
+		],
+		"overrides": [{"email": "Ada@Acme.com", "drive_url": "`+folderURL+`ada-1234567890"}]
+	}`)
+
+	plan, err := BuildPlan(db, file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"change default default",
+		"change domain edited.com !",
+		"add domain new.com",
+		"remove domain stale.com",
+		"add override ada@acme.com",
+	}, "\n")
+	if got := summary(plan); got != want {
+		t.Errorf("plan:\n%s\nwant:\n%s", got, want)
+	}
+	if plan.Pending() != 4 {
+		t.Errorf("pending = %d, want 4", plan.Pending())
+	}
+
+	// Forced, the panel's mappings are the file's too
+	plan, err = BuildPlan(db, file, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Join([]string{
+		"change default default",
+		"change domain edited.com",
+		"add domain new.com",
+		"remove domain panel.com",
+		"remove domain stale.com",
+		"add override ada@acme.com",
+	}, "\n")
+	if got := summary(plan); got != want {
+		t.Errorf("forced plan:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := newTestDB(t)
+	standIn := withStandIn(t, "acme-1234567890", "acme-new-1234567890", "beta-1234567890")
+
+	acme := models.DomainMapping{Domain: "acme.com", DriveURL: folderURL + "acme-1234567890", FolderID: "acme-1234567890", IsActive: true, ManagedBy: models.ManagedByConfig}
+	db.Create(&acme)
+	permission, _ := drive.API.CreatePermission(context.Background(), acme.FolderID, "ada@acme.com", "reader")
+	db.Create(&models.DriveGrant{UserID: 1, FolderID: acme.FolderID, PermissionID: permission, MappingType: "domain", MappingID: acme.ID})
+	db.Create(&models.UnmappedDomain{Domain: "beta.com", Status: models.UnmappedOpen})
+
+	file := loadFile(t, `{"domains": [
+		{"domain": "acme.com", "drive_url": "`+folderURL+`acme-new-1234567890"},
+		{"domain": "beta.com", "drive_url": "`+folderURL+`beta-1234567890"}
+	]}`)
+	plan, err := BuildPlan(db, file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(db, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	var actions []string
+	db.Model(&models.AuditEvent{}).Order("id").Pluck("action", &actions)
+	if strings.Join(actions, ",") != "domain_mapping.update,domain_mapping.create" {
+		t.Errorf("audit actions = %v, want an update and a create", actions)
+	}
+	var grant models.DriveGrant
+	db.First(&grant)
+	if grant.RevokedAt == 0 || len(standIn.Permissions(acme.FolderID)) != 0 {
+		t.Error("the grant on the replaced folder was not revoked")
+	}
+	var entry models.UnmappedDomain
+	db.Where("domain = ?", "beta.com").First(&entry)
+	if entry.Status != models.UnmappedMapped || entry.MappingID == 0 {
+		t.Errorf("inbox entry is %s with mapping %d, want mapped", entry.Status, entry.MappingID)
+	}
+}
+
+func TestApplyRefusesMissingFolder(t *testing.T) {
+	db := newTestDB(t)
+	withStandIn(t, "acme-1234567890")
+
+	file := loadFile(t, `{"domains": [
+		{"domain": "acme.com", "drive_url": "`+folderURL+`acme-1234567890"},
+		{"domain": "gone.com", "drive_url": "`+folderURL+`gone-1234567890"}
+	]}`)
+	plan, err := BuildPlan(db, file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(db, plan); err == nil || !strings.Contains(err.Error(), "gone.com") {
+		t.Fatalf("Apply err = %v, want gone.com refused", err)
+	}
+
+	var count int64
+	db.Model(&models.DomainMapping{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d mappings written, want none", count)
+	}
+}
@@ -0,0 +1,246 @@
+package mfa
+
+import (
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Ways a second factor can be proven
+const (
+	MethodTOTP     = "totp"
+	MethodRecovery = "recovery_code"
+)
+
+// Two-factor errors
+var (
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingSetup = errors.New("start two-factor setup first")
+	ErrInvalidCode    = errors.New("invalid authentication code")
+)
+
+// Required reports whether users with the role must use two-factor
+// authentication for admin features
+func Required(role string) bool {
+	for _, required := range splitRoles() {
+		if required != "" && strings.EqualFold(required, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRoles returns the trimmed entries of MFA_REQUIRED_ROLES
+func splitRoles() []string {
+	roles := strings.Split(config.MFARequiredRoles, ",")
+	for i := range roles {
+		roles[i] = strings.TrimSpace(roles[i])
+	}
+	return roles
+}
+
+// Enrollment is what an authenticator app needs to add the account
+type Enrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"` // PNG data URI
+}
+
+// Setup creates a new secret for the user to add to their authenticator app.
+// It only takes effect once Enable confirms a code from the app.
+func Setup(db *gorm.DB, user models.User) (Enrollment, error) {
+	if user.MFAEnabled {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+
+	key, err := NewKey(user.Email)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	qr, err := QRCode(key)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	sealed, err := Seal(key.Secret())
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	if err := db.Model(&models.User{}).Where("id = ?", user.ID).
+		Update("mfa_pending_secret", sealed).Error; err != nil {
+		return Enrollment{}, err
+	}
+	return Enrollment{Secret: key.Secret(), OTPAuthURI: key.URL(), QRCode: qr}, nil
+}
+
+// Enable turns two-factor authentication on once the user proves their app
+// produces valid codes, and returns their first set of recovery codes
+func Enable(db *gorm.DB, c *fiber.Ctx, user models.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.MFAPendingSecret == "" {
+		return nil, ErrNoPendingSetup
+	}
+
+	secret, err := Open(user.MFAPendingSecret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := CheckCode(secret, strings.TrimSpace(code), 0, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"mfa_enabled":        true,
+			"mfa_enabled_at":     now,
+			"mfa_secret":         user.MFAPendingSecret,
+			"mfa_pending_secret": "",
+			"mfa_last_step":      step,
+		}).Error; err != nil {
+			return err
+		}
+
+		generated, err := replaceRecoveryCodes(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		codes = generated
+
+		return audit.Record(tx, c, "user.mfa_enable", "user", user.ID, nil, nil)
+	})
+	return codes, err
+}
+
+// Disable turns two-factor authentication off and drops the recovery codes.
+// action is the audit action, so an admin reset can be told apart.
+func Disable(db *gorm.DB, c *fiber.Ctx, user models.User, action string) error {
+	if !user.MFAEnabled && user.MFAPendingSecret == "" {
+		return ErrNotEnabled
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"mfa_enabled":        false,
+			"mfa_enabled_at":     0,
+			"mfa_secret":         "",
+			"mfa_pending_secret": "",
+			"mfa_last_step":      0,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, action, "user", user.ID, nil, nil)
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user
+func RegenerateRecoveryCodes(db *gorm.DB, c *fiber.Ctx, user models.User) ([]string, error) {
+	if !user.MFAEnabled {
+		return nil, ErrNotEnabled
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		generated, err := replaceRecoveryCodes(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		codes = generated
+		return audit.Record(tx, c, "user.mfa_recovery_codes", "user", user.ID, nil, nil)
+	})
+	return codes, err
+}
+
+// RemainingRecoveryCodes counts the unused recovery codes of a user
+func RemainingRecoveryCodes(db *gorm.DB, userID uint) int64 {
+	var remaining int64
+	db.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at = 0", userID).Count(&remaining)
+	return remaining
+}
+
+// Verify checks a second factor for a user with two-factor authentication:
+// a code from their app, or failing that one of their recovery codes, which
+// is then used up. It returns the method that matched.
+func Verify(db *gorm.DB, user models.User, code string) (string, error) {
+	if !user.MFAEnabled {
+		return "", ErrNotEnabled
+	}
+	code = strings.TrimSpace(code)
+
+	secret, err := Open(user.MFASecret)
+	if err != nil {
+		return "", err
+	}
+	if step, ok := CheckCode(secret, code, user.MFALastStep, time.Now()); ok {
+		// Only move forward, so a concurrent request cannot reuse the code
+		updated := db.Model(&models.User{}).
+			Where("id = ? AND mfa_last_step < ?", user.ID, step).
+			Update("mfa_last_step", step)
+		if updated.Error != nil {
+			return "", updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return "", ErrInvalidCode
+		}
+		return MethodTOTP, nil
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return "", ErrInvalidCode
+	}
+	var unused []models.MFARecoveryCode
+	db.Where("user_id = ? AND used_at = 0", user.ID).Find(&unused)
+	for _, recovery := range unused {
+		if bcrypt.CompareHashAndPassword(recovery.CodeHash, []byte(normalized)) != nil {
+			continue
+		}
+		used := db.Model(&models.MFARecoveryCode{}).
+			Where("id = ? AND used_at = 0", recovery.ID).
+			Update("used_at", time.Now().Unix())
+		if used.Error != nil {
+			return "", used.Error
+		}
+		if used.RowsAffected == 0 {
+			return "", ErrInvalidCode
+		}
+		return MethodRecovery, nil
+	}
+	return "", ErrInvalidCode
+}
+
+// replaceRecoveryCodes drops the user's recovery codes and stores new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	rows := make([]models.MFARecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		rows[i] = models.MFARecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: now}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
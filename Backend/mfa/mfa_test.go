@@ -0,0 +1,237 @@
+package mfa
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testKey = "test-mfa-encryption-key-0123456789abcdef"
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// withKey sets MFA_ENCRYPTION_KEY for the rest of the test
+func withKey(t *testing.T, key string) {
+	t.Helper()
+
+	previous := config.MFAEncryptionKey
+	config.MFAEncryptionKey = key
+	t.Cleanup(func() { config.MFAEncryptionKey = previous })
+}
+
+// enrolledUser stores a user with two-factor authentication enabled and
+// returns it with its secret
+func enrolledUser(t *testing.T, db *gorm.DB) (models.User, string) {
+	t.Helper()
+
+	key, err := NewKey("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(key.Secret())
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Name: "Ada", Email: "ada@example.com", Password: []byte("unusable"), MFAEnabled: true, MFASecret: sealed}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user, key.Secret()
+}
+
+// codeAt returns the code an authenticator app shows at a time
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{Period: period, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestSealOpen(t *testing.T) {
+	withKey(t, testKey)
+
+	first, err := Seal("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := Seal("JBSWY3DPEHPK3PXP")
+	if first == second || strings.Contains(first, "JBSWY3DPEHPK3PXP") {
+		t.Error("sealing is not randomised or leaks the secret")
+	}
+	if secret, err := Open(first); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Open = %q, %v; want the secret back", secret, err)
+	}
+
+	// Every changed byte is detected
+	raw, _ := base64.StdEncoding.DecodeString(first)
+	for i := range raw {
+		tampered := append([]byte(nil), raw...)
+		tampered[i] ^= 0x01
+		if _, err := Open(base64.StdEncoding.EncodeToString(tampered)); err == nil {
+			t.Fatalf("a change to byte %d was not detected", i)
+		}
+	}
+	for _, broken := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := Open(broken); err == nil {
+			t.Errorf("Open(%q) succeeded", broken)
+		}
+	}
+
+	withKey(t, testKey+"-rotated")
+	if _, err := Open(first); err == nil {
+		t.Error("opened with another key")
+	}
+
+	withKey(t, "")
+	if _, err := Seal("JBSWY3DPEHPK3PXP"); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("Seal without a key err = %v, want ErrNoEncryptionKey", err)
+	}
+	if _, err := Open(first); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("Open without a key err = %v, want ErrNoEncryptionKey", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	db := newTestDB(t)
+	previousRoles := config.MFARequiredRoles
+	t.Cleanup(func() { config.MFARequiredRoles = previousRoles })
+
+	withKey(t, "")
+	config.MFARequiredRoles = "admin"
+	if err := Load(db); err == nil {
+		t.Error("started without a key while admins must use two-factor")
+	}
+	config.MFARequiredRoles = " , "
+	if err := Load(db); err != nil {
+		t.Errorf("Load with two-factor unused = %v, want nil", err)
+	}
+
+	// A secret sealed by an older version with the JWT secret
+	legacy := func(secret string) string {
+		gcm, err := newGCM(deriveKey(utils.SecretKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil))
+	}
+	user := models.User{Name: "Ada", Email: "ada@example.com", Password: []byte("unusable"),
+		MFAEnabled: true, MFASecret: legacy("JBSWY3DPEHPK3PXP")}
+	db.Create(&user)
+	if err := Load(db); err == nil {
+		t.Error("started without a key while a user has two-factor enabled")
+	}
+
+	withKey(t, "too-short")
+	if err := Load(db); err == nil {
+		t.Error("accepted a short key")
+	}
+
+	withKey(t, testKey)
+	if err := Load(db); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&user, user.ID)
+	if secret, err := Open(user.MFASecret); err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("resealed secret = %q, %v; want it readable with the configured key", secret, err)
+	}
+	if _, err := open(deriveKey(utils.SecretKey), user.MFASecret); err == nil {
+		t.Error("the secret can still be read with the JWT secret")
+	}
+}
+
+func TestVerifyRejectsReplayedCode(t *testing.T) {
+	withKey(t, testKey)
+	db := newTestDB(t)
+	user, secret := enrolledUser(t, db)
+	code := codeAt(t, secret, time.Now())
+
+	if method, err := Verify(db, user, code); err != nil || method != MethodTOTP {
+		t.Fatalf("Verify = %q, %v; want a TOTP match", method, err)
+	}
+
+	// The same code fails whether or not the caller saw the new last step
+	if _, err := Verify(db, user, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("replay with a stale user err = %v, want ErrInvalidCode", err)
+	}
+	db.First(&user, user.ID)
+	if user.MFALastStep != time.Now().Unix()/period && user.MFALastStep != time.Now().Unix()/period-1 {
+		t.Errorf("mfa_last_step = %d, want the current step", user.MFALastStep)
+	}
+	if _, err := Verify(db, user, code); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("replay err = %v, want ErrInvalidCode", err)
+	}
+
+	// Nor is an older code from the drift window accepted after a newer one
+	if _, err := Verify(db, user, codeAt(t, secret, time.Now().Add(-period*time.Second))); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("previous step code err = %v, want ErrInvalidCode", err)
+	}
+	if _, err := Verify(db, user, "000000"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("wrong code err = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	withKey(t, testKey)
+	db := newTestDB(t)
+	user, _ := enrolledUser(t, db)
+
+	codes, err := RegenerateRecoveryCodes(db, nil, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || RemainingRecoveryCodes(db, user.ID) != RecoveryCodeCount {
+		t.Fatalf("got %d codes, %d stored", len(codes), RemainingRecoveryCodes(db, user.ID))
+	}
+
+	// Typed in capitals without the dash
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if method, err := Verify(db, user, typed); err != nil || method != MethodRecovery {
+		t.Fatalf("Verify(recovery) = %q, %v", method, err)
+	}
+	if _, err := Verify(db, user, codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("reused recovery code err = %v, want ErrInvalidCode", err)
+	}
+	if remaining := RemainingRecoveryCodes(db, user.ID); remaining != RecoveryCodeCount-1 {
+		t.Errorf("%d codes left, want %d", remaining, RecoveryCodeCount-1)
+	}
+
+	// New codes replace the old ones
+	if _, err := RegenerateRecoveryCodes(db, nil, user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(db, user, codes[1]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("replaced recovery code err = %v, want ErrInvalidCode", err)
+	}
+}
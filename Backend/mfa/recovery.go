@@ -0,0 +1,40 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time
+const RecoveryCodeCount = 10
+
+// newRecoveryCodes returns fresh codes, formatted for reading out like
+// "k3m9q-x7d2p", together with their hashes
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([][]byte, RecoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))[:10]
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hash
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts a code however it was typed
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
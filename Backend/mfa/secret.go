@@ -0,0 +1,158 @@
+package mfa
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/utils"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// minKeyLength is the shortest MFA_ENCRYPTION_KEY accepted
+const minKeyLength = 32
+
+// ErrNoEncryptionKey is returned when a secret must be sealed but
+// MFA_ENCRYPTION_KEY is not set
+var ErrNoEncryptionKey = errors.New("MFA_ENCRYPTION_KEY is not set")
+
+// Load checks the key TOTP secrets are encrypted with. Without
+// MFA_ENCRYPTION_KEY it fails while any role must use two-factor
+// authentication or any user has it set up. Secrets sealed by older versions
+// with the key derived from the JWT secret are sealed again with the
+// configured key.
+func Load(db *gorm.DB) error {
+	if config.MFAEncryptionKey == "" {
+		var enrolled int64
+		err := db.Model(&models.User{}).
+			Where("mfa_secret <> '' OR mfa_pending_secret <> ''").
+			Count(&enrolled).Error
+		if err != nil {
+			return err
+		}
+		if hasRequiredRoles() || enrolled > 0 {
+			return errors.New("MFA_ENCRYPTION_KEY must be set while two-factor authentication is required or in use")
+		}
+		return nil
+	}
+	if len(config.MFAEncryptionKey) < minKeyLength {
+		return fmt.Errorf("MFA_ENCRYPTION_KEY must be at least %d characters", minKeyLength)
+	}
+
+	return resealLegacySecrets(db)
+}
+
+// hasRequiredRoles reports whether MFA_REQUIRED_ROLES names any role
+func hasRequiredRoles() bool {
+	for _, role := range splitRoles() {
+		if role != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resealLegacySecrets encrypts secrets stored under the legacy key again
+// with the configured one
+func resealLegacySecrets(db *gorm.DB) error {
+	var users []models.User
+	err := db.Select("id", "mfa_secret", "mfa_pending_secret").
+		Where("mfa_secret <> '' OR mfa_pending_secret <> ''").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	legacy := deriveKey(utils.SecretKey)
+	for _, user := range users {
+		updates := map[string]interface{}{}
+		for column, sealed := range map[string]string{"mfa_secret": user.MFASecret, "mfa_pending_secret": user.MFAPendingSecret} {
+			if sealed == "" {
+				continue
+			}
+			if _, err := Open(sealed); err == nil {
+				continue
+			}
+			secret, err := open(legacy, sealed)
+			if err != nil {
+				return fmt.Errorf("user %d: %s cannot be decrypted with MFA_ENCRYPTION_KEY", user.ID, column)
+			}
+			if updates[column], err = Seal(secret); err != nil {
+				return err
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deriveKey turns a configured key into the AES key secrets are encrypted with
+func deriveKey(key string) []byte {
+	sum := sha256.Sum256([]byte("mfa-secret:" + key))
+	return sum[:]
+}
+
+// Seal encrypts a TOTP secret for storage
+func Seal(secret string) (string, error) {
+	if config.MFAEncryptionKey == "" {
+		return "", ErrNoEncryptionKey
+	}
+	gcm, err := newGCM(deriveKey(config.MFAEncryptionKey))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a secret stored by Seal
+func Open(sealed string) (string, error) {
+	if config.MFAEncryptionKey == "" {
+		return "", ErrNoEncryptionKey
+	}
+	return open(deriveKey(config.MFAEncryptionKey), sealed)
+}
+
+// open decrypts a sealed secret with an AES key
+func open(key []byte, sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("stored secret is too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// newGCM sets up AES-GCM with a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
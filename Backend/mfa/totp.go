@@ -0,0 +1,63 @@
+package mfa
+
+import (
+	"JWT-Authentication-go/config"
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"image/png"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// period is the TOTP time step in seconds, the authenticator app default
+const period = 30
+
+// NewKey generates a TOTP secret for an account
+func NewKey(accountName string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      config.MFAIssuer,
+		AccountName: accountName,
+		Period:      period,
+	})
+}
+
+// QRCode renders the otpauth URI of a key as a PNG data URI for the
+// enrollment page to show
+func QRCode(key *otp.Key) (string, error) {
+	image, err := key.Image(256, 256)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// CheckCode validates a code against a secret, allowing one step of clock
+// drift either way. Steps up to lastStep were used before and are refused so
+// a code cannot be replayed. It returns the step the code belongs to.
+func CheckCode(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	current := now.Unix() / period
+	for _, step := range []int64{current, current - 1, current + 1} {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*period, 0), totp.ValidateOpts{
+			Period:    period,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,19 @@
+package models
+
+// AuditEvent records a privileged action. Events form a hash chain: each
+// Hash covers the event's content and the previous event's Hash, so editing
+// or deleting a row breaks verification from that point on.
+type AuditEvent struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	ActorID    uint   `gorm:"index" json:"actor_id"` // 0 for the system and command-line tools
+	Action     string `gorm:"size:64;index" json:"action"`
+	TargetType string `gorm:"size:32;index:idx_audit_target" json:"target_type"`
+	TargetID   string `gorm:"size:64;index:idx_audit_target" json:"target_id"`
+	Before     string `gorm:"type:text" json:"before"` // JSON snapshot, empty for creations
+	After      string `gorm:"type:text" json:"after"`  // JSON snapshot, empty for deletions
+	IPAddress  string `gorm:"size:64" json:"ip_address"`
+	RequestID  string `gorm:"size:64" json:"request_id"`
+	CreatedAt  int64  `gorm:"index" json:"created_at"`
+	PrevHash   string `gorm:"size:64" json:"prev_hash"`
+	Hash       string `gorm:"size:64;uniqueIndex" json:"hash"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// DirectorySyncRun records one pass of the directory sync job over one
+// LDAP directory
+type DirectorySyncRun struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Directory   string `gorm:"size:64;index" json:"directory"`
+	StartedAt   int64  `gorm:"index" json:"started_at"`
+	FinishedAt  int64  `json:"finished_at"`
+	Checked     int64  `json:"checked"`     // active users looked up
+	Updated     int64  `json:"updated"`     // users whose role or department changed
+	Deactivated int64  `json:"deactivated"` // users no longer in the directory
+	Error       string `json:"error"`
+}
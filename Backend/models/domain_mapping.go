@@ -1,32 +1,79 @@
 package models
 
-// DomainMapping stores the mapping of email domains to Google Drive folder URLs
+// Values for the ManagedBy column of mappings
+const (
+	ManagedByUI     = "ui"     // created or edited through the admin panel
+	ManagedByConfig = "config" // owned by the declarative mappings file
+)
+
+// DomainMapping stores the mapping of email domains to folder URLs on a
+// storage provider (Google Drive unless Provider says otherwise)
 type DomainMapping struct {
 	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
 	Domain      string `json:"domain"`
+	Provider    string `json:"provider" gorm:"default:'gdrive'"`
 	DriveURL    string `json:"drive_url"`
+	FolderID    string `json:"folder_id"` // canonical folder ID parsed from DriveURL by the provider
 	Description string `json:"description"`
 	IsActive    bool   `json:"is_active" gorm:"default:true"`
 	CreatedAt   int64  `json:"created_at"`
 	UpdatedAt   int64  `json:"updated_at"`
 	CreatedBy   uint   `json:"created_by,omitempty"`
+	ManagedBy   string `json:"managed_by" gorm:"default:'ui'"`
+	LinkHealth
 }
 
 // DefaultMapping represents the default/fallback mapping when a domain is not found
 type DefaultMapping struct {
 	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Provider  string `json:"provider" gorm:"default:'gdrive'"`
 	DriveURL  string `json:"drive_url"`
+	FolderID  string `json:"folder_id"`
 	UpdatedAt int64  `json:"updated_at"`
 	UpdatedBy uint   `json:"updated_by"` // Admin user ID who last updated this
+	ManagedBy string `json:"managed_by" gorm:"default:'ui'"`
+	LinkHealth
+}
+
+// Values for LinkHealth.HealthStatus
+const (
+	HealthUnknown = "unknown"
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+)
+
+// LinkHealth is the result of the periodic link check, embedded in mappings
+type LinkHealth struct {
+	HealthStatus        string `json:"health_status" gorm:"default:'unknown'"`
+	LastCheckedAt       int64  `json:"last_checked_at"`
+	LastError           string `json:"last_error"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
+
+// MappingOverride sends a single email address to a specific folder,
+// taking precedence over the mapping of its domain
+type MappingOverride struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Email       string `gorm:"uniqueIndex;size:255" json:"email"`
+	Provider    string `json:"provider" gorm:"default:'gdrive'"`
+	DriveURL    string `json:"drive_url"`
+	FolderID    string `json:"folder_id"`
+	Description string `json:"description"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+	ManagedBy   string `json:"managed_by" gorm:"default:'config'"`
 }
 
 // AccessLog records user access to drive folders
 type AccessLog struct {
-	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID    uint   `json:"user_id"`
-	Domain    string `json:"domain"`
-	DriveURL  string `json:"drive_url"`
-	Timestamp int64  `json:"timestamp"`
-	IPAddress string `json:"ip_address"`
-	UserAgent string `json:"user_agent"`
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint   `gorm:"index" json:"user_id"`
+	Domain      string `gorm:"size:255;index" json:"domain"`
+	DriveURL    string `json:"drive_url"`
+	IsDefault   bool   `gorm:"index" json:"is_default"`     // resolved to the default mapping
+	MappingType string `gorm:"size:16" json:"mapping_type"` // domain, default or override
+	MappingID   uint   `gorm:"index" json:"mapping_id"`     // row of the mapping that answered
+	Timestamp   int64  `gorm:"index" json:"timestamp"`
+	IPAddress   string `gorm:"size:64;index" json:"ip_address"`
+	UserAgent   string `json:"user_agent"`
 }
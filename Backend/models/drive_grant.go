@@ -0,0 +1,20 @@
+package models
+
+// DriveGrant records a Drive permission the app created for a user so it
+// can be revoked when the user is deleted or mapped somewhere else
+type DriveGrant struct {
+	ID           uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       uint   `gorm:"index" json:"user_id"`
+	Email        string `json:"email"`
+	FolderID     string `gorm:"size:255;index" json:"folder_id"`
+	PermissionID string `json:"permission_id"`
+	Role         string `json:"role"`
+	MappingType  string `json:"mapping_type"` // domain, default or override
+	MappingID    uint   `json:"mapping_id"`
+	CreatedAt    int64  `json:"created_at"`
+	RevokedAt    int64  `json:"revoked_at"`
+	// RevokeRequestedAt is set when the grant should go; until RevokedAt is
+	// set too the revocation is retried in the background
+	RevokeRequestedAt int64  `gorm:"index" json:"revoke_requested_at"`
+	RevokeError       string `json:"revoke_error"` // last failed attempt
+}
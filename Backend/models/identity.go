@@ -0,0 +1,13 @@
+package models
+
+// UserIdentity links a user to an account at an external identity provider,
+// so later sign-ins find the user even if the email address changes there
+type UserIdentity struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint   `gorm:"index" json:"user_id"`
+	Provider    string `gorm:"size:64;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject     string `gorm:"size:255;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email       string `json:"email"`
+	CreatedAt   int64  `json:"created_at"`
+	LastLoginAt int64  `json:"last_login_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// Invitation lets a provisioned user set a password and activate their
+// account. Only a hash of the token is stored; the token itself is part of
+// the link handed to the user.
+type Invitation struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     uint   `gorm:"index" json:"user_id"`
+	Email      string `gorm:"size:255;index" json:"email"`
+	Role       string `json:"role"`
+	Department string `json:"department"`
+	TokenHash  string `gorm:"size:64;uniqueIndex" json:"-"`
+	ExpiresAt  int64  `json:"expires_at"`
+	CreatedAt  int64  `json:"created_at"`
+	CreatedBy  uint   `json:"created_by"`
+	AcceptedAt int64  `json:"accepted_at"`
+	RevokedAt  int64  `json:"revoked_at"`
+}
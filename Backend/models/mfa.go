@@ -0,0 +1,24 @@
+package models
+
+// MFARecoveryCode is a one-time code that stands in for the authenticator
+// app. Only a hash is stored.
+type MFARecoveryCode struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	CodeHash  []byte `json:"-"`
+	CreatedAt int64  `json:"created_at"`
+	UsedAt    int64  `json:"used_at"`
+}
+
+// MFAChallenge is the second step of a login for a user with two-factor
+// authentication. Its token is handed out after the password check and
+// exchanged, with a code, for a session.
+type MFAChallenge struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	TokenHash string `gorm:"size:64;uniqueIndex" json:"-"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	Attempts  int    `json:"attempts"`
+	UsedAt    int64  `json:"used_at"`
+}
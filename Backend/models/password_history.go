@@ -0,0 +1,10 @@
+package models
+
+// PasswordHistory keeps the hash of a password a user had before, so it
+// cannot be chosen again
+type PasswordHistory struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	Hash      []byte `json:"-"`
+	CreatedAt int64  `json:"created_at"`
+}
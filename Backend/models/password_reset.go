@@ -0,0 +1,13 @@
+package models
+
+// PasswordReset is a one-time link emailed to a user who forgot their
+// password. Only a hash of the token is stored.
+type PasswordReset struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	TokenHash string `gorm:"size:64;uniqueIndex" json:"-"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	UsedAt    int64  `json:"used_at"`
+	IPAddress string `gorm:"size:64" json:"ip_address"` // where the reset was requested
+}
@@ -0,0 +1,22 @@
+package models
+
+// Values for RegistrationDomainRule.Action
+const (
+	RegistrationAllow = "allow"
+	RegistrationBlock = "block"
+)
+
+// RegistrationDomainRule allows or blocks self-service signup for an email
+// domain and its subdomains. Allow rules can place new users in a
+// department and role.
+type RegistrationDomainRule struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Domain      string `gorm:"size:255;uniqueIndex" json:"domain"`
+	Action      string `gorm:"size:16" json:"action"`
+	Department  string `json:"department"`
+	Role        string `json:"role"`
+	Description string `json:"description"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+	CreatedBy   uint   `json:"created_by"`
+}
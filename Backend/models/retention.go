@@ -0,0 +1,26 @@
+package models
+
+// AccessLogRollup holds daily lookup counts for access logs that were
+// removed by the retention job. It keeps no user, IP or user agent data.
+type AccessLogRollup struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Day         int64  `gorm:"uniqueIndex:idx_access_log_rollup" json:"day"` // unix time of 00:00 UTC
+	Domain      string `gorm:"size:255;uniqueIndex:idx_access_log_rollup" json:"domain"`
+	MappingType string `gorm:"size:16;uniqueIndex:idx_access_log_rollup" json:"mapping_type"`
+	MappingID   uint   `gorm:"uniqueIndex:idx_access_log_rollup" json:"mapping_id"`
+	IsDefault   bool   `json:"is_default"`
+	Lookups     int64  `json:"lookups"`
+	Users       int64  `json:"users"` // distinct users on that day
+}
+
+// RetentionRun records one pass of the access log retention job
+type RetentionRun struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	StartedAt  int64  `gorm:"index" json:"started_at"`
+	FinishedAt int64  `json:"finished_at"`
+	Mode       string `gorm:"size:16" json:"mode"`
+	Cutoff     int64  `json:"cutoff"` // logs older than this were expired
+	Deleted    int64  `json:"deleted"`
+	RolledUp   int64  `json:"rolled_up"` // rollup rows created or updated
+	Error      string `json:"error"`
+}
@@ -0,0 +1,32 @@
+package models
+
+// SAMLConnection sends the users of an email domain, and its subdomains, to
+// their organization's SAML identity provider to sign in
+type SAMLConnection struct {
+	ID     uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Domain string `gorm:"size:255;uniqueIndex" json:"domain"`
+	// MetadataXML is the identity provider's metadata as uploaded; EntityID
+	// and SSOURL are read from it
+	MetadataXML string `gorm:"type:mediumtext" json:"-"`
+	EntityID    string `json:"entity_id"`
+	SSOURL      string `json:"sso_url"`
+
+	// Attributes of the assertion holding the user's details, by name or
+	// friendly name. The email address is the NameID unless EmailAttribute
+	// is set.
+	EmailAttribute      string `json:"email_attribute"`
+	NameAttribute       string `json:"name_attribute"`
+	DepartmentAttribute string `json:"department_attribute"`
+	// RoleAttribute makes users admins when one of its values is AdminValue,
+	// and plain users otherwise
+	RoleAttribute string `json:"role_attribute"`
+	AdminValue    string `json:"admin_value"`
+
+	// CreateUsers creates an account for a new person on their first sign-in
+	CreateUsers bool   `json:"create_users"`
+	IsActive    bool   `json:"is_active"`
+	Description string `json:"description"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+	CreatedBy   uint   `json:"created_by"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// SCIMToken lets an identity provider provision users through the SCIM API.
+// Only a hash of the bearer token is kept.
+type SCIMToken struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name       string `json:"name"`
+	TokenHash  string `gorm:"size:64;uniqueIndex" json:"-"`
+	CreatedAt  int64  `json:"created_at"`
+	CreatedBy  uint   `json:"created_by"`
+	LastUsedAt int64  `json:"last_used_at"`
+	RevokedAt  int64  `json:"revoked_at"`
+}
+
+// SCIMGroup is a group pushed by an identity provider. Its members are not
+// stored: they are the users with its role, for the admin group, or with
+// its department otherwise.
+type SCIMGroup struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	DisplayName string `gorm:"size:255;uniqueIndex" json:"display_name"`
+	ExternalID  string `json:"external_id"`
+	Role        string `json:"role"`
+	Department  string `json:"department"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+}
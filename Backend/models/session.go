@@ -0,0 +1,14 @@
+package models
+
+// Session is one login. Its TokenID is the jti claim of the JWT handed out,
+// so revoking the row invalidates the token before it expires.
+type Session struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint   `gorm:"index" json:"user_id"`
+	TokenID   string `gorm:"size:64;uniqueIndex" json:"-"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	IPAddress string `gorm:"size:64" json:"ip_address"`
+	UserAgent string `json:"user_agent"`
+	RevokedAt int64  `json:"revoked_at"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// ThrottleEntry is a value of the shared throttle store, used when several
+// server instances must agree on rate limits and lockouts
+type ThrottleEntry struct {
+	Key       string `gorm:"primaryKey;size:255"`
+	Value     []byte
+	ExpiresAt int64 `gorm:"index"` // 0 never expires
+}
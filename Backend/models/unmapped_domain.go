@@ -0,0 +1,33 @@
+package models
+
+// Values for UnmappedDomain.Status
+const (
+	UnmappedOpen      = "open"
+	UnmappedDismissed = "dismissed"
+	UnmappedMapped    = "mapped"
+)
+
+// UnmappedDomain is an email domain whose users fell back to the default
+// mapping. Open entries form the admin's to-do list of mappings to create.
+type UnmappedDomain struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Domain      string `gorm:"size:255;uniqueIndex" json:"domain"`
+	Lookups     int64  `json:"lookups"`
+	UserCount   int64  `json:"user_count"`
+	FirstSeenAt int64  `json:"first_seen_at"`
+	LastSeenAt  int64  `json:"last_seen_at"`
+	Status      string `gorm:"size:16;index;default:'open'" json:"status"`
+	NotifiedAt  int64  `json:"notified_at"`
+	MappingID   uint   `json:"mapping_id,omitempty"` // mapping created from this entry
+	ResolvedBy  uint   `json:"resolved_by,omitempty"`
+	ResolvedAt  int64  `json:"resolved_at,omitempty"`
+}
+
+// UnmappedDomainUser is a user affected by an unmapped domain
+type UnmappedDomainUser struct {
+	ID               uint  `gorm:"primaryKey;autoIncrement" json:"id"`
+	UnmappedDomainID uint  `gorm:"uniqueIndex:idx_unmapped_domain_user" json:"unmapped_domain_id"`
+	UserID           uint  `gorm:"uniqueIndex:idx_unmapped_domain_user" json:"user_id"`
+	FirstSeenAt      int64 `json:"first_seen_at"`
+	LastSeenAt       int64 `json:"last_seen_at"`
+}
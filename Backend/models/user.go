@@ -9,4 +9,25 @@ type User struct {
 	Department string `json:"department"`
 	CreatedAt  int64  `json:"created_at"`
 	LastLogin  int64  `json:"last_login"`
+	IsActive   bool   `gorm:"default:true" json:"is_active"`
+
+	// EmailVerifiedAt is when the user proved they own Email, 0 until then
+	EmailVerifiedAt int64 `json:"email_verified_at"`
+	// VerificationSentAt throttles resending the verification email
+	VerificationSentAt int64 `json:"-"`
+
+	// Two-factor authentication. The TOTP secrets are encrypted; the pending
+	// one is waiting for the first code during enrollment.
+	MFAEnabled       bool   `json:"mfa_enabled"`
+	MFAEnabledAt     int64  `json:"mfa_enabled_at"`
+	MFASecret        string `json:"-"`
+	MFAPendingSecret string `json:"-"`
+	MFALastStep      int64  `json:"-"` // time step of the last accepted code, against replays
+
+	// MustChangePassword is set for accounts given a temporary password
+	MustChangePassword bool `json:"must_change_password"`
+
+	// Set while a self-service account deletion is waiting out its grace period
+	DeletionRequestedAt  int64 `json:"deletion_requested_at"`
+	DeletionScheduledFor int64 `gorm:"index" json:"deletion_scheduled_for"`
 }
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"JWT-Authentication-go/config"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Send logs an event for admins and posts it to the configured webhook.
+// Delivery happens in the background and never blocks the caller.
+func Send(event string, payload map[string]interface{}) {
+	fmt.Printf("Notification %s: %v\n", event, payload)
+
+	if config.NotifyWebhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"event":     event,
+		"timestamp": time.Now().Unix(),
+		"data":      payload,
+	})
+	if err != nil {
+		fmt.Println("Error encoding notification:", err)
+		return
+	}
+
+	go func() {
+		response, err := client.Post(config.NotifyWebhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Println("Error delivering notification:", err)
+			return
+		}
+		response.Body.Close()
+
+		if response.StatusCode >= 300 {
+			fmt.Printf("Notification webhook returned %s\n", response.Status)
+		}
+	}()
+}
@@ -0,0 +1,104 @@
+package passwords
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+	// argon2MaxBytes bounds passwords so hashing stays cheap to ask for
+	argon2MaxBytes = 1024
+)
+
+// Argon2id hashes passwords with argon2id. Hashes are stored in the PHC
+// string format, $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<key>.
+type Argon2id struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Hash returns the argon2id hash of a password with a random salt
+func (a Argon2id) Hash(password string) ([]byte, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, argon2KeyLength)
+
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+// Current reports whether hash is an argon2id hash with the same parameters
+func (a Argon2id) Current(hash []byte) bool {
+	params, _, key, err := parseArgon2id(hash)
+	return err == nil && params == a && len(key) == argon2KeyLength
+}
+
+// MaxBytes allows long passphrases; argon2id hashes all of them
+func (a Argon2id) MaxBytes() int {
+	return argon2MaxBytes
+}
+
+func (a Argon2id) validate() error {
+	if a.Memory < 8*uint32(a.Parallelism) || a.Iterations < 1 || a.Parallelism < 1 {
+		return errors.New("argon2id needs at least 1 iteration, 1 thread and 8 KiB of memory per thread")
+	}
+	return nil
+}
+
+// isArgon2id reports whether a hash is in argon2id's PHC format
+func isArgon2id(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$argon2id$"))
+}
+
+func verifyArgon2id(hash []byte, password string) bool {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1
+}
+
+// parseArgon2id splits a PHC string into its parameters, salt and key
+func parseArgon2id(hash []byte) (Argon2id, []byte, []byte, error) {
+	var params Argon2id
+	var version int
+
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 6 || string(parts[1]) != "argon2id" {
+		return params, nil, nil, errors.New("not an argon2id hash")
+	}
+	if _, err := fmt.Sscanf(string(parts[2]), "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+	// argon2 panics on zero threads
+	if err := params.validate(); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(string(parts[5]))
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,50 @@
+package passwords
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with bcrypt
+type Bcrypt struct {
+	Cost int
+}
+
+// Hash returns the bcrypt hash of a password
+func (b Bcrypt) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+}
+
+// Current reports whether hash is a bcrypt hash of the same cost
+func (b Bcrypt) Current(hash []byte) bool {
+	if !isBcrypt(hash) {
+		return false
+	}
+	cost, err := bcrypt.Cost(hash)
+	return err == nil && cost == b.Cost
+}
+
+// MaxBytes is 72, the most bcrypt can hash
+func (b Bcrypt) MaxBytes() int {
+	return 72
+}
+
+func (b Bcrypt) validate() error {
+	if b.Cost < bcrypt.MinCost || b.Cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return nil
+}
+
+// isBcrypt reports whether a hash is in bcrypt's format
+func isBcrypt(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) ||
+		bytes.HasPrefix(hash, []byte("$2b$")) ||
+		bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+func verifyBcrypt(hash []byte, password string) bool {
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
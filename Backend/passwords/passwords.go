@@ -0,0 +1,87 @@
+package passwords
+
+import (
+	"JWT-Authentication-go/config"
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hasher turns passwords into hashes with one algorithm and cost
+type Hasher interface {
+	// Hash returns the encoded hash of a password
+	Hash(password string) ([]byte, error)
+	// Current reports whether a stored hash was made with this algorithm and cost
+	Current(hash []byte) bool
+	// MaxBytes is the longest password this algorithm hashes in full
+	MaxBytes() int
+}
+
+// Default hashes every new password. It uses bcrypt's default cost until
+// main replaces it with the configured one.
+var Default Hasher = Bcrypt{Cost: bcrypt.DefaultCost}
+
+// FromConfig builds the hasher selected by PASSWORD_HASH_ALGORITHM: bcrypt
+// or argon2id
+func FromConfig() (Hasher, error) {
+	switch strings.ToLower(config.PasswordHashAlgorithm) {
+	case "", "bcrypt":
+		hasher := Bcrypt{Cost: config.BcryptCost}
+		return hasher, hasher.validate()
+	case "argon2id":
+		if config.Argon2MemoryKB < 1 || int64(config.Argon2MemoryKB) > math.MaxUint32 {
+			return nil, fmt.Errorf("ARGON2_MEMORY_KB must be between 1 and %d", uint32(math.MaxUint32))
+		}
+		if config.Argon2Iterations < 1 || int64(config.Argon2Iterations) > math.MaxUint32 {
+			return nil, fmt.Errorf("ARGON2_ITERATIONS must be between 1 and %d", uint32(math.MaxUint32))
+		}
+		if config.Argon2Parallelism < 1 || config.Argon2Parallelism > math.MaxUint8 {
+			return nil, fmt.Errorf("ARGON2_PARALLELISM must be between 1 and %d", math.MaxUint8)
+		}
+		hasher := Argon2id{
+			Memory:      uint32(config.Argon2MemoryKB),
+			Iterations:  uint32(config.Argon2Iterations),
+			Parallelism: uint8(config.Argon2Parallelism),
+		}
+		return hasher, hasher.validate()
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q, use bcrypt or argon2id", config.PasswordHashAlgorithm)
+	}
+}
+
+// Hash hashes a new password with the default hasher
+func Hash(password string) ([]byte, error) {
+	return Default.Hash(password)
+}
+
+// MaxBytes is the longest password the default hasher accepts
+func MaxBytes() int {
+	return Default.MaxBytes()
+}
+
+// Verify reports whether password matches a stored hash of any supported
+// algorithm
+func Verify(hash []byte, password string) bool {
+	switch {
+	case isArgon2id(hash):
+		return verifyArgon2id(hash, password)
+	case isBcrypt(hash):
+		return verifyBcrypt(hash, password)
+	default:
+		return false
+	}
+}
+
+// Usable reports whether a stored hash can match a password. Accounts that
+// sign in through an identity provider or wait for an invitation have none.
+func Usable(hash []byte) bool {
+	return isArgon2id(hash) || isBcrypt(hash)
+}
+
+// NeedsRehash reports whether a stored hash should be replaced because the
+// algorithm or cost has changed since it was made
+func NeedsRehash(hash []byte) bool {
+	return len(hash) > 0 && !Default.Current(hash)
+}
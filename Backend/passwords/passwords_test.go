@@ -0,0 +1,163 @@
+package passwords
+
+import (
+	"JWT-Authentication-go/config"
+	"strings"
+	"testing"
+)
+
+// withDefault sets the default hasher for one test
+func withDefault(t *testing.T, hasher Hasher) {
+	t.Helper()
+
+	previous := Default
+	Default = hasher
+	t.Cleanup(func() { Default = previous })
+}
+
+// withArgon2Config sets the hashing settings for one test
+func withArgon2Config(t *testing.T, memory, iterations, parallelism int) {
+	t.Helper()
+
+	algorithm, previousMemory, previousIterations, previousParallelism :=
+		config.PasswordHashAlgorithm, config.Argon2MemoryKB, config.Argon2Iterations, config.Argon2Parallelism
+	t.Cleanup(func() {
+		config.PasswordHashAlgorithm, config.Argon2MemoryKB, config.Argon2Iterations, config.Argon2Parallelism =
+			algorithm, previousMemory, previousIterations, previousParallelism
+	})
+	config.PasswordHashAlgorithm = "argon2id"
+	config.Argon2MemoryKB, config.Argon2Iterations, config.Argon2Parallelism = memory, iterations, parallelism
+}
+
+func TestFromConfig(t *testing.T) {
+	tests := []struct {
+		memory, iterations, parallelism int
+		ok                              bool
+	}{
+		{64, 1, 1, true},
+		{1024, 2, 255, false}, // less than 8 KiB per thread
+		{4096, 3, 255, true},
+		{4096, 1, 256, false}, // would wrap to 0
+		{4096, 1, 257, false}, // would wrap to 1
+		{4096, 1, 0, false},
+		{4096, 1, -1, false},
+		{4096, 0, 1, false},
+		{4096, -1, 1, false},
+		{0, 1, 1, false},
+		{-64, 1, 1, false},
+		{1 << 33, 1, 1, false},
+		{64, 1 << 33, 1, false},
+	}
+	for _, test := range tests {
+		withArgon2Config(t, test.memory, test.iterations, test.parallelism)
+		hasher, err := FromConfig()
+		if (err == nil) != test.ok {
+			t.Errorf("m=%d t=%d p=%d: err = %v, want ok %v", test.memory, test.iterations, test.parallelism, err, test.ok)
+			continue
+		}
+		want := Argon2id{Memory: uint32(test.memory), Iterations: uint32(test.iterations), Parallelism: uint8(test.parallelism)}
+		if test.ok && hasher != want {
+			t.Errorf("m=%d t=%d p=%d: hasher = %+v", test.memory, test.iterations, test.parallelism, hasher)
+		}
+	}
+
+	config.PasswordHashAlgorithm = "scrypt"
+	if _, err := FromConfig(); err == nil {
+		t.Error("accepted an unknown algorithm")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	bcryptHash, err := Bcrypt{Cost: 4}.Hash("Chosen-Passphrase-7390")
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon2Hash, err := Argon2id{Memory: 64, Iterations: 1, Parallelism: 2}.Hash("Chosen-Passphrase-7390")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(argon2Hash), "Chosen") || !strings.HasPrefix(string(argon2Hash), "$argon2id$v=19$m=64,t=1,p=2$") {
+		t.Errorf("argon2id hash = %s", argon2Hash)
+	}
+
+	// Both algorithms verify whichever is the default
+	for _, hasher := range []Hasher{Bcrypt{Cost: 4}, Argon2id{Memory: 32, Iterations: 1, Parallelism: 1}} {
+		withDefault(t, hasher)
+		for _, hash := range [][]byte{bcryptHash, argon2Hash} {
+			if !Verify(hash, "Chosen-Passphrase-7390") {
+				t.Errorf("default %T: the right password did not match %s", hasher, hash)
+			}
+			for _, wrong := range []string{"", "chosen-passphrase-7390", "Chosen-Passphrase-739", "Chosen-Passphrase-73900"} {
+				if Verify(hash, wrong) {
+					t.Errorf("default %T: %q matched %s", hasher, wrong, hash)
+				}
+			}
+		}
+	}
+
+	if !Usable(bcryptHash) || !Usable(argon2Hash) || Usable(nil) || Usable([]byte("unusable")) {
+		t.Error("Usable does not tell hashes from missing passwords")
+	}
+
+	// Anything else never matches, and never panics
+	fields := strings.Split(string(argon2Hash), "$")
+	for _, hash := range []string{
+		"",
+		"Chosen-Passphrase-7390",
+		"$argon2i$v=19$m=64,t=1,p=2$" + fields[4] + "$" + fields[5],
+		"$argon2id$v=16$m=64,t=1,p=2$" + fields[4] + "$" + fields[5],
+		"$argon2id$v=19$m=64,t=1,p=0$" + fields[4] + "$" + fields[5],
+		"$argon2id$v=19$m=64,t=0,p=2$" + fields[4] + "$" + fields[5],
+		"$argon2id$v=19$m=64,t=1,p=300$" + fields[4] + "$" + fields[5],
+		"$argon2id$v=19$m=64,t=1,p=2$" + fields[4] + "$",
+		"$argon2id$v=19$m=64,t=1,p=2$!!$" + fields[5],
+		"$argon2id$v=19$m=64,t=1,p=2$" + fields[4],
+		string(bcryptHash[:len(bcryptHash)-1]),
+	} {
+		if Verify([]byte(hash), "Chosen-Passphrase-7390") {
+			t.Errorf("%q matched", hash)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hashWith := func(hasher Hasher) []byte {
+		hash, err := hasher.Hash("Chosen-Passphrase-7390")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	bcrypt4 := hashWith(Bcrypt{Cost: 4})
+	argon2 := hashWith(Argon2id{Memory: 64, Iterations: 1, Parallelism: 1})
+
+	tests := []struct {
+		name    string
+		current Hasher
+		hash    []byte
+		want    bool
+	}{
+		{"same bcrypt cost", Bcrypt{Cost: 4}, bcrypt4, false},
+		{"bcrypt cost raised", Bcrypt{Cost: 5}, bcrypt4, true},
+		{"bcrypt to argon2id", Argon2id{Memory: 64, Iterations: 1, Parallelism: 1}, bcrypt4, true},
+		{"same argon2id parameters", Argon2id{Memory: 64, Iterations: 1, Parallelism: 1}, argon2, false},
+		{"argon2id memory raised", Argon2id{Memory: 128, Iterations: 1, Parallelism: 1}, argon2, true},
+		{"argon2id iterations raised", Argon2id{Memory: 64, Iterations: 2, Parallelism: 1}, argon2, true},
+		{"argon2id threads raised", Argon2id{Memory: 64, Iterations: 1, Parallelism: 2}, argon2, true},
+		{"argon2id to bcrypt", Bcrypt{Cost: 4}, argon2, true},
+		{"no password", Bcrypt{Cost: 4}, nil, false},
+	}
+	for _, test := range tests {
+		withDefault(t, test.current)
+		if got := NeedsRehash(test.hash); got != test.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// After rehashing with the new settings, the password still matches
+	withDefault(t, Bcrypt{Cost: 5})
+	rehashed, _ := Hash("Chosen-Passphrase-7390")
+	if NeedsRehash(rehashed) || !Verify(rehashed, "Chosen-Passphrase-7390") {
+		t.Error("the rehashed password is stale or does not match")
+	}
+}
@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"JWT-Authentication-go/config"
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// builtinBreached holds the SHA-1 hashes of common breached passwords and
+// their usual variants, uppercase and sorted, one per line
+//
+//go:embed breached_passwords.txt
+var builtinBreached string
+
+var (
+	builtinOnce   sync.Once
+	builtinHashes []string
+)
+
+// breachedPrefixLength is the length of the SHA-1 prefix that names each file
+// and that is sent to the range API
+const breachedPrefixLength = 5
+
+var rangeClient = &http.Client{Timeout: 5 * time.Second}
+
+// IsBreached reports whether a password is in the built-in breached list, in
+// BREACHED_PASSWORDS_DIR or known to BREACHED_PASSWORDS_API. Only the first
+// characters of the password's SHA-1 hash are used to pick a range, so the
+// range API never sees the password or its full hash.
+func IsBreached(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	if builtinContains(hash) {
+		return true
+	}
+	if config.BreachedPasswordsDir != "" && dirContains(os.DirFS(config.BreachedPasswordsDir), prefix, suffix) {
+		return true
+	}
+	if config.BreachedPasswordsAPI != "" {
+		breached, err := apiContains(config.BreachedPasswordsAPI, prefix, suffix)
+		if err != nil {
+			// The local lists still apply when the API cannot be reached
+			fmt.Println("Error checking breached passwords API:", err)
+		}
+		return breached
+	}
+	return false
+}
+
+// builtinContains looks for a full hash in the built-in list
+func builtinContains(hash string) bool {
+	builtinOnce.Do(func() {
+		builtinHashes = strings.Fields(builtinBreached)
+	})
+	i := sort.SearchStrings(builtinHashes, hash)
+	return i < len(builtinHashes) && builtinHashes[i] == hash
+}
+
+// dirContains looks for suffix in the file named after prefix
+func dirContains(fsys fs.FS, prefix, suffix string) bool {
+	file, err := fsys.Open(prefix + ".txt")
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return rangeContains(file, suffix)
+}
+
+// apiContains asks a Have I Been Pwned style range API for the suffixes that
+// share prefix, with padding so the response size gives nothing away
+func apiContains(baseURL, prefix, suffix string) (bool, error) {
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/"+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Add-Padding", "true")
+
+	response, err := rangeClient.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("range API answered %s", response.Status)
+	}
+	return rangeContains(response.Body, suffix), nil
+}
+
+// rangeContains looks for suffix in a range. Each line is a hash suffix,
+// optionally followed by a colon and a count; a count of zero marks padding.
+func rangeContains(r io.Reader, suffix string) bool {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		hashSuffix, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(hashSuffix, suffix) {
+			continue
+		}
+		return strings.TrimSpace(count) != "0"
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"JWT-Authentication-go/config"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// builtinDisposableDomains is the list shipped with the server
+//
+//go:embed disposable_domains.txt
+var builtinDisposableDomains string
+
+var (
+	disposableOnce    sync.Once
+	disposableDomains map[string]bool
+)
+
+// DisposableDomains returns the known disposable email domains: the built-in
+// list plus DISPOSABLE_DOMAINS_FILE. The file is read once.
+func DisposableDomains() map[string]bool {
+	disposableOnce.Do(func() {
+		disposableDomains = map[string]bool{}
+		addDomainList(disposableDomains, builtinDisposableDomains)
+
+		if config.DisposableDomainsFile == "" {
+			return
+		}
+		data, err := os.ReadFile(config.DisposableDomainsFile)
+		if err != nil {
+			fmt.Println("Failed to read disposable domains file:", err)
+			return
+		}
+		addDomainList(disposableDomains, string(data))
+	})
+	return disposableDomains
+}
+
+// IsDisposable reports whether a domain, or a domain it belongs to, is a
+// disposable email provider
+func IsDisposable(domain string) bool {
+	known := DisposableDomains()
+	for _, candidate := range DomainSuffixes(domain) {
+		if known[candidate] {
+			return true
+		}
+	}
+	return false
+}
+
+// addDomainList adds one domain per line, skipping blanks and # comments
+func addDomainList(domains map[string]bool, list string) {
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = true
+	}
+}
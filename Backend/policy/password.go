@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// PasswordError lists the reasons a password was refused
+type PasswordError struct {
+	Problems []string
+}
+
+func (e *PasswordError) Error() string {
+	return "Password " + strings.Join(e.Problems, ", ")
+}
+
+// PasswordRequirements describes the password policy for clients
+type PasswordRequirements struct {
+	MinLength       int  `json:"min_length"`
+	MaxLength       int  `json:"max_length"`
+	MinClasses      int  `json:"min_classes"`
+	History         int  `json:"history"`
+	BlockBreached   bool `json:"block_breached"`
+	NotEqualToEmail bool `json:"not_equal_to_email"`
+}
+
+// Requirements returns the password policy in force
+func Requirements() PasswordRequirements {
+	return PasswordRequirements{
+		MinLength:       config.PasswordMinLength,
+		MaxLength:       passwords.MaxBytes(),
+		MinClasses:      config.PasswordMinClasses,
+		History:         config.PasswordHistory,
+		BlockBreached:   config.BlockBreachedPasswords,
+		NotEqualToEmail: true,
+	}
+}
+
+// CheckPassword tells whether password may become the password of user.
+// A user without an ID is a new account, which has no history yet.
+func CheckPassword(db *gorm.DB, user models.User, password string) error {
+	problems := []string{}
+
+	if len([]rune(password)) < config.PasswordMinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", config.PasswordMinLength))
+	}
+	// New passwords must fit the algorithm they are hashed with
+	if max := passwords.MaxBytes(); len(password) > max {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", max))
+	}
+	if config.PasswordMinClasses > 0 && characterClasses(password) < config.PasswordMinClasses {
+		problems = append(problems, fmt.Sprintf(
+			"must mix at least %d of lowercase letters, uppercase letters, digits and symbols",
+			config.PasswordMinClasses))
+	}
+	if sameAsEmail(password, user.Email) {
+		problems = append(problems, "must not be your email address")
+	}
+	if len(problems) == 0 && user.ID != 0 && usedBefore(db, user, password) {
+		problems = append(problems, "was used recently, choose a new one")
+	}
+	if len(problems) == 0 && config.BlockBreachedPasswords && IsBreached(password) {
+		problems = append(problems, "appears in a known data breach, choose another one")
+	}
+
+	if len(problems) > 0 {
+		return &PasswordError{Problems: problems}
+	}
+	return nil
+}
+
+// RememberPassword keeps the hash of a password the user is leaving behind
+// and forgets those older than the history covers
+func RememberPassword(tx *gorm.DB, userID uint, hash []byte) error {
+	// The current password is one of the remembered ones
+	keep := config.PasswordHistory - 1
+	if keep <= 0 || len(hash) == 0 {
+		return tx.Where("user_id = ?", userID).Delete(&models.PasswordHistory{}).Error
+	}
+
+	entry := models.PasswordHistory{
+		UserID:    userID,
+		Hash:      hash,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	var kept []uint
+	if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("id DESC").Limit(keep).Pluck("id", &kept).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND id NOT IN ?", userID, kept).Delete(&models.PasswordHistory{}).Error
+}
+
+// usedBefore reports whether password is the current password of user or
+// one of the previous ones the history covers
+func usedBefore(db *gorm.DB, user models.User, password string) bool {
+	if config.PasswordHistory <= 0 {
+		return false
+	}
+	if len(user.Password) > 0 && passwords.Verify(user.Password, password) {
+		return true
+	}
+	if config.PasswordHistory == 1 {
+		return false
+	}
+
+	var previous []models.PasswordHistory
+	db.Where("user_id = ?", user.ID).Order("id DESC").Limit(config.PasswordHistory - 1).Find(&previous)
+	for _, entry := range previous {
+		if passwords.Verify(entry.Hash, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// characterClasses counts the kinds of characters a password mixes
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// sameAsEmail reports whether a password is the email address or its local part
+func sameAsEmail(password, email string) bool {
+	password = strings.ToLower(strings.TrimSpace(password))
+	email = strings.ToLower(strings.TrimSpace(email))
+	if password == "" || email == "" {
+		return false
+	}
+	local := email
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		local = email[:at]
+	}
+	return password == email || password == local
+}
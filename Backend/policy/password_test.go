@@ -0,0 +1,277 @@
+package policy
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// withPolicy sets the password policy for one test, with fast hashing and
+// the breach check off
+func withPolicy(t *testing.T, minLength, minClasses, history int) {
+	t.Helper()
+
+	hasher, minLength0, minClasses0, history0 := passwords.Default, config.PasswordMinLength, config.PasswordMinClasses, config.PasswordHistory
+	block, dir, api := config.BlockBreachedPasswords, config.BreachedPasswordsDir, config.BreachedPasswordsAPI
+	t.Cleanup(func() {
+		passwords.Default, config.PasswordMinLength, config.PasswordMinClasses, config.PasswordHistory = hasher, minLength0, minClasses0, history0
+		config.BlockBreachedPasswords, config.BreachedPasswordsDir, config.BreachedPasswordsAPI = block, dir, api
+	})
+	passwords.Default = passwords.Bcrypt{Cost: 4}
+	config.PasswordMinLength, config.PasswordMinClasses, config.PasswordHistory = minLength, minClasses, history
+	config.BlockBreachedPasswords, config.BreachedPasswordsDir, config.BreachedPasswordsAPI = false, "", ""
+}
+
+// problems returns the reasons CheckPassword gave, or nil
+func problems(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var passwordErr *PasswordError
+	if !errors.As(err, &passwordErr) {
+		t.Fatalf("err = %v, want a *PasswordError", err)
+	}
+	return passwordErr.Problems
+}
+
+func TestCheckPasswordLengthFollowsHasher(t *testing.T) {
+	previousHasher, previousBreached := passwords.Default, config.BlockBreachedPasswords
+	t.Cleanup(func() { passwords.Default, config.BlockBreachedPasswords = previousHasher, previousBreached })
+	config.BlockBreachedPasswords = false
+
+	user := models.User{Email: "ada@example.com"}
+	passphrase := strings.Repeat("Correct-Horse-7 ", 8) // 128 bytes
+
+	passwords.Default = passwords.Bcrypt{Cost: 4}
+	if err := CheckPassword(nil, user, passphrase); err == nil {
+		t.Error("bcrypt accepted a password longer than 72 bytes")
+	}
+	if got := Requirements().MaxLength; got != 72 {
+		t.Errorf("bcrypt max length = %d, want 72", got)
+	}
+
+	passwords.Default = passwords.Argon2id{Memory: 64, Iterations: 1, Parallelism: 1}
+	if err := CheckPassword(nil, user, passphrase); err != nil {
+		t.Errorf("argon2id refused a 128-byte passphrase: %v", err)
+	}
+	if err := CheckPassword(nil, user, strings.Repeat(passphrase, 9)); err == nil {
+		t.Error("argon2id accepted a password over its cap")
+	}
+	if got := Requirements().MaxLength; got != passwords.MaxBytes() || got <= 72 {
+		t.Errorf("argon2id max length = %d, want its own cap", got)
+	}
+}
+
+func TestCheckPasswordComplexity(t *testing.T) {
+	withPolicy(t, 10, 3, 0)
+	user := models.User{Email: "ada@example.com"}
+
+	tests := []struct {
+		password string
+		want     []string // parts of the expected problems, in order
+	}{
+		{"Short-7", []string{"at least 10 characters"}},
+		{"alllowercaseletters", []string{"at least 3 of"}},
+		{"lower-and-symbols", []string{"at least 3 of"}},
+		{"Lower-And-Upper", nil},
+		{"lowerdigits123", []string{"at least 3 of"}},
+		{"Lowerdigits123", nil},
+		{"ab1", []string{"at least 10 characters", "at least 3 of"}},
+		// Length counts characters, not bytes, and letters of any script count
+		{"Ünïcödé-ßtr", nil},
+		{"ÜNÏCÖDÉ", []string{"at least 10 characters", "at least 3 of"}},
+	}
+	for _, test := range tests {
+		got := problems(t, CheckPassword(nil, user, test.password))
+		if len(got) != len(test.want) {
+			t.Errorf("%q: problems = %q, want %q", test.password, got, test.want)
+			continue
+		}
+		for i := range got {
+			if !strings.Contains(got[i], test.want[i]) {
+				t.Errorf("%q: problem %q, want one about %q", test.password, got[i], test.want[i])
+			}
+		}
+	}
+
+	config.PasswordMinClasses = 0
+	if err := CheckPassword(nil, user, "alllowercaseletters"); err != nil {
+		t.Errorf("with PASSWORD_MIN_CLASSES=0: %v", err)
+	}
+}
+
+func TestCheckPasswordEmail(t *testing.T) {
+	withPolicy(t, 8, 0, 0)
+	user := models.User{Email: " Ada.Lovelace@Example.com "}
+
+	for _, password := range []string{"ada.lovelace@example.com", "ADA.LOVELACE@EXAMPLE.COM", "Ada.Lovelace", " ada.lovelace "} {
+		got := problems(t, CheckPassword(nil, user, password))
+		if len(got) != 1 || !strings.Contains(got[0], "email address") {
+			t.Errorf("%q: problems = %q, want the email address refused", password, got)
+		}
+	}
+	for _, password := range []string{"ada.lovelace-1815", "example.com", "lovelace@home"} {
+		if err := CheckPassword(nil, user, password); err != nil {
+			t.Errorf("%q: %v", password, err)
+		}
+	}
+	// Without an address there is nothing to compare with
+	if err := CheckPassword(nil, models.User{}, "ada.lovelace"); err != nil {
+		t.Errorf("no email: %v", err)
+	}
+}
+
+func TestCheckPasswordHistory(t *testing.T) {
+	withPolicy(t, 8, 0, 3)
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.User{Name: "Ada", Email: "ada@example.com"}
+	db.Create(&user)
+	// Change the password four times, as the controllers do
+	for _, password := range []string{"first-secret", "second-secret", "third-secret", "fourth-secret"} {
+		if err := RememberPassword(db, user.ID, user.Password); err != nil {
+			t.Fatal(err)
+		}
+		user.Password, _ = passwords.Hash(password)
+		db.Save(&user)
+	}
+
+	var kept int64
+	db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&kept)
+	if kept != 2 {
+		t.Errorf("%d previous passwords kept, want 2", kept)
+	}
+
+	tests := []struct {
+		password string
+		reused   bool
+	}{
+		{"fourth-secret", true},
+		{"third-secret", true},
+		{"second-secret", true},
+		{"first-secret", false},
+		{"fifth-secret", false},
+	}
+	for _, test := range tests {
+		got := problems(t, CheckPassword(db, user, test.password))
+		if reused := len(got) == 1 && strings.Contains(got[0], "used recently"); reused != test.reused || (!test.reused && got != nil) {
+			t.Errorf("%q: problems = %q, want reused %v", test.password, got, test.reused)
+		}
+	}
+
+	// A new account has no history, and the check can be turned off
+	if err := CheckPassword(db, models.User{Email: "new@example.com", Password: user.Password}, "fourth-secret"); err != nil {
+		t.Errorf("new account: %v", err)
+	}
+	config.PasswordHistory = 0
+	if err := CheckPassword(db, user, "fourth-secret"); err != nil {
+		t.Errorf("with PASSWORD_HISTORY=0: %v", err)
+	}
+	config.PasswordHistory = 1
+	if err := CheckPassword(db, user, "third-secret"); err != nil {
+		t.Errorf("with PASSWORD_HISTORY=1, an older password: %v", err)
+	}
+	if err := CheckPassword(db, user, "fourth-secret"); err == nil {
+		t.Error("with PASSWORD_HISTORY=1, the current password was accepted")
+	}
+}
+
+func TestCheckPasswordBreached(t *testing.T) {
+	withPolicy(t, 8, 2, 0)
+	user := models.User{Email: "ada@example.com"}
+
+	// Known breached passwords that pass every other rule
+	known := []string{"password1", "Password123", "qwerty123!", "iloveyou1", "P@ssw0rd", "Summer2024!", "123456789a", "Liverpool1"}
+	for _, password := range known {
+		if err := CheckPassword(nil, user, password); err != nil {
+			t.Fatalf("%q is refused with the breach check off: %v", password, err)
+		}
+	}
+	config.BlockBreachedPasswords = true
+	for _, password := range known {
+		got := problems(t, CheckPassword(nil, user, password))
+		if len(got) != 1 || !strings.Contains(got[0], "data breach") {
+			t.Errorf("%q: problems = %q, want it refused as breached", password, got)
+		}
+	}
+	if err := CheckPassword(nil, user, "Quiet-Lantern-4821"); err != nil {
+		t.Errorf("an unbreached password was refused: %v", err)
+	}
+
+	// Ranges downloaded to BREACHED_PASSWORDS_DIR; the SHA-1 of the password
+	// is 5A55E1D3706ADC63B743D4A65100A56D39222E5D
+	dir := t.TempDir()
+	writeRange := func(lines string) {
+		if err := os.WriteFile(filepath.Join(dir, "5A55E.txt"), []byte(lines), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config.BreachedPasswordsDir = dir
+	writeRange("0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n1D3706ADC63B743D4A65100A56D39222E5D:0\r\n")
+	if IsBreached("Quiet-Lantern-4821") {
+		t.Error("a padding entry counted as a breach")
+	}
+	writeRange("0018A45C4D1DEF81644B54AB7F969B88D65:2\r\n1d3706adc63b743d4a65100a56d39222e5d:3\r\n")
+	if !IsBreached("Quiet-Lantern-4821") {
+		t.Error("a password listed in BREACHED_PASSWORDS_DIR was accepted")
+	}
+}
+
+func TestIsBreachedAsksRangeAPI(t *testing.T) {
+	withPolicy(t, 8, 0, 0)
+
+	var requests []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+" padding="+r.Header.Get("Add-Padding"))
+		if r.URL.Path != "/range/5A55E" {
+			fmt.Fprint(w, "0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n")
+			return
+		}
+		fmt.Fprint(w, "0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n1D3706ADC63B743D4A65100A56D39222E5D:12\r\n")
+	}))
+	defer api.Close()
+	config.BreachedPasswordsAPI = api.URL + "/range/"
+
+	if !IsBreached("Quiet-Lantern-4821") {
+		t.Error("a password known to the range API was accepted")
+	}
+	if IsBreached("Another-Lantern-4821") {
+		t.Error("a password unknown to the range API was refused")
+	}
+	// Only the prefix leaves the server, and padding is asked for
+	if len(requests) != 2 || requests[0] != "/range/5A55E padding=true" {
+		t.Errorf("requests = %q", requests)
+	}
+
+	// The built-in list still applies when the API is down
+	api.Close()
+	if IsBreached("Quiet-Lantern-4821") {
+		t.Error("an unreachable API refused the password")
+	}
+	if !IsBreached("password1") {
+		t.Error("the built-in list was skipped when the API failed")
+	}
+}
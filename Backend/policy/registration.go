@@ -0,0 +1,200 @@
+package policy
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Registration modes accepted by REGISTRATION_MODE
+const (
+	RegistrationOpen          = "open"           // anyone can register
+	RegistrationInviteOnly    = "invite_only"    // accounts come from invitations only
+	RegistrationMappedDomains = "mapped_domains" // only emails on a domain with an active mapping
+)
+
+// Registration errors
+var (
+	ErrInviteOnly       = errors.New("registration is by invitation only")
+	ErrInvalidEmail     = errors.New("invalid email address")
+	ErrDomainNotAllowed = errors.New("registration is not open to this email domain")
+	ErrDomainBlocked    = errors.New("registration from this email domain is blocked")
+	ErrDisposableEmail  = errors.New("disposable email addresses cannot be used to register")
+)
+
+// Signup is what the registration policy decided for an email address
+type Signup struct {
+	Domain     string                         `json:"domain"`
+	Rule       *models.RegistrationDomainRule `json:"rule,omitempty"` // most specific matching rule
+	Department string                         `json:"department,omitempty"`
+	Role       string                         `json:"role,omitempty"`
+}
+
+// RegistrationMode returns the configured mode, open when it is not recognised
+func RegistrationMode() string {
+	switch mode := strings.ToLower(config.RegistrationMode); mode {
+	case RegistrationInviteOnly, RegistrationMappedDomains:
+		return mode
+	default:
+		return RegistrationOpen
+	}
+}
+
+// CheckRegistration reports whether a self-service signup with this email is
+// allowed and which department and role the new account gets.
+//
+// A block rule for the domain always refuses it and an allow rule always
+// accepts it, even for a disposable provider. Otherwise disposable providers
+// are refused, and once any allow rule exists, or in mapped_domains mode,
+// only allowed domains (and those with an active mapping) may register.
+func CheckRegistration(db *gorm.DB, email string) (Signup, error) {
+	var signup Signup
+
+	mode := RegistrationMode()
+	if mode == RegistrationInviteOnly {
+		return signup, ErrInviteOnly
+	}
+
+	signup.Domain = EmailDomain(email)
+	if !strings.Contains(signup.Domain, ".") {
+		return signup, ErrInvalidEmail
+	}
+
+	rule, err := MatchDomainRule(db, signup.Domain)
+	if err != nil {
+		return signup, err
+	}
+	if rule != nil {
+		signup.Rule = rule
+		if rule.Action == models.RegistrationBlock {
+			return signup, ErrDomainBlocked
+		}
+		signup.Department, signup.Role = rule.Department, SignupRole(rule)
+		return signup, nil
+	}
+
+	if config.BlockDisposableEmails && IsDisposable(signup.Domain) {
+		return signup, ErrDisposableEmail
+	}
+
+	if mode == RegistrationMappedDomains {
+		var mapped int64
+		db.Model(&models.DomainMapping{}).
+			Where("domain = ? AND is_active = ?", signup.Domain, true).
+			Count(&mapped)
+		if mapped == 0 {
+			return signup, ErrDomainNotAllowed
+		}
+		return signup, nil
+	}
+
+	var allowRules int64
+	db.Model(&models.RegistrationDomainRule{}).
+		Where("action = ?", models.RegistrationAllow).
+		Count(&allowRules)
+	if allowRules > 0 {
+		return signup, ErrDomainNotAllowed
+	}
+	return signup, nil
+}
+
+// MatchDomainRule returns the rule for the domain, or for the closest parent
+// domain that has one. It returns nil when no rule applies.
+func MatchDomainRule(db *gorm.DB, domain string) (*models.RegistrationDomainRule, error) {
+	candidates := DomainSuffixes(domain)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var rules []models.RegistrationDomainRule
+	if err := db.Where("domain IN ?", candidates).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	var best *models.RegistrationDomainRule
+	for i := range rules {
+		if best == nil || len(rules[i].Domain) > len(best.Domain) {
+			best = &rules[i]
+		}
+	}
+	return best, nil
+}
+
+// NormalizeDomainRule cleans up and validates a rule before it is saved
+func NormalizeDomainRule(rule models.RegistrationDomainRule) (models.RegistrationDomainRule, error) {
+	domain, err := NormalizeDomain(rule.Domain)
+	if err != nil {
+		return rule, err
+	}
+	rule.Domain = domain
+
+	rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+	rule.Department = strings.TrimSpace(rule.Department)
+	rule.Role = strings.ToLower(strings.TrimSpace(rule.Role))
+	rule.Description = strings.TrimSpace(rule.Description)
+
+	switch rule.Action {
+	case models.RegistrationAllow:
+	case models.RegistrationBlock:
+		if rule.Department != "" || rule.Role != "" {
+			return rule, errors.New("block rules cannot assign a department or role")
+		}
+	default:
+		return rule, errors.New("action must be allow or block")
+	}
+
+	// Anyone can sign up with an address on an allowed domain, before
+	// proving they own it, so rules never make admins
+	switch rule.Role {
+	case "", "user":
+	case "admin":
+		return rule, errors.New("registration rules cannot grant the admin role; promote users once they are known")
+	default:
+		return rule, errors.New("role must be user")
+	}
+	return rule, nil
+}
+
+// SignupRole returns the role a rule gives new users. Rules saved before
+// admin roles were refused give none.
+func SignupRole(rule *models.RegistrationDomainRule) string {
+	if rule == nil || rule.Role == "admin" {
+		return ""
+	}
+	return rule.Role
+}
+
+// NormalizeDomain cleans up a domain typed by an admin, accepting forms such
+// as @example.com and *.example.com
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "@")
+	domain = strings.TrimPrefix(domain, "*.")
+	if !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@/ ") {
+		return domain, errors.New("a valid domain is required, e.g. example.com")
+	}
+	return domain, nil
+}
+
+// EmailDomain returns the lower-cased domain of an email address
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// DomainSuffixes returns the domain followed by each parent domain, so
+// eng.example.com gives eng.example.com and example.com
+func DomainSuffixes(domain string) []string {
+	var suffixes []string
+	for strings.Contains(domain, ".") {
+		suffixes = append(suffixes, domain)
+		domain = domain[strings.Index(domain, ".")+1:]
+	}
+	return suffixes
+}
@@ -0,0 +1,74 @@
+package privacy
+
+import (
+	"JWT-Authentication-go/config"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IP modes accepted by ACCESS_LOG_IP_MODE
+const (
+	IPFull     = "full"
+	IPTruncate = "truncate"
+	IPHash     = "hash"
+)
+
+// CheckConfig rejects an IP mode that would store addresses other than as
+// configured: an unknown mode, or hashing without a salt
+func CheckConfig() error {
+	switch strings.ToLower(config.AccessLogIPMode) {
+	case IPFull, IPTruncate:
+		return nil
+	case IPHash:
+		if config.AccessLogIPSalt == "" {
+			return errors.New("ACCESS_LOG_IP_MODE=hash needs ACCESS_LOG_IP_SALT")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown ACCESS_LOG_IP_MODE %q, use full, truncate or hash", config.AccessLogIPMode)
+	}
+}
+
+// StoredIP converts a client IP into the form configured for storage
+func StoredIP(ip string) string {
+	return AnonymizeIP(ip, config.AccessLogIPMode, config.AccessLogIPSalt)
+}
+
+// AnonymizeIP applies an IP mode. truncate zeroes the host part (last octet
+// of IPv4, last 80 bits of IPv6); hash replaces the address with a keyed
+// SHA-256 so equal addresses can still be matched. Unknown modes store
+// nothing rather than the full address.
+func AnonymizeIP(ip, mode, salt string) string {
+	ip = strings.TrimSpace(ip)
+	if ip == "" {
+		return ""
+	}
+
+	switch strings.ToLower(mode) {
+	case IPTruncate:
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return ""
+		}
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return parsed.Mask(net.CIDRMask(48, 128)).String()
+
+	case IPHash:
+		mac := hmac.New(sha256.New, []byte(salt))
+		mac.Write([]byte(ip))
+		return "h:" + hex.EncodeToString(mac.Sum(nil))[:32]
+
+	case IPFull:
+		return ip
+
+	default:
+		return ""
+	}
+}
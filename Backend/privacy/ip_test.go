@@ -0,0 +1,51 @@
+package privacy
+
+import (
+	"JWT-Authentication-go/config"
+	"testing"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		ip, mode, want string
+	}{
+		{"203.0.113.42", IPFull, "203.0.113.42"},
+		{"203.0.113.42", IPTruncate, "203.0.113.0"},
+		{"2001:db8:1:2:3:4:5:6", IPTruncate, "2001:db8:1::"},
+		{"203.0.113.42", "redact", ""},
+		{"", IPFull, ""},
+	}
+	for _, test := range tests {
+		if got := AnonymizeIP(test.ip, test.mode, "salt"); got != test.want {
+			t.Errorf("AnonymizeIP(%q, %q) = %q, want %q", test.ip, test.mode, got, test.want)
+		}
+	}
+
+	hashed := AnonymizeIP("203.0.113.42", IPHash, "salt")
+	if hashed == AnonymizeIP("203.0.113.42", IPHash, "pepper") || hashed != AnonymizeIP("203.0.113.42", IPHash, "salt") {
+		t.Errorf("hash %q does not depend on the salt alone", hashed)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	mode, salt := config.AccessLogIPMode, config.AccessLogIPSalt
+	t.Cleanup(func() { config.AccessLogIPMode, config.AccessLogIPSalt = mode, salt })
+
+	tests := []struct {
+		mode, salt string
+		valid      bool
+	}{
+		{"full", "", true},
+		{"Truncate", "", true},
+		{"hash", "secret", true},
+		{"hash", "", false},
+		{"anonymize", "secret", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		config.AccessLogIPMode, config.AccessLogIPSalt = test.mode, test.salt
+		if err := CheckConfig(); (err == nil) != test.valid {
+			t.Errorf("CheckConfig(%q, salt %q) = %v, want valid %v", test.mode, test.salt, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+var boxFolderID = regexp.MustCompile(`^[0-9]+$`)
+
+// Box handles folder links and shared links on app.box.com
+type Box struct{}
+
+func (Box) Name() string { return "box" }
+
+func (Box) Parse(raw string) (Resource, error) {
+	parsed, host, err := parseHTTPURL("Box", raw)
+	if err != nil {
+		return Resource{}, err
+	}
+	if host != "box.com" && host != "app.box.com" && !strings.HasSuffix(host, ".box.com") {
+		return Resource{}, &LinkError{Provider: "Box", Input: raw, Reason: "it is not a box.com link"}
+	}
+
+	segments := pathSegments(parsed.Path)
+	switch {
+	case len(segments) >= 2 && segments[0] == "folder":
+		if !boxFolderID.MatchString(segments[1]) {
+			return Resource{}, &LinkError{Provider: "Box", Input: raw, Reason: "the folder ID must be numeric"}
+		}
+	case len(segments) >= 2 && (segments[0] == "s" || segments[0] == "v"):
+		// shared links cannot be told apart from file links without the API
+	case len(segments) > 0 && segments[0] == "file":
+		return Resource{}, &LinkError{Provider: "Box", Input: raw, Reason: "it is a link to a file, not a folder"}
+	default:
+		return Resource{}, &LinkError{Provider: "Box", Input: raw, Reason: "it is not a folder or shared link"}
+	}
+
+	id := host + "/" + segments[0] + "/" + segments[1]
+	return Resource{Provider: "box", ID: id, URL: "https://" + id}, nil
+}
+
+func (Box) OpenURL(resource Resource) string {
+	return "https://" + resource.ID
+}
+
+func (b Box) HealthCheck(ctx context.Context, resource Resource) error {
+	return CheckHTTP(ctx, b.OpenURL(resource))
+}
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Dropbox handles shared folder links
+type Dropbox struct{}
+
+func (Dropbox) Name() string { return "dropbox" }
+
+func (Dropbox) Parse(raw string) (Resource, error) {
+	parsed, host, err := parseHTTPURL("Dropbox", raw)
+	if err != nil {
+		return Resource{}, err
+	}
+	if host != "dropbox.com" {
+		return Resource{}, &LinkError{Provider: "Dropbox", Input: raw, Reason: "it is not a dropbox.com link"}
+	}
+
+	segments := pathSegments(parsed.Path)
+	switch {
+	case len(segments) >= 3 && segments[0] == "sh":
+		// legacy shared folder: /sh/<id>/<key>
+	case len(segments) >= 3 && segments[0] == "scl" && segments[1] == "fo":
+		// shared folder: /scl/fo/<id>/<key>?rlkey=...
+	case len(segments) >= 2 && segments[0] == "home":
+		// folder in the signed in user's account
+	case len(segments) > 0 && (segments[0] == "s" || (segments[0] == "scl" && len(segments) > 1 && segments[1] == "fi")):
+		return Resource{}, &LinkError{Provider: "Dropbox", Input: raw, Reason: "it is a link to a file, not a folder"}
+	default:
+		return Resource{}, &LinkError{Provider: "Dropbox", Input: raw, Reason: "it is not a shared folder link"}
+	}
+
+	// Only rlkey is needed to open the link; dl= and st= are per-session noise
+	query := url.Values{}
+	if key := parsed.Query().Get("rlkey"); key != "" {
+		query.Set("rlkey", key)
+	}
+
+	id := "/" + strings.Join(segments, "/")
+	if len(query) > 0 {
+		id += "?" + query.Encode()
+	}
+	return Resource{Provider: "dropbox", ID: id, URL: "https://www.dropbox.com" + id}, nil
+}
+
+func (Dropbox) OpenURL(resource Resource) string {
+	return "https://www.dropbox.com" + resource.ID
+}
+
+func (d Dropbox) HealthCheck(ctx context.Context, resource Resource) error {
+	return CheckHTTP(ctx, d.OpenURL(resource))
+}
@@ -0,0 +1,145 @@
+package providers
+
+import (
+	"JWT-Authentication-go/config"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SMB handles Windows file shares given as \\server\share\path or smb:// URLs
+type SMB struct{}
+
+func (SMB) Name() string { return "smb" }
+
+func (SMB) Parse(raw string) (Resource, error) {
+	input := strings.TrimSpace(raw)
+
+	var rest string
+	switch {
+	case strings.HasPrefix(input, `\\`):
+		rest = strings.ReplaceAll(strings.TrimPrefix(input, `\\`), `\`, "/")
+	case strings.HasPrefix(strings.ToLower(input), "smb://"):
+		rest = input[len("smb://"):]
+	default:
+		return Resource{}, &LinkError{Provider: "SMB", Input: raw, Reason: `use \\server\share\folder or smb://server/share/folder`}
+	}
+
+	segments := pathSegments(rest)
+	if len(segments) < 2 {
+		return Resource{}, &LinkError{Provider: "SMB", Input: raw, Reason: "a server and a share name are required"}
+	}
+
+	segments[0] = strings.ToLower(segments[0])
+	id := strings.Join(segments, "/")
+	return Resource{Provider: "smb", ID: id, URL: "smb://" + id}, nil
+}
+
+func (SMB) OpenURL(resource Resource) string {
+	return "smb://" + resource.ID
+}
+
+// HealthCheck only checks that the file server accepts connections. Only
+// servers listed in HEALTH_CHECK_SMB_HOSTS are dialed, so a mapping cannot
+// make the server connect anywhere it likes.
+func (SMB) HealthCheck(ctx context.Context, resource Resource) error {
+	server, _, _ := strings.Cut(resource.ID, "/")
+	if !listed(config.HealthCheckSMBHosts, server, func(allowed, server string) bool {
+		return strings.EqualFold(allowed, server)
+	}) {
+		return ErrNoHealthCheck
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "445")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Local handles folders on a disk mounted on the client machine
+type Local struct{}
+
+func (Local) Name() string { return "local" }
+
+func (Local) Parse(raw string) (Resource, error) {
+	input := strings.TrimSpace(raw)
+	if strings.HasPrefix(strings.ToLower(input), "file://") {
+		parsed, err := url.Parse(input)
+		if err != nil {
+			return Resource{}, &LinkError{Provider: "local", Input: raw, Reason: "it is not a valid file:// URL"}
+		}
+		input = parsed.Path
+	}
+
+	// Accept Windows drive paths as well as absolute POSIX paths
+	windows := len(input) >= 3 && input[1] == ':' && (input[2] == '\\' || input[2] == '/')
+	if !windows && !strings.HasPrefix(input, "/") {
+		return Resource{}, &LinkError{Provider: "local", Input: raw, Reason: "the path must be absolute"}
+	}
+
+	id := input
+	if !windows {
+		id = filepath.Clean(input)
+	}
+	return Resource{Provider: "local", ID: id, URL: localURL(id)}, nil
+}
+
+func (Local) OpenURL(resource Resource) string {
+	return localURL(resource.ID)
+}
+
+// HealthCheck stats the folder, which is only meaningful when the server
+// can see the same disk as the clients. Only folders under
+// HEALTH_CHECK_LOCAL_ROOTS are looked at, so a mapping cannot probe any
+// path on the server.
+func (Local) HealthCheck(ctx context.Context, resource Resource) error {
+	if !listed(config.HealthCheckLocalRoots, resource.ID, underRoot) {
+		return ErrNoHealthCheck
+	}
+
+	info, err := os.Stat(resource.ID)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", resource.ID)
+	}
+	return nil
+}
+
+// listed reports whether value matches an entry of a comma separated list
+func listed(list, value string, match func(entry, value string) bool) bool {
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" && match(entry, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// underRoot reports whether path is root or inside it
+func underRoot(root, path string) bool {
+	if !filepath.IsAbs(root) || !filepath.IsAbs(path) {
+		return false
+	}
+	relative, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// localURL turns a path into a file:// URL
+func localURL(path string) string {
+	path = strings.ReplaceAll(path, `\`, "/")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
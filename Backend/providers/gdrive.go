@@ -0,0 +1,27 @@
+package providers
+
+import (
+	"JWT-Authentication-go/drive"
+	"context"
+)
+
+// GoogleDrive handles Google Drive folders and shared drives
+type GoogleDrive struct{}
+
+func (GoogleDrive) Name() string { return "gdrive" }
+
+func (GoogleDrive) Parse(raw string) (Resource, error) {
+	folder, err := drive.ParseURL(raw)
+	if err != nil {
+		return Resource{}, err
+	}
+	return Resource{Provider: "gdrive", ID: folder.ID, URL: folder.URL()}, nil
+}
+
+func (GoogleDrive) OpenURL(resource Resource) string {
+	return drive.Folder{ID: resource.ID}.URL()
+}
+
+func (g GoogleDrive) HealthCheck(ctx context.Context, resource Resource) error {
+	return CheckHTTP(ctx, g.OpenURL(resource))
+}
@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"context"
+	"strings"
+)
+
+// OneDrive handles OneDrive personal links and SharePoint / OneDrive for
+// Business sites
+type OneDrive struct{}
+
+func (OneDrive) Name() string { return "onedrive" }
+
+func (OneDrive) Parse(raw string) (Resource, error) {
+	parsed, host, err := parseHTTPURL("OneDrive", raw)
+	if err != nil {
+		return Resource{}, err
+	}
+
+	switch {
+	case host == "1drv.ms", host == "onedrive.live.com":
+	case strings.HasSuffix(host, ".sharepoint.com"):
+		// Sharing links to single files use /:w:/, /:x:/ etc, folders use /:f:/
+		segments := pathSegments(parsed.Path)
+		if len(segments) > 0 && strings.HasPrefix(segments[0], ":") && segments[0] != ":f:" {
+			return Resource{}, &LinkError{Provider: "OneDrive", Input: raw, Reason: "it is a sharing link to a file, not a folder"}
+		}
+	default:
+		return Resource{}, &LinkError{Provider: "OneDrive", Input: raw, Reason: "it is not a onedrive.live.com, 1drv.ms or sharepoint.com link"}
+	}
+
+	if len(pathSegments(parsed.Path)) == 0 && parsed.RawQuery == "" {
+		return Resource{}, &LinkError{Provider: "OneDrive", Input: raw, Reason: "it does not point to a folder"}
+	}
+
+	// The whole link is the identifier, query included (id=, cid=, e=)
+	parsed.Scheme = "https"
+	parsed.Host = host
+	parsed.Fragment = ""
+	canonical := parsed.String()
+	return Resource{Provider: "onedrive", ID: strings.TrimPrefix(canonical, "https://"), URL: canonical}, nil
+}
+
+func (OneDrive) OpenURL(resource Resource) string {
+	return "https://" + resource.ID
+}
+
+func (o OneDrive) HealthCheck(ctx context.Context, resource Resource) error {
+	return CheckHTTP(ctx, o.OpenURL(resource))
+}
@@ -0,0 +1,167 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Default is used for mappings saved before providers existed
+const Default = "gdrive"
+
+// Resource is a validated storage location
+type Resource struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`  // canonical provider specific identifier
+	URL      string `json:"url"` // canonical link as stored
+}
+
+// Provider validates and canonicalizes links for one storage service
+type Provider interface {
+	// Name is the value stored in the provider column
+	Name() string
+	// Parse validates a link and returns its canonical form
+	Parse(raw string) (Resource, error)
+	// OpenURL builds the link the desktop client should open
+	OpenURL(resource Resource) string
+}
+
+// HealthChecker is implemented by providers that can tell whether a
+// location is still reachable
+type HealthChecker interface {
+	HealthCheck(ctx context.Context, resource Resource) error
+}
+
+// ErrNoHealthCheck is returned by providers whose locations cannot be
+// probed from the server
+var ErrNoHealthCheck = errors.New("health checks are not supported for this provider")
+
+// LinkError explains why a link was rejected
+type LinkError struct {
+	Provider string
+	Input    string
+	Reason   string
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("invalid %s link %q: %s", e.Provider, e.Input, e.Reason)
+}
+
+var registry = map[string]Provider{}
+
+// Register adds a provider to the registry, replacing one with the same name
+func Register(provider Provider) {
+	registry[provider.Name()] = provider
+}
+
+func init() {
+	Register(GoogleDrive{})
+	Register(OneDrive{})
+	Register(Dropbox{})
+	Register(Box{})
+	Register(S3{})
+	Register(SMB{})
+	Register(Local{})
+}
+
+// Get returns the provider registered under name. An empty name means Default.
+func Get(name string) (Provider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = Default
+	}
+
+	provider, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q, expected one of: %s", name, strings.Join(Names(), ", "))
+	}
+	return provider, nil
+}
+
+// Names lists the registered providers
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse validates raw with the named provider
+func Parse(name, raw string) (Resource, error) {
+	provider, err := Get(name)
+	if err != nil {
+		return Resource{}, err
+	}
+	return provider.Parse(raw)
+}
+
+// OpenURL builds the link to open for a stored provider/ID/URL triple
+func OpenURL(name, id, link string) string {
+	provider, err := Get(name)
+	if err != nil || id == "" {
+		return link
+	}
+	return provider.OpenURL(Resource{Provider: provider.Name(), ID: id, URL: link})
+}
+
+// parseHTTPURL parses a web link, adding https:// when the scheme is missing
+func parseHTTPURL(provider, raw string) (*url.URL, string, error) {
+	input := strings.TrimSpace(raw)
+	if input == "" {
+		return nil, "", &LinkError{Provider: provider, Input: raw, Reason: "the link is empty"}
+	}
+
+	link := input
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" {
+		return nil, "", &LinkError{Provider: provider, Input: raw, Reason: "it is not a valid URL"}
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return nil, "", &LinkError{Provider: provider, Input: raw, Reason: "it must be an http(s) link"}
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	return parsed, host, nil
+}
+
+// pathSegments splits a URL path into its non-empty parts
+func pathSegments(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// healthClient is shared by the HTTP based health checks
+var healthClient = &http.Client{Timeout: 15 * time.Second}
+
+// CheckHTTP issues a HEAD request and treats 404 and 410 as a dead link.
+// Other statuses, including login redirects, mean the location exists.
+func CheckHTTP(ctx context.Context, link string) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := healthClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone {
+		return fmt.Errorf("%s returned %s", link, response.Status)
+	}
+	if response.StatusCode >= 500 {
+		return fmt.Errorf("%s returned %s", link, response.Status)
+	}
+	return nil
+}
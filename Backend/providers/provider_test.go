@@ -0,0 +1,165 @@
+package providers
+
+import (
+	"JWT-Authentication-go/config"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const driveID = "1AbCdEfGhIjKlMnOpQrStUvWxYz012345"
+
+	tests := []struct {
+		provider string
+		input    string
+		wantID   string // empty when the input must be rejected
+	}{
+		{"gdrive", "https://drive.google.com/drive/folders/" + driveID + "?usp=sharing", driveID},
+		{"gdrive", "https://drive.google.com/file/d/" + driveID + "/view", ""},
+		{"gdrive", "marketing", ""},
+
+		{"onedrive", "https://1drv.ms/f/s!AbCdEf#top", "1drv.ms/f/s!AbCdEf"},
+		{"onedrive", "https://onedrive.live.com/?id=ABC%21123&cid=ABC", "onedrive.live.com/?id=ABC%21123&cid=ABC"},
+		{"onedrive", "http://contoso.sharepoint.com/:f:/s/team/EaBc", "contoso.sharepoint.com/:f:/s/team/EaBc"},
+		{"onedrive", "https://contoso.sharepoint.com/:w:/s/team/EaBc", ""},
+		{"onedrive", "https://onedrive.live.com", ""},
+		{"onedrive", "https://example.com/f/s!AbCdEf", ""},
+
+		{"dropbox", "https://www.dropbox.com/scl/fo/abc123/def456?rlkey=key&dl=0&st=x", "/scl/fo/abc123/def456?rlkey=key"},
+		{"dropbox", "dropbox.com/sh/abc123/def456", "/sh/abc123/def456"},
+		{"dropbox", "https://www.dropbox.com/home/Team/Reports", "/home/Team/Reports"},
+		{"dropbox", "https://www.dropbox.com/s/abc123/report.pdf", ""},
+		{"dropbox", "https://www.dropbox.com/scl/fi/abc123/report.pdf", ""},
+		{"dropbox", "https://dropbox.example.com/sh/abc123/def456", ""},
+		{"dropbox", "ftp://dropbox.com/sh/abc123/def456", ""},
+
+		{"box", "https://app.box.com/folder/123456789", "app.box.com/folder/123456789"},
+		{"box", "https://acme.app.box.com/s/abc123xyz", "acme.app.box.com/s/abc123xyz"},
+		{"box", "https://app.box.com/folder/abc", ""},
+		{"box", "https://app.box.com/file/123456789", ""},
+		{"box", "https://box.example.com/folder/123456789", ""},
+
+		{"s3", "s3://reports-bucket/team/q1", "reports-bucket/team/q1/"},
+		{"s3", "s3://reports-bucket", "reports-bucket/"},
+		{"s3", "https://s3.console.aws.amazon.com/s3/buckets/reports-bucket?prefix=team/", "reports-bucket/team/"},
+		{"s3", "https://reports-bucket.s3.eu-west-1.amazonaws.com/team/", "reports-bucket/team/"},
+		{"s3", "s3://Reports_Bucket/team", ""},
+		{"s3", "https://s3.console.aws.amazon.com/s3/home", ""},
+		{"s3", "https://example.com/reports-bucket", ""},
+		{"s3", "", ""},
+
+		{"smb", `\\FileServer\Share\Team`, "fileserver/Share/Team"},
+		{"smb", "smb://FileServer/Share", "fileserver/Share"},
+		{"smb", `\\fileserver`, ""},
+		{"smb", "//fileserver/share", ""},
+
+		{"local", "/srv/shares/team/../reports/", "/srv/shares/reports"},
+		{"local", "file:///srv/shares/team", "/srv/shares/team"},
+		{"local", `C:\Shares\Team`, `C:\Shares\Team`},
+		{"local", "shares/team", ""},
+		{"local", "", ""},
+	}
+	for _, test := range tests {
+		resource, err := Parse(test.provider, test.input)
+		switch {
+		case test.wantID == "" && err == nil:
+			t.Errorf("Parse(%s, %q) = %q, want an error", test.provider, test.input, resource.ID)
+		case test.wantID != "" && (err != nil || resource.ID != test.wantID):
+			t.Errorf("Parse(%s, %q) = %q, %v; want %q", test.provider, test.input, resource.ID, err, test.wantID)
+		case test.wantID != "" && resource.Provider != test.provider:
+			t.Errorf("Parse(%s, %q) provider = %q", test.provider, test.input, resource.Provider)
+		}
+	}
+
+	if _, err := Parse("ftp", "ftp://example.com"); err == nil {
+		t.Error("an unknown provider is accepted")
+	}
+}
+
+func TestOpenURLRoundTrip(t *testing.T) {
+	tests := []struct {
+		provider string
+		input    string
+		want     string
+	}{
+		{"dropbox", "https://www.dropbox.com/scl/fo/abc123/def456?rlkey=key&dl=0", "https://www.dropbox.com/scl/fo/abc123/def456?rlkey=key"},
+		{"box", "https://app.box.com/folder/123456789", "https://app.box.com/folder/123456789"},
+		{"s3", "s3://reports-bucket/team", "https://s3.console.aws.amazon.com/s3/buckets/reports-bucket?prefix=team%2F"},
+		{"smb", `\\fileserver\share`, "smb://fileserver/share"},
+		{"local", "/srv/shares/team", "file:///srv/shares/team"},
+	}
+	for _, test := range tests {
+		resource, err := Parse(test.provider, test.input)
+		if err != nil {
+			t.Fatalf("Parse(%s, %q): %v", test.provider, test.input, err)
+		}
+		if got := OpenURL(test.provider, resource.ID, resource.URL); got != test.want {
+			t.Errorf("OpenURL(%s, %q) = %q, want %q", test.provider, resource.ID, got, test.want)
+		}
+	}
+}
+
+func TestLocalHealthCheckRoots(t *testing.T) {
+	root := t.TempDir()
+	config.HealthCheckLocalRoots = ""
+	t.Cleanup(func() { config.HealthCheckLocalRoots = "" })
+
+	inside := Resource{Provider: "local", ID: root}
+	if err := (Local{}).HealthCheck(context.Background(), inside); !errors.Is(err, ErrNoHealthCheck) {
+		t.Errorf("without roots, HealthCheck = %v, want ErrNoHealthCheck", err)
+	}
+
+	config.HealthCheckLocalRoots = " /nonexistent , " + root
+	if err := (Local{}).HealthCheck(context.Background(), inside); err != nil {
+		t.Errorf("HealthCheck(root) = %v, want nil", err)
+	}
+	missing := Resource{Provider: "local", ID: filepath.Join(root, "missing")}
+	if err := (Local{}).HealthCheck(context.Background(), missing); err == nil || errors.Is(err, ErrNoHealthCheck) {
+		t.Errorf("HealthCheck(missing folder under root) = %v, want a stat error", err)
+	}
+
+	for _, outside := range []string{"/etc", root + "-other", filepath.Join(root, "..")} {
+		resource := Resource{Provider: "local", ID: outside}
+		if err := (Local{}).HealthCheck(context.Background(), resource); !errors.Is(err, ErrNoHealthCheck) {
+			t.Errorf("HealthCheck(%q) = %v, want ErrNoHealthCheck", outside, err)
+		}
+	}
+}
+
+func TestSMBHealthCheckHosts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	server := listener.Addr().String()
+	share := Resource{Provider: "smb", ID: server + "/share"}
+	config.HealthCheckSMBHosts = ""
+	t.Cleanup(func() { config.HealthCheckSMBHosts = "" })
+
+	if err := (SMB{}).HealthCheck(context.Background(), share); !errors.Is(err, ErrNoHealthCheck) {
+		t.Errorf("without hosts, HealthCheck = %v, want ErrNoHealthCheck", err)
+	}
+
+	config.HealthCheckSMBHosts = "fileserver," + server
+	if err := (SMB{}).HealthCheck(context.Background(), share); err != nil {
+		t.Errorf("HealthCheck(listed host) = %v, want nil", err)
+	}
+	other := Resource{Provider: "smb", ID: "127.0.0.1/share"}
+	if err := (SMB{}).HealthCheck(context.Background(), other); !errors.Is(err, ErrNoHealthCheck) {
+		t.Errorf("HealthCheck(unlisted host) = %v, want ErrNoHealthCheck", err)
+	}
+}
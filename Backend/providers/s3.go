@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var s3Bucket = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// S3 handles bucket prefixes given as s3:// URIs, console links or
+// virtual-hosted style URLs
+type S3 struct{}
+
+func (S3) Name() string { return "s3" }
+
+func (S3) Parse(raw string) (Resource, error) {
+	input := strings.TrimSpace(raw)
+	parsed, err := url.Parse(input)
+	if err != nil || input == "" {
+		return Resource{}, &LinkError{Provider: "S3", Input: raw, Reason: "it is not a valid URL"}
+	}
+
+	var bucket, prefix string
+	host := strings.ToLower(parsed.Hostname())
+
+	switch {
+	case parsed.Scheme == "s3":
+		bucket = parsed.Host
+		prefix = strings.TrimPrefix(parsed.Path, "/")
+	case host == "s3.console.aws.amazon.com" || strings.HasSuffix(host, ".console.aws.amazon.com"):
+		// https://s3.console.aws.amazon.com/s3/buckets/<bucket>?prefix=<prefix>
+		segments := pathSegments(parsed.Path)
+		if len(segments) < 3 || segments[1] != "buckets" {
+			return Resource{}, &LinkError{Provider: "S3", Input: raw, Reason: "it is not a bucket console link"}
+		}
+		bucket = segments[2]
+		prefix = parsed.Query().Get("prefix")
+	case strings.Contains(host, ".s3.") || strings.Contains(host, ".s3-"):
+		// https://<bucket>.s3.<region>.amazonaws.com/<prefix>
+		bucket = host[:strings.Index(host, ".s3")]
+		prefix = strings.TrimPrefix(parsed.Path, "/")
+	default:
+		return Resource{}, &LinkError{Provider: "S3", Input: raw, Reason: "use s3://bucket/prefix or an S3 console link"}
+	}
+
+	if !s3Bucket.MatchString(bucket) {
+		return Resource{}, &LinkError{Provider: "S3", Input: raw, Reason: "the bucket name is invalid"}
+	}
+
+	// Prefixes act as folders, so always end them with a slash
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	id := bucket + "/" + prefix
+	return Resource{Provider: "s3", ID: id, URL: "s3://" + id}, nil
+}
+
+func (S3) OpenURL(resource Resource) string {
+	bucket, prefix, _ := strings.Cut(resource.ID, "/")
+	link := "https://s3.console.aws.amazon.com/s3/buckets/" + url.PathEscape(bucket)
+	if prefix != "" {
+		link += "?prefix=" + url.QueryEscape(prefix)
+	}
+	return link
+}
+
+// HealthCheck is not possible without AWS credentials; buckets are private
+func (S3) HealthCheck(ctx context.Context, resource Resource) error {
+	return ErrNoHealthCheck
+}
@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"JWT-Authentication-go/config"
 	"JWT-Authentication-go/controllers"
+	"JWT-Authentication-go/throttle"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -9,31 +12,123 @@ import (
 func SetupRoutes(app *fiber.App) {
 	// Public routes
 	app.Get("/", controllers.Hello)
-	app.Post("/api/register", controllers.Register)
-	app.Post("/api/login", controllers.Login)
+	app.Post("/api/register", throttle.PerIP("register", config.RegisterRateLimitPerHour, time.Hour), controllers.Register)
+	app.Post("/api/login", throttle.PerIP("login", config.LoginRateLimitPerMinute, time.Minute), controllers.Login)
+	app.Post("/api/login/mfa", throttle.PerIP("login", config.LoginRateLimitPerMinute, time.Minute), controllers.LoginMFA)
 	app.Get("/api/debug/auth", controllers.DebugAuth)
-	app.Post("/api/create-admin", controllers.CreateAdmin)
+	// Open while there is no admin; admins calling it must have set up 2FA
+	app.Post("/api/create-admin", throttle.PerIP("register", config.RegisterRateLimitPerHour, time.Hour), controllers.RequireAdminMFA, controllers.CreateAdmin)
 	app.Get("/api/debug/admin", controllers.DebugAdmin)
 	app.Get("/api/ping", controllers.Ping)
+	app.Get("/api/invitations/:token", controllers.GetInvitation)
+	app.Post("/api/invitations/:token/accept", controllers.AcceptInvitation)
+	app.Post("/api/verify-email", controllers.VerifyEmail)
+	app.Post("/api/password/forgot", throttle.PerIP("password", config.PasswordResetRateLimitPerHour, time.Hour), controllers.ForgotPassword)
+	app.Post("/api/password/reset", throttle.PerIP("password", config.PasswordResetRateLimitPerHour, time.Hour), controllers.ResetPassword)
+	app.Get("/api/password/policy", controllers.GetPasswordPolicy)
+	app.Get("/api/auth/oidc", controllers.GetOIDCProviders)
+	app.Get("/api/auth/oidc/:provider", throttle.PerIP("login", config.LoginRateLimitPerMinute, time.Minute), controllers.OIDCLogin)
+	app.Get("/api/auth/oidc/:provider/callback", throttle.PerIP("login", config.LoginRateLimitPerMinute, time.Minute), controllers.OIDCCallback)
+	app.Get("/api/auth/saml/metadata", controllers.SAMLMetadata)
+	app.Get("/api/auth/saml/login", throttle.PerIP("login", config.LoginRateLimitPerMinute, time.Minute), controllers.SAMLLogin)
+	app.Post("/api/auth/saml/acs", throttle.PerIP("login", config.LoginRateLimitPerMinute, time.Minute), controllers.SAMLACS)
+
+	// Accounts given a temporary password must replace it first
+	app.Use("/api", controllers.RequirePasswordChange)
 
 	// User routes (require authentication)
 	app.Get("/api/user", controllers.User)
 	app.Post("/api/logout", controllers.Logout)
 	app.Put("/api/user/profile", controllers.UpdateProfile)
 	app.Get("/api/user/drive", controllers.FindDriveUrlForUser)
+	app.Post("/api/user/verification/resend", controllers.ResendVerification)
+	app.Get("/api/user/mfa", controllers.GetMFAStatus)
+	app.Post("/api/user/mfa/setup", controllers.SetupMFA)
+	app.Post("/api/user/mfa/enable", controllers.EnableMFA)
+	app.Post("/api/user/mfa/disable", controllers.DisableMFA)
+	app.Post("/api/user/mfa/recovery-codes", controllers.RegenerateMFARecoveryCodes)
+	app.Get("/api/user/identities/oidc/:provider", controllers.LinkOIDC)
+	app.Get("/api/user/export", controllers.ExportUserData)
+	app.Post("/api/user/deletion", controllers.RequestAccountDeletion)
+	app.Delete("/api/user/deletion", controllers.CancelAccountDeletion)
 
 	// Admin routes
+	app.Use("/api/admin", controllers.RequireAdminMFA)
 	app.Get("/api/admin/users", controllers.GetAllUsers)
+	app.Post("/api/admin/users/import", controllers.ImportUsers)
+	app.Get("/api/admin/invitations", controllers.GetInvitations)
+	app.Post("/api/admin/invitations", controllers.CreateInvitation)
+	app.Delete("/api/admin/invitations/:id", controllers.RevokeInvitation)
+	app.Get("/api/admin/registration/policy", controllers.GetRegistrationPolicy)
+	app.Post("/api/admin/registration/check", controllers.CheckRegistrationEmail)
+	app.Get("/api/admin/registration/domains", controllers.GetRegistrationRules)
+	app.Post("/api/admin/registration/domains", controllers.CreateRegistrationRule)
+	app.Put("/api/admin/registration/domains/:id", controllers.UpdateRegistrationRule)
+	app.Delete("/api/admin/registration/domains/:id", controllers.DeleteRegistrationRule)
 	app.Get("/api/admin/users/:id", controllers.GetUserByID)
 	app.Put("/api/admin/users/:id", controllers.UpdateUser)
 	app.Delete("/api/admin/users/:id", controllers.DeleteUser)
+	app.Get("/api/admin/users/:id/export", controllers.ExportUserDataByID)
+	app.Post("/api/admin/users/:id/erase", controllers.EraseUser)
+	app.Delete("/api/admin/users/:id/mfa", controllers.ResetUserMFA)
+	app.Get("/api/admin/users/:id/lockout", controllers.GetUserLockout)
+	app.Post("/api/admin/users/:id/unlock", controllers.UnlockUser)
 	app.Get("/api/admin/domains", controllers.GetDomainMappings)
+	app.Get("/api/admin/domains/health", controllers.GetDomainHealth)
+	app.Post("/api/admin/domains/health/run", controllers.RunDomainHealthCheck)
+	app.Get("/api/admin/domains/unmapped", controllers.GetUnmappedDomains)
+	app.Get("/api/admin/drive/revocations", controllers.GetPendingDriveRevocations)
+	app.Get("/api/admin/domains/unmapped/:id", controllers.GetUnmappedDomain)
+	app.Post("/api/admin/domains/unmapped/:id/map", controllers.MapUnmappedDomain)
+	app.Post("/api/admin/domains/unmapped/:id/dismiss", controllers.DismissUnmappedDomain)
 	app.Post("/api/admin/domains", controllers.CreateDomainMapping)
 	app.Put("/api/admin/domains/:id", controllers.UpdateDomainMapping)
 	app.Delete("/api/admin/domains/:id", controllers.DeleteDomainMapping)
+	app.Get("/api/admin/access-logs", controllers.GetAccessLogs)
+	app.Get("/api/admin/access-logs/export", controllers.ExportAccessLogs)
+	app.Get("/api/admin/access-logs/rollups", controllers.GetAccessLogRollups)
+	app.Get("/api/admin/access-logs/retention", controllers.GetAccessLogRetention)
+	app.Post("/api/admin/access-logs/retention/run", controllers.RunAccessLogRetention)
+	app.Get("/api/admin/directories", controllers.GetDirectories)
+	app.Post("/api/admin/directories/:name/sync", controllers.SyncDirectory)
+	app.Get("/api/admin/saml", controllers.GetSAMLConnections)
+	app.Post("/api/admin/saml", controllers.CreateSAMLConnection)
+	app.Put("/api/admin/saml/:id", controllers.UpdateSAMLConnection)
+	app.Put("/api/admin/saml/:id/metadata", controllers.UploadSAMLMetadata)
+	app.Delete("/api/admin/saml/:id", controllers.DeleteSAMLConnection)
+	app.Get("/api/admin/scim/tokens", controllers.GetSCIMTokens)
+	app.Post("/api/admin/scim/tokens", controllers.CreateSCIMToken)
+	app.Delete("/api/admin/scim/tokens/:id", controllers.RevokeSCIMToken)
+	app.Get("/api/admin/analytics/active-users", controllers.GetActiveUsers)
+	app.Get("/api/admin/analytics/lookups/domains", controllers.GetLookupsByDomain)
+	app.Get("/api/admin/analytics/lookups/mappings", controllers.GetLookupsByMapping)
+	app.Get("/api/admin/analytics/default-share", controllers.GetDefaultShare)
+	app.Get("/api/admin/analytics/unmapped-domains", controllers.GetTopUnmappedDomains)
+	app.Get("/api/admin/analytics/users", controllers.GetUserAccessSummary)
+	app.Get("/api/admin/audit", controllers.GetAuditEvents)
+	app.Get("/api/admin/audit/verify", controllers.VerifyAuditChain)
+	app.Get("/api/admin/providers", controllers.GetProviders)
 	app.Get("/api/admin/default-mapping", controllers.GetDefaultMapping)
 	app.Put("/api/admin/default-mapping", controllers.UpdateDefaultMapping)
 
+	// SCIM provisioning, authenticated with SCIM tokens instead of sessions
+	app.Use("/scim/v2", controllers.RequireSCIMToken)
+	app.Get("/scim/v2/ServiceProviderConfig", controllers.SCIMServiceProviderConfig)
+	app.Get("/scim/v2/ResourceTypes", controllers.SCIMResourceTypes)
+	app.Get("/scim/v2/Schemas", controllers.SCIMSchemas)
+	app.Get("/scim/v2/Users", controllers.GetSCIMUsers)
+	app.Post("/scim/v2/Users", controllers.CreateSCIMUser)
+	app.Get("/scim/v2/Users/:id", controllers.GetSCIMUser)
+	app.Put("/scim/v2/Users/:id", controllers.ReplaceSCIMUser)
+	app.Patch("/scim/v2/Users/:id", controllers.PatchSCIMUser)
+	app.Delete("/scim/v2/Users/:id", controllers.DeleteSCIMUser)
+	app.Get("/scim/v2/Groups", controllers.GetSCIMGroups)
+	app.Post("/scim/v2/Groups", controllers.CreateSCIMGroup)
+	app.Get("/scim/v2/Groups/:id", controllers.GetSCIMGroup)
+	app.Put("/scim/v2/Groups/:id", controllers.ReplaceSCIMGroup)
+	app.Patch("/scim/v2/Groups/:id", controllers.PatchSCIMGroup)
+	app.Delete("/scim/v2/Groups/:id", controllers.DeleteSCIMGroup)
+
 	// Admin user creation
 	app.Post("/api/admin/update-role", controllers.UpdateUserRole)
 }
@@ -0,0 +1,141 @@
+package scim
+
+// MaxResults caps the page size of list requests
+const MaxResults = 200
+
+// ServiceProviderConfig describes which SCIM features this server supports
+func ServiceProviderConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":          []interface{}{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"documentationUri": "",
+		"patch":            map[string]interface{}{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": MaxResults},
+		"changePassword":   map[string]interface{}{"supported": true},
+		"sort":             map[string]interface{}{"supported": false},
+		"etag":             map[string]interface{}{"supported": true},
+		"authenticationSchemes": []interface{}{
+			map[string]interface{}{
+				"type":        "oauthbearertoken",
+				"name":        "Bearer token",
+				"description": "A SCIM token created by an admin, sent in the Authorization header",
+				"primary":     true,
+			},
+		},
+		"meta": map[string]interface{}{
+			"resourceType": "ServiceProviderConfig",
+			"location":     BaseURL() + "/ServiceProviderConfig",
+		},
+	}
+}
+
+// ResourceTypes lists the resource types this server serves
+func ResourceTypes() []map[string]interface{} {
+	return []map[string]interface{}{
+		{
+			"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":          "User",
+			"name":        "User",
+			"endpoint":    "/Users",
+			"description": "User Account",
+			"schema":      UserSchema,
+			"schemaExtensions": []interface{}{
+				map[string]interface{}{"schema": EnterpriseUserSchema, "required": false},
+			},
+			"meta": map[string]interface{}{
+				"resourceType": "ResourceType",
+				"location":     BaseURL() + "/ResourceTypes/User",
+			},
+		},
+		{
+			"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":          "Group",
+			"name":        "Group",
+			"endpoint":    "/Groups",
+			"description": "The admin group, or a department",
+			"schema":      GroupSchema,
+			"meta": map[string]interface{}{
+				"resourceType": "ResourceType",
+				"location":     BaseURL() + "/ResourceTypes/Group",
+			},
+		},
+	}
+}
+
+// Schemas describes the attributes this server understands
+func Schemas() []map[string]interface{} {
+	value := attribute("value", "string", false, false, "readWrite")
+	return []map[string]interface{}{
+		schema(UserSchema, "User", "User Account",
+			attribute("userName", "string", false, true, "readWrite"),
+			attribute("name", "complex", false, false, "readWrite",
+				attribute("formatted", "string", false, false, "readWrite"),
+				attribute("givenName", "string", false, false, "readWrite"),
+				attribute("familyName", "string", false, false, "readWrite"),
+			),
+			attribute("displayName", "string", false, false, "readWrite"),
+			attribute("active", "boolean", false, false, "readWrite"),
+			attribute("password", "string", false, false, "writeOnly"),
+			attribute("emails", "complex", true, false, "readWrite",
+				value,
+				attribute("type", "string", false, false, "readWrite"),
+				attribute("primary", "boolean", false, false, "readWrite"),
+			),
+			attribute("roles", "complex", true, false, "readWrite",
+				value,
+				attribute("primary", "boolean", false, false, "readWrite"),
+			),
+			attribute("groups", "complex", true, false, "readOnly",
+				attribute("value", "string", false, false, "readOnly"),
+				attribute("display", "string", false, false, "readOnly"),
+			),
+		),
+		schema(EnterpriseUserSchema, "EnterpriseUser", "Enterprise User",
+			attribute("department", "string", false, false, "readWrite"),
+		),
+		schema(GroupSchema, "Group", "The admin group, or a department",
+			attribute("displayName", "string", false, true, "readWrite"),
+			attribute("members", "complex", true, false, "readWrite",
+				value,
+				attribute("display", "string", false, false, "readOnly"),
+			),
+		),
+	}
+}
+
+func schema(id, name, description string, attributes ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":     []interface{}{"urn:ietf:params:scim:schemas:core:2.0:Schema"},
+		"id":          id,
+		"name":        name,
+		"description": description,
+		"attributes":  attributes,
+		"meta": map[string]interface{}{
+			"resourceType": "Schema",
+			"location":     BaseURL() + "/Schemas/" + id,
+		},
+	}
+}
+
+func attribute(name, kind string, multiValued, required bool, mutability string, subAttributes ...map[string]interface{}) map[string]interface{} {
+	definition := map[string]interface{}{
+		"name":        name,
+		"type":        kind,
+		"multiValued": multiValued,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  mutability,
+		"returned":    "default",
+		"uniqueness":  "none",
+	}
+	switch {
+	case mutability == "writeOnly":
+		definition["returned"] = "never"
+	case name == "userName" || (name == "displayName" && required):
+		definition["uniqueness"] = "server"
+	}
+	if len(subAttributes) > 0 {
+		definition["subAttributes"] = subAttributes
+	}
+	return definition
+}
@@ -0,0 +1,420 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidFilter means a filter or path could not be parsed
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2)
+type Filter interface {
+	// Matches reports whether a resource, or an element of a multi-valued
+	// attribute, satisfies the filter
+	Matches(resource map[string]interface{}) bool
+}
+
+// attrPath names an attribute, optionally in an extension schema and
+// optionally one of its sub-attributes
+type attrPath struct {
+	Schema string
+	Name   string
+	Sub    string
+}
+
+type logicalFilter struct {
+	And         bool
+	Left, Right Filter
+}
+
+type notFilter struct {
+	Filter Filter
+}
+
+type compareFilter struct {
+	Path  attrPath
+	Op    string
+	Value interface{}
+}
+
+// valuePathFilter matches when an element of a multi-valued attribute
+// matches the inner filter, as in emails[type eq "work"]
+type valuePathFilter struct {
+	Path   attrPath
+	Filter Filter
+}
+
+// ParseFilter parses a filter such as userName eq "pat@example.com"
+func ParseFilter(filter string) (Filter, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	parsed, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.tokens[p.pos].text)
+	}
+	return parsed, nil
+}
+
+// parseAttrPath splits an attribute path such as name.givenName or
+// urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department
+func parseAttrPath(path string) (attrPath, error) {
+	parsed := attrPath{}
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		colon := strings.LastIndex(path, ":")
+		parsed.Schema, path = path[:colon], path[colon+1:]
+		// A path that is only a schema URN addresses the extension itself
+		if isSchema(parsed.Schema + ":" + path) {
+			return attrPath{Schema: parsed.Schema + ":" + path}, nil
+		}
+		if isCoreSchema(parsed.Schema) {
+			parsed.Schema = ""
+		}
+	}
+	parsed.Name, parsed.Sub, _ = strings.Cut(path, ".")
+	if parsed.Name == "" || strings.Contains(parsed.Sub, ".") {
+		return parsed, fmt.Errorf("%w: bad attribute path %q", ErrInvalidFilter, path)
+	}
+	return parsed, nil
+}
+
+// Matches implements Filter
+func (f logicalFilter) Matches(resource map[string]interface{}) bool {
+	if f.And {
+		return f.Left.Matches(resource) && f.Right.Matches(resource)
+	}
+	return f.Left.Matches(resource) || f.Right.Matches(resource)
+}
+
+// Matches implements Filter
+func (f notFilter) Matches(resource map[string]interface{}) bool {
+	return !f.Filter.Matches(resource)
+}
+
+// Matches implements Filter
+func (f compareFilter) Matches(resource map[string]interface{}) bool {
+	values := pathValues(resource, f.Path)
+	switch f.Op {
+	case "pr":
+		return len(values) > 0
+	case "ne":
+		for _, value := range values {
+			if compare(value, "eq", f.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		if compare(value, f.Op, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches implements Filter
+func (f valuePathFilter) Matches(resource map[string]interface{}) bool {
+	for _, element := range elements(resource, f.Path) {
+		if object, ok := element.(map[string]interface{}); ok && f.Filter.Matches(object) {
+			return true
+		}
+	}
+	return false
+}
+
+// elements returns the values of a possibly multi-valued attribute
+func elements(resource map[string]interface{}, path attrPath) []interface{} {
+	container := resource
+	if path.Schema != "" {
+		extension, ok := lookup(resource, path.Schema).(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		container = extension
+	}
+	switch value := lookup(container, path.Name).(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return value
+	default:
+		return []interface{}{value}
+	}
+}
+
+// pathValues returns the non-empty values an attribute path points at
+func pathValues(resource map[string]interface{}, path attrPath) []interface{} {
+	values := []interface{}{}
+	for _, element := range elements(resource, path) {
+		if path.Sub != "" {
+			object, ok := element.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			element = lookup(object, path.Sub)
+		}
+		if element != nil && element != "" {
+			values = append(values, element)
+		}
+	}
+	return values
+}
+
+// lookup reads a key case-insensitively, as SCIM attribute names are
+func lookup(object map[string]interface{}, key string) interface{} {
+	if value, ok := object[key]; ok {
+		return value
+	}
+	for name, value := range object {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+	return nil
+}
+
+// compare applies a comparison operator. Strings compare case-insensitively.
+func compare(value interface{}, op string, operand interface{}) bool {
+	switch operand := operand.(type) {
+	case string:
+		text, ok := value.(string)
+		if !ok {
+			return false
+		}
+		text, operand = strings.ToLower(text), strings.ToLower(operand)
+		switch op {
+		case "eq":
+			return text == operand
+		case "co":
+			return strings.Contains(text, operand)
+		case "sw":
+			return strings.HasPrefix(text, operand)
+		case "ew":
+			return strings.HasSuffix(text, operand)
+		case "gt":
+			return text > operand
+		case "ge":
+			return text >= operand
+		case "lt":
+			return text < operand
+		case "le":
+			return text <= operand
+		}
+	case float64:
+		number, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return number == operand
+		case "gt":
+			return number > operand
+		case "ge":
+			return number >= operand
+		case "lt":
+			return number < operand
+		case "le":
+			return number <= operand
+		}
+	case bool:
+		return op == "eq" && value == operand
+	case nil:
+		return op == "eq" && value == nil
+	}
+	return false
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits a filter into words, quoted strings, parentheses and
+// brackets
+func tokenize(filter string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(filter); {
+		switch ch := filter[i]; {
+		case ch == ' ' || ch == '\t':
+			i++
+		case ch == '(' || ch == ')' || ch == '[' || ch == ']':
+			tokens = append(tokens, token{text: string(ch)})
+			i++
+		case ch == '"':
+			end := i + 1
+			for end < len(filter) && filter[end] != '"' {
+				if filter[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(filter) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			var text string
+			if err := json.Unmarshal([]byte(filter[i:end+1]), &text); err != nil {
+				return nil, fmt.Errorf("%w: bad string %s", ErrInvalidFilter, filter[i:end+1])
+			}
+			tokens = append(tokens, token{text: text, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(filter) && !strings.ContainsRune(" \t()[]\"", rune(filter[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: filter[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// peekWord returns the next unquoted token lower-cased, or ""
+func (p *parser) peekWord() string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return ""
+	}
+	return strings.ToLower(p.tokens[p.pos].text)
+}
+
+func (p *parser) expect(text string) error {
+	if p.peekWord() != text {
+		return fmt.Errorf("%w: expected %q", ErrInvalidFilter, text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) parseOr() (Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalFilter{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord() == "and" {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalFilter{And: true, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Filter, error) {
+	switch p.peekWord() {
+	case "not":
+		p.pos++
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{Filter: inner}, p.expect(")")
+	case "(":
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case "":
+		return nil, fmt.Errorf("%w: expected an attribute", ErrInvalidFilter)
+	}
+	return p.parseAttrExpression()
+}
+
+func (p *parser) parseAttrExpression() (Filter, error) {
+	path, err := parseAttrPath(p.tokens[p.pos].text)
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+
+	if p.peekWord() == "[" {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return valuePathFilter{Path: path, Filter: inner}, nil
+	}
+
+	op := p.peekWord()
+	switch op {
+	case "pr":
+		p.pos++
+		return compareFilter{Path: path, Op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+		p.pos++
+	default:
+		return nil, fmt.Errorf("%w: expected an operator after %s", ErrInvalidFilter, path.Name)
+	}
+
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("%w: expected a value", ErrInvalidFilter)
+	}
+	value, err := parseValue(p.tokens[p.pos])
+	if err != nil {
+		return nil, err
+	}
+	p.pos++
+	return compareFilter{Path: path, Op: op, Value: value}, nil
+}
+
+// parseValue reads a comparison value: a string, number, boolean or null
+func parseValue(t token) (interface{}, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if number, err := strconv.ParseFloat(t.text, 64); err == nil && !strings.ContainsFunc(t.text, unicode.IsLetter) {
+		return number, nil
+	}
+	return nil, fmt.Errorf("%w: bad value %q", ErrInvalidFilter, t.text)
+}
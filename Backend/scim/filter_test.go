@@ -0,0 +1,134 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// ada is a user resource as UserResource builds them
+func ada() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":  []interface{}{UserSchema, EnterpriseUserSchema},
+		"id":       "7",
+		"userName": "Ada@Example.com",
+		"name": map[string]interface{}{
+			"givenName":  "Ada",
+			"familyName": "Lovelace",
+		},
+		"active": true,
+		"emails": []interface{}{
+			map[string]interface{}{"value": "ada@example.com", "type": "work", "primary": true},
+			map[string]interface{}{"value": "ada@home.example", "type": "home"},
+		},
+		"groups": []interface{}{
+			map[string]interface{}{"value": "2", "display": "Analytics"},
+			map[string]interface{}{"value": "5", "display": "Admins"},
+		},
+		EnterpriseUserSchema: map[string]interface{}{
+			"department": "Analytics",
+		},
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		// Attribute names, operators and strings ignore case
+		{`userName eq "ada@example.com"`, true},
+		{`USERNAME Eq "ADA@EXAMPLE.COM"`, true},
+		{`userName ne "ada@example.com"`, false},
+		{`userName sw "ada@" and userName ew ".COM"`, true},
+		{`userName co "lovelace"`, false},
+		{`id eq "7"`, true},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`externalId eq null`, false},
+
+		// and binds tighter than or
+		{`userName eq "ada@example.com" or userName eq "nobody" and active eq false`, true},
+		{`(userName eq "ada@example.com" or userName eq "nobody") and active eq false`, false},
+		{`active eq false and userName eq "nobody" or id eq "7"`, true},
+		{`active eq false and (userName eq "nobody" or id eq "7")`, false},
+
+		{`not (active eq true)`, false},
+		{`not (userName eq "nobody")`, true},
+		{`not (userName eq "nobody") and not (active eq false)`, true},
+		{`not (userName eq "nobody" or id eq "7")`, false},
+
+		// Value paths test each element on its own
+		{`emails[type eq "work" and value co "example.com"]`, true},
+		{`emails[type eq "home" and primary eq true]`, false},
+		{`emails[type eq "home"] and groups[display eq "admins"]`, true},
+		{`emails.value ew "home.example"`, true},
+		{`emails.type eq "other"`, false},
+		{`name.familyName eq "lovelace"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "analytics"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "ada@example.com"`, true},
+		{`name pr`, true},
+		{`title pr`, false},
+		{`externalId pr`, false},
+	}
+	for _, test := range tests {
+		filter, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%s): %v", test.filter, err)
+			continue
+		}
+		if got := filter.Matches(ada()); got != test.want {
+			t.Errorf("%s matches = %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestParseFilterPrecedence(t *testing.T) {
+	filter, err := ParseFilter(`a eq 1 or b eq 2 and not (c pr) or d eq "x"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTo := func(name string, value interface{}) compareFilter {
+		return compareFilter{Path: attrPath{Name: name}, Op: "eq", Value: value}
+	}
+	want := logicalFilter{
+		Left: logicalFilter{
+			Left: compareTo("a", 1.0),
+			Right: logicalFilter{
+				And:   true,
+				Left:  compareTo("b", 2.0),
+				Right: notFilter{Filter: compareFilter{Path: attrPath{Name: "c"}, Op: "pr"}},
+			},
+		},
+		Right: compareTo("d", "x"),
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("parsed %+v\nwant %+v", filter, want)
+	}
+}
+
+func TestParseFilterRejectsBadInput(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName eq "unterminated`,
+		`userName eq "bad \q escape"`,
+		`userName xx "ada"`,
+		`userName eq ada`,
+		`userName eq 12abc`,
+		`(userName eq "ada"`,
+		`userName eq "ada")`,
+		`userName eq "ada" and`,
+		`and userName eq "ada"`,
+		`not userName eq "ada"`,
+		`emails[type eq "work"`,
+		`emails[]`,
+		`name.given.name eq "Ada"`,
+		`"userName" eq "ada"`,
+	} {
+		if _, err := ParseFilter(filter); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseFilter(%s) err = %v, want ErrInvalidFilter", filter, err)
+		}
+	}
+}
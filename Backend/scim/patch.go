@@ -0,0 +1,357 @@
+package scim
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// PATCH errors, named after the SCIM error types they are reported as
+var (
+	ErrInvalidPath = errors.New("invalid path")
+	ErrNoTarget    = errors.New("the path matches no value")
+)
+
+// PatchRequest is the body of a PATCH request (RFC 7644 section 3.5.2)
+type PatchRequest struct {
+	Schemas    []string    `json:"schemas"`
+	Operations []Operation `json:"Operations"`
+}
+
+// Operation is one add, replace or remove operation of a PATCH request
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// Patch applies the operations, in order, to a resource in place
+func Patch(resource map[string]interface{}, operations []Operation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(strings.TrimSpace(operation.Op))
+		switch op {
+		case "add", "replace", "remove":
+		default:
+			return fmt.Errorf("%w: unknown op %q", ErrInvalidValue, operation.Op)
+		}
+
+		if strings.TrimSpace(operation.Path) != "" {
+			if err := patchPath(resource, op, strings.TrimSpace(operation.Path), operation.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Without a path the value holds the attributes to change
+		if op == "remove" {
+			return fmt.Errorf("%w: remove needs a path", ErrNoTarget)
+		}
+		values, ok := operation.Value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: a value object is required without a path", ErrInvalidValue)
+		}
+		for key, value := range values {
+			if err := patchPath(resource, op, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// patchPath applies one operation at a path such as members,
+// name.givenName, emails[type eq "work"].value or an extension attribute
+func patchPath(resource map[string]interface{}, op, path string, value interface{}) error {
+	target, filter, err := parsePatchPath(path)
+	if err != nil {
+		return err
+	}
+
+	// A bare extension URN addresses the whole extension
+	if target.Name == "" {
+		if op == "remove" {
+			delete(resource, keyFor(resource, target.Schema))
+			return nil
+		}
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: %s needs an object", ErrInvalidValue, target.Schema)
+		}
+		for key, value := range values {
+			if err := patchPath(resource, op, target.Schema+":"+key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	container := resource
+	if target.Schema != "" {
+		key := keyFor(resource, target.Schema)
+		extension, ok := resource[key].(map[string]interface{})
+		if !ok {
+			if op == "remove" {
+				return nil
+			}
+			extension = map[string]interface{}{}
+			resource[key] = extension
+		}
+		container = extension
+	}
+	key := keyFor(container, target.Name)
+
+	if filter != nil {
+		return patchFiltered(container, key, op, filter, target.Sub, value)
+	}
+
+	if target.Sub != "" {
+		switch current := container[key].(type) {
+		case []interface{}:
+			for _, element := range current {
+				if object, ok := element.(map[string]interface{}); ok {
+					setSub(object, op, target.Sub, value)
+				}
+			}
+		case map[string]interface{}:
+			setSub(current, op, target.Sub, value)
+		default:
+			if op != "remove" {
+				container[key] = map[string]interface{}{target.Sub: value}
+			}
+		}
+		return nil
+	}
+
+	switch op {
+	case "remove":
+		// Some identity providers name the members to remove in the value
+		// rather than in a filter
+		if current, ok := container[key].([]interface{}); ok && value != nil {
+			container[key] = removeValues(current, value)
+			return nil
+		}
+		delete(container, key)
+	case "add":
+		switch current := container[key].(type) {
+		case []interface{}:
+			container[key] = appendValues(current, value)
+		case map[string]interface{}:
+			if values, ok := value.(map[string]interface{}); ok {
+				for sub, subValue := range values {
+					current[keyFor(current, sub)] = subValue
+				}
+				return nil
+			}
+			container[key] = value
+		default:
+			container[key] = value
+		}
+	case "replace":
+		current, isObject := container[key].(map[string]interface{})
+		values, valueIsObject := value.(map[string]interface{})
+		if isObject && valueIsObject {
+			for sub, subValue := range values {
+				current[keyFor(current, sub)] = subValue
+			}
+			return nil
+		}
+		container[key] = value
+	}
+	return nil
+}
+
+// patchFiltered applies an operation to the elements of a multi-valued
+// attribute that match a filter
+func patchFiltered(container map[string]interface{}, key, op string, filter Filter, sub string, value interface{}) error {
+	current, _ := container[key].([]interface{})
+	kept := make([]interface{}, 0, len(current))
+	matched := false
+	for _, element := range current {
+		object, ok := element.(map[string]interface{})
+		if !ok || !filter.Matches(object) {
+			kept = append(kept, element)
+			continue
+		}
+		matched = true
+
+		switch {
+		case sub != "":
+			setSub(object, op, sub, value)
+		case op == "remove":
+			continue
+		case op == "replace" && !isObject(value):
+			element = value
+		default:
+			values, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%w: %s needs an object", ErrInvalidValue, key)
+			}
+			for name, subValue := range values {
+				object[keyFor(object, name)] = subValue
+			}
+		}
+		kept = append(kept, element)
+	}
+
+	if !matched {
+		if op == "remove" {
+			return nil
+		}
+		// Adding to an element that is not there yet creates it, as in
+		// emails[type eq "work"].value when there is no work email
+		element, ok := newElement(filter)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNoTarget, key)
+		}
+		if sub != "" {
+			element[sub] = value
+		} else if values, ok := value.(map[string]interface{}); ok {
+			for name, subValue := range values {
+				element[name] = subValue
+			}
+		}
+		kept = append(kept, element)
+	}
+	container[key] = kept
+	return nil
+}
+
+// newElement builds the element a filter of equality tests describes
+func newElement(filter Filter) (map[string]interface{}, bool) {
+	switch filter := filter.(type) {
+	case compareFilter:
+		if filter.Op != "eq" || filter.Path.Sub != "" || filter.Path.Schema != "" {
+			return nil, false
+		}
+		return map[string]interface{}{filter.Path.Name: filter.Value}, true
+	case logicalFilter:
+		if !filter.And {
+			return nil, false
+		}
+		left, ok := newElement(filter.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := newElement(filter.Right)
+		if !ok {
+			return nil, false
+		}
+		for name, value := range right {
+			left[name] = value
+		}
+		return left, true
+	}
+	return nil, false
+}
+
+// parsePatchPath splits a PATCH path into the attribute it addresses, an
+// optional filter over its elements and an optional sub-attribute
+func parsePatchPath(path string) (attrPath, Filter, error) {
+	open := strings.Index(path, "[")
+	if open < 0 {
+		target, err := parseAttrPath(path)
+		if err != nil {
+			return target, nil, fmt.Errorf("%w: %s", ErrInvalidPath, path)
+		}
+		return target, nil, nil
+	}
+
+	closing := strings.LastIndex(path, "]")
+	if closing < open {
+		return attrPath{}, nil, fmt.Errorf("%w: %s", ErrInvalidPath, path)
+	}
+	target, err := parseAttrPath(path[:open])
+	if err != nil || target.Sub != "" || target.Name == "" {
+		return target, nil, fmt.Errorf("%w: %s", ErrInvalidPath, path)
+	}
+	filter, err := ParseFilter(path[open+1 : closing])
+	if err != nil {
+		return target, nil, fmt.Errorf("%w: %s", ErrInvalidPath, path)
+	}
+
+	rest := path[closing+1:]
+	if rest != "" {
+		sub, ok := strings.CutPrefix(rest, ".")
+		if !ok || sub == "" || strings.Contains(sub, ".") {
+			return target, nil, fmt.Errorf("%w: %s", ErrInvalidPath, path)
+		}
+		target.Sub = sub
+	}
+	return target, filter, nil
+}
+
+// setSub sets or removes a sub-attribute of a complex value
+func setSub(object map[string]interface{}, op, sub string, value interface{}) {
+	if op == "remove" {
+		delete(object, keyFor(object, sub))
+		return
+	}
+	object[keyFor(object, sub)] = value
+}
+
+// appendValues adds values to a multi-valued attribute, skipping those
+// already present
+func appendValues(current []interface{}, value interface{}) []interface{} {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, value := range values {
+		if indexOf(current, value) < 0 {
+			current = append(current, value)
+		}
+	}
+	return current
+}
+
+// removeValues drops the listed values from a multi-valued attribute
+func removeValues(current []interface{}, value interface{}) []interface{} {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	kept := []interface{}{}
+	for _, element := range current {
+		if indexOf(values, element) < 0 {
+			kept = append(kept, element)
+		}
+	}
+	return kept
+}
+
+// indexOf finds a value in a list. Complex values with a "value"
+// sub-attribute are the same when their values are.
+func indexOf(list []interface{}, value interface{}) int {
+	for i, element := range list {
+		if reflect.DeepEqual(element, value) {
+			return i
+		}
+		left, leftOK := element.(map[string]interface{})
+		right, rightOK := value.(map[string]interface{})
+		if leftOK && rightOK && lookup(left, "value") != nil &&
+			fmt.Sprint(lookup(left, "value")) == fmt.Sprint(lookup(right, "value")) {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyFor returns the existing key matching a name case-insensitively, or
+// the name itself
+func keyFor(object map[string]interface{}, name string) string {
+	if _, ok := object[name]; ok {
+		return name
+	}
+	for key := range object {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+func isObject(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
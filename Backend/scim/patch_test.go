@@ -0,0 +1,126 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []Operation
+		check      func(resource map[string]interface{}) bool
+	}{
+		{
+			name:       "replace a path",
+			operations: []Operation{{Op: "Replace", Path: "active", Value: false}},
+			check:      func(r map[string]interface{}) bool { return r["active"] == false },
+		},
+		{
+			name:       "replace without a path merges objects",
+			operations: []Operation{{Op: "replace", Value: map[string]interface{}{"name": map[string]interface{}{"givenName": "Augusta"}}}},
+			check: func(r map[string]interface{}) bool {
+				name := r["name"].(map[string]interface{})
+				return name["givenName"] == "Augusta" && name["familyName"] == "Lovelace"
+			},
+		},
+		{
+			name: "add skips values already present",
+			operations: []Operation{{Op: "add", Path: "groups", Value: []interface{}{
+				map[string]interface{}{"value": "5"},
+				map[string]interface{}{"value": "9"},
+			}}},
+			check: func(r map[string]interface{}) bool { return len(r["groups"].([]interface{})) == 3 },
+		},
+		{
+			name:       "replace a sub-attribute of filtered elements",
+			operations: []Operation{{Op: "replace", Path: `emails[type eq "work"].value`, Value: "ada@analytics.example"}},
+			check: func(r map[string]interface{}) bool {
+				emails := r["emails"].([]interface{})
+				return len(emails) == 2 && lookup(emails[0].(map[string]interface{}), "value") == "ada@analytics.example" &&
+					lookup(emails[1].(map[string]interface{}), "value") == "ada@home.example"
+			},
+		},
+		{
+			name:       "add through a filter creates the element",
+			operations: []Operation{{Op: "add", Path: `emails[type eq "other"].value`, Value: "ada@other.example"}},
+			check: func(r map[string]interface{}) bool {
+				emails := r["emails"].([]interface{})
+				return len(emails) == 3 && reflect.DeepEqual(emails[2], map[string]interface{}{"type": "other", "value": "ada@other.example"})
+			},
+		},
+		{
+			name:       "remove filtered elements",
+			operations: []Operation{{Op: "remove", Path: `emails[type eq "home"]`}},
+			check: func(r map[string]interface{}) bool {
+				emails := r["emails"].([]interface{})
+				return len(emails) == 1 && lookup(emails[0].(map[string]interface{}), "type") == "work"
+			},
+		},
+		{
+			name:       "remove members named in the value",
+			operations: []Operation{{Op: "remove", Path: "groups", Value: []interface{}{map[string]interface{}{"value": "2"}}}},
+			check: func(r map[string]interface{}) bool {
+				groups := r["groups"].([]interface{})
+				return len(groups) == 1 && lookup(groups[0].(map[string]interface{}), "value") == "5"
+			},
+		},
+		{
+			name:       "remove a sub-attribute",
+			operations: []Operation{{Op: "remove", Path: "name.givenName"}},
+			check: func(r map[string]interface{}) bool {
+				name := r["name"].(map[string]interface{})
+				return name["givenName"] == nil && name["familyName"] == "Lovelace"
+			},
+		},
+		{
+			name:       "replace an extension attribute",
+			operations: []Operation{{Op: "replace", Path: EnterpriseUserSchema + ":department", Value: "Research"}},
+			check: func(r map[string]interface{}) bool {
+				return r[EnterpriseUserSchema].(map[string]interface{})["department"] == "Research"
+			},
+		},
+		{
+			name: "operations apply in order",
+			operations: []Operation{
+				{Op: "remove", Path: "emails"},
+				{Op: "add", Path: `emails[type eq "work"].value`, Value: "ada@new.example"},
+			},
+			check: func(r map[string]interface{}) bool {
+				return reflect.DeepEqual(r["emails"], []interface{}{map[string]interface{}{"type": "work", "value": "ada@new.example"}})
+			},
+		},
+	}
+	for _, test := range tests {
+		resource := ada()
+		if err := Patch(resource, test.operations); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !test.check(resource) {
+			t.Errorf("%s: patched to %+v", test.name, resource)
+		}
+	}
+}
+
+func TestPatchRejectsBadOperations(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation Operation
+		want      error
+	}{
+		{"unknown op", Operation{Op: "move", Path: "active", Value: true}, ErrInvalidValue},
+		{"remove without a path", Operation{Op: "remove"}, ErrNoTarget},
+		{"no path and no object", Operation{Op: "replace", Value: "Ada"}, ErrInvalidValue},
+		{"bad path", Operation{Op: "replace", Path: "name.given.name", Value: "Ada"}, ErrInvalidPath},
+		{"bad filter", Operation{Op: "replace", Path: `emails[type eq].value`, Value: "x"}, ErrInvalidPath},
+		{"unclosed filter", Operation{Op: "replace", Path: `emails[type eq "work".value`, Value: "x"}, ErrInvalidPath},
+		{"filter that cannot create an element", Operation{Op: "add", Path: `emails[type ne "work" and type ne "home"].value`, Value: "x"}, ErrNoTarget},
+	}
+	for _, test := range tests {
+		if err := Patch(ada(), []Operation{test.operation}); !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package scim
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/audit"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/passwords"
+	"JWT-Authentication-go/policy"
+	"JWT-Authentication-go/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Provider names the identity links holding the identity provider's
+// externalId for a user
+const Provider = "scim"
+
+// Provisioning errors
+var (
+	ErrNotFound   = errors.New("resource not found")
+	ErrUniqueness = errors.New("the resource already exists")
+	ErrLastAdmin  = errors.New("the change would leave no active admin")
+)
+
+// Users returns one page of the users matching filter, which may be nil,
+// with the number of matches. startIndex is 1-based. Filters on userName and
+// externalId are answered and paged by the database; other filters are
+// applied to the users the database narrows them down to.
+func Users(db *gorm.DB, filter Filter, startIndex, count int) ([]map[string]interface{}, int, error) {
+	condition, args, exact := "", []interface{}(nil), true
+	if filter != nil {
+		condition, args, exact = userCondition(db, filter)
+	}
+	query := func() *gorm.DB {
+		query := db.Model(&models.User{})
+		if condition != "" {
+			query = query.Where(condition, args...)
+		}
+		return query
+	}
+
+	if !exact {
+		var users []models.User
+		if err := query().Order("id").Find(&users).Error; err != nil {
+			return nil, 0, err
+		}
+		resources, err := userResources(db, users)
+		if err != nil {
+			return nil, 0, err
+		}
+		page, total := Page(Select(resources, filter), startIndex, count)
+		return page, total, nil
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	users := []models.User{}
+	if count > 0 {
+		if err := query().Order("id").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	resources, err := userResources(db, users)
+	return resources, int(total), err
+}
+
+// userCondition translates a filter into a condition on users. exact is
+// false when the condition only narrows the users down and the filter must
+// still be applied to their resources; an empty condition narrows nothing.
+func userCondition(db *gorm.DB, filter Filter) (string, []interface{}, bool) {
+	switch f := filter.(type) {
+	case compareFilter:
+		value, ok := f.Value.(string)
+		if !ok || f.Op != "eq" || f.Path.Schema != "" || f.Path.Sub != "" {
+			return "", nil, false
+		}
+		// Strings compare case-insensitively, as in Matches
+		switch strings.ToLower(f.Path.Name) {
+		case "username":
+			return "LOWER(email) = ?", []interface{}{strings.ToLower(value)}, true
+		case "externalid":
+			linked := db.Model(&models.UserIdentity{}).Select("user_id").
+				Where("provider = ? AND LOWER(subject) = ?", Provider, strings.ToLower(value))
+			return "id IN (?)", []interface{}{linked}, true
+		}
+	case logicalFilter:
+		left, leftArgs, leftExact := userCondition(db, f.Left)
+		right, rightArgs, rightExact := userCondition(db, f.Right)
+		switch {
+		case left != "" && right != "":
+			operator := " OR "
+			if f.And {
+				operator = " AND "
+			}
+			return "(" + left + ")" + operator + "(" + right + ")", append(leftArgs, rightArgs...), leftExact && rightExact
+		// Either side of an and narrows the users down
+		case f.And && left != "":
+			return left, leftArgs, false
+		case f.And && right != "":
+			return right, rightArgs, false
+		}
+	}
+	return "", nil, false
+}
+
+// User returns a user and its SCIM resource
+func User(db *gorm.DB, id string) (models.User, map[string]interface{}, error) {
+	var user models.User
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
+		return user, nil, ErrNotFound
+	}
+	resources, err := userResources(db, []models.User{user})
+	if err != nil {
+		return user, nil, err
+	}
+	return user, resources[0], nil
+}
+
+// userResources builds the resources of several users with one query for
+// their external IDs and one for the groups
+func userResources(db *gorm.DB, users []models.User) ([]map[string]interface{}, error) {
+	ids := make([]uint, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	var links []models.UserIdentity
+	if err := db.Where("provider = ? AND user_id IN ?", Provider, ids).Find(&links).Error; err != nil {
+		return nil, err
+	}
+	externalIDs := map[uint]string{}
+	for _, link := range links {
+		externalIDs[link.UserID] = link.Subject
+	}
+
+	var groups []models.SCIMGroup
+	if err := db.Order("display_name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	resources := make([]map[string]interface{}, 0, len(users))
+	for _, user := range users {
+		memberOf := []models.SCIMGroup{}
+		for _, group := range groups {
+			if isMember(group, user) {
+				memberOf = append(memberOf, group)
+			}
+		}
+		resources = append(resources, UserResource(user, externalIDs[user.ID], memberOf))
+	}
+	return resources, nil
+}
+
+// isMember reports whether a user belongs to a group
+func isMember(group models.SCIMGroup, user models.User) bool {
+	if group.Role != "" {
+		return user.Role == group.Role
+	}
+	return group.Department != "" && strings.EqualFold(user.Department, group.Department)
+}
+
+// CreateUser provisions a user. The identity provider vouches for the email
+// address; without a password in the request nobody knows the password and
+// the user signs in through single sign-on.
+func CreateUser(db *gorm.DB, c *fiber.Ctx, input UserInput) (models.User, error) {
+	now := time.Now().Unix()
+	user := models.User{
+		Name:            input.Name,
+		Email:           strings.ToLower(input.Email),
+		Role:            input.Role,
+		Department:      input.Department,
+		CreatedAt:       now,
+		EmailVerifiedAt: now,
+		IsActive:        true,
+	}
+	if user.Name == "" {
+		user.Name = strings.SplitN(user.Email, "@", 2)[0]
+	}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+
+	var existing models.User
+	if db.Where("email = ?", user.Email).First(&existing).Error == nil {
+		return user, ErrUniqueness
+	}
+
+	// Without a password the user signs in through the identity provider
+	if input.Password != "" {
+		if err := policy.CheckPassword(db, user, input.Password); err != nil {
+			return user, err
+		}
+		hash, err := passwords.Hash(input.Password)
+		if err != nil {
+			return user, err
+		}
+		user.Password = hash
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// The column defaults to active, so a disabled user is created first
+		if !input.Active {
+			user.IsActive = false
+			if err := tx.Model(&user).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+		if err := linkExternalID(tx, user, input.ExternalID); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "user.scim_create", "user", user.ID, nil, user)
+	})
+	return user, err
+}
+
+// UpdateUser replaces a user's attributes with those of a resource.
+// Deactivated users are signed out everywhere.
+func UpdateUser(db *gorm.DB, c *fiber.Ctx, user models.User, input UserInput) (models.User, error) {
+	before := user
+
+	email := strings.ToLower(input.Email)
+	if email != user.Email {
+		var existing models.User
+		if db.Where("email = ? AND id <> ?", email, user.ID).First(&existing).Error == nil {
+			return user, ErrUniqueness
+		}
+		user.Email = email
+		user.EmailVerifiedAt = time.Now().Unix()
+	}
+	if input.Name != "" {
+		user.Name = input.Name
+	}
+	user.Department = input.Department
+	if input.Role != "" {
+		user.Role = input.Role
+	}
+	user.IsActive = input.Active
+
+	var previousPassword []byte
+	if input.Password != "" {
+		if err := policy.CheckPassword(db, user, input.Password); err != nil {
+			return before, err
+		}
+		hash, err := passwords.Hash(input.Password)
+		if err != nil {
+			return before, err
+		}
+		previousPassword = user.Password
+		user.Password = hash
+		user.MustChangePassword = false
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if previousPassword != nil {
+			if err := policy.RememberPassword(tx, user.ID, previousPassword); err != nil {
+				return err
+			}
+		}
+		if err := linkExternalID(tx, user, input.ExternalID); err != nil {
+			return err
+		}
+		if err := requireAdmin(tx); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "user.scim_update", "user", user.ID, before, user)
+	})
+	if err != nil {
+		return before, err
+	}
+
+	if before.IsActive && !user.IsActive {
+		utils.RevokeUserSessions(user.ID)
+	}
+	return user, nil
+}
+
+// DeleteUser erases a user the identity provider deprovisioned
+func DeleteUser(db *gorm.DB, c *fiber.Ctx, user models.User) error {
+	if user.Role == "admin" && user.IsActive {
+		var admins int64
+		if err := db.Model(&models.User{}).Where("role = ? AND is_active = ?", "admin", true).Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+	return accounts.Erase(db, c, user, accounts.ReasonProvisioning)
+}
+
+// linkExternalID records the identity provider's ID for a user, replacing
+// any earlier one
+func linkExternalID(tx *gorm.DB, user models.User, externalID string) error {
+	var link models.UserIdentity
+	found := tx.Where("provider = ? AND user_id = ?", Provider, user.ID).First(&link).Error == nil
+	if found && link.Subject == externalID {
+		return nil
+	}
+	if found {
+		if err := tx.Delete(&link).Error; err != nil {
+			return err
+		}
+	}
+	if externalID == "" {
+		return nil
+	}
+
+	// Replace a link left behind by a deleted user
+	tx.Where("provider = ? AND subject = ?", Provider, externalID).Delete(&models.UserIdentity{})
+	return tx.Create(&models.UserIdentity{
+		UserID:    user.ID,
+		Provider:  Provider,
+		Subject:   externalID,
+		Email:     user.Email,
+		CreatedAt: time.Now().Unix(),
+	}).Error
+}
+
+// requireAdmin refuses a change that leaves nobody able to administer the
+// server
+func requireAdmin(tx *gorm.DB) error {
+	var admins int64
+	if err := tx.Model(&models.User{}).Where("role = ? AND is_active = ?", "admin", true).Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// Groups returns every group as a SCIM resource
+func Groups(db *gorm.DB) ([]map[string]interface{}, error) {
+	var groups []models.SCIMGroup
+	if err := db.Order("id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	resources := make([]map[string]interface{}, 0, len(groups))
+	for _, group := range groups {
+		members := []models.User{}
+		for _, user := range users {
+			if isMember(group, user) {
+				members = append(members, user)
+			}
+		}
+		resources = append(resources, GroupResource(group, members))
+	}
+	return resources, nil
+}
+
+// Group returns a group and its SCIM resource
+func Group(db *gorm.DB, id string) (models.SCIMGroup, map[string]interface{}, error) {
+	var group models.SCIMGroup
+	if err := db.First(&group, "id = ?", id).Error; err != nil {
+		return group, nil, ErrNotFound
+	}
+	members, err := groupMembers(db, group)
+	if err != nil {
+		return group, nil, err
+	}
+	return group, GroupResource(group, members), nil
+}
+
+// groupMembers returns the users in a group
+func groupMembers(db *gorm.DB, group models.SCIMGroup) ([]models.User, error) {
+	members := []models.User{}
+	query := db.Order("id")
+	if group.Role != "" {
+		query = query.Where("role = ?", group.Role)
+	} else {
+		query = query.Where("department = ?", group.Department)
+	}
+	return members, query.Find(&members).Error
+}
+
+// CreateGroup provisions a group. The admin group makes its members admins;
+// any other group is a department its members are moved to.
+func CreateGroup(db *gorm.DB, c *fiber.Ctx, input GroupInput) (models.SCIMGroup, error) {
+	now := time.Now().Unix()
+	group := models.SCIMGroup{
+		DisplayName: input.DisplayName,
+		ExternalID:  input.ExternalID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if IsAdminGroup(group.DisplayName) {
+		group.Role = "admin"
+	} else {
+		group.Department = group.DisplayName
+	}
+
+	var existing models.SCIMGroup
+	if db.Where("display_name = ?", group.DisplayName).First(&existing).Error == nil {
+		return group, ErrUniqueness
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		// Users already in the department stay in it
+		if err := addMembers(tx, c, group, input.MemberIDs); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "scim_group.create", "scim_group", group.ID, nil, group)
+	})
+	return group, err
+}
+
+// UpdateGroup replaces a group's name and members with those of a resource.
+// Renaming a department group renames the department of its members.
+func UpdateGroup(db *gorm.DB, c *fiber.Ctx, group models.SCIMGroup, input GroupInput) (models.SCIMGroup, error) {
+	before := group
+
+	if IsAdminGroup(input.DisplayName) != (group.Role == "admin") {
+		return group, fmt.Errorf("%w: the admin group and department groups cannot be renamed into each other", ErrInvalidValue)
+	}
+	if input.DisplayName != group.DisplayName {
+		var existing models.SCIMGroup
+		if db.Where("display_name = ? AND id <> ?", input.DisplayName, group.ID).First(&existing).Error == nil {
+			return group, ErrUniqueness
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		current, err := groupMembers(tx, group)
+		if err != nil {
+			return err
+		}
+
+		if group.Role == "" && input.DisplayName != group.DisplayName {
+			if err := tx.Model(&models.User{}).Where("department = ?", group.Department).
+				Update("department", input.DisplayName).Error; err != nil {
+				return err
+			}
+			group.Department = input.DisplayName
+		}
+		group.DisplayName = input.DisplayName
+		group.ExternalID = input.ExternalID
+		group.UpdatedAt = time.Now().Unix()
+		if err := tx.Save(&group).Error; err != nil {
+			return err
+		}
+
+		wanted := map[uint]bool{}
+		for _, id := range input.MemberIDs {
+			wanted[id] = true
+		}
+		removed := []uint{}
+		for _, member := range current {
+			if !wanted[member.ID] {
+				removed = append(removed, member.ID)
+			}
+		}
+		if err := removeMembers(tx, c, group, removed); err != nil {
+			return err
+		}
+		if err := addMembers(tx, c, group, input.MemberIDs); err != nil {
+			return err
+		}
+		if err := requireAdmin(tx); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "scim_group.update", "scim_group", group.ID, before, group)
+	})
+	if err != nil {
+		return before, err
+	}
+	return group, nil
+}
+
+// DeleteGroup removes a group; its members lose its role or department
+func DeleteGroup(db *gorm.DB, c *fiber.Ctx, group models.SCIMGroup) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		members, err := groupMembers(tx, group)
+		if err != nil {
+			return err
+		}
+		ids := make([]uint, 0, len(members))
+		for _, member := range members {
+			ids = append(ids, member.ID)
+		}
+		if err := removeMembers(tx, c, group, ids); err != nil {
+			return err
+		}
+		if err := tx.Delete(&group).Error; err != nil {
+			return err
+		}
+		if err := requireAdmin(tx); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, "scim_group.delete", "scim_group", group.ID, group, nil)
+	})
+}
+
+// addMembers gives users the group's role or department
+func addMembers(tx *gorm.DB, c *fiber.Ctx, group models.SCIMGroup, ids []uint) error {
+	for _, id := range ids {
+		var user models.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return fmt.Errorf("%w: user %d does not exist", ErrInvalidValue, id)
+		}
+		if isMember(group, user) {
+			continue
+		}
+		if err := setMembership(tx, c, user, group, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMembers takes the group's role or department away from users
+func removeMembers(tx *gorm.DB, c *fiber.Ctx, group models.SCIMGroup, ids []uint) error {
+	for _, id := range ids {
+		var user models.User
+		if err := tx.First(&user, id).Error; err != nil {
+			continue
+		}
+		if !isMember(group, user) {
+			continue
+		}
+		if err := setMembership(tx, c, user, group, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setMembership adds a user to a group or removes them from it
+func setMembership(tx *gorm.DB, c *fiber.Ctx, user models.User, group models.SCIMGroup, member bool) error {
+	before := user
+	switch {
+	case group.Role != "" && member:
+		user.Role = group.Role
+	case group.Role != "":
+		user.Role = "user"
+	case member:
+		user.Department = group.Department
+	default:
+		user.Department = ""
+	}
+	if err := tx.Save(&user).Error; err != nil {
+		return err
+	}
+	return audit.Record(tx, c, "user.scim_update", "user", user.ID, before, user)
+}
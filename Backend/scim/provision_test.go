@@ -0,0 +1,97 @@
+package scim
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestUsers(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Ada", "Bob", "Cy", "Dee", "Eve"} {
+		user := models.User{Name: name, Email: fmt.Sprintf("%s@Acme.com", name), Role: "user"}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := linkExternalID(db, user, fmt.Sprintf("ext-%s", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&models.User{}).Where("name = ?", "Dee").Update("is_active", false)
+	// Another provider's subject is not an externalId
+	db.Create(&models.UserIdentity{UserID: 1, Provider: "oidc:acme", Subject: "ext-Bob"})
+
+	tests := []struct {
+		filter            string
+		startIndex, count int
+		want              []string
+		total             int
+	}{
+		{"", 1, 10, []string{"Ada", "Bob", "Cy", "Dee", "Eve"}, 5},
+		{"", 2, 2, []string{"Bob", "Cy"}, 5},
+		{"", 6, 2, []string{}, 5},
+		{"", 1, 0, []string{}, 5},
+		{`userName eq "ada@acme.com"`, 1, 10, []string{"Ada"}, 1},
+		{`userName eq "nobody@acme.com"`, 1, 10, []string{}, 0},
+		{`externalId eq "EXT-BOB"`, 1, 10, []string{"Bob"}, 1},
+		{`userName eq "ada@acme.com" or externalId eq "ext-Eve"`, 1, 10, []string{"Ada", "Eve"}, 2},
+		{`userName eq "ada@acme.com" or externalId eq "ext-Eve"`, 2, 10, []string{"Eve"}, 2},
+		{`userName eq "ada@acme.com" and externalId eq "ext-Ada"`, 1, 10, []string{"Ada"}, 1},
+		{`userName eq "ada@acme.com" and externalId eq "ext-Bob"`, 1, 10, []string{}, 0},
+		// Only part of these can be asked of the database
+		{`userName eq "dee@acme.com" and active eq true`, 1, 10, []string{}, 0},
+		{`externalId eq "ext-Dee" and active eq false`, 1, 10, []string{"Dee"}, 1},
+		{`userName eq "ada@acme.com" or active eq false`, 1, 10, []string{"Ada", "Dee"}, 2},
+		{`active eq true`, 2, 2, []string{"Bob", "Cy"}, 4},
+		{`active eq true`, 1, 0, []string{}, 4},
+		{`not (userName eq "ada@acme.com")`, 1, 10, []string{"Bob", "Cy", "Dee", "Eve"}, 4},
+	}
+	for _, test := range tests {
+		var filter Filter
+		if test.filter != "" {
+			if filter, err = ParseFilter(test.filter); err != nil {
+				t.Fatal(err)
+			}
+		}
+		resources, total, err := Users(db, filter, test.startIndex, test.count)
+		if err != nil {
+			t.Errorf("%s: %v", test.filter, err)
+			continue
+		}
+		names := []string{}
+		for _, resource := range resources {
+			names = append(names, resource["displayName"].(string))
+		}
+		if !reflect.DeepEqual(names, test.want) || total != test.total {
+			t.Errorf("%q from %d, %d: got %v of %d, want %v of %d",
+				test.filter, test.startIndex, test.count, names, total, test.want, test.total)
+		}
+	}
+
+	// userName and externalId tests are answered by the database alone
+	for _, text := range []string{
+		`userName eq "ada@acme.com"`,
+		`externalId eq "ext-Ada"`,
+		`USERNAME eq "ada@acme.com" or externalid eq "ext-Bob"`,
+	} {
+		filter, _ := ParseFilter(text)
+		if condition, _, exact := userCondition(db, filter); condition == "" || !exact {
+			t.Errorf("%s: condition %q, exact %v", text, condition, exact)
+		}
+	}
+}
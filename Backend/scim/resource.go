@@ -0,0 +1,381 @@
+package scim
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema URNs of the resources and messages this server speaks
+const (
+	UserSchema           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	EnterpriseUserSchema = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	GroupSchema          = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ListResponseSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema          = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// ErrInvalidValue means a resource sent by the identity provider is unusable
+var ErrInvalidValue = errors.New("invalid value")
+
+// isSchema reports whether a URN names one of the supported schemas
+func isSchema(urn string) bool {
+	switch strings.ToLower(urn) {
+	case strings.ToLower(UserSchema), strings.ToLower(EnterpriseUserSchema), strings.ToLower(GroupSchema):
+		return true
+	}
+	return false
+}
+
+// isCoreSchema reports whether a URN names a core schema, whose attributes
+// sit at the top level of a resource
+func isCoreSchema(urn string) bool {
+	return strings.EqualFold(urn, UserSchema) || strings.EqualFold(urn, GroupSchema)
+}
+
+// BaseURL is where the SCIM API is served
+func BaseURL() string {
+	return strings.TrimSuffix(config.APIBaseURL, "/") + "/scim/v2"
+}
+
+// IsAdminGroup reports whether a group name is the configured admin group
+func IsAdminGroup(displayName string) bool {
+	return strings.EqualFold(strings.TrimSpace(displayName), strings.TrimSpace(config.SCIMAdminGroup))
+}
+
+// UserResource represents a user as a SCIM User. externalID is the
+// identity provider's own ID for the user and groups are those the user
+// belongs to.
+func UserResource(user models.User, externalID string, groups []models.SCIMGroup) map[string]interface{} {
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	givenName, familyName, _ := strings.Cut(strings.TrimSpace(user.Name), " ")
+
+	memberOf := []interface{}{}
+	for _, group := range groups {
+		groupID := strconv.FormatUint(uint64(group.ID), 10)
+		memberOf = append(memberOf, map[string]interface{}{
+			"value":   groupID,
+			"display": group.DisplayName,
+			"$ref":    BaseURL() + "/Groups/" + groupID,
+		})
+	}
+
+	resource := map[string]interface{}{
+		"schemas":  []interface{}{UserSchema, EnterpriseUserSchema},
+		"id":       id,
+		"userName": user.Email,
+		"name": map[string]interface{}{
+			"formatted":  user.Name,
+			"givenName":  givenName,
+			"familyName": familyName,
+		},
+		"displayName": user.Name,
+		"emails": []interface{}{
+			map[string]interface{}{"value": user.Email, "type": "work", "primary": true},
+		},
+		"active": user.IsActive,
+		"roles": []interface{}{
+			map[string]interface{}{"value": user.Role, "primary": true},
+		},
+		"groups": memberOf,
+		EnterpriseUserSchema: map[string]interface{}{
+			"department": user.Department,
+		},
+	}
+	if externalID != "" {
+		resource["externalId"] = externalID
+	}
+	return withMeta(resource, "User", user.CreatedAt, BaseURL()+"/Users/"+id)
+}
+
+// GroupResource represents a group as a SCIM Group with its members
+func GroupResource(group models.SCIMGroup, members []models.User) map[string]interface{} {
+	id := strconv.FormatUint(uint64(group.ID), 10)
+
+	memberList := []interface{}{}
+	for _, member := range members {
+		memberID := strconv.FormatUint(uint64(member.ID), 10)
+		memberList = append(memberList, map[string]interface{}{
+			"value":   memberID,
+			"display": member.Email,
+			"type":    "User",
+			"$ref":    BaseURL() + "/Users/" + memberID,
+		})
+	}
+
+	resource := map[string]interface{}{
+		"schemas":     []interface{}{GroupSchema},
+		"id":          id,
+		"displayName": group.DisplayName,
+		"members":     memberList,
+	}
+	if group.ExternalID != "" {
+		resource["externalId"] = group.ExternalID
+	}
+	return withMeta(resource, "Group", group.CreatedAt, BaseURL()+"/Groups/"+id)
+}
+
+// withMeta adds the meta attribute, whose version is a weak ETag of the
+// rest of the resource
+func withMeta(resource map[string]interface{}, resourceType string, created int64, location string) map[string]interface{} {
+	meta := map[string]interface{}{
+		"resourceType": resourceType,
+		"location":     location,
+		"version":      ETag(resource),
+	}
+	if created > 0 {
+		meta["created"] = time.Unix(created, 0).UTC().Format(time.RFC3339)
+	}
+	resource["meta"] = meta
+	return resource
+}
+
+// ETag returns a weak entity tag for a resource, ignoring its meta
+func ETag(resource map[string]interface{}) string {
+	content := make(map[string]interface{}, len(resource))
+	for key, value := range resource {
+		if key != "meta" {
+			content[key] = value
+		}
+	}
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Version returns the ETag recorded in a resource's meta
+func Version(resource map[string]interface{}) string {
+	meta, _ := resource["meta"].(map[string]interface{})
+	version, _ := meta["version"].(string)
+	return version
+}
+
+// ETagMatches reports whether an If-Match or If-None-Match header lists the
+// resource's version. Weak and strong forms of a tag are treated alike.
+func ETagMatches(header string, resource map[string]interface{}) bool {
+	version := strings.TrimPrefix(Version(resource), "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Project keeps only the requested attributes of a resource, or drops the
+// excluded ones, as the attributes and excludedAttributes parameters ask.
+// The id, schemas and meta attributes are always returned.
+func Project(resource map[string]interface{}, attributes, excluded string) map[string]interface{} {
+	keep := attributeNames(attributes)
+	drop := attributeNames(excluded)
+	if len(keep) == 0 && len(drop) == 0 {
+		return resource
+	}
+
+	projected := map[string]interface{}{}
+	for key, value := range resource {
+		name := strings.ToLower(key)
+		switch {
+		case name == "id" || name == "schemas" || name == "meta":
+		case len(keep) > 0 && !keep[name]:
+			continue
+		case drop[name]:
+			continue
+		}
+		projected[key] = value
+	}
+	return projected
+}
+
+// attributeNames reads a comma separated attribute list, keeping the
+// top-level name of each
+func attributeNames(list string) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if path, err := parseAttrPath(name); err == nil {
+			name = path.Name
+			if path.Schema != "" {
+				name = path.Schema
+			}
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
+
+// Select returns the resources a filter matches; a nil filter matches all
+func Select(resources []map[string]interface{}, filter Filter) []map[string]interface{} {
+	if filter == nil {
+		return resources
+	}
+	matching := []map[string]interface{}{}
+	for _, resource := range resources {
+		if filter.Matches(resource) {
+			matching = append(matching, resource)
+		}
+	}
+	return matching
+}
+
+// Page returns count resources from the 1-based startIndex on, with the
+// number of resources there are in all
+func Page(resources []map[string]interface{}, startIndex, count int) ([]map[string]interface{}, int) {
+	total := len(resources)
+	start := min(startIndex-1, total)
+	end := min(start+count, total)
+	return resources[start:end], total
+}
+
+// ListResponse wraps one page of resources. startIndex is 1-based.
+func ListResponse(resources []map[string]interface{}, total, startIndex int) map[string]interface{} {
+	page := make([]interface{}, 0, len(resources))
+	for _, resource := range resources {
+		page = append(page, resource)
+	}
+	return map[string]interface{}{
+		"schemas":      []interface{}{ListResponseSchema},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(page),
+		"Resources":    page,
+	}
+}
+
+// UserInput is what a SCIM User resource asks for
+type UserInput struct {
+	Email      string
+	Name       string
+	Department string
+	Role       string // "" leaves the role alone
+	Active     bool
+	ExternalID string
+	Password   string
+}
+
+// ParseUser reads a SCIM User resource. The user name is the email address;
+// identity providers that use another kind of user name must send a
+// primary or work email.
+func ParseUser(resource map[string]interface{}) (UserInput, error) {
+	input := UserInput{Active: true}
+
+	input.Email = stringValue(lookup(resource, "userName"))
+	if !strings.Contains(input.Email, "@") {
+		input.Email = primaryEmail(resource)
+	}
+	if !strings.Contains(input.Email, "@") {
+		return input, fmt.Errorf("%w: userName or a primary email must be an email address", ErrInvalidValue)
+	}
+
+	name, _ := lookup(resource, "name").(map[string]interface{})
+	given := stringValue(lookup(name, "givenName"))
+	family := stringValue(lookup(name, "familyName"))
+	switch {
+	case given != "" || family != "":
+		input.Name = strings.TrimSpace(given + " " + family)
+	case stringValue(lookup(name, "formatted")) != "":
+		input.Name = stringValue(lookup(name, "formatted"))
+	default:
+		input.Name = stringValue(lookup(resource, "displayName"))
+	}
+
+	if enterprise, ok := lookup(resource, EnterpriseUserSchema).(map[string]interface{}); ok {
+		input.Department = stringValue(lookup(enterprise, "department"))
+	}
+
+	if active, ok := lookup(resource, "active").(bool); ok {
+		input.Active = active
+	} else if active, ok := lookup(resource, "active").(string); ok {
+		// Some identity providers send booleans as strings
+		input.Active = !strings.EqualFold(active, "false")
+	}
+
+	for _, role := range pathValues(resource, attrPath{Name: "roles", Sub: "value"}) {
+		role := strings.ToLower(stringValue(role))
+		switch role {
+		case "user", "admin":
+			if input.Role != "admin" {
+				input.Role = role
+			}
+		default:
+			return input, fmt.Errorf("%w: roles must be user or admin", ErrInvalidValue)
+		}
+	}
+
+	input.ExternalID = stringValue(lookup(resource, "externalId"))
+	input.Password = stringValue(lookup(resource, "password"))
+	return input, nil
+}
+
+// primaryEmail returns the primary email, else the work email, else the
+// first one
+func primaryEmail(resource map[string]interface{}) string {
+	emails, _ := lookup(resource, "emails").([]interface{})
+	best, bestRank := "", 0
+	for _, element := range emails {
+		email, ok := element.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rank := 1
+		if strings.EqualFold(stringValue(lookup(email, "type")), "work") {
+			rank = 2
+		}
+		if primary, _ := lookup(email, "primary").(bool); primary {
+			rank = 3
+		}
+		if rank > bestRank {
+			best, bestRank = stringValue(lookup(email, "value")), rank
+		}
+	}
+	return best
+}
+
+// GroupInput is what a SCIM Group resource asks for
+type GroupInput struct {
+	DisplayName string
+	ExternalID  string
+	MemberIDs   []uint
+}
+
+// ParseGroup reads a SCIM Group resource
+func ParseGroup(resource map[string]interface{}) (GroupInput, error) {
+	input := GroupInput{
+		DisplayName: stringValue(lookup(resource, "displayName")),
+		ExternalID:  stringValue(lookup(resource, "externalId")),
+	}
+	if input.DisplayName == "" {
+		return input, fmt.Errorf("%w: displayName is required", ErrInvalidValue)
+	}
+
+	seen := map[uint]bool{}
+	for _, value := range pathValues(resource, attrPath{Name: "members", Sub: "value"}) {
+		id, err := strconv.ParseUint(stringValue(value), 10, 64)
+		if err != nil {
+			return input, fmt.Errorf("%w: members must be user IDs", ErrInvalidValue)
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			input.MemberIDs = append(input.MemberIDs, uint(id))
+		}
+	}
+	return input, nil
+}
+
+// stringValue returns a trimmed string, or "" for anything else
+func stringValue(value interface{}) string {
+	text, _ := value.(string)
+	return strings.TrimSpace(text)
+}
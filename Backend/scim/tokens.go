@@ -0,0 +1,64 @@
+package scim
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/models"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidToken means a request carried no active SCIM token
+var ErrInvalidToken = errors.New("a valid SCIM token is required")
+
+// tokenPrefix marks SCIM tokens so they are recognisable in secret scanners
+const tokenPrefix = "scim_"
+
+// NewToken creates a SCIM token. The token itself is returned only here;
+// just its hash is stored.
+func NewToken(tx *gorm.DB, name string, createdBy uint) (models.SCIMToken, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return models.SCIMToken{}, "", err
+	}
+	raw := tokenPrefix + secret
+
+	token := models.SCIMToken{
+		Name:      strings.TrimSpace(name),
+		TokenHash: accounts.HashToken(raw),
+		CreatedAt: time.Now().Unix(),
+		CreatedBy: createdBy,
+	}
+	return token, raw, tx.Create(&token).Error
+}
+
+// FindToken returns the active token an Authorization header carries and
+// records that it was used
+func FindToken(db *gorm.DB, authorization string) (models.SCIMToken, error) {
+	var token models.SCIMToken
+	scheme, raw, _ := strings.Cut(strings.TrimSpace(authorization), " ")
+	raw = strings.TrimSpace(raw)
+	if !strings.EqualFold(scheme, "Bearer") || raw == "" {
+		return token, ErrInvalidToken
+	}
+	if err := db.Where("token_hash = ? AND revoked_at = 0", accounts.HashToken(raw)).First(&token).Error; err != nil {
+		return token, ErrInvalidToken
+	}
+
+	token.LastUsedAt = time.Now().Unix()
+	db.Model(&token).Update("last_used_at", token.LastUsedAt)
+	return token, nil
+}
+
+// randomToken returns size random bytes, URL-safe encoded
+func randomToken(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,271 @@
+package sso
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/policy"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDC sign-in errors
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrDomainNotServed = errors.New("this identity provider does not serve your email domain")
+)
+
+// OIDCProvider is an OpenID Connect identity provider users can sign in with
+type OIDCProvider struct {
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	// Domains limits sign-in to these email domains and their subdomains.
+	// Every provider needs some, except Google with a HostedDomain.
+	Domains []string `json:"domains"`
+	// HostedDomain makes Google offer only accounts of this Workspace domain
+	// and is checked against the hd claim
+	HostedDomain string `json:"hosted_domain"`
+	// DepartmentClaim names the ID token claim holding the department
+	DepartmentClaim string `json:"department_claim"`
+	// CreateUsers creates an account for a new person on their first sign-in
+	CreateUsers bool `json:"create_users"`
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+var oidcProviders = map[string]*OIDCProvider{}
+
+// googleIssuer is the only issuer that sends the hd claim
+const googleIssuer = "https://accounts.google.com"
+
+// LoadOIDC reads the providers from OIDC_PROVIDERS_FILE and adds Google
+// when GOOGLE_CLIENT_ID is set. Values in the file may refer to environment
+// variables as ${NAME}, to keep secrets out of it.
+func LoadOIDC() error {
+	providers := []*OIDCProvider{}
+
+	if config.OIDCProvidersFile != "" {
+		data, err := os.ReadFile(config.OIDCProvidersFile)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(os.ExpandEnv(string(data))), &providers); err != nil {
+			return fmt.Errorf("%s: %w", config.OIDCProvidersFile, err)
+		}
+	}
+
+	if config.GoogleClientID != "" {
+		providers = append(providers, &OIDCProvider{
+			Name:         "google",
+			DisplayName:  "Google",
+			Issuer:       googleIssuer,
+			ClientID:     config.GoogleClientID,
+			ClientSecret: config.GoogleClientSecret,
+			Domains:      strings.Split(config.GoogleDomains, ","),
+			HostedDomain: config.GoogleHostedDomain,
+			CreateUsers:  config.GoogleCreateUsers,
+		})
+	}
+
+	loaded := map[string]*OIDCProvider{}
+	for _, provider := range providers {
+		provider.Name = strings.ToLower(strings.TrimSpace(provider.Name))
+		if provider.Name == "" || provider.Issuer == "" || provider.ClientID == "" {
+			return errors.New("every OIDC provider needs a name, issuer and client_id")
+		}
+		if loaded[provider.Name] != nil {
+			return fmt.Errorf("OIDC provider %q is configured twice", provider.Name)
+		}
+		domains := []string{}
+		for _, domain := range provider.Domains {
+			if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+				domains = append(domains, domain)
+			}
+		}
+		provider.Domains = domains
+		// Anyone can get an account at most providers, with any address
+		if len(provider.Domains) == 0 && (provider.Issuer != googleIssuer || provider.HostedDomain == "") {
+			return fmt.Errorf("OIDC provider %q needs the email domains it serves in domains, or a hosted_domain for Google", provider.Name)
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = provider.Name
+		}
+		loaded[provider.Name] = provider
+	}
+	oidcProviders = loaded
+	return nil
+}
+
+// OIDCProviders returns the configured providers ordered by name
+func OIDCProviders() []*OIDCProvider {
+	providers := make([]*OIDCProvider, 0, len(oidcProviders))
+	for _, provider := range oidcProviders {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Name < providers[j].Name
+	})
+	return providers
+}
+
+// FindOIDC returns the provider with the given name
+func FindOIDC(name string) (*OIDCProvider, error) {
+	provider, ok := oidcProviders[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// CallbackURL is where the provider sends the user back to
+func (p *OIDCProvider) CallbackURL() string {
+	return strings.TrimSuffix(config.APIBaseURL, "/") + "/api/auth/oidc/" + p.Name + "/callback"
+}
+
+// AuthCodeURL is the provider's login page for one sign-in attempt. The
+// state, nonce and PKCE verifier must be kept for Exchange.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	oauth, err := p.oauth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	options := []oauth2.AuthCodeOption{oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)}
+	if p.HostedDomain != "" {
+		options = append(options, oauth2.SetAuthURLParam("hd", p.HostedDomain))
+	}
+	return oauth.AuthCodeURL(state, options...), nil
+}
+
+// Exchange trades an authorization code for the user's verified identity
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce, verifier string) (accounts.ExternalIdentity, error) {
+	var identity accounts.ExternalIdentity
+
+	oauth, err := p.oauth2Config(ctx)
+	if err != nil {
+		return identity, err
+	}
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return identity, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return identity, errors.New("the identity provider returned no ID token")
+	}
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return identity, err
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return identity, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return identity, errors.New("ID token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return identity, err
+	}
+
+	identity = accounts.ExternalIdentity{
+		Provider:      "oidc:" + p.Name,
+		Subject:       idToken.Subject,
+		Email:         stringClaim(claims, "email"),
+		EmailVerified: boolClaim(claims, "email_verified"),
+		Name:          stringClaim(claims, "name"),
+	}
+	if p.DepartmentClaim != "" {
+		identity.Department = stringClaim(claims, p.DepartmentClaim)
+	}
+
+	if p.HostedDomain != "" && !strings.EqualFold(stringClaim(claims, "hd"), p.HostedDomain) {
+		return identity, ErrDomainNotServed
+	}
+	if !p.servesDomain(policy.EmailDomain(identity.Email)) {
+		return identity, ErrDomainNotServed
+	}
+	return identity, nil
+}
+
+// servesDomain reports whether users of an email domain may sign in here
+func (p *OIDCProvider) servesDomain(domain string) bool {
+	// Google checks the hosted domain itself
+	if len(p.Domains) == 0 {
+		return p.HostedDomain != ""
+	}
+	for _, allowed := range p.Domains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// discover fetches the provider's configuration the first time it is needed,
+// so a provider that is down does not keep the server from starting
+func (p *OIDCProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC discovery for %s failed: %w", p.Name, err)
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+func (p *OIDCProvider) oauth2Config(ctx context.Context) (*oauth2.Config, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.CallbackURL(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+	}, nil
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return strings.TrimSpace(value)
+}
+
+// boolClaim reads a boolean claim, which some providers send as a string
+func boolClaim(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,335 @@
+package sso
+
+import (
+	"JWT-Authentication-go/accounts"
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/policy"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	"gorm.io/gorm"
+)
+
+// SAML sign-in errors
+var (
+	ErrSAMLMetadata     = errors.New("the metadata does not describe a SAML identity provider with a signing certificate and a redirect sign-on URL")
+	ErrSAMLNoConnection = errors.New("single sign-on is not set up for this email domain")
+	ErrSAMLResponse     = errors.New("the identity provider's response could not be verified")
+)
+
+var (
+	samlKey  *rsa.PrivateKey
+	samlCert *x509.Certificate
+)
+
+// LoadSAML reads the key pair this server uses as a SAML service provider
+func LoadSAML() error {
+	if config.SAMLCertFile == "" && config.SAMLKeyFile == "" {
+		fmt.Println("SAML_SP_CERT_FILE is not set, using a temporary SAML key; identity providers that encrypt assertions need the metadata again after every restart")
+		key, cert, err := selfSignedKey(samlEntityID())
+		if err != nil {
+			return err
+		}
+		samlKey, samlCert = key, cert
+		return nil
+	}
+
+	pair, err := tls.LoadX509KeyPair(config.SAMLCertFile, config.SAMLKeyFile)
+	if err != nil {
+		return fmt.Errorf("loading the SAML key pair: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("SAML_SP_KEY_FILE must hold an RSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return err
+	}
+	samlKey, samlCert = key, cert
+	return nil
+}
+
+// selfSignedKey makes a key pair for development
+func selfSignedKey(commonName string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return key, cert, err
+}
+
+// samlEntityID names this server to identity providers; it is also where its
+// metadata is served
+func samlEntityID() string {
+	return strings.TrimSuffix(config.APIBaseURL, "/") + "/api/auth/saml/metadata"
+}
+
+// serviceProvider is this server as seen by one identity provider
+func serviceProvider(idp *saml.EntityDescriptor) *saml.ServiceProvider {
+	metadataURL, _ := url.Parse(samlEntityID())
+	acsURL, _ := url.Parse(strings.TrimSuffix(config.APIBaseURL, "/") + "/api/auth/saml/acs")
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		Key:               samlKey,
+		Certificate:       samlCert,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idp,
+		AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+	}
+}
+
+// SAMLMetadata is the service provider metadata to give identity providers
+func SAMLMetadata() ([]byte, error) {
+	data, err := xml.MarshalIndent(serviceProvider(nil).Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseIDPMetadata reads identity provider metadata. A federation file with
+// several entities gives its first identity provider.
+func ParseIDPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	candidates := []saml.EntityDescriptor{}
+
+	entity := saml.EntityDescriptor{}
+	if err := xml.Unmarshal(data, &entity); err == nil {
+		candidates = append(candidates, entity)
+	} else {
+		entities := saml.EntitiesDescriptor{}
+		if err := xml.Unmarshal(data, &entities); err != nil {
+			return nil, ErrSAMLMetadata
+		}
+		candidates = append(candidates, entities.EntityDescriptors...)
+	}
+
+	for i := range candidates {
+		idp := &candidates[i]
+		if idp.EntityID != "" && len(idp.IDPSSODescriptors) > 0 && hasSigningCert(idp) &&
+			serviceProvider(idp).GetSSOBindingLocation(saml.HTTPRedirectBinding) != "" {
+			return idp, nil
+		}
+	}
+	return nil, ErrSAMLMetadata
+}
+
+// hasSigningCert reports whether the identity provider publishes a
+// certificate its responses can be checked with
+func hasSigningCert(idp *saml.EntityDescriptor) bool {
+	for _, descriptor := range idp.IDPSSODescriptors {
+		for _, key := range descriptor.KeyDescriptors {
+			if key.Use != "encryption" && len(key.KeyInfo.X509Data.X509Certificates) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeSAMLConnection cleans up and validates a connection before it is
+// saved, reading the identity provider's details from its metadata
+func NormalizeSAMLConnection(connection models.SAMLConnection) (models.SAMLConnection, error) {
+	domain, err := policy.NormalizeDomain(connection.Domain)
+	if err != nil {
+		return connection, err
+	}
+	connection.Domain = domain
+
+	idp, err := ParseIDPMetadata([]byte(connection.MetadataXML))
+	if err != nil {
+		return connection, err
+	}
+	connection.EntityID = idp.EntityID
+	connection.SSOURL = serviceProvider(idp).GetSSOBindingLocation(saml.HTTPRedirectBinding)
+
+	connection.EmailAttribute = strings.TrimSpace(connection.EmailAttribute)
+	connection.NameAttribute = strings.TrimSpace(connection.NameAttribute)
+	connection.DepartmentAttribute = strings.TrimSpace(connection.DepartmentAttribute)
+	connection.RoleAttribute = strings.TrimSpace(connection.RoleAttribute)
+	connection.AdminValue = strings.TrimSpace(connection.AdminValue)
+	connection.Description = strings.TrimSpace(connection.Description)
+	if connection.RoleAttribute != "" && connection.AdminValue == "" {
+		return connection, errors.New("admin_value is required with role_attribute")
+	}
+	return connection, nil
+}
+
+// MatchSAMLConnection returns the active connection for an email address's
+// domain, or its closest parent domain, or nil
+func MatchSAMLConnection(db *gorm.DB, email string) (*models.SAMLConnection, error) {
+	candidates := policy.DomainSuffixes(policy.EmailDomain(email))
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var connections []models.SAMLConnection
+	if err := db.Where("domain IN ? AND is_active = ?", candidates, true).Find(&connections).Error; err != nil {
+		return nil, err
+	}
+
+	var best *models.SAMLConnection
+	for i := range connections {
+		if best == nil || len(connections[i].Domain) > len(best.Domain) {
+			best = &connections[i]
+		}
+	}
+	return best, nil
+}
+
+// SAMLProvider names a connection in sign-in state and linked identities
+func SAMLProvider(connection models.SAMLConnection) string {
+	return "saml:" + strconv.FormatUint(uint64(connection.ID), 10)
+}
+
+// FindSAMLConnection returns the active connection a SAMLProvider name
+// refers to
+func FindSAMLConnection(db *gorm.DB, provider string) (*models.SAMLConnection, error) {
+	id, ok := strings.CutPrefix(provider, "saml:")
+	if !ok {
+		return nil, ErrSAMLNoConnection
+	}
+	var connection models.SAMLConnection
+	if err := db.Where("id = ? AND is_active = ?", id, true).First(&connection).Error; err != nil {
+		return nil, ErrSAMLNoConnection
+	}
+	return &connection, nil
+}
+
+// SAMLAuthURL returns the identity provider address that starts a sign-in,
+// and the ID of the request it carries
+func SAMLAuthURL(connection models.SAMLConnection, relayState string) (string, string, error) {
+	idp, err := ParseIDPMetadata([]byte(connection.MetadataXML))
+	if err != nil {
+		return "", "", err
+	}
+	sp := serviceProvider(idp)
+	request, err := sp.MakeAuthenticationRequest(connection.SSOURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	redirect, err := request.Redirect(relayState, sp)
+	if err != nil {
+		return "", "", err
+	}
+	return redirect.String(), request.ID, nil
+}
+
+// SAMLIdentity checks the signed response the identity provider posted, which
+// must answer requestID, and returns who it says the user is
+func SAMLIdentity(connection models.SAMLConnection, encodedResponse, requestID string) (accounts.ExternalIdentity, error) {
+	var identity accounts.ExternalIdentity
+
+	idp, err := ParseIDPMetadata([]byte(connection.MetadataXML))
+	if err != nil {
+		return identity, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encodedResponse)
+	if err != nil {
+		return identity, ErrSAMLResponse
+	}
+	assertion, err := serviceProvider(idp).ParseXMLResponse(raw, []string{requestID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		return identity, fmt.Errorf("%w: %v", ErrSAMLResponse, err)
+	}
+	if assertion.Subject == nil || assertion.Subject.NameID == nil {
+		return identity, fmt.Errorf("%w: the assertion has no subject", ErrSAMLResponse)
+	}
+
+	nameID := assertion.Subject.NameID
+	identity = accounts.ExternalIdentity{
+		Provider:   SAMLProvider(connection),
+		Subject:    nameID.Value,
+		Email:      nameID.Value,
+		Name:       samlAttribute(assertion, connection.NameAttribute),
+		Department: samlAttribute(assertion, connection.DepartmentAttribute),
+		// The connection is only used for its own domain, which the
+		// identity provider is trusted to vouch for
+		EmailVerified:  true,
+		ClaimsAccounts: true,
+	}
+	if connection.EmailAttribute != "" {
+		identity.Email = samlAttribute(assertion, connection.EmailAttribute)
+	}
+	// Transient identifiers change at every sign-in
+	if nameID.Format == string(saml.TransientNameIDFormat) {
+		identity.Subject = strings.ToLower(identity.Email)
+	}
+	if connection.RoleAttribute != "" {
+		identity.Role = "user"
+		for _, value := range samlAttributeValues(assertion, connection.RoleAttribute) {
+			if value == connection.AdminValue {
+				identity.Role = "admin"
+			}
+		}
+	}
+
+	// An identity provider only vouches for the addresses of its own domain
+	domain := policy.EmailDomain(identity.Email)
+	if domain != connection.Domain && !strings.HasSuffix(domain, "."+connection.Domain) {
+		return identity, ErrDomainNotServed
+	}
+	return identity, nil
+}
+
+// samlAttribute returns the first value of an attribute, or ""
+func samlAttribute(assertion *saml.Assertion, name string) string {
+	values := samlAttributeValues(assertion, name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// samlAttributeValues returns the values of the attribute with a name or
+// friendly name
+func samlAttributeValues(assertion *saml.Assertion, name string) []string {
+	values := []string{}
+	if name == "" {
+		return values
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if attribute.Name != name && attribute.FriendlyName != name {
+				continue
+			}
+			for _, value := range attribute.Values {
+				if value := strings.TrimSpace(value.Value); value != "" {
+					values = append(values, value)
+				}
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,167 @@
+package sso
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+)
+
+// SAMLStandIn is a small SAML identity provider for trying single sign-on
+// without a partner's. It signs in whoever the tester says they are, so it
+// must never serve real users.
+type SAMLStandIn struct {
+	IDP *saml.IdentityProvider
+
+	mu               sync.Mutex
+	serviceProviders map[string]*saml.EntityDescriptor
+}
+
+// NewSAMLStandIn returns a stand-in reachable at baseURL. Its metadata is
+// served at /metadata and sign-in requests are taken at /sso.
+func NewSAMLStandIn(baseURL string) (*SAMLStandIn, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	key, cert, err := selfSignedKey(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	metadataURL, err := url.Parse(baseURL + "/metadata")
+	if err != nil {
+		return nil, err
+	}
+	ssoURL, _ := url.Parse(baseURL + "/sso")
+
+	standIn := &SAMLStandIn{serviceProviders: map[string]*saml.EntityDescriptor{}}
+	standIn.IDP = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		Logger:                  logger.DefaultLogger,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: standIn,
+		SessionProvider:         standIn,
+	}
+	return standIn, nil
+}
+
+// Metadata returns the stand-in's metadata, to upload as a connection's
+func (s *SAMLStandIn) Metadata() ([]byte, error) {
+	return xml.MarshalIndent(s.IDP.Metadata(), "", "  ")
+}
+
+// AddServiceProvider trusts a service provider's metadata. Unknown service
+// providers are fetched from their entity ID, which is where this server
+// publishes its metadata.
+func (s *SAMLStandIn) AddServiceProvider(metadata []byte) error {
+	descriptor := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(metadata, descriptor); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serviceProviders[descriptor.EntityID] = descriptor
+	return nil
+}
+
+// GetServiceProvider implements saml.ServiceProviderProvider
+func (s *SAMLStandIn) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	s.mu.Lock()
+	descriptor := s.serviceProviders[serviceProviderID]
+	s.mu.Unlock()
+	if descriptor != nil {
+		return descriptor, nil
+	}
+
+	response, err := http.Get(serviceProviderID)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	defer response.Body.Close()
+	metadata, err := io.ReadAll(response.Body)
+	if err != nil || response.StatusCode != http.StatusOK {
+		return nil, os.ErrNotExist
+	}
+	if err := s.AddServiceProvider(metadata); err != nil {
+		return nil, os.ErrNotExist
+	}
+	return s.GetServiceProvider(r, serviceProviderID)
+}
+
+// standInLoginPage asks who to sign in as
+var standInLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+<h1>SAML stand-in</h1>
+<p>Signs in whoever you enter. For testing only.</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="SAMLRequest" value="{{.Request}}">
+<input type="hidden" name="RelayState" value="{{.RelayState}}">
+<p><label>Email <input name="email" type="email" required></label></p>
+<p><label>Name <input name="name"></label></p>
+<p><label>Department <input name="department"></label></p>
+<p><label>Groups, comma separated <input name="groups"></label></p>
+<p><button type="submit">Sign in</button></p>
+</form>
+</body></html>`))
+
+// GetSession implements saml.SessionProvider. Without an email in the form
+// it shows the login page and returns nil.
+func (s *SAMLStandIn) GetSession(w http.ResponseWriter, r *http.Request, req *saml.IdpAuthnRequest) *saml.Session {
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	if r.Method != http.MethodPost || email == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		standInLoginPage.Execute(w, map[string]string{
+			"Action":     s.IDP.SSOURL.String(),
+			"Request":    base64.StdEncoding.EncodeToString(req.RequestBuffer),
+			"RelayState": req.RelayState,
+		})
+		return nil
+	}
+
+	now := time.Now()
+	session := &saml.Session{
+		ID:             fmt.Sprintf("standin-%d", now.UnixNano()),
+		CreateTime:     now,
+		ExpireTime:     now.Add(time.Hour),
+		Index:          fmt.Sprintf("%d", now.UnixNano()),
+		NameID:         email,
+		NameIDFormat:   string(saml.EmailAddressNameIDFormat),
+		UserEmail:      email,
+		UserCommonName: strings.TrimSpace(r.PostFormValue("name")),
+	}
+	for _, group := range strings.Split(r.PostFormValue("groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			session.Groups = append(session.Groups, group)
+		}
+	}
+	if department := strings.TrimSpace(r.PostFormValue("department")); department != "" {
+		session.CustomAttributes = append(session.CustomAttributes, saml.Attribute{
+			FriendlyName: "department",
+			Name:         "department",
+			NameFormat:   "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+			Values:       []saml.AttributeValue{{Type: "xs:string", Value: department}},
+		})
+	}
+	return session
+}
+
+// ServeHTTP serves the stand-in's metadata and sign-in page
+func (s *SAMLStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/metadata":
+		s.IDP.ServeMetadata(w, r)
+	case "/sso":
+		s.IDP.ServeSSO(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,136 @@
+package sso
+
+import (
+	"JWT-Authentication-go/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// LoginStateTTL is how long a user may take at the identity provider
+const LoginStateTTL = 10 * time.Minute
+
+// loginStatePurpose keeps sign-in state tokens from being used as anything else
+const loginStatePurpose = "sso_login"
+
+// ErrLoginState means the browser came back without a matching sign-in
+var ErrLoginState = errors.New("the sign-in has expired or was started in another browser, please try again")
+
+// LoginState is what the browser carries, signed, between leaving for the
+// identity provider and coming back
+type LoginState struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string
+	// RequestID is the SAML request the response must answer
+	RequestID string
+	// Redirect is the frontend path to return to
+	Redirect string
+	// LinkUserID is the signed-in user linking the provider to their
+	// account, 0 for a sign-in
+	LinkUserID uint
+}
+
+// NewLoginState starts a sign-in with a provider and returns it with its
+// signed form for a cookie
+func NewLoginState(provider, redirect string) (LoginState, string, error) {
+	state := LoginState{
+		Provider: provider,
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: safeRedirect(redirect),
+	}
+	var err error
+	if state.State, err = randomString(); err != nil {
+		return state, "", err
+	}
+	if state.Nonce, err = randomString(); err != nil {
+		return state, "", err
+	}
+	signed, err := state.Sign()
+	return state, signed, err
+}
+
+// Sign returns the state in its signed form for a cookie
+func (state LoginState) Sign() (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"purpose":    loginStatePurpose,
+		"provider":   state.Provider,
+		"state":      state.State,
+		"nonce":      state.Nonce,
+		"verifier":   state.Verifier,
+		"request_id": state.RequestID,
+		"redirect":   state.Redirect,
+		"link_user":  state.LinkUserID,
+		"exp":        time.Now().Add(LoginStateTTL).Unix(),
+	})
+	return token.SignedString([]byte(utils.SecretKey))
+}
+
+// ParseLoginState checks the signed state from the cookie against the
+// provider and state the browser came back with
+func ParseLoginState(signed, provider, returnedState string) (LoginState, error) {
+	state, err := parseLoginState(signed)
+	if err != nil {
+		return state, err
+	}
+	if state.Provider != provider || state.State == "" || state.State != returnedState {
+		return LoginState{}, ErrLoginState
+	}
+	return state, nil
+}
+
+// LoginStateProvider returns the provider a signed state was made for, or ""
+// if it is not valid. SAML responses all arrive at one address and need it
+// to know which connection to check them against.
+func LoginStateProvider(signed string) string {
+	state, err := parseLoginState(signed)
+	if err != nil {
+		return ""
+	}
+	return state.Provider
+}
+
+// parseLoginState checks the signature and expiry of a signed state
+func parseLoginState(signed string) (LoginState, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(signed, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(utils.SecretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || claims["purpose"] != loginStatePurpose {
+		return LoginState{}, ErrLoginState
+	}
+
+	state := LoginState{}
+	state.Provider, _ = claims["provider"].(string)
+	state.State, _ = claims["state"].(string)
+	state.Nonce, _ = claims["nonce"].(string)
+	state.Verifier, _ = claims["verifier"].(string)
+	state.RequestID, _ = claims["request_id"].(string)
+	state.Redirect, _ = claims["redirect"].(string)
+	if linkUser, ok := claims["link_user"].(float64); ok {
+		state.LinkUserID = uint(linkUser)
+	}
+	return state, nil
+}
+
+// safeRedirect keeps the return address inside the frontend
+func safeRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, `\`) {
+		return "/"
+	}
+	return path
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
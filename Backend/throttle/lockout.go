@@ -0,0 +1,107 @@
+package throttle
+
+import (
+	"JWT-Authentication-go/config"
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+)
+
+// LoginState is the failed login record of one email address
+type LoginState struct {
+	Failures    int   `json:"failures"`
+	LastFailure int64 `json:"last_failure"`
+	RetryAt     int64 `json:"retry_at"`     // no attempt is accepted before this time
+	LockedUntil int64 `json:"locked_until"` // set while the account is locked out
+}
+
+// Locked reports whether the lockout is in force
+func (s LoginState) Locked(now time.Time) bool {
+	return s.LockedUntil > now.Unix()
+}
+
+// Wait is how long until the next attempt is accepted, 0 when it is now
+func (s LoginState) Wait(now time.Time) time.Duration {
+	until := s.RetryAt
+	if s.LockedUntil > until {
+		until = s.LockedUntil
+	}
+	if until <= now.Unix() {
+		return 0
+	}
+	return time.Duration(until-now.Unix()) * time.Second
+}
+
+// loginKey is the store key for an email address
+func loginKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginStatus returns the failed login record of an email address. Callers
+// should refuse the login when it fails, since the record is unknown.
+func LoginStatus(email string) (LoginState, error) {
+	var state LoginState
+	raw, err := Store.Get(loginKey(email))
+	if err != nil || raw == nil {
+		return state, err
+	}
+	err = json.Unmarshal(raw, &state)
+	return state, err
+}
+
+// RecordLoginFailure counts a failed login for an email address. After
+// LOGIN_BACKOFF_AFTER failures each further one doubles the wait before the
+// next attempt; at LOGIN_LOCKOUT_THRESHOLD the address is locked for
+// LOGIN_LOCKOUT_MINUTES. It reports whether this failure started a lockout,
+// and an error when the failure could not be counted.
+func RecordLoginFailure(email string) (LoginState, bool, error) {
+	var state LoginState
+	started := false
+
+	// The record is read and written in one step so concurrent failures,
+	// on this instance or another sharing the store, are all counted
+	err := update(loginKey(email), func(raw []byte) ([]byte, time.Duration) {
+		now := time.Now()
+		if raw != nil {
+			json.Unmarshal(raw, &state)
+		}
+		state.Failures++
+		state.LastFailure = now.Unix()
+
+		if config.LoginLockoutThreshold > 0 && state.Failures >= config.LoginLockoutThreshold {
+			if !state.Locked(now) {
+				started = true
+			}
+			state.LockedUntil = now.Add(time.Duration(config.LoginLockoutMinutes) * time.Minute).Unix()
+			// Counting starts over once the lockout ends
+			state.Failures = 0
+		} else if extra := state.Failures - config.LoginBackoffAfter; extra > 0 {
+			delay := math.Min(math.Pow(2, float64(extra-1)), float64(config.LoginLockoutMinutes*60))
+			state.RetryAt = now.Add(time.Duration(delay) * time.Second).Unix()
+		}
+
+		value, _ := json.Marshal(state)
+		return value, loginStateLifetime(state, now)
+	})
+	if err != nil {
+		return LoginState{}, false, err
+	}
+	return state, started, nil
+}
+
+// ResetLogin clears the record of an email address after a successful login
+// or when an admin unlocks it
+func ResetLogin(email string) error {
+	return Store.Delete(loginKey(email))
+}
+
+// loginStateLifetime keeps a record until the later of the lockout end and
+// the failure window
+func loginStateLifetime(state LoginState, now time.Time) time.Duration {
+	keep := time.Duration(config.LoginFailureWindowMinutes) * time.Minute
+	if locked := time.Unix(state.LockedUntil, 0).Sub(now); locked > keep {
+		keep = locked
+	}
+	return keep
+}
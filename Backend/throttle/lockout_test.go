@@ -0,0 +1,135 @@
+package throttle
+
+import (
+	"JWT-Authentication-go/config"
+	"JWT-Authentication-go/models"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// withLoginLimits sets the lockout settings for one test
+func withLoginLimits(t *testing.T, backoffAfter, threshold int) {
+	previousBackoff, previousThreshold := config.LoginBackoffAfter, config.LoginLockoutThreshold
+	config.LoginBackoffAfter, config.LoginLockoutThreshold = backoffAfter, threshold
+	t.Cleanup(func() {
+		config.LoginBackoffAfter, config.LoginLockoutThreshold = previousBackoff, previousThreshold
+	})
+}
+
+// recordConcurrently records failures for one address from many goroutines
+func recordConcurrently(email string, failures int) {
+	var wg sync.WaitGroup
+	for i := 0; i < failures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RecordLoginFailure(email)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRecordLoginFailureCountsEveryFailure(t *testing.T) {
+	withLoginLimits(t, 1000, 1000)
+	Store = NewMemory()
+
+	recordConcurrently("Ada@Example.com", 50)
+	if state, err := LoginStatus("ada@example.com"); err != nil || state.Failures != 50 {
+		t.Errorf("failures = %d, %v; want 50", state.Failures, err)
+	}
+}
+
+func TestDatabaseStoreSharesFailures(t *testing.T) {
+	withLoginLimits(t, 1000, 1000)
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.ThrottleEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		sqlDB.Close()
+		Store = NewMemory()
+	})
+
+	// Two instances, each with its own store over the same database
+	first, second := NewDatabase(db), NewDatabase(db)
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		store := first
+		if i%2 == 1 {
+			store = second
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Update("counter", func(raw []byte) ([]byte, time.Duration) {
+				return append(raw, '+'), time.Minute
+			})
+		}()
+	}
+	wg.Wait()
+	if raw, _ := second.Get("counter"); len(raw) != 40 {
+		t.Errorf("counter = %d, want 40", len(raw))
+	}
+
+	Store = first
+	recordConcurrently("ada@example.com", 40)
+	Store = second
+	if state, err := LoginStatus("ada@example.com"); err != nil || state.Failures != 40 {
+		t.Errorf("failures = %d, %v; want 40", state.Failures, err)
+	}
+}
+
+// failingLogins is a store whose failed login records cannot be read or
+// written
+type failingLogins struct{ *Memory }
+
+var errStoreDown = errors.New("store unavailable")
+
+func (f failingLogins) Get(key string) ([]byte, error) {
+	if strings.HasPrefix(key, "login:") {
+		return nil, errStoreDown
+	}
+	return f.Memory.Get(key)
+}
+
+func (f failingLogins) Set(key string, value []byte, exp time.Duration) error {
+	if strings.HasPrefix(key, "login:") {
+		return errStoreDown
+	}
+	return f.Memory.Set(key, value, exp)
+}
+
+func (f failingLogins) Update(key string, fn func(value []byte) ([]byte, time.Duration)) error {
+	if strings.HasPrefix(key, "login:") {
+		return errStoreDown
+	}
+	return f.Memory.Update(key, fn)
+}
+
+func TestLoginTrackingReportsStoreErrors(t *testing.T) {
+	withLoginLimits(t, 1000, 1)
+	Store = failingLogins{NewMemory()}
+	t.Cleanup(func() { Store = NewMemory() })
+
+	if _, locked, err := RecordLoginFailure("ada@example.com"); !errors.Is(err, errStoreDown) || locked {
+		t.Errorf("RecordLoginFailure = locked %v, %v; want the store error", locked, err)
+	}
+	if _, err := LoginStatus("ada@example.com"); !errors.Is(err, errStoreDown) {
+		t.Errorf("LoginStatus err = %v, want the store error", err)
+	}
+}
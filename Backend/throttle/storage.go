@@ -0,0 +1,221 @@
+package throttle
+
+import (
+	"JWT-Authentication-go/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Memory is an in-process fiber.Storage. Each server instance keeps its own
+// counts, which is enough for a single instance.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time // zero never expires
+}
+
+// NewMemory returns an empty in-process store
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]memoryEntry{}}
+}
+
+// Get returns the value for key, or nil when it is missing or expired
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, nil
+	}
+	return entry.value, nil
+}
+
+// Set stores a value for exp, or for good when exp is 0
+func (m *Memory) Set(key string, value []byte, exp time.Duration) error {
+	if key == "" || len(value) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if exp > 0 {
+		entry.expiresAt = time.Now().Add(exp)
+	}
+	m.entries[key] = entry
+
+	// Drop expired entries now and then so the map does not grow forever
+	if len(m.entries)%1000 == 0 {
+		now := time.Now()
+		for k, e := range m.entries {
+			if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	return nil
+}
+
+// Update replaces the value of key under the store's lock
+func (m *Memory) Update(key string, fn func(value []byte) ([]byte, time.Duration)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var current []byte
+	if entry, ok := m.entries[key]; ok && (entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt)) {
+		current = entry.value
+	}
+
+	value, exp := fn(current)
+	if len(value) == 0 {
+		return nil
+	}
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if exp > 0 {
+		entry.expiresAt = time.Now().Add(exp)
+	}
+	m.entries[key] = entry
+	return nil
+}
+
+// Delete removes a key
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Reset removes every key
+func (m *Memory) Reset() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = map[string]memoryEntry{}
+	return nil
+}
+
+// Close does nothing for the in-process store
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Database is a fiber.Storage kept in the application database, so every
+// server instance sharing the database shares the counts
+type Database struct {
+	db   *gorm.DB
+	mu   sync.Mutex
+	sets int
+}
+
+// NewDatabase returns a store backed by the throttle_entries table
+func NewDatabase(db *gorm.DB) *Database {
+	return &Database{db: db}
+}
+
+// Get returns the value for key, or nil when it is missing or expired
+func (d *Database) Get(key string) ([]byte, error) {
+	var entry models.ThrottleEntry
+	err := d.db.Where(&models.ThrottleEntry{Key: key}).
+		Where("expires_at = 0 OR expires_at > ?", time.Now().Unix()).
+		Limit(1).Find(&entry).Error
+	if err != nil || entry.Key == "" {
+		return nil, err
+	}
+	return entry.Value, nil
+}
+
+// Set stores a value for exp, or for good when exp is 0
+func (d *Database) Set(key string, value []byte, exp time.Duration) error {
+	if key == "" || len(value) == 0 {
+		return nil
+	}
+
+	// Clear out expired entries every so often
+	d.mu.Lock()
+	d.sets++
+	purge := d.sets%500 == 0
+	d.mu.Unlock()
+	if purge {
+		d.Purge()
+	}
+
+	entry := models.ThrottleEntry{Key: key, Value: value}
+	if exp > 0 {
+		// Round up so short windows do not expire early
+		entry.ExpiresAt = time.Now().Add(exp + time.Second - 1).Unix()
+	}
+	return d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at"}),
+	}).Create(&entry).Error
+}
+
+// Update replaces the value of key in a transaction that holds its row
+// lock, so instances sharing the database take turns
+func (d *Database) Update(key string, fn func(value []byte) ([]byte, time.Duration)) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure there is a row to lock; an expired one reads as missing
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ThrottleEntry{Key: key, ExpiresAt: 1}).Error
+		if err != nil {
+			return err
+		}
+
+		var entry models.ThrottleEntry
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(&models.ThrottleEntry{Key: key}).First(&entry).Error
+		if err != nil {
+			return err
+		}
+		current := entry.Value
+		if entry.ExpiresAt > 0 && entry.ExpiresAt <= time.Now().Unix() {
+			current = nil
+		}
+
+		value, exp := fn(current)
+		if len(value) == 0 {
+			return nil
+		}
+		entry.Value = value
+		entry.ExpiresAt = 0
+		if exp > 0 {
+			// Round up so short windows do not expire early
+			entry.ExpiresAt = time.Now().Add(exp + time.Second - 1).Unix()
+		}
+		return tx.Save(&entry).Error
+	})
+}
+
+// Delete removes a key
+func (d *Database) Delete(key string) error {
+	return d.db.Where(&models.ThrottleEntry{Key: key}).Delete(&models.ThrottleEntry{}).Error
+}
+
+// Reset removes every key
+func (d *Database) Reset() error {
+	return d.db.Where("1 = 1").Delete(&models.ThrottleEntry{}).Error
+}
+
+// Close does nothing; the database connection belongs to the application
+func (d *Database) Close() error {
+	return nil
+}
+
+// Purge removes expired entries
+func (d *Database) Purge() error {
+	return d.db.Where("expires_at > 0 AND expires_at <= ?", time.Now().Unix()).
+		Delete(&models.ThrottleEntry{}).Error
+}
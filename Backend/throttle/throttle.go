@@ -0,0 +1,93 @@
+package throttle
+
+import (
+	"JWT-Authentication-go/config"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"gorm.io/gorm"
+)
+
+// Store holds rate limit counters and failed login records. It is in-process
+// until main replaces it with the configured one.
+var Store fiber.Storage = NewMemory()
+
+// FromConfig builds the store selected by THROTTLE_STORE: memory, or
+// database to share counts between instances using the same database
+func FromConfig(db *gorm.DB) (fiber.Storage, error) {
+	switch strings.ToLower(config.ThrottleStore) {
+	case "", "memory":
+		return NewMemory(), nil
+	case "database":
+		return NewDatabase(db), nil
+	default:
+		return nil, fmt.Errorf("unknown throttle store %q, use memory or database", config.ThrottleStore)
+	}
+}
+
+// Updater is a store that can replace a value based on the current one
+// without another writer slipping in between. fn gets nil for a missing or
+// expired key and returns the new value and how long to keep it.
+type Updater interface {
+	Update(key string, fn func(value []byte) ([]byte, time.Duration)) error
+}
+
+// updateMu serialises updates of stores that are not Updaters
+var updateMu sync.Mutex
+
+// update changes a value of Store in one step: atomically when the store
+// supports it, within this instance otherwise
+func update(key string, fn func(value []byte) ([]byte, time.Duration)) error {
+	if updater, ok := Store.(Updater); ok {
+		return updater.Update(key, fn)
+	}
+
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	current, err := Store.Get(key)
+	if err != nil {
+		return err
+	}
+	value, exp := fn(current)
+	return Store.Set(key, value, exp)
+}
+
+// PerIP limits how often one client address may call a route group. name
+// keeps the counters of different groups apart; max 0 disables the limit.
+func PerIP(name string, max int, window time.Duration) fiber.Handler {
+	if max <= 0 {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "ip:" + name + ":" + c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many requests, please try again later",
+			})
+		},
+		Storage: storeProxy{},
+	})
+}
+
+// storeProxy lets limiters built at startup use whatever Store is current
+type storeProxy struct{}
+
+func (storeProxy) Get(key string) ([]byte, error) { return Store.Get(key) }
+func (storeProxy) Set(key string, value []byte, exp time.Duration) error {
+	return Store.Set(key, value, exp)
+}
+func (storeProxy) Delete(key string) error { return Store.Delete(key) }
+func (storeProxy) Reset() error            { return Store.Reset() }
+func (storeProxy) Close() error            { return nil }
@@ -56,16 +56,13 @@ func IsAdmin(c *fiber.Ctx) bool {
 		return false
 	}
 
-	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(SecretKey), nil
-	})
+	claims, err := ParseToken(cookie)
 
 	if err != nil {
 		fmt.Println("JWT parsing error:", err)
 		return false
 	}
 
-	claims := token.Claims.(*jwt.MapClaims)
 	fmt.Printf("JWT claims: %+v\n", *claims)
 
 	userID := GetUintFromClaims(claims, "sub")
@@ -97,14 +94,11 @@ func min(a, b int) int {
 // GetUserIdFromToken gets the user ID from JWT token
 func GetUserIdFromToken(c *fiber.Ctx) uint {
 	cookie := c.Cookies("jwt")
-	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(SecretKey), nil
-	})
+	claims, err := ParseToken(cookie)
 
 	if err != nil {
 		return 0
 	}
 
-	claims := token.Claims.(*jwt.MapClaims)
 	return GetUintFromClaims(claims, "sub")
 }
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// SortField describes a column a list endpoint can be ordered by
+type SortField struct {
+	Column  string
+	Numeric bool
+}
+
+// Page holds the ordering and cursor parsed from a list request
+type Page struct {
+	Field  SortField
+	Desc   bool
+	Limit  int
+	Offset int
+	Cursor *Cursor
+}
+
+// Cursor marks the last row of the previous page for keyset pagination
+type Cursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// ParsePage reads sort, order, limit and either cursor or offset query
+// parameters. sorts maps the accepted sort names to columns; defaultSort
+// must be one of them.
+func ParsePage(c *fiber.Ctx, sorts map[string]SortField, defaultSort string, defaultDesc bool, defaultLimit, maxLimit int) (*Page, error) {
+	sortName := c.Query("sort", defaultSort)
+	field, ok := sorts[sortName]
+	if !ok {
+		names := make([]string, 0, len(sorts))
+		for name := range sorts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("invalid sort %q, expected one of: %s", sortName, strings.Join(names, ", "))
+	}
+
+	page := &Page{Field: field, Desc: defaultDesc, Limit: defaultLimit}
+
+	switch strings.ToLower(c.Query("order")) {
+	case "":
+	case "asc":
+		page.Desc = false
+	case "desc":
+		page.Desc = true
+	default:
+		return nil, errors.New("order must be asc or desc")
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+		page.Limit = limit
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := DecodeCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		page.Cursor = &cursor
+	}
+
+	if raw := c.Query("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return nil, errors.New("offset must be a non-negative number")
+		}
+		if page.Cursor != nil {
+			return nil, errors.New("use either cursor or offset, not both")
+		}
+		page.Offset = offset
+	}
+
+	return page, nil
+}
+
+// Apply orders the query and positions it after the cursor. One extra row
+// is fetched so callers can tell whether another page exists.
+func (p *Page) Apply(query *gorm.DB) *gorm.DB {
+	direction, operator := "ASC", ">"
+	if p.Desc {
+		direction, operator = "DESC", "<"
+	}
+
+	if p.Cursor != nil {
+		var value interface{} = p.Cursor.Value
+		if p.Field.Numeric {
+			number, _ := strconv.ParseInt(p.Cursor.Value, 10, 64)
+			value = number
+		}
+
+		column := p.Field.Column
+		if column == "id" {
+			query = query.Where(fmt.Sprintf("id %s ?", operator), p.Cursor.ID)
+		} else {
+			query = query.Where(
+				fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, operator, column, operator),
+				value, value, p.Cursor.ID,
+			)
+		}
+	}
+
+	order := fmt.Sprintf("%s %s", p.Field.Column, direction)
+	if p.Field.Column != "id" {
+		order += fmt.Sprintf(", id %s", direction)
+	}
+
+	query = query.Order(order).Limit(p.Limit + 1)
+	if p.Offset > 0 {
+		query = query.Offset(p.Offset)
+	}
+	return query
+}
+
+// SetListHeaders reports the total number of matching rows and the cursor of
+// the next page on list endpoints that return a bare array
+func SetListHeaders(c *fiber.Ctx, total int64, nextCursor string) {
+	c.Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if nextCursor != "" {
+		c.Set("X-Next-Cursor", nextCursor)
+	}
+}
+
+// LikePattern turns free text into a LIKE pattern matching it anywhere.
+// Wildcards in the text are escaped with '!', so use it with ESCAPE '!'.
+func LikePattern(text string) string {
+	replacer := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return "%" + strings.ToLower(replacer.Replace(strings.TrimSpace(text))) + "%"
+}
+
+// EncodeCursor builds the opaque cursor for a row
+func EncodeCursor(value interface{}, id uint) string {
+	raw, _ := json.Marshal(Cursor{Value: fmt.Sprint(value), ID: id})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor
+func DecodeCursor(raw string) (Cursor, error) {
+	var cursor Cursor
+
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return cursor, errors.New("invalid cursor")
+	}
+	return cursor, nil
+}
+
+// ParseTimeParam accepts unix seconds, RFC 3339 or a YYYY-MM-DD date
+func ParseTimeParam(raw string) (int64, error) {
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return seconds, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+		return parsed.Unix(), nil
+	}
+	if parsed, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		return parsed.Unix(), nil
+	}
+	return 0, fmt.Errorf("invalid time %q, use unix seconds, RFC 3339 or YYYY-MM-DD", raw)
+}
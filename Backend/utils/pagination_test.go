@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// pageRow is a table with a non-unique text and numeric column to sort on
+type pageRow struct {
+	ID    uint `gorm:"primaryKey"`
+	Name  string
+	Score int64
+}
+
+var pageSorts = map[string]SortField{
+	"id":    {Column: "id", Numeric: true},
+	"name":  {Column: "name"},
+	"score": {Column: "score", Numeric: true},
+}
+
+// parsePage runs ParsePage on a request with the query string
+func parsePage(t *testing.T, query string) (*Page, error) {
+	t.Helper()
+
+	var page *Page
+	var err error
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		page, err = ParsePage(c, pageSorts, "id", false, 2, 3)
+		return nil
+	})
+	if _, testErr := app.Test(httptest.NewRequest("GET", "/?"+query, nil), -1); testErr != nil {
+		t.Fatal(testErr)
+	}
+	return page, err
+}
+
+func newPageDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", url.PathEscape(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&pageRow{}); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// Names and scores repeat so pages must break ties on the ID
+	rows := []pageRow{
+		{Name: "b", Score: 20}, {Name: "a", Score: 10}, {Name: "b", Score: 10},
+		{Name: "a", Score: 20}, {Name: "c", Score: 10}, {Name: "b", Score: 20},
+		{Name: "a", Score: 10},
+	}
+	db.Create(&rows)
+	return db
+}
+
+// walk follows next cursors from the first page to the last and returns the
+// IDs in the order they were served
+func walk(t *testing.T, db *gorm.DB, query string) []uint {
+	t.Helper()
+
+	var ids []uint
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page, err := parsePage(t, query+"&cursor="+cursor)
+		if err != nil {
+			t.Fatalf("ParsePage(%s): %v", query, err)
+		}
+		var rows []pageRow
+		page.Apply(db.Model(&pageRow{})).Find(&rows)
+
+		more := len(rows) > page.Limit
+		if more {
+			rows = rows[:page.Limit]
+		}
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+		if !more {
+			return ids
+		}
+
+		last := rows[len(rows)-1]
+		var value interface{} = last.ID
+		switch page.Field.Column {
+		case "name":
+			value = last.Name
+		case "score":
+			value = last.Score
+		}
+		cursor = EncodeCursor(value, last.ID)
+	}
+	t.Fatalf("walking %s did not end", query)
+	return nil
+}
+
+func TestPageApplyWalksTies(t *testing.T) {
+	db := newPageDB(t)
+
+	tests := []struct {
+		query string
+		want  []uint
+	}{
+		{"sort=id", []uint{1, 2, 3, 4, 5, 6, 7}},
+		{"sort=id&order=desc", []uint{7, 6, 5, 4, 3, 2, 1}},
+		{"sort=name", []uint{2, 4, 7, 1, 3, 6, 5}},
+		{"sort=name&order=desc", []uint{5, 6, 3, 1, 7, 4, 2}},
+		{"sort=score", []uint{2, 3, 5, 7, 1, 4, 6}},
+		{"sort=score&order=desc", []uint{6, 4, 1, 7, 5, 3, 2}},
+	}
+	for _, test := range tests {
+		// A limit of 2 splits every group of ties across pages
+		if got := walk(t, db, test.query+"&limit=2"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("walking %s = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestPageApplyOffset(t *testing.T) {
+	db := newPageDB(t)
+
+	page, err := parsePage(t, "sort=score&order=desc&offset=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []pageRow
+	page.Apply(db.Model(&pageRow{})).Find(&rows)
+
+	// The extra row is fetched past the page
+	var ids []uint
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	if want := []uint{1, 7, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("offset page = %v, want %v", ids, want)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	cursor := EncodeCursor("b", 3)
+
+	tests := []struct {
+		query     string
+		wantLimit int
+		wantDesc  bool
+		wantErr   string // empty when the query must be accepted
+	}{
+		{"", 2, false, ""},
+		{"limit=1", 1, false, ""},
+		{"limit=100", 3, false, ""}, // clamped to the maximum
+		{"order=DESC", 2, true, ""},
+		{"sort=name&cursor=" + cursor, 2, false, ""},
+		{"offset=0", 2, false, ""},
+
+		{"limit=0", 0, false, "limit"},
+		{"limit=-5", 0, false, "limit"},
+		{"limit=ten", 0, false, "limit"},
+		{"order=sideways", 0, false, "order"},
+		{"sort=password", 0, false, "invalid sort"},
+		{"offset=-1", 0, false, "offset"},
+		{"cursor=not-a-cursor!", 0, false, "cursor"},
+		{"cursor=" + cursor + "&offset=10", 0, false, "either cursor or offset"},
+	}
+	for _, test := range tests {
+		page, err := parsePage(t, test.query)
+		switch {
+		case test.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("ParsePage(%q) err = %v, want one about %q", test.query, err, test.wantErr)
+			}
+		case err != nil:
+			t.Errorf("ParsePage(%q): %v", test.query, err)
+		case page.Limit != test.wantLimit || page.Desc != test.wantDesc:
+			t.Errorf("ParsePage(%q) = limit %d desc %v, want limit %d desc %v",
+				test.query, page.Limit, page.Desc, test.wantLimit, test.wantDesc)
+		}
+	}
+
+	page, _ := parsePage(t, "sort=name&cursor="+cursor)
+	if page.Cursor == nil || page.Cursor.Value != "b" || page.Cursor.ID != 3 {
+		t.Errorf("cursor = %+v, want b #3", page.Cursor)
+	}
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"JWT-Authentication-go/database"
+	"JWT-Authentication-go/models"
+	"JWT-Authentication-go/privacy"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SessionLifetime is how long a login stays valid
+const SessionLifetime = 24 * time.Hour
+
+// ErrSessionRevoked is returned for a token whose session was logged out,
+// revoked or removed
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// ErrNotSessionToken is returned for tokens signed for another purpose, such
+// as email verification links
+var ErrNotSessionToken = errors.New("token is not a session token")
+
+// ParseToken verifies a JWT and, for tokens tied to a session, that the
+// session is still active. Tokens issued before sessions were tracked carry
+// no jti and are only checked for signature and expiry.
+func ParseToken(cookie string) (*jwt.MapClaims, error) {
+	token, err := jwt.ParseWithClaims(cookie, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(SecretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*jwt.MapClaims)
+	if _, ok := (*claims)["purpose"]; ok {
+		return nil, ErrNotSessionToken
+	}
+	if tokenID, ok := (*claims)["jti"].(string); ok {
+		var session models.Session
+		if err := database.DB.Where("token_id = ?", tokenID).First(&session).Error; err != nil || session.RevokedAt != 0 {
+			return nil, ErrSessionRevoked
+		}
+	}
+	return claims, nil
+}
+
+// NewSession records a login for the user and returns the signed token for it
+func NewSession(c *fiber.Ctx, user models.User) (string, models.Session, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", models.Session{}, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:    user.ID,
+		TokenID:   hex.EncodeToString(raw),
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(SessionLifetime).Unix(),
+		IPAddress: privacy.StoredIP(c.IP()),
+		UserAgent: c.Get("User-Agent"),
+	}
+
+	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": strconv.Itoa(int(user.ID)),
+		"jti": session.TokenID,
+		"exp": session.ExpiresAt,
+	})
+	token, err := claims.SignedString([]byte(SecretKey))
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	if err := database.DB.Create(&session).Error; err != nil {
+		return "", models.Session{}, err
+	}
+	return token, session, nil
+}
+
+// RevokeSession ends the session a token belongs to, if it has one
+func RevokeSession(cookie string) {
+	token, _, err := jwt.NewParser().ParseUnverified(cookie, &jwt.MapClaims{})
+	if err != nil {
+		return
+	}
+	if tokenID, ok := (*token.Claims.(*jwt.MapClaims))["jti"].(string); ok {
+		database.DB.Model(&models.Session{}).
+			Where("token_id = ? AND revoked_at = 0", tokenID).
+			Update("revoked_at", time.Now().Unix())
+	}
+}
+
+// RevokeUserSessions ends every active session of a user
+func RevokeUserSessions(userID uint) {
+	database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at = 0", userID).
+		Update("revoked_at", time.Now().Unix())
+}